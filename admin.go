@@ -0,0 +1,158 @@
+package gomemssn
+
+// For back-office tools which need to look at or log out specific sessions
+// without an HTTP request/response pair.  Sessions returned here have no
+// cookie; they can be changed and written back with WriteSession(nil, s).
+
+// GetSessionByKey reads the session key from the backing store (bypassing
+// the local cache), ErrNotFound if there is no such session
+func (m *Manager) GetSessionByKey(key string) (*Session, error) {
+	l, err := m.fetch(key)
+	if err != nil {
+		return nil, err
+	}
+	s := m.loadedSession(key, l)
+	s.snap = s.Snapshot()
+	return s, nil
+}
+
+// GetSessionsByKey is GetSessionByKey for several keys, read in as few round
+// trips as the backing store allows; keys without a session are not in the
+// result
+func (m *Manager) GetSessionsByKey(keys []string) (map[string]*Session, error) {
+	return m.getSessions(keys, false)
+}
+
+// LoadSessions is GetSessionsByKey for batch jobs going over many sessions
+// (setting a notification flag in all of a list, say): sessions past
+// AbsoluteExpiration are left out too, and so are ones which can't be
+// decoded, which are reported to OnDecodeError (with a nil request) or the
+// log instead of failing the batch
+func (m *Manager) LoadSessions(keys []string) (map[string]*Session, error) {
+	return m.getSessions(keys, true)
+}
+
+// getSessions reads the sessions keys in batches, leaving out the ones
+// LoadSessions does if lenient
+func (m *Manager) getSessions(keys []string, lenient bool) (map[string]*Session, error) {
+
+	ret := make(map[string]*Session, len(keys))
+
+	for len(keys) > 0 {
+
+		batch := keys
+		if len(batch) > prefetchBatch {
+			batch = batch[:prefetchBatch]
+		}
+		keys = keys[len(batch):]
+
+		found, err := m.getMulti(batch)
+		if err != nil {
+			return nil, err
+		}
+		for key, l := range found {
+			l.rec, err = m.decodeRecord(l.data)
+			if err != nil && lenient {
+				de := &DecodeError{SessionID: SessionID(key), Err: err}
+				if m.OnDecodeError != nil {
+					m.OnDecodeError(nil, de)
+				} else {
+					m.logger().Warn("skipping session which can't be decoded", "session_id", de.SessionID, "err", de.Err)
+				}
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			s := m.loadedSession(key, l)
+			if lenient && m.tooOld(s) {
+				continue
+			}
+			s.snap = s.Snapshot()
+			ret[key] = s
+		}
+
+	}
+
+	return ret, nil
+
+}
+
+// SessionFromToken returns the session of token, a session cookie value as
+// the client has it (or the TokenHeader value), for code which gets it some
+// other way than in an HTTP request: a WebSocket message, gRPC metadata, a
+// job queued by a handler.  ErrNotFound is returned if the token isn't
+// genuine or its session is gone, revoked or past AbsoluteExpiration.  The
+// session can be written back with WriteSession(nil, s).
+func (m *Manager) SessionFromToken(token string) (*Session, error) {
+
+	key, payload, ok := m.parseCookie(token)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	payload, l, err := m.loadFirst(key, payload)
+
+	var s *Session
+	if payload != nil {
+		// kept in the cookie, see CookieFallback
+		rec, err := m.decodeRecord(payload)
+		if err != nil {
+			return nil, err
+		}
+		s = m.newSession(key)
+		s.Values, s.Meta, s.raw, s.cas, s.loaded = rec.Values, rec.Meta, rec.raw, casWritten, payload
+		s.inCookie, s.source = true, SourceCookie
+		m.expireValues(s)
+	} else {
+		if l == nil && err == nil {
+			l, err = m.load(key)
+		}
+		if err == errRevoked {
+			return nil, ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		s = m.loadedSession(key, l)
+	}
+
+	if m.tooOld(s) {
+		return nil, ErrNotFound
+	}
+	s.lastSeen = s.Meta.LastSeenAt
+	s.snap = s.Snapshot()
+	return s, nil
+
+}
+
+// WriteSessionByKey applies f to the values of the session key and writes
+// them back, as Session.Update does, for code without a request; returns
+// ErrNotFound if there is no such session
+func (m *Manager) WriteSessionByKey(key string, f func(Values) error) error {
+	s, err := m.GetSessionByKey(key)
+	if err != nil {
+		return err
+	}
+	return s.Update(f)
+}
+
+// DeleteSessionByKey removes the session key (and its heavy values) from the
+// backing store, forcing whoever has it to start over; it is not an error if
+// there is no such session
+func (m *Manager) DeleteSessionByKey(key string) error {
+	if m.ReadOnly() || m.Degraded() {
+		return ErrReadOnly
+	}
+	if err := m.delSession(key); err != nil {
+		return err
+	}
+	m.audit(nil, AuditDestroy, &Session{Key: key}, "by key")
+	return nil
+}
+
+// loadedSession returns a session for key with what was read in l
+func (m *Manager) loadedSession(key string, l *loaded) *Session {
+	s := m.newSession(key)
+	s.Values, s.Meta, s.raw, s.cas, s.loaded = l.rec.Values, l.rec.Meta, l.rec.raw, l.cas, l.data
+	s.source = SourceHit
+	m.expireValues(s)
+	return s
+}
@@ -0,0 +1,118 @@
+package gomemssn
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSessionsByKey(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	var keys []string
+	for i := 0; i < 3; i++ {
+		s := loadTestSession(t, m, "")
+		s.Values["i"] = i
+		m.MustWriteSession(nil, s)
+		keys = append(keys, s.Key)
+	}
+
+	s, err := m.GetSessionByKey(keys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Values["i"] != 1 {
+		t.Fatalf("unexpected values: %v", s.Values)
+	}
+	s.Values["admin"] = true
+	m.MustWriteSession(nil, s)
+
+	found, err := m.GetSessionsByKey(append(keys, "notthere"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 || found[keys[2]].Values["i"] != 2 || found[keys[1]].Values["admin"] != true {
+		t.Fatalf("unexpected sessions: %v", found)
+	}
+
+	if err := m.DeleteSessionByKey(keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetSessionByKey(keys[0]); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+	if s := loadTestSession(t, m, keys[0]); s.Values["i"] != nil {
+		t.Fatalf("deleted session still loads: %v", s.Values)
+	}
+
+}
+
+func TestLoadSessions(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now = clock.Now
+	m.Expiration = 24 * time.Hour
+	m.AbsoluteExpiration = 2 * time.Hour
+	var keys []string
+	for i := 0; i < 3; i++ {
+		s := loadTestSession(t, m, "")
+		s.Values["i"] = i
+		m.MustWriteSession(nil, s)
+		keys = append(keys, s.Key)
+		clock.Advance(time.Hour)
+	}
+	if err := m.stub.Set(m.storeKey(keys[2]), []byte("garbage"), 0); err != nil {
+		t.Fatal(err)
+	}
+	var decodeErrs int
+	m.OnDecodeError = func(r *http.Request, err *DecodeError) { decodeErrs++ }
+
+	if _, err := m.GetSessionsByKey(keys); err == nil {
+		t.Fatal("expected GetSessionsByKey to fail on the corrupt session")
+	}
+	found, err := m.LoadSessions(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first is past AbsoluteExpiration, the last corrupt
+	if len(found) != 1 || found[keys[1]] == nil || decodeErrs != 1 {
+		t.Fatalf("expected only the second session, got %v (%d decode errors)", found, decodeErrs)
+	}
+
+}
+
+func TestSessionFromToken(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.SigningKey = []byte("0123456789abcdef0123456789abcdef")
+	s := loadTestSession(t, m, "")
+	s.Values["uid"] = "joe"
+	m.MustWriteSession(nil, s)
+
+	// e.g. sent along with a WebSocket upgrade
+	ws, err := m.SessionFromToken(s.Cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.Key != s.Key || ws.Values["uid"] != "joe" {
+		t.Fatalf("unexpected session %q %v", ws.Key, ws.Values)
+	}
+	if _, err := m.SessionFromToken(s.Key); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound for an unsigned token, got %v", err)
+	}
+
+	ws.Values["seen"] = true
+	m.MustWriteSession(nil, ws)
+	if err := m.WriteSessionByKey(s.Key, func(v Values) error { v["n"] = 1; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.GetSessionByKey(s.Key)
+	if err != nil || got.Values["seen"] != true || got.Values["n"] != 1 {
+		t.Fatalf("expected both writes, got %v (%v)", got, err)
+	}
+	if err := m.WriteSessionByKey("notthere", func(Values) error { return nil }); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+
+}
@@ -0,0 +1,229 @@
+package gomemssn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// audit event types
+const (
+	AuditCreate     = "create"     // a new session was started
+	AuditDestroy    = "destroy"    // a session was deleted (logout)
+	AuditRegenerate = "regenerate" // a session got a new key
+	AuditAnomaly    = "anomaly"    // something about the request doesn't match the session
+	AuditTamper     = "tamper"     // a cookie failed verification
+)
+
+// AuditSchemaVersion is the version of the AuditEvent JSON format, fields
+// may be added without changing it but existing ones are never renamed,
+// removed or changed in meaning
+const AuditSchemaVersion = 1
+
+// AuditEvent describes something security relevant that happened to a
+// session.  Its JSON form is the stable schema used by WebhookSink and
+// WriterSink:
+//
+//	{"v":1,"type":"create","time":"2006-01-02T15:04:05.999999999Z07:00",
+//	 "session_id":"...","remote_addr":"...","user_agent":"...","path":"...","detail":"..."}
+//
+// everything except v, type and time is omitted when empty.
+type AuditEvent struct {
+	Version    int       `json:"v"`                     // AuditSchemaVersion
+	Type       string    `json:"type"`                  // one of the Audit* constants
+	Time       time.Time `json:"time"`                  // when it happened
+	SessionID  string    `json:"session_id,omitempty"`  // SessionID of the session, never the key itself
+	RemoteAddr string    `json:"remote_addr,omitempty"` // client IP of the request, see Manager.ClientIP
+	UserAgent  string    `json:"user_agent,omitempty"`  // of the request
+	Path       string    `json:"path,omitempty"`        // of the request
+	Detail     string    `json:"detail,omitempty"`      // free form explanation
+}
+
+// AuditSink receives audit events, Audit is called synchronously from the
+// request so it should not block
+type AuditSink interface {
+	Audit(e AuditEvent)
+}
+
+// SessionID returns an identifier for a session key which can be logged
+// without making it possible to hijack the session
+func SessionID(key string) string {
+	if key == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(key))
+	return base64.RawURLEncoding.EncodeToString(h[:12])
+}
+
+// audit sends an event to the AuditSink, if there is one; r and s may be nil
+func (m *Manager) audit(r *http.Request, typ string, s *Session, detail string) {
+	if m.AuditSink == nil {
+		return
+	}
+	e := AuditEvent{Version: AuditSchemaVersion, Type: typ, Time: m.now().UTC(), Detail: detail}
+	if s != nil {
+		e.SessionID = SessionID(s.Key)
+	}
+	if r != nil {
+		e.RemoteAddr = m.ClientIP(r)
+		e.UserAgent = r.UserAgent()
+		e.Path = r.URL.Path
+	}
+	m.AuditSink.Audit(e)
+}
+
+// WriterSink is an AuditSink which writes each event as a line of JSON
+// (NDJSON) to W, e.g. os.Stdout or a log file
+type WriterSink struct {
+	W       io.Writer
+	OnError func(AuditEvent, error) // called when an event could not be written
+	mu      sync.Mutex
+}
+
+// NewWriterSink returns a WriterSink writing to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{W: w}
+}
+
+func (ws *WriterSink) Audit(e AuditEvent) {
+	b, err := json.Marshal(e)
+	if err == nil {
+		b = append(b, '\n')
+		ws.mu.Lock()
+		_, err = ws.W.Write(b)
+		ws.mu.Unlock()
+	}
+	if err != nil && ws.OnError != nil {
+		ws.OnError(e, err)
+	}
+}
+
+// WebhookSink is an AuditSink which POSTs each event as JSON to URL, from a
+// background goroutine so requests are never held up.  Events are dropped
+// (and counted) when more than QueueSize are waiting.
+type WebhookSink struct {
+	URL       string                  // where to POST
+	Client    *http.Client            // http.DefaultClient if nil
+	Header    http.Header             // extra headers for each POST (auth tokens...)
+	Retries   int                     // how many times a failed POST is retried
+	Backoff   time.Duration           // wait before the first retry, doubled for each one after
+	QueueSize int                     // how many events can be waiting to be sent, 0 means 1000
+	OnError   func(AuditEvent, error) // called when an event could not be delivered
+
+	once    sync.Once
+	queue   chan AuditEvent
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// defaultQueueSize is the WebhookSink.QueueSize used when it is 0
+const defaultQueueSize = 1000
+
+// NewWebhookSink returns a WebhookSink for url with sensible defaults
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		URL:       url,
+		Retries:   3,
+		Backoff:   time.Second,
+		QueueSize: defaultQueueSize,
+	}
+}
+
+func (ws *WebhookSink) start() {
+	ws.once.Do(func() {
+		size := ws.QueueSize
+		if size <= 0 {
+			size = defaultQueueSize
+		}
+		ws.queue = make(chan AuditEvent, size)
+		ws.done = make(chan struct{})
+		go ws.run()
+	})
+}
+
+func (ws *WebhookSink) Audit(e AuditEvent) {
+	ws.start()
+	select {
+	case ws.queue <- e:
+	default:
+		ws.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many events were dropped because the queue was full
+func (ws *WebhookSink) Dropped() int64 {
+	return ws.dropped.Load()
+}
+
+// Close sends the events which are still queued and stops the sink, it must
+// not be used afterwards
+func (ws *WebhookSink) Close() {
+	ws.start()
+	close(ws.queue)
+	<-ws.done
+}
+
+func (ws *WebhookSink) run() {
+	defer close(ws.done)
+	for e := range ws.queue {
+		err := ws.send(e)
+		if err != nil && ws.OnError != nil {
+			ws.OnError(e, err)
+		}
+	}
+}
+
+// send POSTs e, retrying with backoff
+func (ws *WebhookSink) send(e AuditEvent) error {
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	client := ws.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	wait := ws.Backoff
+	for attempt := 0; ; attempt++ {
+
+		err = ws.post(client, body)
+		if err == nil || attempt >= ws.Retries {
+			return err
+		}
+
+		time.Sleep(wait)
+		wait *= 2
+
+	}
+
+}
+
+func (ws *WebhookSink) post(client *http.Client, body []byte) error {
+	req, err := http.NewRequest("POST", ws.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range ws.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("gomemssn: webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package gomemssn
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWebhookSink(t *testing.T) {
+
+	var mu sync.Mutex
+	var events []AuditEvent
+	fails := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// fail the first one to exercise the retry
+		if fails > 0 {
+			fails--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e AuditEvent
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		events = append(events, e)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(srv.URL)
+	sink.Backoff = 0
+	m := NewManager(nil, "gomemssn_test")
+	m.AuditSink = sink
+
+	s := loadTestSession(t, m, "")
+	sink.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event but got %d", len(events))
+	}
+	e := events[0]
+	if e.Type != AuditCreate || e.SessionID != SessionID(s.Key) || e.Path != "/" {
+		t.Fatalf("unexpected event: %#v", e)
+	}
+	if e.SessionID == s.Key {
+		t.Fatalf("the session key must not be sent")
+	}
+
+}
+
+// a WebhookSink without NewWebhookSink still queues events
+func TestWebhookSinkQueue(t *testing.T) {
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	sink := &WebhookSink{URL: srv.URL}
+	for i := 0; i < 10; i++ {
+		sink.Audit(AuditEvent{Type: AuditCreate})
+	}
+	if n := sink.Dropped(); n != 0 {
+		t.Fatalf("expected no events dropped but got %d", n)
+	}
+	close(release)
+	sink.Close()
+
+}
+
+func TestWriterSink(t *testing.T) {
+
+	buf := &bytes.Buffer{}
+	m := NewManager(nil, "gomemssn_test")
+	m.AuditSink = NewWriterSink(buf)
+
+	loadTestSession(t, m, "")
+	loadTestSession(t, m, "")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines but got: %q", buf.String())
+	}
+	for _, l := range lines {
+		var e map[string]interface{}
+		if err := json.Unmarshal([]byte(l), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e["v"] != float64(AuditSchemaVersion) || e["type"] != AuditCreate || e["time"] == nil {
+			t.Fatalf("unexpected event: %s", l)
+		}
+		if _, ok := e["detail"]; ok {
+			t.Fatalf("empty fields should be omitted: %s", l)
+		}
+	}
+
+}
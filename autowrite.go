@@ -0,0 +1,90 @@
+package gomemssn
+
+import (
+	"net/http"
+)
+
+// SessionWriter is an http.ResponseWriter which writes a session to the
+// backing store right before the response header is sent, see AutoWrite
+type SessionWriter struct {
+	http.ResponseWriter
+	Err error // what writing the session returned
+
+	m         *Manager
+	r         *http.Request
+	s         *Session
+	written   bool
+	requested bool // WriteSession was called and deferred, see Manager.DeferWrites
+}
+
+// AutoWrite wraps w so s is written (with WriteSession) just before the
+// first WriteHeader, Write or Flush, i.e. while the cookie can still be
+// changed; handlers which forget to write the session still persist it.
+// If writing fails the error goes to OnMiddlewareError and, for a session
+// which was never stored, its cookie is dropped from the response so the
+// client isn't handed a key which leads nowhere.  Changes made after the
+// header went out are not written unless WriteSession is called again.
+// With DeferWrites, calls to WriteSession for s are left to the
+// SessionWriter until then.
+func (m *Manager) AutoWrite(w http.ResponseWriter, r *http.Request, s *Session) *SessionWriter {
+	sw := &SessionWriter{ResponseWriter: w, m: m, r: r, s: s}
+	if m.DeferWrites && !s.skipped {
+		s.deferTo = sw
+	}
+	return sw
+}
+
+// writeSession writes the session the first time it is called
+func (sw *SessionWriter) writeSession() {
+	if sw.written {
+		return
+	}
+	sw.written = true
+	// the header goes out next, with the cookies held back for it (ones
+	// the handler writes past this, like Gin's, bypass the CookieWriter)
+	if cw := cookieWriter(sw.ResponseWriter); cw != nil {
+		defer cw.Finish()
+	}
+	if !sw.requested && !sw.m.worthWriting(sw.s) {
+		return
+	}
+	sw.Err = sw.m.writeSession(sw.ResponseWriter, sw.s)
+	if sw.Err == nil {
+		return
+	}
+	sw.m.middlewareError(sw.r, sw.Err)
+	if sw.s.loaded == nil && sw.s.Cookie != nil {
+		sw.m.unsendCookie(sw.Header(), sw.s.Cookie.Name)
+		dropPending(sw.ResponseWriter, sw.s.Cookie.Name)
+	}
+}
+
+// Finish writes the session if that didn't happen yet, for when the handler
+// is done (Middleware calls it), and returns Err
+func (sw *SessionWriter) Finish() error {
+	sw.writeSession()
+	return sw.Err
+}
+
+func (sw *SessionWriter) WriteHeader(code int) {
+	sw.writeSession()
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *SessionWriter) Write(b []byte) (int, error) {
+	sw.writeSession()
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the wrapped ResponseWriter does
+func (sw *SessionWriter) Flush() {
+	sw.writeSession()
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController
+func (sw *SessionWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,82 @@
+package gomemssn
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAutoWrite(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	var failed error
+	m.OnMiddlewareError = func(r *http.Request, err error) { failed = err }
+
+	// written before the body goes out, so the handler's later change isn't
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	s := m.MustSession(w, r)
+	sw := m.AutoWrite(w, r, s)
+	s.Values["v"] = "abc123"
+	fmt.Fprint(sw, "hello")
+	s.Values["v"] = "later"
+	if sw.Err != nil {
+		t.Fatal(sw.Err)
+	}
+	if s2 := loadTestSession(t, m, s.Key); s2.Values.GetString("v") != "abc123" {
+		t.Fatalf("session not written with the header: %v", s2.Values)
+	}
+
+	// a new session which can't be stored doesn't get a cookie
+	m.Store = plainStore{failStore{m.stub}}
+	w = httptest.NewRecorder()
+	s = m.MustSession(w, r)
+	sw = m.AutoWrite(w, r, s)
+	s.Values["v"] = "abc123"
+	sw.WriteHeader(http.StatusNoContent)
+	if sw.Err == nil || failed != sw.Err {
+		t.Fatalf("expected the error to be reported, got %v", sw.Err)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Fatalf("expected no cookie but got %v", cookies)
+	}
+
+}
+
+func TestDeferWrites(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.DeferWrites = true
+	writes := func() uint64 {
+		m.stub.mu.RLock()
+		defer m.stub.mu.RUnlock()
+		return m.stub.cas
+	}
+
+	var key string
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := FromContext(r.Context())
+		key = s.Key
+		for i := 0; i < 3; i++ {
+			s.Values["n"] = float64(i)
+			m.MustWriteSession(w, s)
+		}
+		if writes() != 0 {
+			t.Errorf("expected the writes to be deferred")
+		}
+		fmt.Fprint(w, "hello")
+		s.Values["n"] = float64(3)
+		m.MustWriteSession(w, s)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// one write with the header, and the change after it written right away
+	if n := writes(); n != 2 {
+		t.Fatalf("expected 2 writes but got %d", n)
+	}
+	if s := loadTestSession(t, m, key); s.Values["n"] != float64(3) {
+		t.Fatalf("unexpected values: %v", s.Values)
+	}
+
+}
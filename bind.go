@@ -0,0 +1,63 @@
+package gomemssn
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Instead of (or as well as) Values, a session can hold one application
+// defined struct, for compile time checked access:
+//
+//	var u UserState
+//	if err := gomemssn.LoadInto(s, &u); err != nil && err != gomemssn.ErrNoValue { ... }
+//	u.CartItems++
+//	gomemssn.SaveFrom(s, &u)
+//
+// It is kept as a raw value (see SetRaw), encoded with encoding/json if the
+// Manager's Codec is a *JSONCodec and encoding/gob otherwise, so it needs no
+// gob.Register.
+
+// bindRaw is the raw value the struct is kept under
+const bindRaw = "gomemssn.struct"
+
+func useJSON(s *Session) bool {
+	if s.m == nil {
+		return false
+	}
+	_, ok := s.m.Codec.(*JSONCodec)
+	return ok
+}
+
+// SaveFrom encodes src (usually a pointer to a struct) into s, replacing
+// what was saved before
+func SaveFrom(s *Session, src interface{}) error {
+	var b []byte
+	if useJSON(s) {
+		var err error
+		if b, err = json.Marshal(src); err != nil {
+			return err
+		}
+	} else {
+		buf := &bytes.Buffer{}
+		if err := gob.NewEncoder(buf).Encode(src); err != nil {
+			return err
+		}
+		b = buf.Bytes()
+	}
+	s.SetRaw(bindRaw, b)
+	return nil
+}
+
+// LoadInto decodes what was saved with SaveFrom into dst, which must be a
+// pointer; ErrNoValue if nothing was (dst is left alone then)
+func LoadInto(s *Session, dst interface{}) error {
+	b := s.GetRaw(bindRaw)
+	if b == nil {
+		return ErrNoValue
+	}
+	if useJSON(s) {
+		return json.Unmarshal(b, dst)
+	}
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(dst)
+}
@@ -0,0 +1,47 @@
+package gomemssn
+
+import (
+	"testing"
+)
+
+type bindTestState struct {
+	Name  string
+	Items []int
+}
+
+func TestLoadIntoSaveFrom(t *testing.T) {
+
+	for _, c := range []Codec{nil, &JSONCodec{}} {
+
+		m := NewManager(nil, "gomemssn_test")
+		m.Codec = c
+
+		s := loadTestSession(t, m, "")
+		var st bindTestState
+		if err := LoadInto(s, &st); err != ErrNoValue {
+			t.Fatalf("expected ErrNoValue but got %v", err)
+		}
+		st.Name, st.Items = "joe", []int{1, 2}
+		if err := SaveFrom(s, &st); err != nil {
+			t.Fatal(err)
+		}
+		m.MustWriteSession(nil, s)
+
+		s = loadTestSession(t, m, s.Key)
+		var st2 bindTestState
+		if err := LoadInto(s, &st2); err != nil {
+			t.Fatal(err)
+		}
+		if st2.Name != "joe" || len(st2.Items) != 2 {
+			t.Fatalf("unexpected state: %+v", st2)
+		}
+
+		// saving the same thing again is not a change
+		SaveFrom(s, &st2)
+		if m.changed(s) {
+			t.Fatalf("unchanged struct made the session dirty")
+		}
+
+	}
+
+}
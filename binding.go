@@ -0,0 +1,116 @@
+package gomemssn
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Binding says which properties of the client a session is tied to, see
+// Manager.Binding.  They are recorded in the session's Meta when it is
+// started and a request with the session's cookie which doesn't match is
+// treated as a possible hijack, see BindingAction.
+type Binding int
+
+const (
+	BindIP         Binding = 1 << iota // the client's IP, see Manager.ClientIP
+	BindIPPrefix                       // the client's /24 (IPv4) or /64 (IPv6) network, for clients whose address changes within it; ignored with BindIP
+	BindUserAgent                      // the User-Agent header (a hash of it)
+	BindClientCert                     // the client's TLS certificate (a fingerprint of it, see Manager.ClientCertFingerprint), so a stolen cookie is useless on a device without the certificate
+)
+
+// BindingAction is what happens to a session requested by a client which
+// doesn't match its Binding
+type BindingAction int
+
+const (
+	BindingReject     BindingAction = iota // start a new session, the bound one is left alone for its rightful owner
+	BindingRegenerate                      // keep the session but move it to a new key, and bind it to the new client
+	BindingAllow                           // keep the session and bind it to the new client
+)
+
+// userAgentHash is what BindUserAgent records
+func userAgentHash(ua string) string {
+	h := sha256.Sum256([]byte(ua))
+	return base64.RawURLEncoding.EncodeToString(h[:12])
+}
+
+// clientCertFingerprint is what BindClientCert records for r: the SHA-256 of
+// the client's certificate, "" if it has none
+func (m *Manager) clientCertFingerprint(r *http.Request) string {
+	if m.ClientCertFingerprint != nil {
+		return m.ClientCertFingerprint(r)
+	}
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	h := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// bindingIP is what BindIP or BindIPPrefix records for r
+func (m *Manager) bindingIP(r *http.Request) string {
+	ip := m.ClientIP(r)
+	if m.Binding&BindIP != 0 || m.Binding&BindIPPrefix == 0 {
+		return ip
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+// bindClient records the properties of r's client in s, see Manager.Binding
+func (m *Manager) bindClient(r *http.Request, s *Session) {
+	if m.Binding&(BindIP|BindIPPrefix) != 0 {
+		s.Meta.ClientIP = m.bindingIP(r)
+	}
+	if m.Binding&BindUserAgent != 0 {
+		s.Meta.UserAgentHash = userAgentHash(r.UserAgent())
+	}
+	if m.Binding&BindClientCert != 0 {
+		s.Meta.ClientCert = m.clientCertFingerprint(r)
+	}
+}
+
+// checkBinding compares r's client with what s is bound to and, if they
+// differ, reports it to the audit sink and returns what OnBindingMismatch
+// wants done (ok is false then).  Properties which were not recorded (the
+// session is from before Binding was set) are not compared.
+func (m *Manager) checkBinding(r *http.Request, s *Session) (act BindingAction, ok bool) {
+
+	if m.Binding == 0 {
+		return BindingAllow, true
+	}
+
+	var changed Binding
+	var what []string
+	if m.Binding&(BindIP|BindIPPrefix) != 0 && s.Meta.ClientIP != "" && s.Meta.ClientIP != m.bindingIP(r) {
+		changed |= m.Binding & (BindIP | BindIPPrefix)
+		what = append(what, "ip")
+	}
+	if m.Binding&BindUserAgent != 0 && s.Meta.UserAgentHash != "" && s.Meta.UserAgentHash != userAgentHash(r.UserAgent()) {
+		changed |= BindUserAgent
+		what = append(what, "user agent")
+	}
+	if m.Binding&BindClientCert != 0 && s.Meta.ClientCert != "" && s.Meta.ClientCert != m.clientCertFingerprint(r) {
+		changed |= BindClientCert
+		what = append(what, "client certificate")
+	}
+	if changed == 0 {
+		return BindingAllow, true
+	}
+
+	m.audit(r, AuditAnomaly, s, "binding changed: "+strings.Join(what, ", "))
+	if m.OnBindingMismatch == nil {
+		return BindingReject, false
+	}
+	return m.OnBindingMismatch(r, s, changed), false
+
+}
@@ -0,0 +1,112 @@
+package gomemssn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBinding(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.Binding = BindIPPrefix | BindUserAgent
+
+	newReq := func(key, ip, ua string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = ip + ":1234"
+		r.Header.Set("User-Agent", ua)
+		if key != "" {
+			r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: key})
+		}
+		return r
+	}
+
+	s := m.MustSession(httptest.NewRecorder(), newReq("", "10.1.2.3", "firefox"))
+	s.Values["user"] = "joe"
+	m.MustWriteSession(nil, s)
+	if s.Meta.ClientIP != "10.1.2.0/24" || s.Meta.UserAgentHash == "" {
+		t.Fatalf("client not recorded: %+v", s.Meta)
+	}
+
+	// same network, fine
+	if s2 := m.MustSession(httptest.NewRecorder(), newReq(s.Key, "10.1.2.99", "firefox")); s2.Key != s.Key {
+		t.Fatalf("session rejected for the same network")
+	}
+
+	// different browser
+	s2 := m.MustSession(httptest.NewRecorder(), newReq(s.Key, "10.1.2.3", "curl"))
+	if s2.Key == s.Key || s2.Values["user"] != nil {
+		t.Fatalf("expected a new session for a different user agent")
+	}
+
+	var changed Binding
+	m.OnBindingMismatch = func(r *http.Request, s *Session, c Binding) BindingAction {
+		changed = c
+		return BindingRegenerate
+	}
+	w := httptest.NewRecorder()
+	s2 = m.MustSession(w, newReq(s.Key, "192.168.0.1", "firefox"))
+	if changed != BindIPPrefix {
+		t.Fatalf("expected the ip to have changed, got %v", changed)
+	}
+	if s2.Key == s.Key || s2.Values["user"] != "joe" || s2.Meta.ClientIP != "192.168.0.0/24" {
+		t.Fatalf("expected the session under a new key and bound to the new ip, got %q %+v", s2.Key, s2.Meta)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != s2.Key {
+		t.Fatalf("expected the new key in the cookie, got %v", cookies)
+	}
+
+	// rebound, so the new client is fine now
+	changed = 0
+	m.MustSession(httptest.NewRecorder(), newReq(s2.Key, "192.168.0.1", "firefox"))
+	if changed != 0 {
+		t.Fatalf("session was not rebound")
+	}
+
+}
+
+func TestBindClientCert(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.Binding = BindClientCert
+	var changes []Binding
+	m.OnBindingMismatch = func(r *http.Request, s *Session, changed Binding) BindingAction {
+		changes = append(changes, changed)
+		return BindingRegenerate
+	}
+	newReq := func(key, cert string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		if cert != "" {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Raw: []byte(cert)}}}
+		}
+		if key != "" {
+			r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: key})
+		}
+		return r
+	}
+
+	s := m.MustSession(httptest.NewRecorder(), newReq("", "laptop"))
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+	if s.Meta.ClientCert == "" {
+		t.Fatal("expected the certificate recorded")
+	}
+
+	if s2 := m.MustSession(httptest.NewRecorder(), newReq(s.Key, "laptop")); s2.Key != s.Key || len(changes) != 0 {
+		t.Fatalf("expected the same session for the same certificate")
+	}
+	for _, cert := range []string{"phone", ""} {
+		s2 := m.MustSession(httptest.NewRecorder(), newReq(s.Key, cert))
+		if s2.Key == s.Key || s2.Values["v"] != "abc123" {
+			t.Fatalf("expected the session regenerated for certificate %q", cert)
+		}
+		m.MustWriteSession(nil, s2)
+		s = s2
+	}
+	if len(changes) != 2 || changes[0] != BindClientCert {
+		t.Fatalf("unexpected mismatches %v", changes)
+	}
+
+}
@@ -0,0 +1,258 @@
+// Package boltstore is a gomemssn.Store keeping sessions in a bbolt database
+// file, for single node deployments which should keep their sessions across
+// restarts without running memcache:
+//
+//	st, err := boltstore.Open("sessions.db")
+//	...
+//	m := gomemssn.NewManager(nil, "myapp")
+//	m.Store = st
+package boltstore
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn"
+	"go.etcd.io/bbolt"
+)
+
+// DefaultBucket is the bbolt bucket sessions go in unless Store.Bucket is set
+const DefaultBucket = "gomemssn"
+
+// Store implements gomemssn.CASStore, gomemssn.MultiGetStore,
+// gomemssn.TTLStore and gomemssn.TxStore.  Each value
+// is stored as the expiry (unix nanos, 0 for never) and a version number,
+// both 8 bytes big endian, followed by the data.  Expired entries are not
+// returned, Sweep removes them from the file.
+type Store struct {
+	DB     *bbolt.DB
+	Bucket []byte
+}
+
+// Open opens (creating if needed) the database file at path
+func Open(path string) (*Store, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return New(db)
+}
+
+// New returns a Store using db, creating the bucket if needed
+func New(db *bbolt.DB) (*Store, error) {
+	s := &Store{DB: db, Bucket: []byte(DefaultBucket)}
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(s.Bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
+
+const headerLen = 16
+
+// entry splits a stored value, ok is false if it is missing or expired
+func entry(v []byte, now time.Time) (exp int64, version uint64, data []byte, ok bool) {
+	if len(v) < headerLen {
+		return 0, 0, nil, false
+	}
+	exp = int64(binary.BigEndian.Uint64(v))
+	if exp != 0 && exp <= now.UnixNano() {
+		return 0, 0, nil, false
+	}
+	return exp, binary.BigEndian.Uint64(v[8:]), v[headerLen:], true
+}
+
+func expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
+}
+
+func value(exp int64, version uint64, data []byte) []byte {
+	v := make([]byte, headerLen+len(data))
+	binary.BigEndian.PutUint64(v, uint64(exp))
+	binary.BigEndian.PutUint64(v[8:], version)
+	copy(v[headerLen:], data)
+	return v
+}
+
+func (s *Store) Get(key string) ([]byte, error) {
+	data, _, err := s.GetCAS(key)
+	return data, err
+}
+
+func (s *Store) GetCAS(key string) (data []byte, token interface{}, err error) {
+	err = s.DB.View(func(tx *bbolt.Tx) error {
+		data, token, err = getCAS(tx.Bucket(s.Bucket), key)
+		return err
+	})
+	return data, token, err
+}
+
+func (s *Store) GetMulti(keys []string) (map[string]*gomemssn.StoreItem, error) {
+	ret := make(map[string]*gomemssn.StoreItem, len(keys))
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(s.Bucket)
+		now := time.Now()
+		for _, key := range keys {
+			if _, version, d, ok := entry(b.Get([]byte(key)), now); ok {
+				ret[key] = &gomemssn.StoreItem{Data: append([]byte(nil), d...), CAS: version}
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
+
+func (s *Store) Set(key string, data []byte, ttl time.Duration) error {
+	return s.DB.Update(func(tx *bbolt.Tx) error {
+		return set(tx.Bucket(s.Bucket), key, data, ttl)
+	})
+}
+
+func (s *Store) CompareAndSwap(key string, data []byte, token interface{}, ttl time.Duration) error {
+	return s.DB.Update(func(tx *bbolt.Tx) error {
+		return compareAndSwap(tx.Bucket(s.Bucket), key, data, token, ttl)
+	})
+}
+
+func (s *Store) Delete(key string) error {
+	return s.DB.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(s.Bucket).Delete([]byte(key))
+	})
+}
+
+func (s *Store) Touch(key string, ttl time.Duration) error {
+	return s.DB.Update(func(tx *bbolt.Tx) error {
+		return touch(tx.Bucket(s.Bucket), key, ttl)
+	})
+}
+
+// Tx runs f in one bbolt read-write transaction, so its reads see its own
+// changes
+func (s *Store) Tx(f func(gomemssn.Store) error) error {
+	return s.DB.Update(func(tx *bbolt.Tx) error {
+		ts := &txStore{b: tx.Bucket(s.Bucket)}
+		if err := f(ts); err != nil {
+			return err
+		}
+		if ts.conflict {
+			return gomemssn.ErrCASConflict
+		}
+		return nil
+	})
+}
+
+// the operations of Store, on a bucket in a transaction
+
+func getCAS(b *bbolt.Bucket, key string) ([]byte, interface{}, error) {
+	_, version, d, ok := entry(b.Get([]byte(key)), time.Now())
+	if !ok {
+		return nil, nil, gomemssn.ErrNotFound
+	}
+	// bbolt's memory is only valid during the transaction
+	return append([]byte(nil), d...), version, nil
+}
+
+func set(b *bbolt.Bucket, key string, data []byte, ttl time.Duration) error {
+	version, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), value(expiry(ttl), version, data))
+}
+
+func compareAndSwap(b *bbolt.Bucket, key string, data []byte, token interface{}, ttl time.Duration) error {
+	_, version, _, ok := entry(b.Get([]byte(key)), time.Now())
+	if (!ok && token != nil) || (ok && token != version) {
+		return gomemssn.ErrCASConflict
+	}
+	return set(b, key, data, ttl)
+}
+
+func touch(b *bbolt.Bucket, key string, ttl time.Duration) error {
+	_, version, data, ok := entry(b.Get([]byte(key)), time.Now())
+	if !ok {
+		return gomemssn.ErrNotFound
+	}
+	return b.Put([]byte(key), value(expiry(ttl), version, data))
+}
+
+// txStore is the Store Tx hands to its function
+type txStore struct {
+	b        *bbolt.Bucket
+	conflict bool // a CompareAndSwap failed, the transaction is rolled back
+}
+
+func (ts *txStore) Get(key string) ([]byte, error) {
+	data, _, err := getCAS(ts.b, key)
+	return data, err
+}
+
+func (ts *txStore) GetCAS(key string) ([]byte, interface{}, error) {
+	return getCAS(ts.b, key)
+}
+
+func (ts *txStore) Set(key string, data []byte, ttl time.Duration) error {
+	return set(ts.b, key, data, ttl)
+}
+
+func (ts *txStore) CompareAndSwap(key string, data []byte, token interface{}, ttl time.Duration) error {
+	err := compareAndSwap(ts.b, key, data, token, ttl)
+	if err == gomemssn.ErrCASConflict {
+		ts.conflict = true
+	}
+	return err
+}
+
+func (ts *txStore) Delete(key string) error {
+	return ts.b.Delete([]byte(key))
+}
+
+func (ts *txStore) Touch(key string, ttl time.Duration) error {
+	return touch(ts.b, key, ttl)
+}
+
+func (s *Store) TTL(key string) (ttl time.Duration, err error) {
+	err = s.DB.View(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		exp, _, _, ok := entry(tx.Bucket(s.Bucket).Get([]byte(key)), now)
+		if !ok {
+			return gomemssn.ErrNotFound
+		}
+		if exp != 0 {
+			ttl = time.Unix(0, exp).Sub(now)
+		}
+		return nil
+	})
+	return ttl, err
+}
+
+// Sweep removes expired entries from the database, returns how many.  Call
+// it now and then (e.g. from a time.Ticker) to keep the file from growing.
+func (s *Store) Sweep() (int, error) {
+	n := 0
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(s.Bucket).Cursor()
+		now := time.Now()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if _, _, _, ok := entry(v, now); !ok {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
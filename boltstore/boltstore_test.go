@@ -0,0 +1,75 @@
+package boltstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/bradleypeabody/gomemssn/storetest"
+)
+
+func TestStore(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	st, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := gomemssn.NewManager(nil, "gomemssn_test")
+	m.Store = st
+	m.OnConflict = gomemssn.ConflictFail
+
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(w, s)
+
+	// survives a restart
+	st.Close()
+	if st, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	m.Store = st
+
+	load := func() *gomemssn.Session {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+		return m.MustSession(httptest.NewRecorder(), r)
+	}
+	a, b := load(), load()
+	if a.Values.GetString("v") != "abc123" {
+		t.Fatalf("session not read back: %v", a.Values)
+	}
+	a.Values["v"] = "a"
+	m.MustWriteSession(nil, a)
+	b.Values["v"] = "b"
+	if err := m.WriteSession(nil, b); err == nil {
+		t.Fatalf("expected a conflict")
+	}
+
+	if err := st.Set("short", []byte("x"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := st.Get("short"); err != gomemssn.ErrNotFound {
+		t.Fatalf("expected expired entry to be gone but got %v", err)
+	}
+	if n, err := st.Sweep(); err != nil || n != 1 {
+		t.Fatalf("expected to sweep 1 entry, got %d %v", n, err)
+	}
+
+}
+
+func TestConformance(t *testing.T) {
+	st, err := Open(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	storetest.TestStore(t, st)
+	storetest.TestExpiration(t, st, time.Sleep)
+}
@@ -0,0 +1,63 @@
+package gomemssn
+
+import "errors"
+
+// BroadcastValue sets key to value in all sessions of the users userIDs (see
+// Session.SetUserID), to flag them all for a password reset, say, or show
+// them a banner again.  The sessions are read together from the backing
+// store (see LoadSessions) and written one by one; one written by its user
+// in the meantime is read again and updated as with Session.Update.
+// Sessions which are gone are skipped, and so are failures to write one:
+// the others are still written and the first error is returned.
+func (m *Manager) BroadcastValue(userIDs []string, key string, value interface{}) error {
+
+	if m.ReadOnly() || m.Degraded() {
+		return ErrReadOnly
+	}
+
+	owner := make(map[string]string)
+	var keys []string
+	for _, uid := range userIDs {
+		data, _, err := m.get(userIndexKey(uid))
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, k := range m.parseIndex(data) {
+			if _, ok := owner[k]; !ok {
+				owner[k] = uid
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	sessions, err := m.LoadSessions(keys)
+	if err != nil {
+		return err
+	}
+
+	set := func(v Values) error {
+		v[key] = value
+		return nil
+	}
+	var first error
+	for _, k := range keys {
+		s, ok := sessions[k]
+		if !ok || s.Meta.UserID != owner[k] {
+			// gone, or belongs to someone else now
+			continue
+		}
+		s.OnConflict = ConflictFail
+		set(s.Values)
+		err := m.WriteSession(nil, s)
+		if errors.Is(err, ErrSessionConflict) {
+			err = m.WriteSessionByKey(k, set)
+		}
+		if err != nil && err != ErrNotFound && first == nil {
+			first = err
+		}
+	}
+	return first
+
+}
@@ -0,0 +1,36 @@
+package gomemssn
+
+import "testing"
+
+func TestBroadcastValue(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+
+	newUserSession := func(uid string) string {
+		s := loadTestSession(t, m, "")
+		s.SetUserID(uid)
+		s.Values["v"] = uid
+		m.MustWriteSession(nil, s)
+		return s.Key
+	}
+	a1, a2, b, c := newUserSession("a"), newUserSession("a"), newUserSession("b"), newUserSession("c")
+
+	// a session which moved to another user keeps out of a's broadcast
+	s := loadTestSession(t, m, a2)
+	s.SetUserID("c")
+	m.MustWriteSession(nil, s)
+
+	if err := m.BroadcastValue([]string{"a", "b", "nobody"}, "reset", true); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{a1: true, a2: false, b: true, c: false} {
+		s := loadTestSession(t, m, key)
+		if got := s.Values["reset"] == true; got != want {
+			t.Errorf("%s of %s: expected the value set %v but got %v", key, s.UserID(), want, got)
+		}
+		if s.Values["v"] == nil {
+			t.Errorf("%s lost its values: %v", key, s.Values)
+		}
+	}
+
+}
@@ -0,0 +1,168 @@
+package gomemssn
+
+import (
+	"bytes"
+	"context"
+)
+
+// Heavy keys (Manager.HeavyKeys) are top level entries in Values which hold
+// large blobs (search state, multi-step wizards...).  Instead of going into
+// the main record they are each stored under a key derived from the session
+// key, and only written back when their encoded form changed, so the record
+// read and written on every request stays small.  They are also not read
+// with the session, call Session.Bucket(name).Load(ctx) before using one.
+
+// Bucket is a handle to a heavy key of a session
+type Bucket struct {
+	s    *Session
+	name string
+}
+
+// Bucket returns a handle to the heavy key name, see Manager.HeavyKeys
+func (s *Session) Bucket(name string) *Bucket {
+	return &Bucket{s: s, name: name}
+}
+
+// Load reads the heavy value from the backing store into Values (unless it was
+// already loaded) and returns it, nil if there is no such value
+func (b *Bucket) Load(ctx context.Context) (interface{}, error) {
+	s := b.s
+	if _, ok := s.buckets[b.name]; !ok && s.m != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.m.loadBucket(s, b.name); err != nil {
+			return nil, err
+		}
+	}
+	return s.Values[b.name], nil
+}
+
+// backend key a heavy value of session key is stored under
+func bucketKey(key, name string) string {
+	return key + ":" + name
+}
+
+func (m *Manager) isHeavy(name string) bool {
+	for _, h := range m.HeavyKeys {
+		if h == name {
+			return true
+		}
+	}
+	return false
+}
+
+// coreValues returns vals without the heavy keys, i.e. what goes in the main record
+func (m *Manager) coreValues(vals Values) Values {
+	if len(m.HeavyKeys) == 0 {
+		return vals
+	}
+	ret := make(Values, len(vals))
+	for k, v := range vals {
+		if !m.isHeavy(k) {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// encodes a single heavy value, wrapped in Values so interface types work the same as in the main record
+func (m *Manager) encodeBucket(name string, v interface{}) ([]byte, error) {
+	b, err := m.codec().Encode(Values{name: v})
+	if err != nil {
+		return nil, err
+	}
+	return m.compress(b)
+}
+
+// loadBucket reads the heavy value name of s into s.Values (if it exists)
+func (m *Manager) loadBucket(s *Session, name string) error {
+	if s.buckets == nil {
+		s.buckets = make(map[string][]byte)
+	}
+	data, _, err := m.get(bucketKey(s.Key, name))
+	if err == ErrNotFound {
+		s.buckets[name] = nil
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if data, err = m.openStored(data); err != nil {
+		return err
+	}
+	if err := m.checkDecodeSize(data); err != nil {
+		return err
+	}
+	vals := make(Values)
+	plain, err := decompress(data, m.MaxDecodeSize)
+	if err != nil {
+		return err
+	}
+	err = m.codec().Decode(plain, &vals)
+	if err != nil {
+		return err
+	}
+	if err := m.checkTypes(vals); err != nil {
+		return err
+	}
+	if v, ok := vals[name]; ok {
+		s.Values[name] = v
+	}
+	s.buckets[name] = data
+	return nil
+}
+
+// writeBuckets writes the heavy values of s which changed since they were
+// read and removes the ones which were deleted from Values; the expiration
+// of the others (unchanged, or never loaded) is extended to the main
+// record's, so they don't expire before it
+func (m *Manager) writeBuckets(s *Session) error {
+	ttl := m.ttl(m.expiration(s))
+	touch := func(name string) error {
+		err := m.store().Touch(m.storeKey(bucketKey(s.Key, name)), ttl)
+		if err == ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	for _, name := range m.HeavyKeys {
+		old, loaded := s.buckets[name]
+		had := old != nil
+		v, ok := s.Values[name]
+		if !ok {
+			if had {
+				if err := m.del(bucketKey(s.Key, name)); err != nil {
+					return err
+				}
+				delete(s.buckets, name)
+			} else if !loaded {
+				if err := touch(name); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		b, err := m.encodeBucket(name, v)
+		if err != nil {
+			return err
+		}
+		if had && bytes.Equal(old, b) {
+			if err := touch(name); err != nil {
+				return err
+			}
+			continue
+		}
+		sealed, err := m.sealStored(b)
+		if err != nil {
+			return err
+		}
+		if err := m.set(bucketKey(s.Key, name), sealed, ttl); err != nil {
+			return err
+		}
+		if s.buckets == nil {
+			s.buckets = make(map[string][]byte)
+		}
+		s.buckets[name] = b
+	}
+	return nil
+}
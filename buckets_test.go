@@ -0,0 +1,108 @@
+package gomemssn
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHeavyKeys(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.HeavyKeys = []string{"search"}
+
+	s := loadTestSession(t, m, "")
+	s.Values["search"] = "lots of data"
+	s.Values["v"] = "abc123"
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _, err := m.get(s.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core := &Session{}
+	if err := m.decodeSession(data, core); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := core.Values["search"]; ok {
+		t.Fatalf("heavy key should not be in the main record")
+	}
+	_, cas, err := m.get(bucketKey(s.Key, "search"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s = loadTestSession(t, m, s.Key)
+	if _, ok := s.Values["search"]; ok {
+		t.Fatalf("heavy key should not be loaded until asked for")
+	}
+
+	// not loaded so it's not rewritten
+	s.Values["v"] = "def456"
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	if _, cas2, _ := m.get(bucketKey(s.Key, "search")); cas2 != cas {
+		t.Fatalf("unloaded heavy key was rewritten")
+	}
+
+	v, err := s.Bucket("search").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "lots of data" || s.Values.GetString("search") != "lots of data" {
+		t.Fatalf("expected search='lots of data' but got: %v", v)
+	}
+
+	// unchanged so it's not written again
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	if _, cas2, _ := m.get(bucketKey(s.Key, "search")); cas2 != cas {
+		t.Fatalf("unchanged heavy key was rewritten")
+	}
+
+	delete(s.Values, "search")
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.get(bucketKey(s.Key, "search")); err != ErrNotFound {
+		t.Fatalf("expected deleted heavy key to be removed but got: %v", err)
+	}
+
+}
+
+// unchanged and unloaded heavy values live as long as the session
+func TestHeavyKeysExpiration(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now, m.stub.Now = clock.Now, clock.Now
+	m.Expiration = time.Minute
+	m.HeavyKeys = []string{"search"}
+
+	s := loadTestSession(t, m, "")
+	s.Values["search"] = "lots of data"
+	m.MustWriteSession(nil, s)
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(40 * time.Second)
+		s = loadTestSession(t, m, s.Key)
+		if i%2 == 0 {
+			if _, err := s.Bucket("search").Load(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s.Values["v"] = i
+		m.MustWriteSession(nil, s)
+	}
+
+	clock.Advance(40 * time.Second)
+	s = loadTestSession(t, m, s.Key)
+	if v, err := s.Bucket("search").Load(context.Background()); err != nil || v != "lots of data" {
+		t.Fatalf("expected the heavy value to survive but got %v, %v", v, err)
+	}
+
+}
@@ -0,0 +1,198 @@
+package gomemssn
+
+import (
+	"container/list"
+	"context"
+	"time"
+)
+
+// The local read cache holds sessions read ahead of time by Prefetch, so the
+// requests which follow don't each go to memcache.  With LocalCacheAll it is
+// a tier in front of the backing store: every session read goes in it
+// (read-through) and every successful write replaces the entry with what was
+// written (write-through).  Any other write or delete of a key through the
+// Manager drops it from the cache.  It holds at most LocalCacheSize sessions,
+// dropping the least recently used.
+//
+// Entries which were written through carry no cas token (we don't get one
+// back from memcache) so conflicting writes of sessions read from them are
+// not detected, and other servers' writes are only seen once entries expire;
+// deployments which need strict consistency should leave LocalCacheAll off.
+
+// defaultLocalCacheSize is the LocalCacheSize used when it is 0
+const defaultLocalCacheSize = 10000
+
+type cacheEntry struct {
+	key     string
+	l       *loaded
+	expires time.Time
+	elem    *list.Element // in cacheLRU, most recently used at the front
+}
+
+// cacheGet returns a copy of the cached session for key, nil if there isn't one
+func (m *Manager) cacheGet(key string) *loaded {
+	if m.LocalCacheTTL <= 0 {
+		return nil
+	}
+	m.cacheMutex.Lock()
+	defer m.cacheMutex.Unlock()
+	e := m.cache[key]
+	if e == nil {
+		return nil
+	}
+	if m.now().After(e.expires) {
+		if m.OnStoreError != FallbackToLocalCache {
+			m.cacheRemove(e)
+		}
+		return nil
+	}
+	m.cacheLRU.MoveToFront(e.elem)
+	return e.l.clone()
+}
+
+// cacheStale is cacheGet, but returns expired entries as well, see
+// FallbackToLocalCache
+func (m *Manager) cacheStale(key string) *loaded {
+	if m.LocalCacheTTL <= 0 {
+		return nil
+	}
+	m.cacheMutex.Lock()
+	defer m.cacheMutex.Unlock()
+	e := m.cache[key]
+	if e == nil {
+		return nil
+	}
+	return e.l.clone()
+}
+
+func (m *Manager) cachePut(key string, l *loaded) {
+	m.cacheMutex.Lock()
+	defer m.cacheMutex.Unlock()
+	if m.cache == nil {
+		m.cache = make(map[string]*cacheEntry)
+		m.cacheLRU = list.New()
+	}
+	if e := m.cache[key]; e != nil {
+		m.cacheRemove(e)
+	}
+	e := &cacheEntry{key: key, l: l, expires: m.now().Add(m.LocalCacheTTL)}
+	e.elem = m.cacheLRU.PushFront(e)
+	m.cache[key] = e
+	size := m.LocalCacheSize
+	if size <= 0 {
+		size = defaultLocalCacheSize
+	}
+	for m.cacheLRU.Len() > size {
+		m.cacheRemove(m.cacheLRU.Back().Value.(*cacheEntry))
+	}
+}
+
+func (m *Manager) cacheDel(key string) {
+	m.cacheMutex.Lock()
+	if e := m.cache[key]; e != nil {
+		m.cacheRemove(e)
+	}
+	m.cacheMutex.Unlock()
+}
+
+// cacheRemove drops e, cacheMutex must be held
+func (m *Manager) cacheRemove(e *cacheEntry) {
+	delete(m.cache, e.key)
+	m.cacheLRU.Remove(e.elem)
+}
+
+// cacheWritten is the write-through part of LocalCacheAll: it caches what
+// was just written for s
+func (m *Manager) cacheWritten(s *Session, data []byte) {
+	if m.LocalCacheTTL <= 0 || !m.LocalCacheAll {
+		return
+	}
+	vals := m.coreValues(s.Values)
+	l := &loaded{data: data, cas: casWritten, rec: &record{Meta: s.Meta, Values: vals, raw: s.raw}}
+	m.cachePut(s.Key, l.clone())
+}
+
+// prefetchBatch is how many keys Prefetch asks memcache for at once
+const prefetchBatch = 100
+
+// Prefetch reads the sessions with the given keys into the local read cache
+// (see LocalCacheTTL), so the requests for them which are about to happen
+// (e.g. after a websocket broadcast) are served from memory.  Keys which
+// don't exist or can't be decoded are skipped.  It does nothing if
+// LocalCacheTTL is not set.
+func (m *Manager) Prefetch(ctx context.Context, keys []string) error {
+
+	if m.LocalCacheTTL <= 0 {
+		return nil
+	}
+
+	for len(keys) > 0 {
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch := keys
+		if len(batch) > prefetchBatch {
+			batch = batch[:prefetchBatch]
+		}
+		keys = keys[len(batch):]
+
+		found, err := m.getMulti(batch)
+		if err != nil {
+			return err
+		}
+		for key, l := range found {
+			l.rec, err = m.decodeRecord(l.data)
+			if err != nil {
+				continue
+			}
+			m.cachePut(key, l)
+		}
+
+	}
+
+	return nil
+
+}
+
+// Preload is Prefetch for the sessions of the users uids (see SetUserID),
+// to warm the local read cache before an event which brings them all back
+// at once (a sale starting, a scheduled broadcast).  It does nothing if
+// LocalCacheTTL is not set.
+func (m *Manager) Preload(ctx context.Context, uids []string) error {
+
+	if m.LocalCacheTTL <= 0 {
+		return nil
+	}
+
+	var keys []string
+	for len(uids) > 0 {
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch := uids
+		if len(batch) > prefetchBatch {
+			batch = batch[:prefetchBatch]
+		}
+		uids = uids[len(batch):]
+
+		ikeys := make([]string, len(batch))
+		for i, uid := range batch {
+			ikeys[i] = userIndexKey(uid)
+		}
+		found, err := m.getMulti(ikeys)
+		if err != nil {
+			return err
+		}
+		for _, l := range found {
+			keys = append(keys, m.parseIndex(l.data)...)
+		}
+
+	}
+
+	return m.Prefetch(ctx, keys)
+
+}
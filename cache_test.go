@@ -0,0 +1,123 @@
+package gomemssn
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPrefetch(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.LocalCacheTTL = time.Minute
+
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Prefetch(context.Background(), []string{s.Key, "notthere"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// remove it behind the cache's back, it should still be served
+	m.stub.mu.Lock()
+	e := m.stub.entries[m.storeKey(s.Key)]
+	delete(m.stub.entries, m.storeKey(s.Key))
+	m.stub.mu.Unlock()
+	s2 := loadTestSession(t, m, s.Key)
+	if v := s2.Values.GetString("v"); v != "abc123" {
+		t.Fatalf("expected v='abc123' from the cache but got: %v", v)
+	}
+	m.stub.mu.Lock()
+	m.stub.entries[m.storeKey(s.Key)] = e
+	m.stub.mu.Unlock()
+
+	// writes drop the entry
+	s2.Values["v"] = "def456"
+	if err := m.WriteSession(nil, s2); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.cache[s.Key]; ok {
+		t.Fatalf("expected write to drop the cache entry")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Prefetch(ctx, []string{s.Key}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled but got: %v", err)
+	}
+
+}
+
+func TestLocalCacheAll(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.LocalCacheTTL = time.Minute
+	m.LocalCacheAll = true
+	m.LocalCacheSize = 2
+
+	var keys []string
+	for i := 0; i < 3; i++ {
+		s := loadTestSession(t, m, "")
+		s.Values["i"] = i
+		m.MustWriteSession(nil, s)
+		keys = append(keys, s.Key)
+	}
+	if len(m.cache) != 2 || m.cache[keys[0]] != nil {
+		t.Fatalf("expected the least recently used session to be dropped")
+	}
+
+	// written through, served without the store
+	m.stub.mu.Lock()
+	e := m.stub.entries[m.storeKey(keys[2])]
+	delete(m.stub.entries, m.storeKey(keys[2]))
+	m.stub.mu.Unlock()
+	if s := loadTestSession(t, m, keys[2]); s.Values["i"] != 2 {
+		t.Fatalf("expected the session from the cache but got: %v", s.Values)
+	}
+	m.stub.mu.Lock()
+	m.stub.entries[m.storeKey(keys[2])] = e
+	m.stub.mu.Unlock()
+
+	// read through
+	loadTestSession(t, m, keys[0])
+	if m.cache[keys[0]] == nil || m.cache[keys[1]] != nil {
+		t.Fatalf("expected the read session to be cached")
+	}
+
+	// changes to a session don't leak into the cache
+	s := loadTestSession(t, m, keys[0])
+	s.Values["i"] = 100
+	if s := loadTestSession(t, m, keys[0]); s.Values["i"] != 0 {
+		t.Fatalf("cached session was modified: %v", s.Values)
+	}
+
+}
+
+func TestPreload(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.LocalCacheTTL = time.Minute
+	keys := make(map[string]string)
+	for _, uid := range []string{"joe", "joe", "ann"} {
+		s := loadTestSession(t, m, "")
+		s.SetUserID(uid)
+		m.MustWriteSession(nil, s)
+		keys[s.Key] = uid
+	}
+	if len(m.cache) != 0 {
+		t.Fatalf("expected nothing cached yet, got %d entries", len(m.cache))
+	}
+
+	if err := m.Preload(context.Background(), []string{"joe", "nobody"}); err != nil {
+		t.Fatal(err)
+	}
+	for key, uid := range keys {
+		if _, ok := m.cache[key]; ok != (uid == "joe") {
+			t.Fatalf("expected only joe's sessions preloaded, %s's is cached: %v", uid, ok)
+		}
+	}
+
+}
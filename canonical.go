@@ -0,0 +1,127 @@
+package gomemssn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// The canonical form of a session is a serialization which only depends on
+// what is in it: map entries are sorted, and metadata, values and raw values
+// always come in that order.  Gob (and so GobCodec and exports) writes maps
+// in whatever order they iterate in, so the same session encodes to
+// different bytes from one write to the next.  The canonical form can't be
+// decoded, it is only for telling whether two sessions are the same: see
+// Session.Fingerprint and Manager.CanonicalEncoding.  Audit events don't
+// need it, their JSON has its fields in a fixed order and no session values.
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// appendCanonical appends the canonical form of v to b
+func appendCanonical(b []byte, v reflect.Value) []byte {
+
+	if !v.IsValid() {
+		return append(b, 'n')
+	}
+	if v.Type() == timeType && v.CanInterface() {
+		t := v.Interface().(time.Time)
+		b = append(b, 't')
+		b = binary.AppendVarint(b, t.UnixNano())
+		return appendCanonicalString(b, t.Location().String())
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 'T')
+		}
+		return append(b, 'F')
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(append(b, 'i'), v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.AppendUvarint(append(b, 'u'), v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return binary.BigEndian.AppendUint64(append(b, 'f'), math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		b = binary.BigEndian.AppendUint64(append(b, 'c'), math.Float64bits(real(c)))
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(imag(c)))
+	case reflect.String:
+		return appendCanonicalString(append(b, 's'), v.String())
+	case reflect.Interface:
+		if v.IsNil() {
+			return append(b, 'n')
+		}
+		// the dynamic type, so 1 and int64(1) differ like they do in a session
+		b = appendCanonicalString(append(b, 'I'), v.Elem().Type().String())
+		return appendCanonical(b, v.Elem())
+	case reflect.Pointer:
+		if v.IsNil() {
+			return append(b, 'n')
+		}
+		return appendCanonical(append(b, 'p'), v.Elem())
+	case reflect.Slice, reflect.Array:
+		// nil and empty slices are the same, gob doesn't tell them apart either
+		b = binary.AppendUvarint(append(b, 'l'), uint64(v.Len()))
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return append(b, v.Bytes()...)
+		}
+		for i := 0; i < v.Len(); i++ {
+			b = appendCanonical(b, v.Index(i))
+		}
+		return b
+	case reflect.Map:
+		entries := make([][]byte, 0, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			k := appendCanonical(nil, it.Key())
+			e := append(binary.AppendUvarint(nil, uint64(len(k))), k...)
+			entries = append(entries, appendCanonical(e, it.Value()))
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i], entries[j]) < 0 })
+		b = binary.AppendUvarint(append(b, 'm'), uint64(len(entries)))
+		for _, e := range entries {
+			b = append(b, e...)
+		}
+		return b
+	case reflect.Struct:
+		b = binary.AppendUvarint(append(b, 'S'), uint64(v.NumField()))
+		for i := 0; i < v.NumField(); i++ {
+			b = appendCanonical(b, v.Field(i))
+		}
+		return b
+	}
+
+	// channels and functions are only the same as themselves
+	b = appendCanonicalString(append(b, 'x'), v.Type().String())
+	return binary.AppendUvarint(b, uint64(v.Pointer()))
+
+}
+
+func appendCanonicalString(b []byte, s string) []byte {
+	return append(binary.AppendUvarint(b, uint64(len(s))), s...)
+}
+
+// canonicalSum returns a hash of the canonical form of the metadata, values
+// and raw values
+func canonicalSum(meta Meta, vals Values, raw map[string][]byte) []byte {
+	b := appendCanonical(nil, reflect.ValueOf(meta))
+	b = appendCanonical(b, reflect.ValueOf(vals))
+	b = appendCanonical(b, reflect.ValueOf(raw))
+	h := sha256.Sum256(b)
+	return h[:]
+}
+
+// Fingerprint returns a hash of what is in the session (values, metadata and
+// raw values), the same for sessions with the same contents however they
+// were built or encoded: for telling whether a session changed, or
+// comparing copies of it.  Values are compared as they are, so an int and
+// an int64 1 differ, and a session fresh from JSONCodec differs from the
+// one which was written.
+func (s *Session) Fingerprint() string {
+	return base64.RawURLEncoding.EncodeToString(canonicalSum(s.Meta, s.Values, s.raw))
+}
@@ -0,0 +1,74 @@
+package gomemssn
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+
+	a, b := &Session{Values: make(Values)}, &Session{Values: make(Values)}
+	for i := 0; i < 20; i++ {
+		a.Values[fmt.Sprint(i)] = map[string]int{"x": i, "y": -i}
+	}
+	for i := 19; i >= 0; i-- {
+		b.Values[fmt.Sprint(i)] = map[string]int{"y": -i, "x": i}
+	}
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Fatal("expected the same fingerprint for the same contents")
+	}
+	b.Values["3"].(map[string]int)["x"] = 4
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Fatal("expected a change in place to change the fingerprint")
+	}
+	b.Values["3"] = map[string]int{"x": 3, "y": -3}
+	b.Values["n"], a.Values["n"] = 1, int64(1)
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Fatal("expected values of different types to differ")
+	}
+
+}
+
+func TestCanonicalEncoding(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.CanonicalEncoding = true
+
+	s := loadTestSession(t, m, "")
+	s.Values["list"] = []string{"a", "b"}
+	for i := 0; i < 20; i++ {
+		s.Values[fmt.Sprint("k", i)] = i
+	}
+	m.MustWriteSession(nil, s)
+
+	// changed in place, without MarkModified
+	s = loadTestSession(t, m, s.Key)
+	s.Values["list"].([]string)[0] = "z"
+	m.MustWriteSession(nil, s)
+	if s2 := loadTestSession(t, m, s.Key); s2.Values["list"].([]string)[0] != "z" {
+		t.Fatalf("change in place not written: %v", s2.Values["list"])
+	}
+
+	first, err := m.ExportSession(s.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if again, _ := m.ExportSession(s.Key); !bytes.Equal(first, again) {
+			t.Fatal("expected the same export every time")
+		}
+	}
+	dst := NewManager(nil, "other")
+	if err := dst.ImportSession(s.Key, first); err != nil {
+		t.Fatal(err)
+	}
+	s2, err := dst.GetSessionByKey(s.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2.Values["k7"] != 7 || s2.Values["list"].([]string)[0] != "z" {
+		t.Fatalf("session not imported: %v", s2.Values)
+	}
+
+}
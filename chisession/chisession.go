@@ -0,0 +1,28 @@
+// Package chisession is gomemssn's Middleware for chi, which takes plain
+// net/http middleware so this is only for symmetry with the Gin and Echo
+// packages and to name the accessor:
+//
+//	r := chi.NewRouter()
+//	r.Use(chisession.Middleware(m))
+//	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+//		s := chisession.Get(r)
+//		...
+//	})
+package chisession
+
+import (
+	"net/http"
+
+	"github.com/bradleypeabody/gomemssn"
+)
+
+// Middleware returns chi middleware loading and writing sessions with m, see
+// Manager.Middleware
+func Middleware(m *gomemssn.Manager) func(http.Handler) http.Handler {
+	return m.Middleware
+}
+
+// Get returns the session Middleware loaded for r, nil if there is none
+func Get(r *http.Request) *gomemssn.Session {
+	return gomemssn.FromContext(r.Context())
+}
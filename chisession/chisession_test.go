@@ -0,0 +1,40 @@
+package chisession
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	m := gomemssn.NewManager(nil, "gomemssn_test")
+	r := chi.NewRouter()
+	r.Use(Middleware(m))
+	r.Get("/set", func(w http.ResponseWriter, r *http.Request) {
+		Get(r).Values["v"] = "abc123"
+	})
+	r.Get("/get", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, Get(r).Values["v"])
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/set", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a cookie but got %v", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/get", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "abc123" {
+		t.Fatalf("expected the session value but got %q", w.Body.String())
+	}
+
+}
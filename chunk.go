@@ -0,0 +1,183 @@
+package gomemssn
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Memcache refuses items over 1MB, so encoded sessions bigger than ChunkSize
+// are split: the pieces are written under key:0.gen, key:1.gen... and the key
+// itself gets a manifest, chunkMagic followed by
+//
+//	uvarint len(gen), gen, uvarint number of chunks, uvarint total length
+//
+// gen is random for each write, so a concurrent write can't mix its chunks
+// with ours and the manifest (which is what cas is done on) always points at
+// a complete set.  Chunks of earlier writes are left to expire.  A chunked
+// session also gets a mark under key#chunked, so TouchSession can tell it
+// needs the manifest without reading the key.
+
+const (
+	chunkMagic       = "\x00GMC"
+	defaultChunkSize = 1000 * 1000
+	chunkMarkSuffix  = "#chunked" // not ":", that's for heavy keys
+)
+
+// chunkedToken is the cas token of a chunked session, the keys are kept so
+// they can be touched along with the manifest
+type chunkedToken struct {
+	token interface{}
+	keys  []string
+}
+
+func (m *Manager) chunkSize() int {
+	if m.ChunkSize == 0 {
+		return defaultChunkSize
+	}
+	return m.ChunkSize
+}
+
+func chunkKey(key string, i int, gen string) string {
+	return key + ":" + strconv.Itoa(i) + "." + gen
+}
+
+// chunk writes data in chunks under keys derived from key if it is too big,
+// and returns what should be written under key itself
+func (m *Manager) chunk(key string, data []byte, ttl time.Duration) ([]byte, error) {
+
+	size := m.chunkSize()
+	if size <= 0 || len(data) <= size {
+		return data, nil
+	}
+
+	g := make([]byte, 6)
+	if _, err := crand.Read(g); err != nil {
+		return nil, err
+	}
+	gen := base64.RawURLEncoding.EncodeToString(g)
+
+	n := 0
+	for off := 0; off < len(data); off += size {
+		end := min(off+size, len(data))
+		if err := m.store().Set(m.storeKey(chunkKey(key, n, gen)), data[off:end], ttl); err != nil {
+			return nil, err
+		}
+		n++
+	}
+	if err := m.store().Set(m.storeKey(key+chunkMarkSuffix), []byte{1}, ttl); err != nil {
+		return nil, err
+	}
+
+	b := []byte(chunkMagic)
+	b = appendUvarintBytes(b, []byte(gen))
+	b = binary.AppendUvarint(b, uint64(n))
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return b, nil
+
+}
+
+// parseManifest returns the chunk keys of a manifest and the total length,
+// ok is false if data isn't a manifest
+func parseManifest(key string, data []byte) (keys []string, total int, ok bool, err error) {
+	if !strings.HasPrefix(string(data), chunkMagic) {
+		return nil, 0, false, nil
+	}
+	r := bytes.NewReader(data[len(chunkMagic):])
+	gl, err := binary.ReadUvarint(r)
+	if err != nil || gl > uint64(r.Len()) {
+		return nil, 0, true, errBadFrame
+	}
+	gen := make([]byte, gl)
+	r.Read(gen)
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, true, errBadFrame
+	}
+	t, err := binary.ReadUvarint(r)
+	if err != nil || n > t {
+		return nil, 0, true, errBadFrame
+	}
+	for i := 0; i < int(n); i++ {
+		keys = append(keys, chunkKey(key, i, string(gen)))
+	}
+	return keys, int(t), true, nil
+}
+
+// unchunk returns data as is, or reassembled if it is a manifest; a missing
+// chunk means the session is gone (ErrNotFound)
+func (m *Manager) unchunk(key string, data []byte, token interface{}) ([]byte, interface{}, error) {
+
+	keys, total, ok, err := parseManifest(key, data)
+	if !ok || err != nil {
+		return data, token, err
+	}
+
+	parts := make(map[string][]byte, len(keys))
+	if ms, ok := m.store().(MultiGetStore); ok {
+		skeys := make([]string, len(keys))
+		for i, k := range keys {
+			skeys[i] = m.storeKey(k)
+		}
+		items, err := ms.GetMulti(skeys)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, k := range keys {
+			if it, ok := items[skeys[i]]; ok {
+				parts[k] = it.Data
+			}
+		}
+	} else {
+		for _, k := range keys {
+			b, err := m.store().Get(m.storeKey(k))
+			if err == ErrNotFound {
+				break
+			} else if err != nil {
+				return nil, nil, err
+			}
+			parts[k] = b
+		}
+	}
+
+	ret := make([]byte, 0, total)
+	for _, k := range keys {
+		b, ok := parts[k]
+		if !ok {
+			return nil, nil, ErrNotFound
+		}
+		ret = append(ret, b...)
+	}
+	if len(ret) != total {
+		return nil, nil, errBadFrame
+	}
+	return ret, &chunkedToken{token: token, keys: keys}, nil
+
+}
+
+// delChunks removes the chunks of key, if it is chunked
+func (m *Manager) delChunks(key string) error {
+	if m.chunkSize() <= 0 {
+		return nil
+	}
+	data, _, err := m.storeGet(key)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	keys, _, ok, err := parseManifest(key, data)
+	if !ok || err != nil {
+		return nil
+	}
+	for _, k := range append(keys, key+chunkMarkSuffix) {
+		if err := m.store().Delete(m.storeKey(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package gomemssn
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunking(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.ChunkSize = 100
+	m.OnConflict = ConflictFail
+
+	s := loadTestSession(t, m, "")
+	big := strings.Repeat("0123456789", 50)
+	s.Values["big"] = big
+	m.MustWriteSession(nil, s)
+	if n := m.stub.Len(); n < 6 {
+		t.Fatalf("expected the session to be split in chunks but there are %d entries", n)
+	}
+
+	a := loadTestSession(t, m, s.Key)
+	b := loadTestSession(t, m, s.Key)
+	if a.Values["big"] != big {
+		t.Fatalf("chunked session not read back")
+	}
+	if _, ok := a.cas.(*chunkedToken); !ok {
+		t.Fatalf("expected a chunkedToken but got %T", a.cas)
+	}
+	a.Values["x"] = "1"
+	m.MustWriteSession(nil, a)
+	b.Values["x"] = "2"
+	if err := m.WriteSession(nil, b); err == nil {
+		t.Fatalf("expected a conflict")
+	}
+	if s := loadTestSession(t, m, s.Key); s.Values["x"] != "1" || s.Values["big"] != big {
+		t.Fatalf("unexpected values: %v", s.Values["x"])
+	}
+
+	// a missing chunk loses the session
+	m.stub.mu.Lock()
+	for k := range m.stub.entries {
+		if strings.HasPrefix(k, m.storeKey(s.Key)+":0.") {
+			delete(m.stub.entries, k)
+		}
+	}
+	m.stub.mu.Unlock()
+	if _, _, err := m.get(s.Key); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+
+	s = loadTestSession(t, m, "")
+	s.Values["big"] = big
+	m.MustWriteSession(nil, s)
+	before := m.stub.Len()
+	if err := m.DestroySession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	if after := m.stub.Len(); before-after < 6 {
+		t.Fatalf("chunks not deleted: %d entries before, %d after", before, after)
+	}
+
+}
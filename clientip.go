@@ -0,0 +1,101 @@
+package gomemssn
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies parses CIDRs ("10.0.0.0/8") or plain IPs for
+// Manager.TrustedProxies
+func ParseTrustedProxies(cidrs ...string) ([]*net.IPNet, error) {
+	ret := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			if ip := net.ParseIP(c); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				ret = append(ret, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, n)
+	}
+	return ret, nil
+}
+
+func (m *Manager) trusted(ip net.IP) bool {
+	for _, n := range m.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parses an address as found in headers: ip, ip:port, [ipv6]:port, "quoted"
+func parseHeaderIP(s string) net.IP {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
+
+// ClientIP returns the IP address of the client which made r.  If the
+// request came from one of TrustedProxies the forwarding headers are
+// consulted (X-Forwarded-For, then Forwarded, then X-Real-IP), skipping
+// addresses of trusted proxies from the right, so clients can't spoof their
+// IP by sending those headers themselves.  This is what all the features
+// that look at the client's IP use.
+func (m *Manager) ClientIP(r *http.Request) string {
+
+	remote := parseHeaderIP(r.RemoteAddr)
+	if remote == nil {
+		return r.RemoteAddr
+	}
+	if !m.trusted(remote) {
+		return remote.String()
+	}
+
+	// each of these is a list ordered from the client to the last proxy
+	var hops []string
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		for _, h := range xff {
+			hops = append(hops, strings.Split(h, ",")...)
+		}
+	} else if fwd := r.Header.Values("Forwarded"); len(fwd) > 0 {
+		for _, h := range fwd {
+			for _, elem := range strings.Split(h, ",") {
+				for _, pair := range strings.Split(elem, ";") {
+					k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+					if ok && strings.EqualFold(k, "for") {
+						hops = append(hops, v)
+					}
+				}
+			}
+		}
+	} else if xri := r.Header.Get("X-Real-IP"); xri != "" {
+		hops = []string{xri}
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseHeaderIP(hops[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !m.trusted(ip) {
+			break
+		}
+	}
+	return client.String()
+
+}
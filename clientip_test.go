@@ -0,0 +1,47 @@
+package gomemssn
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	var err error
+	m.TrustedProxies, err = ParseTrustedProxies("10.0.0.0/8", "192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		// untrusted peers can't spoof
+		{"1.2.3.4:5678", map[string]string{"X-Forwarded-For": "9.9.9.9"}, "1.2.3.4"},
+		{"10.0.0.1:5678", nil, "10.0.0.1"},
+		{"10.0.0.1:5678", map[string]string{"X-Forwarded-For": "9.9.9.9, 1.2.3.4"}, "1.2.3.4"},
+		{"10.0.0.1:5678", map[string]string{"X-Forwarded-For": "9.9.9.9, 1.2.3.4, 10.1.1.1, 192.168.1.1"}, "1.2.3.4"},
+		{"192.168.1.1:5678", map[string]string{"Forwarded": `for=1.2.3.4;proto=https, for="[2001:db8::1]:4711"`}, "2001:db8::1"},
+		{"10.0.0.1:5678", map[string]string{"X-Real-IP": "1.2.3.4"}, "1.2.3.4"},
+		{"10.0.0.1:5678", map[string]string{"X-Forwarded-For": "garbage"}, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if got := m.ClientIP(r); got != tt.want {
+			t.Errorf("%v %v: expected %v but got %v", tt.remote, tt.headers, tt.want, got)
+		}
+	}
+
+	if _, err := ParseTrustedProxies("nonsense"); err == nil {
+		t.Fatalf("expected error for bad cidr")
+	}
+
+}
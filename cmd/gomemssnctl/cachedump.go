@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memcache has no way to list keys other than the (debugging only)
+// "stats cachedump" command, which returns at most about 1MB worth of keys
+// per slab class, so listings of big caches are incomplete
+
+// dumpKeys returns the keys stored on the memcache server addr which start
+// with prefix
+func dumpKeys(addr, prefix string) ([]string, error) {
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+
+	lines, err := statsCommand(rw, "stats items")
+	if err != nil {
+		return nil, err
+	}
+	var slabs []int
+	for _, l := range lines {
+		// STAT items:<slab>:number <count>
+		f := strings.Fields(l)
+		if len(f) != 3 || !strings.HasSuffix(f[1], ":number") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(f[1], "items:"), ":number"))
+		if err != nil {
+			return nil, fmt.Errorf("bad stats items line %q", l)
+		}
+		slabs = append(slabs, id)
+	}
+
+	var ret []string
+	for _, id := range slabs {
+		lines, err := statsCommand(rw, "stats cachedump "+strconv.Itoa(id)+" 0")
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range lines {
+			// ITEM <key> [<size> b; <expiration> s]
+			f := strings.Fields(l)
+			if len(f) >= 2 && f[0] == "ITEM" && strings.HasPrefix(f[1], prefix) {
+				ret = append(ret, f[1])
+			}
+		}
+	}
+
+	return ret, nil
+
+}
+
+// statsCommand sends cmd and returns the lines of the reply up to END
+func statsCommand(rw *bufio.ReadWriter, cmd string) ([]string, error) {
+	if _, err := rw.WriteString(cmd + "\r\n"); err != nil {
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		return nil, err
+	}
+	var ret []string
+	for {
+		l, err := rw.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l = strings.TrimRight(l, "\r\n")
+		switch {
+		case l == "END":
+			return ret, nil
+		case l == "ERROR" || strings.HasPrefix(l, "CLIENT_ERROR") || strings.HasPrefix(l, "SERVER_ERROR"):
+			return nil, fmt.Errorf("%s: %s", cmd, l)
+		}
+		ret = append(ret, l)
+	}
+}
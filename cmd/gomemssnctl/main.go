@@ -0,0 +1,235 @@
+// Command gomemssnctl looks at and removes gomemssn sessions in memcache,
+// for debugging login problems in production:
+//
+//	gomemssnctl -servers mc1:11211,mc2:11211 -prefix myapp list
+//	gomemssnctl -prefix myapp dump KEY...
+//	gomemssnctl -prefix myapp delete KEY...
+//	gomemssnctl -prefix myapp user USERID
+//	gomemssnctl -prefix myapp expire -older 720h
+//
+// list and expire go by memcache's "stats cachedump", which only sees part
+// of a big cache; user reads the index kept for Session.SetUserID.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/bradleypeabody/gomemssn"
+)
+
+const usage = `usage: gomemssnctl [flags] command [args]
+
+commands:
+  list                     list session keys
+  dump KEY...              print sessions (metadata and values) as JSON
+  delete KEY...            delete sessions
+  user USERID              print the sessions of a user (see Session.SetUserID)
+  expire -older D | -all   delete sessions created more than D ago, or all of them
+
+flags:
+`
+
+func main() {
+
+	flags := flag.NewFlagSet("gomemssnctl", flag.ExitOnError)
+	servers := flags.String("servers", "localhost:11211", "comma separated memcache servers")
+	prefix := flags.String("prefix", "", "the application's MemcacheKeyPrefix (the keyPrefix passed to NewManager)")
+	hashPrefix := flags.Bool("hash-prefix", false, "the application sets HashKeyPrefix")
+	codec := flags.String("codec", "gob", "the application's Codec, gob or json")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	addrs := strings.Split(*servers, ",")
+	m := gomemssn.NewManager(memcache.New(addrs...), *prefix)
+	m.HashKeyPrefix = *hashPrefix
+	switch *codec {
+	case "gob":
+	case "json":
+		m.Codec = &gomemssn.JSONCodec{}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown codec %q\n", *codec)
+		os.Exit(2)
+	}
+
+	c := &ctl{m: m, servers: addrs, out: os.Stdout}
+	if err := c.run(flags.Args()); err == errUsage {
+		flags.Usage()
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "gomemssnctl:", err)
+		os.Exit(1)
+	}
+
+}
+
+var errUsage = errors.New("usage")
+
+type ctl struct {
+	m       *gomemssn.Manager
+	servers []string  // memcache servers to list keys from
+	out     io.Writer // where results go
+}
+
+// run carries out the command in args
+func (c *ctl) run(args []string) error {
+
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, args := args[0], args[1:]
+
+	switch cmd {
+
+	case "list":
+		keys, err := c.sessionKeys()
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			fmt.Fprintln(c.out, k)
+		}
+		return nil
+
+	case "dump":
+		if len(args) == 0 {
+			return errUsage
+		}
+		for _, k := range args {
+			s, err := c.m.GetSessionByKey(k)
+			if err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			if err := c.print(s); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+		return nil
+
+	case "delete":
+		if len(args) == 0 {
+			return errUsage
+		}
+		for _, k := range args {
+			if err := c.m.DeleteSessionByKey(k); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+		return nil
+
+	case "user":
+		if len(args) != 1 {
+			return errUsage
+		}
+		sessions, err := c.m.SessionsForUser(args[0])
+		if err != nil {
+			return err
+		}
+		for _, s := range sortSessions(sessions) {
+			if err := c.print(s); err != nil {
+				return fmt.Errorf("%s: %w", s.Key, err)
+			}
+		}
+		return nil
+
+	case "expire":
+		flags := flag.NewFlagSet("expire", flag.ContinueOnError)
+		older := flags.Duration("older", 0, "only sessions created more than this long ago")
+		all := flags.Bool("all", false, "all sessions")
+		if err := flags.Parse(args); err != nil || (*older > 0) == *all {
+			return errUsage
+		}
+		n, err := c.expire(*older)
+		fmt.Fprintf(c.out, "deleted %d sessions\n", n)
+		return err
+
+	}
+
+	return errUsage
+
+}
+
+// sessionKeys lists the session keys in memcache, without the keys derived
+// from them (heavy values, chunks, locks) and user indexes
+func (c *ctl) sessionKeys() ([]string, error) {
+	prefix := c.m.StoreKey("")
+	var ret []string
+	for _, addr := range c.servers {
+		keys, err := dumpKeys(addr, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", addr, err)
+		}
+		for _, k := range keys {
+			k = strings.TrimPrefix(k, prefix)
+			if !strings.ContainsAny(k, ":#") {
+				ret = append(ret, k)
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// expire deletes the sessions created more than older ago, all of them if
+// older is 0, and returns how many it deleted
+func (c *ctl) expire(older time.Duration) (int, error) {
+
+	keys, err := c.sessionKeys()
+	if err != nil {
+		return 0, err
+	}
+	if older > 0 {
+		sessions, err := c.m.GetSessionsByKey(keys)
+		if err != nil {
+			return 0, err
+		}
+		keys = keys[:0]
+		for _, s := range sortSessions(sessions) {
+			if time.Since(s.Meta.CreatedAt) > older {
+				keys = append(keys, s.Key)
+			}
+		}
+	}
+
+	for i, k := range keys {
+		if err := c.m.DeleteSessionByKey(k); err != nil {
+			return i, fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	return len(keys), nil
+
+}
+
+// print writes s as JSON
+func (c *ctl) print(s *gomemssn.Session) error {
+	b, err := json.MarshalIndent(struct {
+		Key    string
+		Meta   gomemssn.Meta
+		Values gomemssn.Values
+	}{s.Key, s.Meta, s.Values}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.out, "%s\n", b)
+	return err
+}
+
+func sortSessions(sessions map[string]*gomemssn.Session) []*gomemssn.Session {
+	ret := make([]*gomemssn.Session, 0, len(sessions))
+	for _, s := range sessions {
+		ret = append(ret, s)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+	return ret
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn"
+)
+
+// fakeMemcache answers stats items and stats cachedump with keys, all in
+// slab 1
+func fakeMemcache(t *testing.T, keys []string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					l, err := br.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch strings.TrimSpace(l) {
+					case "stats items":
+						conn.Write([]byte("STAT items:1:number 3\r\nSTAT items:1:age 10\r\nEND\r\n"))
+					case "stats cachedump 1 0":
+						for _, k := range keys {
+							conn.Write([]byte("ITEM " + k + " [10 b; 0 s]\r\n"))
+						}
+						conn.Write([]byte("END\r\n"))
+					default:
+						conn.Write([]byte("ERROR\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestCtl(t *testing.T) {
+
+	m := gomemssn.NewManager(nil, "app")
+	var keys []string
+	for i := 0; i < 2; i++ {
+		s := m.MustSession(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		s.Values["n"] = float64(i)
+		s.SetUserID("joe")
+		if i == 0 {
+			s.Meta.CreatedAt = time.Now().Add(-48 * time.Hour)
+		}
+		m.MustWriteSession(nil, s)
+		keys = append(keys, s.Key)
+	}
+
+	stored := []string{m.StoreKey(keys[0]), m.StoreKey(keys[1]), m.StoreKey(keys[1]) + "#lock", "other" + keys[0]}
+	var out bytes.Buffer
+	c := &ctl{m: m, servers: []string{fakeMemcache(t, stored)}, out: &out}
+
+	if err := c.run([]string{"list"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.String(), "\n"); n != 2 {
+		t.Fatalf("expected 2 keys listed but got %q", out.String())
+	}
+
+	out.Reset()
+	if err := c.run([]string{"dump", keys[1]}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"n": 1`) || !strings.Contains(out.String(), `"UserID": "joe"`) {
+		t.Fatalf("unexpected dump: %s", out.String())
+	}
+
+	out.Reset()
+	if err := c.run([]string{"user", "joe"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.String(), `"Key"`); n != 2 {
+		t.Fatalf("expected 2 sessions for the user but got %d", n)
+	}
+
+	if err := c.run([]string{"expire"}); err != errUsage {
+		t.Fatalf("expected errUsage but got %v", err)
+	}
+	out.Reset()
+	if err := c.run([]string{"expire", "-older", "24h"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetSessionByKey(keys[0]); err != gomemssn.ErrNotFound {
+		t.Fatalf("expected the old session to be deleted, got %v", err)
+	}
+	if _, err := m.GetSessionByKey(keys[1]); err != nil {
+		t.Fatalf("expected the new session to be kept, got %v", err)
+	}
+
+	if err := c.run([]string{"delete", keys[1]}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetSessionByKey(keys[1]); err != gomemssn.ErrNotFound {
+		t.Fatalf("expected the session to be deleted, got %v", err)
+	}
+
+}
@@ -0,0 +1,330 @@
+package gomemssn
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec serializes what gets written to memcache.  v is always a pointer to
+// a struct or map made of Values, Meta and the like.
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte, v interface{}) error
+}
+
+// GobCodec encodes with encoding/gob; concrete types stored in Values must be
+// registered with gob.Register (better RegisterType), or have a hook (see
+// TypeHooks)
+type GobCodec struct {
+	TypeHooks
+}
+
+// encoding buffers are reused, the result is copied out of them; gob
+// encoders themselves can't be, each message has to carry its own types
+var bufPool = sync.Pool{New: func() interface{} { return &bytes.Buffer{} }}
+
+// buffers bigger than this are not kept for reuse
+const maxPooledBuf = 64 << 10
+
+func getBuf() *bytes.Buffer {
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuf(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuf {
+		bufPool.Put(buf)
+	}
+}
+
+func (c *GobCodec) Encode(v interface{}) ([]byte, error) {
+	v, err := c.wrap(v)
+	if err != nil {
+		return nil, err
+	}
+	buf := getBuf()
+	defer putBuf(buf)
+	err = gob.NewEncoder(buf).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+func (c *GobCodec) Decode(data []byte, v interface{}) error {
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	if err != nil {
+		return err
+	}
+	return c.unwrap(v)
+}
+
+// JSONCodec encodes with encoding/json; note that values come back as what
+// json decodes into an interface{} (float64, map[string]interface{}...)
+// unless they have a hook (see TypeHooks)
+type JSONCodec struct {
+	TypeHooks
+}
+
+func (c *JSONCodec) Encode(v interface{}) ([]byte, error) {
+	v, err := c.wrap(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func (c *JSONCodec) Decode(data []byte, v interface{}) error {
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return err
+	}
+	return c.unwrap(v)
+}
+
+// TypeHooks lets specific types stored in Values be serialized by the
+// application (e.g. decimal.Decimal or proto messages) instead of by gob or
+// json.  Hooks apply to values stored directly in Values, not ones nested
+// inside other values.
+type TypeHooks struct {
+	mu     sync.RWMutex
+	byType map[reflect.Type]*typeHook
+	byName map[string]*typeHook
+}
+
+type typeHook struct {
+	name   string
+	encode func(v interface{}) ([]byte, error)
+	decode func(data []byte) (interface{}, error)
+}
+
+// hookedValue is what a hooked value is replaced with for serialization
+type hookedValue struct {
+	Hook string `json:"$gomemssn_hook"`
+	Data []byte `json:"data"`
+}
+
+func init() {
+	gob.RegisterName("gomemssn.hookedValue", hookedValue{})
+}
+
+// RegisterHook makes values of the same type as sample be serialized with
+// encode and deserialized with decode.  name is stored with each value to
+// find the hook again when decoding, so it must stay the same across deploys.
+func (h *TypeHooks) RegisterHook(name string, sample interface{}, encode func(v interface{}) ([]byte, error), decode func(data []byte) (interface{}, error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.byType == nil {
+		h.byType = make(map[reflect.Type]*typeHook)
+		h.byName = make(map[string]*typeHook)
+	}
+	th := &typeHook{name: name, encode: encode, decode: decode}
+	h.byType[reflect.TypeOf(sample)] = th
+	h.byName[name] = th
+}
+
+// wrap returns v with hooked values replaced by hookedValues, v itself is not modified
+func (h *TypeHooks) wrap(v interface{}) (interface{}, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.byType) == 0 {
+		return v, nil
+	}
+	var vals Values
+	switch x := v.(type) {
+	case *record:
+		vals = x.Values
+	case Values:
+		vals = x
+	default:
+		return v, nil
+	}
+	var ret Values
+	for k, val := range vals {
+		th := h.byType[reflect.TypeOf(val)]
+		if th == nil {
+			continue
+		}
+		b, err := th.encode(val)
+		if err != nil {
+			return nil, fmt.Errorf("gomemssn: encoding %q with hook %q: %w", k, th.name, err)
+		}
+		if ret == nil {
+			ret = make(Values, len(vals))
+			for k2, v2 := range vals {
+				ret[k2] = v2
+			}
+		}
+		ret[k] = hookedValue{Hook: th.name, Data: b}
+	}
+	if ret == nil {
+		return v, nil
+	}
+	if rec, ok := v.(*record); ok {
+		rec2 := *rec
+		rec2.Values = ret
+		return &rec2, nil
+	}
+	return ret, nil
+}
+
+// unwrap replaces hookedValues in the decoded v with what their hooks return
+func (h *TypeHooks) unwrap(v interface{}) error {
+	var vals Values
+	switch x := v.(type) {
+	case *record:
+		vals = x.Values
+	case *Values:
+		vals = *x
+	default:
+		return nil
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for k, val := range vals {
+		hv, ok := asHookedValue(val)
+		if !ok {
+			continue
+		}
+		th := h.byName[hv.Hook]
+		if th == nil {
+			return fmt.Errorf("gomemssn: no hook registered for %q (value %q)", hv.Hook, k)
+		}
+		dv, err := th.decode(hv.Data)
+		if err != nil {
+			return fmt.Errorf("gomemssn: decoding %q with hook %q: %w", k, hv.Hook, err)
+		}
+		vals[k] = dv
+	}
+	return nil
+}
+
+// asHookedValue recognizes a hookedValue as decoded by gob, or by json (as a map)
+func asHookedValue(v interface{}) (hookedValue, bool) {
+	switch x := v.(type) {
+	case hookedValue:
+		return x, true
+	case map[string]interface{}:
+		name, ok := x["$gomemssn_hook"].(string)
+		if !ok {
+			return hookedValue{}, false
+		}
+		// []byte is base64 in json
+		var hv hookedValue
+		b, err := json.Marshal(x)
+		if err != nil || json.Unmarshal(b, &hv) != nil {
+			return hookedValue{}, false
+		}
+		hv.Hook = name
+		return hv, true
+	}
+	return hookedValue{}, false
+}
+
+var defaultCodec = &GobCodec{}
+
+func (m *Manager) codec() Codec {
+	if m.Codec != nil {
+		return m.Codec
+	}
+	return defaultCodec
+}
+
+// encode the session values and metadata for the backing store
+func (m *Manager) encodeSession(s *Session) ([]byte, error) {
+	return m.encodeRecord(&record{Meta: s.Meta, Values: s.Values, raw: s.raw})
+}
+
+// newRecord returns what gets written to the main key for s
+func (m *Manager) newRecord(s *Session) *record {
+	return &record{Meta: s.Meta, Values: m.coreValues(s.Values), raw: s.raw}
+}
+
+func (m *Manager) encodeRecord(rec *record) ([]byte, error) {
+	b, err := m.codec().Encode(rec)
+	if err != nil {
+		return nil, m.encodeError(rec.Values, err)
+	}
+	if len(rec.raw) > 0 {
+		b = appendFrame(b, rec.raw)
+	}
+	if b, err = m.compress(b); err != nil {
+		return nil, err
+	}
+	return m.sealStored(b)
+}
+
+// decode data from the backing store into s
+func (m *Manager) decodeSession(data []byte, s *Session) error {
+	rec, err := m.decodeRecord(data)
+	if err != nil {
+		return err
+	}
+	s.Meta = rec.Meta
+	s.Values = rec.Values
+	s.raw = rec.raw
+	return nil
+}
+
+// sessions written by older versions are just the gob encoded Values, those
+// are still understood
+func (m *Manager) decodeRecord(data []byte) (rec *record, err error) {
+	defer func() {
+		if err == nil {
+			return
+		}
+		if m.Metrics != nil {
+			m.Metrics.DecodeFailed()
+		}
+		if m.LogLifecycle {
+			m.logger().Debug("session decode failed", "err", err)
+		}
+	}()
+	if data, err = m.openStored(data); err != nil {
+		return nil, err
+	}
+	if err = m.checkDecodeSize(data); err != nil {
+		return nil, err
+	}
+	data, err = decompress(data, m.MaxDecodeSize)
+	if err != nil {
+		return nil, err
+	}
+	data, raw, err := splitFrame(data)
+	if err != nil {
+		return nil, err
+	}
+	rec, err = m.decodeCodec(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkTypes(rec.Values); err != nil {
+		return nil, err
+	}
+	if err := m.migrate(rec); err != nil {
+		return nil, err
+	}
+	rec.raw = raw
+	return rec, nil
+}
+
+func (m *Manager) decodeCodec(data []byte) (*record, error) {
+	rec := &record{}
+	err := m.codec().Decode(data, rec)
+	if err != nil {
+		vals := make(Values)
+		if err2 := m.codec().Decode(data, &vals); err2 != nil {
+			return nil, err
+		}
+		rec = &record{Values: vals}
+	}
+	if rec.Values == nil {
+		rec.Values = make(Values)
+	}
+	return rec, nil
+}
@@ -0,0 +1,69 @@
+package gomemssn
+
+import (
+	"strconv"
+	"testing"
+)
+
+// has no exported fields so gob and json can't handle it on their own
+type testMoney struct {
+	cents int64
+}
+
+func newTestHookCodecs() []Codec {
+	enc := func(v interface{}) ([]byte, error) {
+		return []byte(strconv.FormatInt(v.(testMoney).cents, 10)), nil
+	}
+	dec := func(data []byte) (interface{}, error) {
+		c, err := strconv.ParseInt(string(data), 10, 64)
+		return testMoney{cents: c}, err
+	}
+	g, j := &GobCodec{}, &JSONCodec{}
+	g.RegisterHook("money", testMoney{}, enc, dec)
+	j.RegisterHook("money", testMoney{}, enc, dec)
+	return []Codec{g, j}
+}
+
+func TestCodecHooks(t *testing.T) {
+
+	for _, c := range newTestHookCodecs() {
+
+		m := NewManager(nil, "gomemssn_test")
+		m.Codec = c
+
+		s := loadTestSession(t, m, "")
+		s.Values["price"] = testMoney{cents: 1999}
+		s.Values["v"] = "abc123"
+		if err := m.WriteSession(nil, s); err != nil {
+			t.Fatalf("%T: %v", c, err)
+		}
+		if _, ok := s.Values["price"].(testMoney); !ok {
+			t.Fatalf("%T: encoding should not change the session's values", c)
+		}
+
+		s = loadTestSession(t, m, s.Key)
+		if p, ok := s.Values["price"].(testMoney); !ok || p.cents != 1999 {
+			t.Fatalf("%T: expected price to round trip but got: %#v", c, s.Values["price"])
+		}
+		if v := s.Values.GetString("v"); v != "abc123" {
+			t.Fatalf("%T: expected v='abc123' but got: %v", c, v)
+		}
+
+	}
+
+}
+
+func BenchmarkGobCodec(b *testing.B) {
+	m := NewManager(nil, "bench")
+	rec := &record{Values: Values{"user": "joe@example.com", "n": 42, "cart": []string{"a", "b", "c"}}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, err := m.encodeRecord(rec)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := m.decodeRecord(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package gomemssn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// With Manager.CompressThreshold set, encoded sessions (and heavy values) of
+// at least that many bytes are gzipped before going to the backing store,
+// if that makes them smaller.  Compressed data is compressMagic followed by
+// the gzip stream; like frameMagic it can't be the start of codec output,
+// so uncompressed data is read as before.
+
+const compressMagic = "\x00GMZ"
+
+// compress returns b gzipped and marked if it is worth it, b otherwise
+func (m *Manager) compress(b []byte) ([]byte, error) {
+	if m.CompressThreshold <= 0 || len(b) < m.CompressThreshold {
+		return b, nil
+	}
+	buf := getBuf()
+	defer putBuf(buf)
+	buf.WriteString(compressMagic)
+	zw := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(zw)
+	zw.Reset(buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() >= len(b) {
+		return b, nil
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// gzip writers and readers carry sizeable state, they are reused
+var (
+	gzipWriters = sync.Pool{New: func() interface{} {
+		zw, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+		return zw
+	}}
+	gzipReaders sync.Pool
+)
+
+// decompress undoes compress, data which isn't compressed is returned as is;
+// data decompressing to more than limit bytes (if > 0) is rejected
+func decompress(data []byte, limit int) ([]byte, error) {
+	if !strings.HasPrefix(string(data), compressMagic) {
+		return data, nil
+	}
+	br := bytes.NewReader(data[len(compressMagic):])
+	zr, _ := gzipReaders.Get().(*gzip.Reader)
+	var err error
+	if zr == nil {
+		zr, err = gzip.NewReader(br)
+	} else {
+		err = zr.Reset(br)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReaders.Put(zr)
+	if limit <= 0 {
+		return io.ReadAll(zr)
+	}
+	b, err := io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+	if err == nil && len(b) > limit {
+		err = fmt.Errorf("%w: decompresses to over %d bytes, MaxDecodeSize", ErrDecodeRejected, limit)
+	}
+	return b, err
+}
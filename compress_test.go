@@ -0,0 +1,61 @@
+package gomemssn
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.CompressThreshold = 1024
+	m.HeavyKeys = []string{"blob"}
+
+	s := loadTestSession(t, m, "")
+	s.Values["small"] = "x"
+	m.MustWriteSession(nil, s)
+	data, _, _ := m.get(s.Key)
+	if strings.HasPrefix(string(data), compressMagic) {
+		t.Fatalf("small session should not be compressed")
+	}
+
+	big := strings.Repeat("abcdefgh", 1000)
+	s.Values["big"] = big
+	s.Values["blob"] = big
+	s.SetRaw("r", []byte("raw"))
+	m.MustWriteSession(nil, s)
+	data, _, _ = m.get(s.Key)
+	if !strings.HasPrefix(string(data), compressMagic) || len(data) > len(big)/4 {
+		t.Fatalf("expected a compressed record but got %d bytes", len(data))
+	}
+	data, _, _ = m.get(bucketKey(s.Key, "blob"))
+	if !strings.HasPrefix(string(data), compressMagic) {
+		t.Fatalf("expected a compressed heavy value")
+	}
+
+	s = loadTestSession(t, m, s.Key)
+	if s.Values["big"] != big || string(s.GetRaw("r")) != "raw" {
+		t.Fatalf("compressed session not read back")
+	}
+	if v, err := s.Bucket("blob").Load(context.Background()); err != nil || v != big {
+		t.Fatalf("compressed heavy value not read back: %v", err)
+	}
+
+}
+
+func BenchmarkCompress(b *testing.B) {
+	m := NewManager(nil, "bench")
+	m.CompressThreshold = 1024
+	data := []byte(strings.Repeat("some session data ", 1000))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		z, err := m.compress(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := decompress(z, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package gomemssn
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ConflictStrategy says what WriteSession does when the session was changed in
+// the backing store by someone else (usually a parallel request from the
+// same browser) since we read it
+type ConflictStrategy int
+
+const (
+	ConflictDefault       ConflictStrategy = iota // use the Manager's OnConflict (only meaningful on Session)
+	ConflictLastWriteWins                         // just overwrite whatever is there, no CAS is done
+	ConflictFail                                  // return a *ConflictError
+	ConflictMerge                                 // re-read, combine with Manager.Merge (and the sign-in state, see mergeMeta) and try again
+)
+
+// Merger combines the values this request wants to write (mine) with the ones
+// some other request wrote in the meantime (theirs), the result is written
+// instead of mine.  It may modify and return either map.
+type Merger func(mine, theirs Values) Values
+
+// MergeChanges returns a Merger which applies to theirs only the keys that
+// mine set, changed or deleted compared to base (what was originally read),
+// so parallel requests touching different keys (tab A sets prefs, tab B sets
+// the cart) both survive.  If both changed the same key, mine wins.
+func MergeChanges(base Values) Merger {
+	return func(mine, theirs Values) Values {
+		for k, v := range mine {
+			if bv, ok := base[k]; !ok || !reflect.DeepEqual(bv, v) {
+				theirs[k] = v
+			}
+		}
+		for k := range base {
+			if _, ok := mine[k]; !ok {
+				delete(theirs, k)
+			}
+		}
+		return theirs
+	}
+}
+
+// mergeMeta brings the sign-in state (UserID and LastAuthenticatedAt) theirs
+// has over to mine if mine didn't change it since base, so a write doesn't
+// undo a login or logout done by a parallel request; false if both changed
+// it differently.  The later CookieIssuedAt is kept.
+func mergeMeta(mine *Meta, base, theirs Meta) bool {
+	ours := !sameSignIn(*mine, base)
+	if ours && !sameSignIn(theirs, base) && !sameSignIn(*mine, theirs) {
+		return false
+	}
+	if !ours {
+		mine.UserID, mine.LastAuthenticatedAt = theirs.UserID, theirs.LastAuthenticatedAt
+	}
+	if theirs.CookieIssuedAt.After(mine.CookieIssuedAt) {
+		mine.CookieIssuedAt = theirs.CookieIssuedAt
+	}
+	return true
+}
+
+func sameSignIn(a, b Meta) bool {
+	return a.UserID == b.UserID && a.LastAuthenticatedAt.Equal(b.LastAuthenticatedAt)
+}
+
+// ErrSessionConflict can be used with errors.Is to detect a *ConflictError
+var ErrSessionConflict = errors.New("gomemssn: session was modified concurrently")
+
+// ConflictError is returned by WriteSession when a concurrent modification was
+// detected and could not be resolved
+type ConflictError struct {
+	Key      string // key of the session that could not be written
+	Attempts int    // how many times we tried
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%v (gave up after %d attempt(s))", ErrSessionConflict, e.Attempts)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrSessionConflict
+}
+
+// returns the strategy in effect for writing s
+func (m *Manager) conflictStrategy(s *Session) ConflictStrategy {
+	if s.OnConflict != ConflictDefault {
+		return s.OnConflict
+	}
+	if m.OnConflict != ConflictDefault {
+		return m.OnConflict
+	}
+	return ConflictLastWriteWins
+}
@@ -0,0 +1,164 @@
+package gomemssn
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// loads the session with the given key, like a request from a browser that has the cookie
+func loadTestSession(t *testing.T, m *Manager, key string) *Session {
+	r := httptest.NewRequest("GET", "/", nil)
+	if key != "" {
+		r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: key})
+	}
+	s, err := m.Session(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestConflictFail(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.OnConflict = ConflictFail
+
+	s := loadTestSession(t, m, "")
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+
+	a := loadTestSession(t, m, s.Key)
+	b := loadTestSession(t, m, s.Key)
+	a.Values["a"] = "1"
+	b.Values["b"] = "2"
+	if err := m.WriteSession(nil, a); err != nil {
+		t.Fatal(err)
+	}
+	err := m.WriteSession(nil, b)
+	if !errors.Is(err, ErrSessionConflict) {
+		t.Fatalf("expected conflict but got: %v", err)
+	}
+
+	// per session override
+	b.OnConflict = ConflictLastWriteWins
+	if err := m.WriteSession(nil, b); err != nil {
+		t.Fatal(err)
+	}
+	if v := loadTestSession(t, m, s.Key).Values.GetString("b"); v != "2" {
+		t.Fatalf("expected b='2' but got: %v", v)
+	}
+
+}
+
+func TestConflictMerge(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.OnConflict = ConflictMerge
+
+	s := loadTestSession(t, m, "")
+	s.Values["x"] = "0"
+	s.Values["y"] = "0"
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+
+	a := loadTestSession(t, m, s.Key)
+	b := loadTestSession(t, m, s.Key)
+	a.Values["a"] = "1"
+	a.Values["x"] = "1"
+	delete(a.Values, "y")
+	b.Values["b"] = "2"
+	if err := m.WriteSession(nil, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteSession(nil, b); err != nil {
+		t.Fatal(err)
+	}
+
+	s = loadTestSession(t, m, s.Key)
+	if s.Values.GetString("a") != "1" || s.Values.GetString("b") != "2" || s.Values.GetString("x") != "1" {
+		t.Fatalf("expected both requests' changes to survive but got: %v", s.Values)
+	}
+	if _, ok := s.Values["y"]; ok {
+		t.Fatalf("expected y to stay deleted but got: %v", s.Values)
+	}
+
+}
+
+func TestConflictMergeParallel(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.OnConflict = ConflictMerge
+	m.ConflictRetries = 100
+
+	s := loadTestSession(t, m, "")
+	m.MustWriteSession(nil, s)
+
+	// like a page firing off several ajax requests at once
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := httptest.NewRequest("POST", "/", nil)
+			r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+			s, err := m.Session(httptest.NewRecorder(), r)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			s.Values[fmt.Sprint(i)] = i
+			if err := m.WriteSession(nil, s); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s = loadTestSession(t, m, s.Key)
+	if len(s.Values) != 8 {
+		t.Fatalf("expected all 8 requests' values to survive but got: %v", s.Values)
+	}
+
+}
+
+func TestConflictMergeMeta(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.OnConflict = ConflictMerge
+
+	s := loadTestSession(t, m, "")
+	s.Values["x"] = "0"
+	m.MustWriteSession(nil, s)
+
+	// one tab signs in while another puts something in the cart
+	a := loadTestSession(t, m, s.Key)
+	b := loadTestSession(t, m, s.Key)
+	a.SetUserID("joe")
+	b.Values["cart"] = "1"
+	m.MustWriteSession(nil, a)
+	m.MustWriteSession(nil, b)
+	s = loadTestSession(t, m, s.Key)
+	if s.UserID() != "joe" || s.Values.GetString("cart") != "1" {
+		t.Fatalf("expected the login and the cart to survive but got %q %v", s.UserID(), s.Values)
+	}
+	if ss, err := m.SessionsForUser("joe"); err != nil || len(ss) != 1 {
+		t.Fatalf("expected the session in joe's index, got %v %v", ss, err)
+	}
+
+	// both sign in, as different users
+	a = loadTestSession(t, m, s.Key)
+	b = loadTestSession(t, m, s.Key)
+	a.SetUserID("ann")
+	b.SetUserID("bob")
+	m.MustWriteSession(nil, a)
+	if err := m.WriteSession(nil, b); !errors.Is(err, ErrSessionConflict) {
+		t.Fatalf("expected a conflict but got %v", err)
+	}
+
+}
@@ -0,0 +1,114 @@
+package gomemssn
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// IsHTTPS reports whether r reached us (or, if it came from one of
+// TrustedProxies, the proxy) over https, going by r.TLS and the
+// X-Forwarded-Proto header
+func (m *Manager) IsHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if ip := parseHeaderIP(r.RemoteAddr); ip == nil || !m.trusted(ip) {
+		return false
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// requestCookie applies the per request cookie settings (CookieDomain,
+// Partitioned, SecureAuto, CookieFunc) to c, a copy of TemplateCookie
+func (m *Manager) requestCookie(r *http.Request, c *http.Cookie) {
+	m.cookieDomain(r, c)
+	if m.Partitioned {
+		c.Partitioned = true
+		c.SameSite = http.SameSiteNoneMode
+	}
+	if m.SecureAuto {
+		c.Secure = m.IsHTTPS(r)
+	}
+	if m.CookieFunc != nil {
+		m.CookieFunc(r, c)
+	}
+	crossSiteSecure(c)
+}
+
+// cookieName is the name of the session cookie for r, TemplateCookie's unless
+// CookieFunc changes it
+func (m *Manager) cookieName(r *http.Request) string {
+	if m.CookieFunc == nil {
+		return m.TemplateCookie.Name
+	}
+	c := *m.TemplateCookie
+	m.CookieFunc(r, &c)
+	return c.Name
+}
+
+// crossSiteSecure marks c Secure if it is SameSite=None or Partitioned,
+// browsers drop such cookies otherwise (and so they only work over https)
+func crossSiteSecure(c *http.Cookie) {
+	if c.SameSite == http.SameSiteNoneMode || c.Partitioned {
+		c.Secure = true
+	}
+}
+
+// cookieDue reports whether the cookie of s has to be sent with this
+// response: it is new or changed (source is not SourceHit), its expiration
+// slides with every request (RollingCookie, SlidingExpiration), or it is
+// past half its MaxAge since it was last sent, so a session in use never
+// loses its cookie
+func (m *Manager) cookieDue(s *Session, source string) bool {
+	if m.AlwaysSetCookie || m.cookieFollowsExpiration() || source != SourceHit {
+		return true
+	}
+	if s.Cookie.MaxAge <= 0 {
+		// lasts as long as the browser session, or until a fixed time
+		return false
+	}
+	issued := s.Meta.CookieIssuedAt
+	return issued.IsZero() || m.now().Sub(issued) > time.Duration(s.Cookie.MaxAge)*time.Second/2
+}
+
+// cookieAged reports whether cookieDue goes by Meta.CookieIssuedAt for s,
+// it is only kept up to date then, to not make sessions dirty for nothing
+func (m *Manager) cookieAged(s *Session) bool {
+	return !m.AlwaysSetCookie && !m.cookieFollowsExpiration() && s.Cookie.MaxAge > 0
+}
+
+// cookieFollowsExpiration reports whether the cookie's MaxAge and Expires
+// are set from Expiration (instead of TemplateCookie) and it is sent again
+// with every response, see RollingCookie and SlidingExpiration
+func (m *Manager) cookieFollowsExpiration() bool {
+	return m.RollingCookie || m.SlidingExpiration
+}
+
+// maxCookieBytes is the most a cookie (name, value and attributes) may take,
+// it is all browsers promise to store
+const maxCookieBytes = 4096
+
+// ErrCookieTooBig is wrapped by the error for a cookie over maxCookieBytes
+var ErrCookieTooBig = errors.New("gomemssn: cookie over 4096 bytes")
+
+// checkCookie returns an error wrapping ErrCookieTooBig if c is too big to
+// be stored by browsers, unless OnCookieTooBig lets it through
+func (m *Manager) checkCookie(c *http.Cookie) error {
+	// attributes other than these are short, skip the formatting if far off
+	if len(c.Name)+len(c.Value)+len(c.Path)+len(c.Domain) < maxCookieBytes-200 {
+		return nil
+	}
+	n := len(c.String())
+	if n <= maxCookieBytes {
+		return nil
+	}
+	err := fmt.Errorf("%w: %s is %d bytes", ErrCookieTooBig, c.Name, n)
+	if m.OnCookieTooBig != nil {
+		return m.OnCookieTooBig(c, err)
+	}
+	return err
+}
@@ -0,0 +1,308 @@
+package gomemssn
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookieOptions(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.SecureAuto = true
+	m.TrustedProxies, _ = ParseTrustedProxies("10.0.0.1")
+	m.CookieFunc = func(r *http.Request, c *http.Cookie) {
+		if r.Host == "example.org" {
+			c.Domain = "example.org"
+		}
+	}
+
+	cookie := func(r *http.Request) *http.Cookie {
+		w := httptest.NewRecorder()
+		m.MustSession(w, r)
+		return w.Result().Cookies()[0]
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	c := cookie(r)
+	if !c.HttpOnly || c.SameSite != http.SameSiteLaxMode || c.Secure || c.Domain != "" {
+		t.Fatalf("unexpected cookie: %#v", c)
+	}
+
+	r = httptest.NewRequest("GET", "https://example.org/", nil)
+	r.TLS = &tls.ConnectionState{}
+	if c := cookie(r); !c.Secure || c.Domain != "example.org" {
+		t.Fatalf("expected a secure cookie for example.org: %#v", c)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	if c := cookie(r); c.Secure {
+		t.Fatalf("X-Forwarded-Proto from an untrusted client must be ignored")
+	}
+	r.RemoteAddr = "10.0.0.1:1234"
+	if c := cookie(r); !c.Secure {
+		t.Fatalf("expected X-Forwarded-Proto from a trusted proxy to count")
+	}
+
+	// embedded in other sites, Secure even over http
+	m.Partitioned = true
+	r = httptest.NewRequest("GET", "/", nil)
+	if c := cookie(r); !c.Partitioned || c.SameSite != http.SameSiteNoneMode || !c.Secure {
+		t.Fatalf("expected a partitioned SameSite=None secure cookie: %#v", c)
+	}
+	m.Partitioned = false
+	m.TemplateCookie.SameSite = http.SameSiteNoneMode
+	if c := cookie(r); c.Partitioned || !c.Secure {
+		t.Fatalf("expected a SameSite=None cookie to be secure: %#v", c)
+	}
+
+}
+
+func TestCookieOnlyWhenDue(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+
+	cookies := func() int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+		s = m.MustSession(w, r)
+		m.MustWriteSession(w, s)
+		return len(w.Result().Cookies())
+	}
+
+	if n := cookies(); n != 0 {
+		t.Fatalf("expected no Set-Cookie for an existing session, got %d", n)
+	}
+
+	// past half its MaxAge
+	s.Meta.CookieIssuedAt = time.Now().Add(-20 * time.Minute)
+	m.MustWriteSession(nil, s)
+	if n := cookies(); n != 1 {
+		t.Fatalf("expected the cookie to be refreshed")
+	}
+	if n := cookies(); n != 0 {
+		t.Fatalf("expected no Set-Cookie right after a refresh")
+	}
+
+	m.AlwaysSetCookie = true
+	if n := cookies(); n != 1 {
+		t.Fatalf("expected a Set-Cookie with AlwaysSetCookie")
+	}
+
+}
+
+func TestRollingCookie(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.Expiration = 2 * time.Hour
+	m.RollingCookie = true
+	s := loadTestSession(t, m, "")
+	m.MustWriteSession(nil, s)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	m.MustSession(w, r)
+	cs := w.Result().Cookies()
+	if len(cs) != 1 || cs[0].MaxAge != 7200 || time.Until(cs[0].Expires) < time.Hour {
+		t.Fatalf("expected the cookie to be sent with MaxAge following Expiration, got %v", cs)
+	}
+
+}
+
+func TestLazySessions(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.LazySessions = true
+
+	// nothing put in it: no cookie, nothing stored
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	m.MustWriteSession(w, s)
+	if len(w.Result().Cookies()) != 0 || m.stub.Len() != 0 {
+		t.Fatalf("expected no cookie and nothing stored for an empty session")
+	}
+
+	// the cookie comes with the first write
+	s.Values["v"] = "abc123"
+	w = httptest.NewRecorder()
+	m.MustWriteSession(w, s)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || m.stub.Len() != 1 {
+		t.Fatalf("expected a cookie and the session stored, got %v", cookies)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	if s2 := m.MustSession(httptest.NewRecorder(), r); s2.Values.GetString("v") != "abc123" {
+		t.Fatalf("session not found with the cookie: %v", s2.Values)
+	}
+
+}
+
+func TestCookieSize(t *testing.T) {
+
+	m := NewManager(nil, strings.Repeat("p", 300))
+	m.KeyLength = 16
+	m.HashKeyPrefix = true
+
+	s := loadTestSession(t, m, "")
+	if len(s.Key) != 24 {
+		t.Fatalf("expected a 24 character key but got %q", s.Key)
+	}
+	m.MustWriteSession(nil, s)
+	if k := m.storeKey(s.Key); len(k) != 36 {
+		t.Fatalf("expected the prefix to be hashed but got %q", k)
+	}
+
+	m.TemplateCookie.Path = "/" + strings.Repeat("d", 4000)
+	if _, err := m.Session(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); !errors.Is(err, ErrCookieTooBig) {
+		t.Fatalf("expected ErrCookieTooBig but got %v", err)
+	}
+	m.OnCookieTooBig = func(c *http.Cookie, err error) error {
+		c.Path = "/"
+		return nil
+	}
+	w := httptest.NewRecorder()
+	m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].Path != "/" {
+		t.Fatalf("expected the trimmed cookie, got %v", c)
+	}
+
+}
+
+func TestCookieFuncName(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.CookieFunc = func(r *http.Request, c *http.Cookie) {
+		if strings.HasPrefix(r.URL.Path, "/admin") {
+			c.Name, c.Path, c.Secure, c.MaxAge = c.Name+"_admin", "/admin", true, 300
+		}
+	}
+	visit := func(path string, c *http.Cookie) (*Session, *http.Cookie) {
+		r := httptest.NewRequest("GET", path, nil)
+		if c != nil {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s := m.MustSession(w, r)
+		m.MustWriteSession(w, s)
+		if cs := w.Result().Cookies(); len(cs) == 1 {
+			return s, cs[0]
+		}
+		return s, nil
+	}
+
+	admin, ac := visit("/admin/users", nil)
+	if ac == nil || ac.Name != m.TemplateCookie.Name+"_admin" || ac.Path != "/admin" || !ac.Secure || ac.MaxAge != 300 {
+		t.Fatalf("unexpected admin cookie %v", ac)
+	}
+	public, pc := visit("/", nil)
+	if pc == nil || pc.Name != m.TemplateCookie.Name || pc.Secure {
+		t.Fatalf("unexpected public cookie %v", pc)
+	}
+
+	// each is read back by its own name
+	if s, _ := visit("/admin/users", ac); s.Key != admin.Key {
+		t.Fatal("expected the admin session back")
+	}
+	if s, _ := visit("/about", pc); s.Key != public.Key {
+		t.Fatal("expected the public session back")
+	}
+	if s, _ := visit("/admin/users", pc); s.Key == public.Key {
+		t.Fatal("expected the public cookie not to be used for /admin")
+	}
+
+}
+
+func TestDuplicateCookies(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+	stale, err := m.cookieValue("stalekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stale one comes first, as a cookie with a longer path would
+	r := httptest.NewRequest("GET", "/app/page", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: stale})
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Cookie.Value})
+	w := httptest.NewRecorder()
+	s2 := m.MustSession(w, r)
+	if s2.Key != s.Key || s2.Values.GetString("v") != "abc123" {
+		t.Fatalf("expected the stored session, got %q %v", s2.Key, s2.Values)
+	}
+
+	cs := w.Result().Cookies()
+	if len(cs) < 2 {
+		t.Fatalf("expected the duplicates to be cleared, got %v", cs)
+	}
+	paths := map[string]bool{}
+	for _, c := range cs[:len(cs)-1] {
+		if c.MaxAge >= 0 || c.Value != "" {
+			t.Fatalf("expected an expiring cookie but got %v", c)
+		}
+		paths[c.Path] = true
+	}
+	if !paths["/app/page"] || !paths["/app"] || !paths["/"] {
+		t.Fatalf("expected the request path and its parents cleared, got %v", cs)
+	}
+	if last := cs[len(cs)-1]; last.Value != s.Cookie.Value || last.Path != m.TemplateCookie.Path {
+		t.Fatalf("expected the session cookie to go out last, got %v", last)
+	}
+
+	// a single cookie is left alone
+	r = httptest.NewRequest("GET", "/app/page", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Cookie.Value})
+	w = httptest.NewRecorder()
+	m.MustSession(w, r)
+	if cs := w.Result().Cookies(); len(cs) != 0 {
+		t.Fatalf("expected no cookies but got %v", cs)
+	}
+
+}
+
+func TestDuplicateCookiesCapped(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.SigningKey = []byte("0123456789abcdef0123456789abcdef")
+	s := loadTestSession(t, m, "")
+	m.MustWriteSession(nil, s)
+
+	request := func(stale int) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: "forged"})
+		for i := 0; i < stale; i++ {
+			v, err := m.cookieValue(fmt.Sprintf("stalekey%d", i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: v})
+		}
+		r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Cookie.Value})
+		return r
+	}
+
+	// forged cookies don't count, stale ones do
+	if got := m.cookieToken(request(maxCookieCandidates - 1)); got != s.Cookie.Value {
+		t.Fatalf("expected the stored session's cookie but got %q", got)
+	}
+	got := m.cookieToken(request(maxCookieCandidates))
+	if key, _, _ := m.parseCookie(got); key != "stalekey0" {
+		t.Fatalf("expected the first genuine cookie but got %q", key)
+	}
+
+}
@@ -0,0 +1,90 @@
+package gomemssn
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash/crc32"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CookieCodec turns session keys into cookie values and back, for cookies
+// other frameworks can read or write while an application moves over to (or
+// away from) this package.  With Manager.CookieCodec set it is used instead
+// of SigningKey's format; EncryptionKey still applies on top of it.
+type CookieCodec interface {
+	// EncodeKey returns the cookie value for key
+	EncodeKey(key string) string
+	// DecodeKey returns the key in value, ok is false if value is not
+	// valid (it is then reported as tampered, see AuditTamper)
+	DecodeKey(value string) (key string, ok bool)
+}
+
+// RawCookieCodec puts the key in the cookie as is, what is done without
+// SigningKey
+type RawCookieCodec struct{}
+
+func (RawCookieCodec) EncodeKey(key string) string {
+	return key
+}
+
+func (RawCookieCodec) DecodeKey(value string) (string, bool) {
+	return value, true
+}
+
+// ChecksumCookieCodec writes base64(key) + "." + a CRC-32 of the key, so
+// cookies mangled on the way are told apart from unknown keys without a trip
+// to the backing store; unlike SigningKey it doesn't stop forgery
+type ChecksumCookieCodec struct{}
+
+func (ChecksumCookieCodec) EncodeKey(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key)) + "." + strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(key))), 36)
+}
+
+func (ChecksumCookieCodec) DecodeKey(value string) (string, bool) {
+	enc, sum, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", false
+	}
+	key, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil || sum != strconv.FormatUint(uint64(crc32.ChecksumIEEE(key)), 36) {
+		return "", false
+	}
+	return string(key), true
+}
+
+// ExpressCookieCodec reads and writes cookies like express-session (with
+// cookie-signature) does: "s:" + key + "." + base64 HMAC-SHA256 of the key
+// with Secret, URL encoded.  Together with a Store and Codec which understand
+// each other's records, sessions can be shared with a Node.js application.
+type ExpressCookieCodec struct {
+	Secret []byte // express-session's secret
+}
+
+func (c ExpressCookieCodec) sign(key string) string {
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write([]byte(key))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c ExpressCookieCodec) EncodeKey(key string) string {
+	return url.QueryEscape("s:" + key + "." + c.sign(key))
+}
+
+func (c ExpressCookieCodec) DecodeKey(value string) (string, bool) {
+	v, err := url.QueryUnescape(value)
+	if err != nil || !strings.HasPrefix(v, "s:") {
+		return "", false
+	}
+	i := strings.LastIndexByte(v, '.')
+	if i < 2 {
+		return "", false
+	}
+	key, sig := v[2:i], v[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(c.sign(key))) {
+		return "", false
+	}
+	return key, true
+}
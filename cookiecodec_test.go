@@ -0,0 +1,37 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCookieCodecs(t *testing.T) {
+
+	// from cookie-signature's documentation
+	express := ExpressCookieCodec{Secret: []byte("tobiiscool")}
+	if v := express.EncodeKey("hello"); v != "s%3Ahello.DGDUkGlIkCzPz%2BC0B064FNgHdEjox7ch8tOBGslZ5QI" {
+		t.Fatalf("unexpected express cookie %q", v)
+	}
+
+	for _, c := range []CookieCodec{RawCookieCodec{}, ChecksumCookieCodec{}, express} {
+		m := NewManager(nil, "gomemssn_test")
+		m.CookieCodec = c
+		s := loadTestSession(t, m, "")
+		s.Values["v"] = "abc123"
+		m.MustWriteSession(nil, s)
+		if s.Cookie.Value != c.EncodeKey(s.Key) {
+			t.Fatalf("%T: cookie not encoded with the codec: %q", c, s.Cookie.Value)
+		}
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: s.Cookie.Name, Value: s.Cookie.Value})
+		if s2 := m.MustSession(httptest.NewRecorder(), r); s2.Key != s.Key {
+			t.Fatalf("%T: session not found from its cookie", c)
+		}
+		if _, ok := c.DecodeKey(s.Cookie.Value[:len(s.Cookie.Value)-1]); ok && c != (RawCookieCodec{}) {
+			t.Fatalf("%T: expected a mangled cookie to be rejected", c)
+		}
+	}
+
+}
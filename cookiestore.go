@@ -0,0 +1,67 @@
+package gomemssn
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// With Store set to a CookieStore there is no backing store at all: every
+// session is kept in its cookie, the way CookieFallback keeps the ones which
+// can't be written to the store (encrypted with EncryptionKey, which is
+// required).  That suits small deployments and edge functions, as long as
+// sessions stay small (they are limited to maxCookiePayload bytes encoded)
+// and it's fine that they can't be listed, revoked or destroyed other than
+// by the client dropping its cookie: DestroySession expires the cookie, but
+// a copy of it still works until the session would have expired.
+
+// ErrCookieOnly is returned when writing a session kept in its cookie (see
+// CookieStore) without a response to send the cookie with
+var ErrCookieOnly = errors.New("gomemssn: session is kept in its cookie and can only be written with a response")
+
+// CookieStore is the Store for sessions kept entirely in their cookies, the
+// Manager doesn't write anything to it and it remembers nothing
+type CookieStore struct{}
+
+func (CookieStore) Get(key string) ([]byte, error) {
+	return nil, ErrNotFound
+}
+
+func (CookieStore) Set(key string, data []byte, ttl time.Duration) error {
+	return nil
+}
+
+func (CookieStore) Delete(key string) error {
+	return nil
+}
+
+func (CookieStore) Touch(key string, ttl time.Duration) error {
+	return ErrNotFound
+}
+
+// cookieOnly reports whether the Store is a CookieStore
+func (m *Manager) cookieOnly() bool {
+	_, ok := unwrapStore(m.baseStore()).(CookieStore)
+	return ok
+}
+
+// writeCookie is writeSession with a CookieStore
+func (m *Manager) writeCookie(w http.ResponseWriter, s *Session) error {
+	if len(m.EncryptionKey) == 0 {
+		return errors.New("gomemssn: CookieStore needs an EncryptionKey")
+	}
+	if w == nil {
+		return ErrCookieOnly
+	}
+	m.recordChange(s)
+	ttl := m.ttl(m.expiration(s))
+	s.Meta.ExpiresAt = m.now().Add(ttl)
+	s.expiresAt = s.Meta.ExpiresAt
+	if err := m.cookieFallback(w, s, ErrSessionTooLarge); err != nil {
+		return err
+	}
+	s.snap, s.modified = s.Snapshot(), false
+	m.sendExpiresIn(w, s)
+	sessionHook(m.Hooks.OnWrite, s)
+	return nil
+}
@@ -0,0 +1,63 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookieStore(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now = clock.Now
+	m.Expiration = time.Hour
+	m.EncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+	m.Store = CookieStore{}
+
+	request := func(c *http.Cookie) (*httptest.ResponseRecorder, *Session) {
+		r := httptest.NewRequest("GET", "/", nil)
+		if c != nil {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		return w, m.MustSession(w, r)
+	}
+	sent := func(w *httptest.ResponseRecorder) *http.Cookie {
+		cookies := w.Result().Cookies()
+		if len(cookies) == 0 {
+			t.Fatal("expected a cookie")
+		}
+		return cookies[len(cookies)-1]
+	}
+
+	w, s := request(nil)
+	s.Values["a"] = "b"
+	m.MustWriteSession(w, s)
+	c := sent(w)
+
+	w, s2 := request(c)
+	if s2.Source() != SourceCookie || s2.Key != s.Key || s2.Values["a"] != "b" {
+		t.Fatalf("session not read from the cookie: %s %v", s2.Source(), s2.Values)
+	}
+	s2.Values["c"] = "d"
+	m.MustWriteSession(w, s2)
+	c = sent(w)
+
+	if err := m.WriteSession(nil, s2); err != ErrCookieOnly {
+		t.Fatalf("expected ErrCookieOnly but got %v", err)
+	}
+	s2.Values["big"] = strings.Repeat("x", 2*maxCookiePayload)
+	if err := m.WriteSession(httptest.NewRecorder(), s2); err != ErrSessionTooLarge {
+		t.Fatalf("expected ErrSessionTooLarge but got %v", err)
+	}
+
+	// the cookie is no good once the session expired
+	clock.Advance(2 * time.Hour)
+	if _, s3 := request(c); s3.Source() != SourceMiss || len(s3.Values) != 0 {
+		t.Fatalf("expected a lapsed session, got %s %v", s3.Source(), s3.Values)
+	}
+
+}
@@ -0,0 +1,81 @@
+package gomemssn
+
+import (
+	"strconv"
+	"time"
+)
+
+// Counters are numbers kept next to a session in the backing store, under
+// keys of their own, which Session.Incr adds to atomically: per session API
+// quotas, attempts, wizard steps and the like, which as Values would need
+// the session locked (see LockSessions) not to lose updates to concurrent
+// requests.  They are tied to the session key, so they start over after
+// RegenerateSession, and expire on their own (they are not removed by
+// DestroySession).
+
+func counterKey(key, name string) string {
+	return key + "#counter:" + name
+}
+
+// Incr adds delta (which may be negative) to the counter name of the session
+// and returns the result, counting from 0 if there is none; counters don't go
+// below 0.  A counter expires Expiration after it was created with stores
+// which implement IncrStore (memcache does), after it was last changed with
+// others.  With a quota per minute, say, put the minute in the name:
+//
+//	n, err := s.Incr("api:"+strconv.FormatInt(time.Now().Unix()/60, 10), 1)
+//	if err == nil && n > 100 {
+//		http.Error(w, "slow down", http.StatusTooManyRequests)
+//	}
+func (s *Session) Incr(name string, delta int64) (int64, error) {
+	if s.m == nil || s.ReadOnly() {
+		return 0, ErrReadOnly
+	}
+	return incr(s.m.store(), s.m.storeKey(counterKey(s.Key, name)), delta, s.m.expiration(s))
+}
+
+// Counter returns the counter name of the session, 0 if there is none
+func (s *Session) Counter(name string) (int64, error) {
+	if s.m == nil || s.skipped {
+		return 0, nil
+	}
+	data, err := s.m.store().Get(s.m.storeKey(counterKey(s.Key, name)))
+	if err == ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(data), 10, 64)
+}
+
+// incr adds delta to the counter key of st, with Incr if st has it
+func incr(st Store, key string, delta int64, ttl time.Duration) (int64, error) {
+	if is, ok := st.(IncrStore); ok {
+		return is.Incr(key, delta, ttl)
+	}
+	return casIncr(st, key, delta, ttl)
+}
+
+// casIncr is incr for stores without Incr: read, add and write back with cas
+// until no one else wrote in between (a plain Set, without CASStore)
+func casIncr(st Store, key string, delta int64, ttl time.Duration) (int64, error) {
+	for {
+		data, token, err := getCAS(st, key)
+		if err != nil && err != ErrNotFound {
+			return 0, err
+		}
+		n, _ := strconv.ParseInt(string(data), 10, 64)
+		n = max(n+delta, 0)
+		value := []byte(strconv.FormatInt(n, 10))
+		if cs, ok := st.(CASStore); ok {
+			err = cs.CompareAndSwap(key, value, token, ttl)
+		} else {
+			err = st.Set(key, value, ttl)
+		}
+		if err == nil {
+			return n, nil
+		} else if err != ErrCASConflict {
+			return 0, err
+		}
+	}
+}
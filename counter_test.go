@@ -0,0 +1,52 @@
+package gomemssn
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCounters(t *testing.T) {
+
+	for _, cas := range []bool{true, false} {
+
+		m := NewManager(nil, "gomemssn_test")
+		if !cas {
+			// without IncrStore, counters go through cas
+			m.Store = &ShadowStore{Old: m.stub, New: NewMemoryStore()}
+		}
+		s := loadTestSession(t, m, "")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := s.Incr("hits", 1); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if n, err := s.Counter("hits"); err != nil || n != 20 {
+			t.Fatalf("expected 20 hits but got %d, %v", n, err)
+		}
+		if n, err := s.Incr("hits", -25); err != nil || n != 0 {
+			t.Fatalf("expected the counter to stop at 0 but got %d, %v", n, err)
+		}
+		if n, _ := s.Counter("other"); n != 0 {
+			t.Fatalf("expected 0 for a missing counter but got %d", n)
+		}
+
+		// counters belong to the session
+		if n, _ := loadTestSession(t, m, "").Counter("hits"); n != 0 {
+			t.Fatalf("expected another session's counter to be 0 but got %d", n)
+		}
+
+		m.SetReadOnly(true)
+		if _, err := s.Incr("hits", 1); err != ErrReadOnly {
+			t.Fatalf("expected ErrReadOnly but got %v", err)
+		}
+
+	}
+
+}
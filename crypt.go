@@ -0,0 +1,214 @@
+package gomemssn
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// With Manager.EncryptionKey set the cookie value is the base64 of an AES-GCM
+// sealed (nonce first) blob, so the client can neither read nor change what's
+// in it.  Normally that is just the (signed, if there is a SigningKey) session
+// key, prefixed with 'k'.  With CookieFallback, when a session can't be
+// written to the backing store it is kept in the cookie instead: 'p', the
+// uvarint length of the signed key, the signed key, the varint Unix time the
+// session expires at, then the encoded session.  The store still has the last
+// word: the session is only read from the cookie while the store is
+// unavailable (see loadFirst), and the next successful write moves it back
+// there.  Once expired the copy in the cookie is ignored, so a cookie kept
+// (or replayed) from an outage doesn't bring the session back for good.
+
+// maxCookiePayload is the most bytes of encoded session CookieFallback puts in
+// a cookie, so the cookie stays under the 4KB browsers accept
+const maxCookiePayload = 2800
+
+func aead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("gomemssn: bad EncryptionKey: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns plain encrypted with EncryptionKey, nonce first
+func (m *Manager) seal(plain []byte) ([]byte, error) {
+	return sealWith(m.EncryptionKey, plain)
+}
+
+// sealWith is seal with key
+func sealWith(key, plain []byte) ([]byte, error) {
+	gcm, err := aead(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plain)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+// open undoes seal, with EncryptionKey or any of OldEncryptionKeys
+func (m *Manager) open(b []byte) ([]byte, bool) {
+	return openWith(b, append([][]byte{m.EncryptionKey}, m.OldEncryptionKeys...))
+}
+
+// openWith is open with the first of keys which works
+func openWith(b []byte, keys [][]byte) ([]byte, bool) {
+	for _, key := range keys {
+		gcm, err := aead(key)
+		if err != nil || len(b) < gcm.NonceSize() {
+			continue
+		}
+		if plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil); err == nil {
+			return plain, true
+		}
+	}
+	return nil, false
+}
+
+func (m *Manager) encrypt(plain []byte) (string, error) {
+	b, err := m.seal(plain)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (m *Manager) decrypt(value string) ([]byte, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, false
+	}
+	return m.open(b)
+}
+
+// With EncryptAtRest, session records and heavy values are sealed as well
+// before they go to the backing store: sealMagic, then the nonce and the
+// AES-GCM ciphertext.  Like compressMagic it can't be the start of codec
+// output, so sessions written before EncryptAtRest was turned on are still
+// read (until they expire), and rotating EncryptionKey (moving the old one
+// to OldEncryptionKeys) doesn't lose any.
+
+const sealMagic = "\x00GME"
+
+// sealStored encrypts data for the backing store if EncryptAtRest is on
+func (m *Manager) sealStored(data []byte) ([]byte, error) {
+	if !m.EncryptAtRest {
+		return data, nil
+	}
+	b, err := m.seal(data)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(sealMagic), b...), nil
+}
+
+// openStored undoes sealStored, data which isn't sealed is returned as is
+func (m *Manager) openStored(data []byte) ([]byte, error) {
+	if !strings.HasPrefix(string(data), sealMagic) {
+		return data, nil
+	}
+	plain, ok := m.open(data[len(sealMagic):])
+	if !ok {
+		return nil, errors.New("gomemssn: can't decrypt stored session, wrong EncryptionKey?")
+	}
+	return plain, nil
+}
+
+// cookieValue returns what the cookie for session key holds
+func (m *Manager) cookieValue(key string) (string, error) {
+	if len(m.EncryptionKey) == 0 || key == "" {
+		return m.signedValue(key), nil
+	}
+	return m.encrypt([]byte("k" + m.signedValue(key)))
+}
+
+// parseCookie returns the session key in a cookie value, the encoded session
+// if it was kept in the cookie and hasn't expired, and whether the value is genuine and the key
+// well formed (see validKey)
+func (m *Manager) parseCookie(value string) (string, []byte, bool) {
+
+	if len(m.EncryptionKey) == 0 {
+		key, ok := m.verifySigned(value)
+		return key, nil, ok && validKey(key)
+	}
+
+	plain, ok := m.decrypt(value)
+	if !ok || len(plain) == 0 {
+		return "", nil, false
+	}
+	var payload []byte
+	switch plain[0] {
+	case 'k':
+		value = string(plain[1:])
+	case 'p':
+		n, l := binary.Uvarint(plain[1:])
+		if l <= 0 || n > uint64(len(plain)-1-l) {
+			return "", nil, false
+		}
+		value = string(plain[1+l : 1+l+int(n)])
+		exp, el := binary.Varint(plain[1+l+int(n):])
+		if el <= 0 {
+			return "", nil, false
+		}
+		if m.now().Unix() < exp {
+			payload = plain[1+l+int(n)+el:]
+		}
+	default:
+		return "", nil, false
+	}
+	key, ok := m.verifySigned(value)
+	return key, payload, ok && validKey(key)
+
+}
+
+// cookieFallback tries to keep s in its cookie after writing it to the backing
+// store failed with err (nil if the write was skipped), returns err if it can't
+func (m *Manager) cookieFallback(w http.ResponseWriter, s *Session, err error) error {
+
+	if !m.CookieFallback && !m.cookieOnly() || len(m.EncryptionKey) == 0 || w == nil {
+		return err
+	}
+	b, e := m.encodeSession(s)
+	if e != nil || len(b) > maxCookiePayload {
+		return err
+	}
+	signed := m.signedValue(s.Key)
+	plain := append([]byte{'p'}, binary.AppendUvarint(nil, uint64(len(signed)))...)
+	plain = binary.AppendVarint(append(plain, signed...), m.now().Add(m.ttl(m.expiration(s))).Unix())
+	plain = append(plain, b...)
+	value, e := m.encrypt(plain)
+	if e != nil || m.checkCookie(&http.Cookie{Name: s.Cookie.Name, Value: value, Path: s.Cookie.Path, Domain: s.Cookie.Domain}) != nil {
+		return err
+	}
+
+	m.replaceCookie(w, s, value)
+	s.inCookie = true
+	m.sendCookie(w, s.Cookie)
+	s.debug.set(fmt.Sprintf("cookie %dB", len(b)))
+	return nil
+
+}
+
+// loadFirst reads the session key from the backing store for a cookie which
+// has the session in it as well (payload, see CookieFallback), and returns
+// the payload to use if the store is unavailable, otherwise nil and what the
+// store answered: found or not, it is more recent than a cookie the client
+// may have kept.  With a CookieStore there is nothing to read.
+func (m *Manager) loadFirst(key string, payload []byte) ([]byte, *loaded, error) {
+	if payload == nil || m.cookieOnly() {
+		return payload, nil, nil
+	}
+	l, err := m.load(key)
+	if errors.Is(err, ErrStoreUnavailable) {
+		return payload, nil, nil
+	}
+	return nil, l, err
+}
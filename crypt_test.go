@@ -0,0 +1,194 @@
+package gomemssn
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a store which fails all writes, like memcache being down
+type failStore struct{ Store }
+
+func (failStore) Set(key string, data []byte, ttl time.Duration) error {
+	return errors.New("store is down")
+}
+
+func TestEncryptedCookies(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.EncryptionKey = []byte("0123456789abcdef")
+	m.SigningKey = []byte("signing")
+
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["a"] = "b"
+	m.MustWriteSession(w, s)
+	c := w.Result().Cookies()[0]
+	if strings.Contains(c.Value, s.Key) {
+		t.Fatalf("session key visible in cookie: %q", c.Value)
+	}
+
+	get := func(value string) *Session {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: c.Name, Value: value})
+		return m.MustSession(httptest.NewRecorder(), r)
+	}
+	if s2 := get(c.Value); s2.Key != s.Key || s2.Values["a"] != "b" {
+		t.Fatalf("encrypted cookie not accepted")
+	}
+	for _, v := range []string{s.Key, m.signedValue(s.Key), c.Value[:len(c.Value)-2] + "AA", ""} {
+		if s2 := get(v); s2.Key == s.Key {
+			t.Fatalf("cookie %q should not give the session", v)
+		}
+	}
+
+	m.EncryptionKey = []byte("short")
+	if _, err := m.Session(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); err == nil {
+		t.Fatalf("expected an error for a bad EncryptionKey")
+	}
+
+}
+
+// a store which fails reads as well as writes
+type outageStore struct{ failStore }
+
+func (outageStore) Get(key string) ([]byte, error) {
+	return nil, errors.New("store is down")
+}
+
+func TestCookieFallback(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now, m.stub.Now = clock.Now, clock.Now
+	m.Expiration = time.Hour
+	m.EncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+	m.CookieFallback = true
+	m.Store = plainStore{outageStore{failStore{m.stub}}}
+
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["a"] = "b"
+	if err := m.WriteSession(w, s); err != nil {
+		t.Fatalf("expected the session to go in the cookie but got: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one cookie but got: %v", cookies)
+	}
+	c := cookies[0]
+	request := func(c *http.Cookie) (*httptest.ResponseRecorder, *Session) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(c)
+		w := httptest.NewRecorder()
+		return w, m.MustSession(w, r)
+	}
+
+	// read from the cookie while the store is down
+	_, s2 := request(c)
+	if s2.Source() != SourceCookie || s2.Key != s.Key || s2.Values["a"] != "b" {
+		t.Fatalf("session not read from cookie: %s %v", s2.Source(), s2.Values)
+	}
+	if s3, err := m.SessionFromToken(c.Value); err != nil || s3.Values["a"] != "b" {
+		t.Fatalf("session not read from the token: %v", err)
+	}
+
+	// the store is back and has never heard of it: the cookie is ignored
+	m.Store = nil
+	if _, s2 := request(c); s2.Source() != SourceMiss || len(s2.Values) != 0 {
+		t.Fatalf("expected the cookie to be ignored, got %s %v", s2.Source(), s2.Values)
+	}
+	if _, err := m.SessionFromToken(c.Value); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+
+	// or has a copy of its own, which wins
+	stored := m.newSession(s.Key)
+	stored.Values["a"] = "stored"
+	m.MustWriteSession(nil, stored)
+	w, s2 = request(c)
+	if s2.Source() != SourceHit || s2.Values["a"] != "stored" {
+		t.Fatalf("expected the stored session, got %s %v", s2.Source(), s2.Values)
+	}
+	s2.Values["a"] = "c"
+	m.MustWriteSession(w, s2)
+	cookies = w.Result().Cookies()
+	if key, payload, ok := m.parseCookie(cookies[len(cookies)-1].Value); !ok || key != s.Key || payload != nil {
+		t.Fatalf("session not removed from the cookie")
+	}
+
+	// down again, the cookie is only good until the session expires
+	m.Store = plainStore{outageStore{failStore{m.stub}}}
+	clock.Advance(59 * time.Minute)
+	if _, s2 := request(c); s2.Source() != SourceCookie {
+		t.Fatalf("expected the session from the cookie, got %s", s2.Source())
+	}
+	clock.Advance(2 * time.Minute)
+	if _, payload, ok := m.parseCookie(c.Value); !ok || payload != nil {
+		t.Fatalf("expected the expired session to be dropped from the cookie")
+	}
+	if _, err := m.SessionFromToken(c.Value); err == nil {
+		t.Fatalf("expected the expired cookie not to be used")
+	}
+
+	// too big for a cookie
+	s2.Values["big"] = strings.Repeat("x", 2*maxCookiePayload)
+	if err := m.WriteSession(httptest.NewRecorder(), s2); err == nil {
+		t.Fatalf("expected the write error for a session too big for the cookie")
+	}
+
+}
+
+func TestEncryptAtRest(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.HeavyKeys = []string{"big"}
+
+	// written before encryption was turned on
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "plaintext"
+	m.MustWriteSession(nil, s)
+	old := s.Key
+
+	m.EncryptionKey = []byte("0123456789abcdef")
+	m.EncryptAtRest = true
+	s = loadTestSession(t, m, "")
+	s.Values["v"] = "secret-value"
+	s.Values["big"] = "secret-heavy"
+	m.MustWriteSession(nil, s)
+	for _, k := range []string{s.Key, bucketKey(s.Key, "big")} {
+		data, err := m.stub.Get(m.storeKey(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "secret") || !strings.HasPrefix(string(data), sealMagic) {
+			t.Fatalf("expected %s sealed, got %q", k, data)
+		}
+	}
+
+	// rotated: the old key still reads it, the new one writes
+	m.OldEncryptionKeys = [][]byte{m.EncryptionKey}
+	m.EncryptionKey = []byte("fedcba9876543210")
+	s2, err := m.GetSessionByKey(s.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.loadBucket(s2, "big"); err != nil {
+		t.Fatal(err)
+	}
+	if s2.Values["v"] != "secret-value" || s2.Values["big"] != "secret-heavy" {
+		t.Fatalf("unexpected values: %v", s2.Values)
+	}
+	if s2, err = m.GetSessionByKey(old); err != nil || s2.Values["v"] != "plaintext" {
+		t.Fatalf("expected the unencrypted session still read, got %v", err)
+	}
+
+	m.OldEncryptionKeys = nil
+	if _, err := m.GetSessionByKey(s.Key); err == nil {
+		t.Fatalf("expected an error without the key the session was sealed with")
+	}
+
+}
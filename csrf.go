@@ -0,0 +1,129 @@
+package gomemssn
+
+import (
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+// csrfKey is where the CSRF token is kept in Values
+const csrfKey = "_csrf"
+
+// CSRFKey is the key of the CSRF token in Values, for keeping it with
+// Session.Clear
+const CSRFKey = csrfKey
+
+// where VerifyCSRF looks for the token submitted with a request
+const (
+	CSRFField  = "csrf_token"   // form field
+	CSRFHeader = "X-CSRF-Token" // request header, for scripts
+)
+
+// ErrCSRF is returned by VerifyCSRF for a request without the right token
+var ErrCSRF = errors.New("gomemssn: missing or wrong CSRF token")
+
+// CSRFToken returns the session's CSRF token, making one if it has none
+// yet; put it in forms as CSRFField (or send it as CSRFHeader) and check it
+// with VerifyCSRF.  The session has to be written if a token was made.
+func (s *Session) CSRFToken() (string, error) {
+	if t, ok := s.Values[csrfKey].(string); ok && t != "" {
+		return t, nil
+	}
+	b := make([]byte, 32)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	t := base64.RawURLEncoding.EncodeToString(b)
+	s.Values[csrfKey] = t
+	return t, nil
+}
+
+// CSRFCookieName returns the name of the cookie SetCSRFCookie sets,
+// TemplateCookie's name with "_csrf" appended
+func (m *Manager) CSRFCookieName() string {
+	return m.TemplateCookie.Name + "_csrf"
+}
+
+// SetCSRFCookie sends the session's CSRF token (see CSRFToken) in a cookie
+// scripts can read (CSRFCookieName), for single page apps doing the double
+// submit pattern: they copy it into the CSRFHeader of their requests, which
+// VerifyCSRF checks against the session.  The cookie holds nothing but the
+// token, the session key stays in its HttpOnly cookie.  The session has to
+// be written if a token was made.
+func (m *Manager) SetCSRFCookie(w http.ResponseWriter, r *http.Request, s *Session) error {
+	token, err := s.CSRFToken()
+	if err != nil {
+		return err
+	}
+	c := *m.TemplateCookie
+	if r != nil {
+		m.requestCookie(r, &c)
+	}
+	c.Name, c.Value, c.HttpOnly = m.CSRFCookieName(), token, false
+	if s.Cookie != nil {
+		c.MaxAge, c.Expires = s.Cookie.MaxAge, s.Cookie.Expires
+	}
+	dropCookie(w.Header(), c.Name)
+	http.SetCookie(w, &c)
+	return nil
+}
+
+// csrfSafe reports whether requests with method don't need a CSRF token,
+// they must not change anything
+func csrfSafe(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// VerifyCSRF returns ErrCSRF unless r (if its method is not GET, HEAD,
+// OPTIONS or TRACE) has the CSRF token of its session in the CSRFHeader
+// header or CSRFField form field.  The session is the one in the request
+// context, see Middleware.
+func (m *Manager) VerifyCSRF(r *http.Request) error {
+	if csrfSafe(r.Method) {
+		return nil
+	}
+	s := FromContext(r.Context())
+	if s == nil {
+		return errors.New("gomemssn: VerifyCSRF needs the session in the request context, see Middleware")
+	}
+	want, _ := s.Values[csrfKey].(string)
+	got := r.Header.Get(CSRFHeader)
+	if got == "" {
+		got = r.PostFormValue(CSRFField)
+	}
+	if want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return ErrCSRF
+	}
+	return nil
+}
+
+// RequireCSRF is middleware which answers requests VerifyCSRF rejects with a
+// 403.  The session is the one put in the request context by Middleware, if
+// used, otherwise it is loaded and put there.
+func (m *Manager) RequireCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if FromContext(r.Context()) == nil {
+			s, err := m.Session(w, r)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			r = r.WithContext(NewContext(r.Context(), s))
+		}
+
+		if err := m.VerifyCSRF(r); err != nil {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+
+	})
+}
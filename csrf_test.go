@@ -0,0 +1,101 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	var token string
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ = FromContext(r.Context()).CSRFToken()
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	cookie := w.Result().Cookies()[0]
+	if token == "" {
+		t.Fatal("expected a token")
+	}
+
+	ok := false
+	protected := m.Middleware(m.RequireCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { ok = true })))
+	post := func(form url.Values, header string) int {
+		ok = false
+		r := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header != "" {
+			r.Header.Set(CSRFHeader, header)
+		}
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := post(nil, ""); code != http.StatusForbidden || ok {
+		t.Fatalf("expected a 403 without a token, got %d", code)
+	}
+	if code := post(url.Values{CSRFField: {"wrong"}}, ""); code != http.StatusForbidden || ok {
+		t.Fatalf("expected a 403 with the wrong token, got %d", code)
+	}
+	if code := post(url.Values{CSRFField: {token}}, ""); code != http.StatusOK || !ok {
+		t.Fatalf("expected the form field to be accepted, got %d", code)
+	}
+	if code := post(nil, token); code != http.StatusOK || !ok {
+		t.Fatalf("expected the header to be accepted, got %d", code)
+	}
+
+	// a session without a token never passes
+	r := httptest.NewRequest("POST", "/", nil)
+	if err := m.VerifyCSRF(r.WithContext(NewContext(r.Context(), m.newSession("k")))); err != ErrCSRF {
+		t.Fatalf("expected ErrCSRF but got %v", err)
+	}
+
+}
+
+func TestCSRFCookie(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	var cookie *http.Cookie
+	h := m.Middleware(m.RequireCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := m.SetCSRFCookie(w, r, FromContext(r.Context())); err != nil {
+			t.Fatal(err)
+		}
+	})))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	var sess *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		switch c.Name {
+		case m.CSRFCookieName():
+			cookie = c
+		case m.TemplateCookie.Name:
+			sess = c
+		}
+	}
+	if cookie == nil || sess == nil || cookie.HttpOnly || cookie.Value == sess.Value {
+		t.Fatalf("expected a readable cookie with the token alone, got %v", w.Result().Cookies())
+	}
+
+	// the script sends it back in the header
+	for header, want := range map[string]int{cookie.Value: http.StatusOK, "": http.StatusForbidden, "wrong": http.StatusForbidden} {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.AddCookie(sess)
+		r.AddCookie(cookie)
+		if header != "" {
+			r.Header.Set(CSRFHeader, header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Fatalf("expected %d for header %q, got %d", want, header, w.Code)
+		}
+	}
+
+}
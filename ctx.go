@@ -0,0 +1,53 @@
+package gomemssn
+
+import (
+	"context"
+	"net/http"
+)
+
+// SessionCtx is Session, but gives up on the backing store once ctx is done
+// and returns ctx.Err(), so a slow or unreachable memcache node can't hold
+// up the handler for longer than the request's deadline
+func (m *Manager) SessionCtx(ctx context.Context, w http.ResponseWriter, r *http.Request) (*Session, error) {
+	s, err := m.withContext(ctx).Session(w, r)
+	if s != nil {
+		s.m = m
+	}
+	return s, err
+}
+
+// WriteSessionCtx is WriteSession, but gives up on the backing store once ctx
+// is done and returns ctx.Err().  The write may still happen after that.
+func (m *Manager) WriteSessionCtx(ctx context.Context, w http.ResponseWriter, s *Session) error {
+	return m.withContext(ctx).WriteSession(w, s)
+}
+
+// withContext returns a copy of m whose store round trips are abandoned when
+// ctx is done (or m itself if ctx can't be)
+func (m *Manager) withContext(ctx context.Context) *Manager {
+	if ctx.Done() == nil {
+		return m
+	}
+	m2 := *m
+	m2.Store = hookStore{st: m.baseStore(), do: ctxDo(ctx)}
+	return &m2
+}
+
+// ctxDo returns a hookStore hook which runs each operation in its own
+// goroutine and returns ctx.Err() if ctx is done first, leaving the
+// operation to finish (or time out) in the background
+func ctxDo(ctx context.Context) func(op string, f func() error) error {
+	return func(op string, f func() error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		done := make(chan error, 1)
+		go func() { done <- f() }()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
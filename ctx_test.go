@@ -0,0 +1,54 @@
+package gomemssn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blocks all reads until release is closed
+type slowStore struct {
+	*MemoryStore
+	release chan struct{}
+}
+
+func (ss slowStore) GetCAS(key string) ([]byte, interface{}, error) {
+	<-ss.release
+	return ss.MemoryStore.GetCAS(key)
+}
+
+func TestSessionCtx(t *testing.T) {
+
+	ss := slowStore{MemoryStore: NewMemoryStore(), release: make(chan struct{})}
+	defer close(ss.release)
+	m := NewManager(nil, "gomemssn_test")
+	m.Store = ss
+
+	// new sessions don't touch the store
+	s, err := m.SessionCtx(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Values["v"] = "abc123"
+	if err := m.WriteSessionCtx(context.Background(), nil, s); err != nil {
+		t.Fatal(err)
+	}
+	if s.m != m {
+		t.Fatalf("session should belong to m")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	start := time.Now()
+	if _, err := m.SessionCtx(ctx, httptest.NewRecorder(), r); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded but got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("took too long to give up")
+	}
+
+}
@@ -0,0 +1,53 @@
+package gomemssn
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// DebugHeader is the response header Manager.Debug adds, e.g.
+//
+//	X-Session-Debug: source=hit; read=212B; write=saved 230B
+//
+// source is new (no cookie), miss (cookie but nothing in the store), hit,
+// cookie (kept in the cookie, see CookieFallback), expired (replaced, see
+// AbsoluteExpiration), rejected (replaced, see Binding), corrupt (replaced,
+// see DecodeError), error (the store failed, see OnStoreError) or jwt, see
+// the Source constants.
+// The write part only makes it to the client if the session is written
+// before the handler starts writing the response.
+const DebugHeader = "X-Session-Debug"
+
+type debugInfo struct {
+	source string // one of the Source constants
+	read   int    // bytes read from the store
+	write  string // what happened on the last write, empty if there was none
+}
+
+// set records the outcome of a write, does nothing on a nil debugInfo
+func (d *debugInfo) set(write string) {
+	if d != nil {
+		d.write = write
+	}
+}
+
+// wrote fills in the write outcome (unless already set) and updates the header
+func (d *debugInfo) wrote(w http.ResponseWriter, s *Session, err error) {
+	if err != nil {
+		d.write = "failed"
+	} else if d.write == "" {
+		d.write = fmt.Sprintf("saved %dB", len(s.loaded))
+	}
+	if w != nil {
+		d.setHeader(w)
+	}
+	d.write = ""
+}
+
+func (d *debugInfo) setHeader(w http.ResponseWriter) {
+	v := fmt.Sprintf("source=%s; read=%dB", d.source, d.read)
+	if d.write != "" {
+		v += "; write=" + d.write
+	}
+	w.Header().Set(DebugHeader, v)
+}
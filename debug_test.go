@@ -0,0 +1,55 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugHeader(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.Debug = true
+
+	w := httptest.NewRecorder()
+	s, err := m.Session(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := w.Header().Get(DebugHeader); h != "source=new; read=0B" {
+		t.Fatalf("unexpected header: %q", h)
+	}
+	if err := m.WriteSession(w, s); err != nil {
+		t.Fatal(err)
+	}
+	if h := w.Header().Get(DebugHeader); !strings.Contains(h, "write=saved ") {
+		t.Fatalf("unexpected header: %q", h)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	s, err = m.Session(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := w.Header().Get(DebugHeader); !strings.HasPrefix(h, "source=hit; read=") || strings.HasPrefix(h, "source=hit; read=0B") {
+		t.Fatalf("unexpected header: %q", h)
+	}
+	m.SetReadOnly(true)
+	if err := m.WriteSession(w, s); err != nil {
+		t.Fatal(err)
+	}
+	if h := w.Header().Get(DebugHeader); !strings.HasSuffix(h, "write=skipped") {
+		t.Fatalf("unexpected header: %q", h)
+	}
+
+	m.Debug = false
+	w = httptest.NewRecorder()
+	m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	if h := w.Header().Get(DebugHeader); h != "" {
+		t.Fatalf("expected no header without Debug but got: %q", h)
+	}
+
+}
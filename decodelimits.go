@@ -0,0 +1,89 @@
+package gomemssn
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// What is in the backing store is trusted to be what WriteSession put there,
+// but with a shared or exposed memcache it might not be.  MaxDecodeSize stops
+// oversized (or decompressing to oversized) entries before they are decoded,
+// and AllowedTypes stops values of types the application doesn't expect
+// (gob makes whatever registered type an entry names).  Such sessions are
+// handled like any which can't be decoded, see DecodeError; their error
+// matches ErrDecodeRejected.
+
+// ErrDecodeRejected is what the DecodeError of a session MaxDecodeSize or
+// AllowedTypes rejected matches
+var ErrDecodeRejected = errors.New("gomemssn: session rejected by the decoding limits")
+
+// checkDecodeSize rejects data over MaxDecodeSize
+func (m *Manager) checkDecodeSize(data []byte) error {
+	if m.MaxDecodeSize > 0 && len(data) > m.MaxDecodeSize {
+		return fmt.Errorf("%w: %d bytes, MaxDecodeSize is %d", ErrDecodeRejected, len(data), m.MaxDecodeSize)
+	}
+	return nil
+}
+
+// checkTypes rejects vals if it holds values of types not in AllowedTypes
+func (m *Manager) checkTypes(vals Values) error {
+	if m.AllowedTypes == nil {
+		return nil
+	}
+	allowed := make(map[reflect.Type]bool, len(m.AllowedTypes))
+	for _, sample := range m.AllowedTypes {
+		allowed[reflect.TypeOf(sample)] = true
+	}
+	for k, v := range vals {
+		if t := disallowedType(v, allowed); t != nil {
+			return fmt.Errorf("%w: value %q holds a %v", ErrDecodeRejected, k, t)
+		}
+	}
+	return nil
+}
+
+// disallowedType returns the first type in v which is neither allowed, a
+// predeclared one, time.Time (see Values.SetTime) nor one of this package's,
+// nil if there is none
+func disallowedType(v interface{}, allowed map[reflect.Type]bool) reflect.Type {
+	switch x := v.(type) {
+	case nil, []byte, time.Time, hookedValue:
+		return nil
+	case []interface{}:
+		for _, e := range x {
+			if t := disallowedType(e, allowed); t != nil {
+				return t
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		for _, e := range x {
+			if t := disallowedType(e, allowed); t != nil {
+				return t
+			}
+		}
+		return nil
+	case []Flash:
+		for _, f := range x {
+			if t := disallowedType(f.Value, allowed); t != nil {
+				return t
+			}
+		}
+		return nil
+	}
+	t := reflect.TypeOf(v)
+	if allowed[t] {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
+		if t.PkgPath() == "" {
+			return nil
+		}
+	}
+	return t
+}
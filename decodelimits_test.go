@@ -0,0 +1,58 @@
+package gomemssn
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type allowedValue struct{ N int }
+type unexpectedValue struct{ S string }
+
+func init() {
+	MustRegisterType(allowedValue{}, unexpectedValue{})
+}
+
+func TestDecodeLimits(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.FailOnDecodeError = true
+	write := func(vals Values) string {
+		s := loadTestSession(t, m, "")
+		for k, v := range vals {
+			s.Values[k] = v
+		}
+		m.MustWriteSession(nil, s)
+		return s.Key
+	}
+
+	m.AllowedTypes = []interface{}{allowedValue{}}
+	ok := write(Values{"a": allowedValue{1}, "list": []interface{}{"x", 2.5}, "t": time.Now()})
+	if _, err := m.GetSessionByKey(ok); err != nil {
+		t.Fatalf("expected allowed types to decode, got %v", err)
+	}
+	bad := write(Values{"a": allowedValue{1}, "nested": map[string]interface{}{"u": unexpectedValue{"boom"}}})
+	if _, err := m.GetSessionByKey(bad); !errors.Is(err, ErrDecodeRejected) || !errors.Is(err, ErrDecodeFailed) {
+		t.Fatalf("expected ErrDecodeRejected, got %v", err)
+	}
+
+	m.AllowedTypes = nil
+	m.MaxDecodeSize = 1000
+	big := write(Values{"big": strings.Repeat("x", 2000)})
+	if _, err := m.GetSessionByKey(big); !errors.Is(err, ErrDecodeRejected) {
+		t.Fatalf("expected the big session rejected, got %v", err)
+	}
+	m.CompressThreshold = 100
+	zipped := write(Values{"big": strings.Repeat("x", 2000)})
+	if _, err := m.GetSessionByKey(zipped); !errors.Is(err, ErrDecodeRejected) {
+		t.Fatalf("expected the session decompressing too big rejected, got %v", err)
+	}
+
+	// with the default policy the session is replaced
+	m.FailOnDecodeError = false
+	if s := loadTestSession(t, m, big); s.Key == big || s.Values["big"] != nil {
+		t.Fatalf("expected a new session, got %v", s.Values)
+	}
+
+}
@@ -0,0 +1,112 @@
+package gomemssn
+
+import "net/http"
+
+// Cookies are normally put in the response header as soon as they are set,
+// so a handler which regenerates or destroys the session after Session sent
+// its cookie, or after the JWT went in, relies on each change taking back
+// the Set-Cookie before it.  A CookieWriter holds the session's cookies
+// (and its JWT's) back instead, keeping the last one set for each name,
+// path and domain, and only adds them to the header right before it goes
+// out.  Middleware uses one with Manager.DeferCookies; elsewhere wrap the
+// ResponseWriter with NewCookieWriter before calling Session.  Either way
+// it is found behind other ResponseWriters through their Unwrap method, the
+// way http.ResponseController finds what it needs.
+
+// CookieWriter is an http.ResponseWriter which adds the session cookies set
+// through it to the header only right before the header is sent (the first
+// WriteHeader, Write or Flush) or Finish is called
+type CookieWriter struct {
+	http.ResponseWriter
+	pending []*http.Cookie
+	sent    bool
+}
+
+// NewCookieWriter wraps w to hold the session cookies back, see CookieWriter
+func NewCookieWriter(w http.ResponseWriter) *CookieWriter {
+	return &CookieWriter{ResponseWriter: w}
+}
+
+// cookieWriter returns the CookieWriter which is or is wrapped by w, nil if
+// there is none
+func cookieWriter(w http.ResponseWriter) *CookieWriter {
+	for w != nil {
+		if cw, ok := w.(*CookieWriter); ok {
+			return cw
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+	return nil
+}
+
+// setCookie sets c on w, held back by its CookieWriter if it has one
+func setCookie(w http.ResponseWriter, c *http.Cookie) {
+	cw := cookieWriter(w)
+	if cw == nil || cw.sent {
+		http.SetCookie(w, c)
+		return
+	}
+	cp := *c
+	for i, p := range cw.pending {
+		if p.Name == c.Name && p.Path == c.Path && p.Domain == c.Domain {
+			cw.pending[i] = &cp
+			return
+		}
+	}
+	cw.pending = append(cw.pending, &cp)
+}
+
+// dropPending forgets the cookies named name held back for w
+func dropPending(w http.ResponseWriter, name string) {
+	cw := cookieWriter(w)
+	if cw == nil {
+		return
+	}
+	kept := cw.pending[:0]
+	for _, c := range cw.pending {
+		if c.Name != name {
+			kept = append(kept, c)
+		}
+	}
+	cw.pending = kept
+}
+
+// Finish adds the cookies held back to the header, if it wasn't sent yet;
+// call it once the handler is done (Middleware does), in case it never
+// writes anything.  Cookies set afterwards go in the header right away.
+func (cw *CookieWriter) Finish() {
+	if cw.sent {
+		return
+	}
+	cw.sent = true
+	for _, c := range cw.pending {
+		http.SetCookie(cw.ResponseWriter, c)
+	}
+	cw.pending = nil
+}
+
+func (cw *CookieWriter) WriteHeader(code int) {
+	cw.Finish()
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *CookieWriter) Write(b []byte) (int, error) {
+	cw.Finish()
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush sends the header with the cookies, and flushes the wrapped
+// ResponseWriter if it can
+func (cw *CookieWriter) Flush() {
+	cw.Finish()
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController
+func (cw *CookieWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,75 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeferCookies(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.DeferCookies = true
+	m.JWTKey = []byte("secret")
+	stale, err := m.cookieValue("stalekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var first string
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(w.Header()["Set-Cookie"]) != 0 {
+			t.Errorf("expected the cookies held back, got %v", w.Header()["Set-Cookie"])
+		}
+		s := FromContext(r.Context())
+		first = s.Key
+		s.SetUserID("u1")
+		if err := m.RegenerateSession(w, r, s); err != nil {
+			t.Error(err)
+		}
+		m.MustWriteSession(w, s)
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Error(err)
+		}
+		// too late to change the cookie now
+		if len(w.Header()["Set-Cookie"]) == 0 {
+			t.Error("expected the cookies in the header once flushed")
+		}
+	}))
+
+	r := httptest.NewRequest("GET", "/app", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: stale})
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: stale})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if !w.Flushed {
+		t.Fatal("expected the response flushed")
+	}
+
+	seen := map[string]int{}
+	var session, jwt *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		seen[c.Name+" "+c.Domain+" "+c.Path]++
+		switch {
+		case c.Name == m.jwtCookieName():
+			jwt = c
+		case c.Name == m.TemplateCookie.Name && c.Path == m.TemplateCookie.Path && c.Value != "":
+			session = c
+		}
+	}
+	for k, n := range seen {
+		if n > 1 {
+			t.Fatalf("expected one Set-Cookie for %s, got %d: %v", k, n, w.Header()["Set-Cookie"])
+		}
+	}
+	if session == nil || jwt == nil {
+		t.Fatalf("expected the session and JWT cookies, got %v", w.Header()["Set-Cookie"])
+	}
+	if key, _, _ := m.parseCookie(session.Value); key == first || key == "" {
+		t.Fatalf("expected the regenerated key, got %q", key)
+	}
+	if len(seen) < 3 {
+		t.Fatalf("expected the duplicates to be expired too, got %v", w.Header()["Set-Cookie"])
+	}
+
+}
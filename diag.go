@@ -0,0 +1,55 @@
+package gomemssn
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Diagnostics is how the session layer did for a request, for access logs
+// and for finding out whether slow requests are slow because of the
+// backing store, see Session.Diagnostics and WithDiagnostics
+type Diagnostics struct {
+	LoadDuration  time.Duration // reading the session, from the local cache or the backing store
+	WriteDuration time.Duration // writing it, all writes during the request together
+	CacheHit      bool          // the session came from the local read cache, see LocalCacheTTL
+}
+
+type diagnosticsKey struct{}
+
+// WithDiagnostics returns r with a Diagnostics which the sessions read for
+// it (or for requests derived from it) are accounted in, for access log
+// middleware outside Middleware to log once the request is done:
+//
+//	r, d := gomemssn.WithDiagnostics(r)
+//	next.ServeHTTP(w, r)
+//	log.Printf("%s session load=%v write=%v", r.URL.Path, d.LoadDuration, d.WriteDuration)
+func WithDiagnostics(r *http.Request) (*http.Request, *Diagnostics) {
+	d := &Diagnostics{}
+	return r.WithContext(context.WithValue(r.Context(), diagnosticsKey{}, d)), d
+}
+
+// requestDiagnostics returns the Diagnostics for the sessions of r
+func requestDiagnostics(r *http.Request) *Diagnostics {
+	if r != nil {
+		if d, ok := r.Context().Value(diagnosticsKey{}).(*Diagnostics); ok {
+			return d
+		}
+	}
+	return &Diagnostics{}
+}
+
+// Diagnostics returns how reading and writing the session went so far
+func (s *Session) Diagnostics() Diagnostics {
+	if s.diag == nil {
+		return Diagnostics{}
+	}
+	return *s.diag
+}
+
+// timeWrite adds the time since start to the write duration of s
+func timeWrite(s *Session, start time.Time) {
+	if s.diag != nil {
+		s.diag.WriteDuration += time.Since(start)
+	}
+}
@@ -0,0 +1,50 @@
+package gomemssn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDiagnostics(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.LocalCacheTTL = time.Minute
+
+	s := loadTestSession(t, m, "")
+	if d := s.Diagnostics(); d.CacheHit || d.LoadDuration != 0 || d.WriteDuration != 0 {
+		t.Fatalf("unexpected diagnostics for a new session: %+v", d)
+	}
+	s.Values["v"] = "abc123"
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Diagnostics().WriteDuration <= 0 {
+		t.Fatalf("expected the write to be timed")
+	}
+
+	if d := loadTestSession(t, m, s.Key).Diagnostics(); d.CacheHit || d.LoadDuration <= 0 {
+		t.Fatalf("expected a timed load from the store but got: %+v", d)
+	}
+	if err := m.Prefetch(context.Background(), []string{s.Key}); err != nil {
+		t.Fatal(err)
+	}
+	if d := loadTestSession(t, m, s.Key).Diagnostics(); !d.CacheHit {
+		t.Fatalf("expected a cache hit but got: %+v", d)
+	}
+
+	// an access log outside Middleware
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Values["n"] = 1.0
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	r, d := WithDiagnostics(r)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if !d.CacheHit || d.LoadDuration <= 0 || d.WriteDuration <= 0 {
+		t.Fatalf("unexpected request diagnostics: %+v", *d)
+	}
+
+}
@@ -0,0 +1,37 @@
+package gomemssn
+
+import (
+	"bytes"
+	"reflect"
+)
+
+// Whether a session changed is found by comparing Values, Meta and the raw
+// values with a Snapshot taken when it was read or last written.  Values
+// which are mutated in place (a slice element, a field of a pointer) are
+// shared with the snapshot so such changes can't be seen; call MarkModified
+// after making them, or turn on Manager.CanonicalEncoding to compare the
+// canonical forms instead.
+
+// MarkModified makes the next WriteSession write the session even if no
+// change to it can be seen, for values which were mutated in place
+func (s *Session) MarkModified() {
+	s.modified = true
+}
+
+// equal reports whether s has the values, metadata and raw values of snap
+func (snap *Snapshot) equal(s *Session) bool {
+	if snap.sum != nil {
+		return bytes.Equal(snap.sum, canonicalSum(s.Meta, s.Values, s.raw))
+	}
+	return reflect.DeepEqual(snap.values, s.Values) && reflect.DeepEqual(snap.meta, s.Meta) && reflect.DeepEqual(snap.raw, s.raw)
+}
+
+// changed reports whether s needs to be written.  New sessions always do, and
+// unchanged ones are still written once they are past half their lifetime,
+// so ones in use don't expire.
+func (m *Manager) changed(s *Session) bool {
+	if s.snap == nil || s.loaded == nil || s.modified || s.inCookie || !s.snap.equal(s) {
+		return true
+	}
+	return s.Meta.ExpiresAt.Sub(m.now()) < m.expiration(s)/2
+}
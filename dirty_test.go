@@ -0,0 +1,57 @@
+package gomemssn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSkipUnchangedWrites(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	writes := func() uint64 {
+		m.stub.mu.RLock()
+		defer m.stub.mu.RUnlock()
+		return m.stub.cas
+	}
+
+	s := loadTestSession(t, m, "")
+	m.MustWriteSession(nil, s) // new sessions are always written
+	s = loadTestSession(t, m, s.Key)
+	s.Values["a"] = []string{"x"}
+	m.MustWriteSession(nil, s)
+	if writes() != 2 {
+		t.Fatalf("expected 2 writes, got %d", writes())
+	}
+
+	s = loadTestSession(t, m, s.Key)
+	m.MustWriteSession(nil, s)
+	if writes() != 2 {
+		t.Fatalf("unchanged session was written")
+	}
+
+	s.Values["a"].([]string)[0] = "y"
+	m.MustWriteSession(nil, s)
+	if writes() != 2 {
+		t.Fatalf("in place change should not be seen")
+	}
+	s.MarkModified()
+	m.MustWriteSession(nil, s)
+	if writes() != 3 {
+		t.Fatalf("expected MarkModified to cause a write")
+	}
+
+	// past half its lifetime
+	s.Meta.ExpiresAt = time.Now().Add(m.Expiration / 3)
+	s.snap = s.Snapshot()
+	m.MustWriteSession(nil, s)
+	if writes() != 4 {
+		t.Fatalf("expected a session close to expiring to be written")
+	}
+
+	m.ForceWrite = true
+	m.MustWriteSession(nil, s)
+	if writes() != 5 {
+		t.Fatalf("expected ForceWrite to cause a write")
+	}
+
+}
@@ -0,0 +1,75 @@
+package gomemssn
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DomainPolicy returns the Domain to give the cookie on a request to host
+// (lowercase, without the port), "" to keep TemplateCookie's; see
+// Manager.CookieDomain
+type DomainPolicy func(host string) string
+
+// RegistrableDomain is a DomainPolicy which shares the cookie between all
+// subdomains of the registrable domain of the host: app.example.com and
+// api.example.com both get Domain=example.com.  That is the last two labels
+// of the host, or three if the last two are one of publicSuffixes (like
+// "co.uk", there is no public suffix list built in).  Hosts which are IP
+// addresses or have a single label (localhost) keep host-only cookies.
+func RegistrableDomain(publicSuffixes ...string) DomainPolicy {
+	return func(host string) string {
+		if net.ParseIP(host) != nil {
+			return ""
+		}
+		labels := strings.Split(host, ".")
+		n := 2
+		if len(labels) > 2 {
+			last2 := strings.Join(labels[len(labels)-2:], ".")
+			for _, ps := range publicSuffixes {
+				if strings.EqualFold(last2, ps) {
+					n = 3
+				}
+			}
+		}
+		if len(labels) < n {
+			return ""
+		}
+		return strings.Join(labels[len(labels)-n:], ".")
+	}
+}
+
+// AllowedDomains is a DomainPolicy which gives the cookie the first of
+// domains the host is or is a subdomain of, and keeps host-only cookies for
+// other hosts; unlike RegistrableDomain it only shares cookies between the
+// hosts meant to
+func AllowedDomains(domains ...string) DomainPolicy {
+	return func(host string) string {
+		for _, d := range domains {
+			d = strings.ToLower(strings.TrimPrefix(d, "."))
+			if host == d || strings.HasSuffix(host, "."+d) {
+				return d
+			}
+		}
+		return ""
+	}
+}
+
+// requestHost returns the host r was sent to, without the port
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// cookieDomain sets the Domain of c for r from CookieDomain
+func (m *Manager) cookieDomain(r *http.Request, c *http.Cookie) {
+	if m.CookieDomain == nil {
+		return
+	}
+	if d := m.CookieDomain(requestHost(r)); d != "" {
+		c.Domain = d
+	}
+}
@@ -0,0 +1,45 @@
+package gomemssn
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDomainPolicy(t *testing.T) {
+
+	rd := RegistrableDomain("co.uk")
+	ad := AllowedDomains("example.com", ".example.org")
+	for _, c := range []struct {
+		host, registrable, allowed string
+	}{
+		{"app.example.com", "example.com", "example.com"},
+		{"example.com", "example.com", "example.com"},
+		{"a.b.example.org", "example.org", "example.org"},
+		{"shop.example.co.uk", "example.co.uk", ""},
+		{"co.uk", "co.uk", ""},
+		{"notexample.com", "notexample.com", ""},
+		{"localhost", "", ""},
+		{"127.0.0.1", "", ""},
+		{"::1", "", ""},
+	} {
+		if d := rd(c.host); d != c.registrable {
+			t.Errorf("RegistrableDomain(%q) = %q, expected %q", c.host, d, c.registrable)
+		}
+		if d := ad(c.host); d != c.allowed {
+			t.Errorf("AllowedDomains(%q) = %q, expected %q", c.host, d, c.allowed)
+		}
+	}
+
+	m := NewManager(nil, "gomemssn_test")
+	m.CookieDomain = RegistrableDomain()
+	for _, host := range []string{"app.example.com", "API.example.com:8443"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = host
+		m.MustSession(w, r)
+		if cs := w.Result().Cookies(); len(cs) != 1 || cs[0].Domain != "example.com" {
+			t.Fatalf("expected a cookie for example.com on %s, got %v", host, cs)
+		}
+	}
+
+}
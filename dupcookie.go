@@ -0,0 +1,123 @@
+package gomemssn
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Proxies, older versions of an application and changes to the cookie's
+// Path or Domain can leave clients with several session cookies of the same
+// name, which they all send, and r.Cookie returns whichever comes first.
+// Session goes with the one whose session is in the store instead, clears
+// the others and sends the one it went with again, so the client is left
+// with just that.
+
+// maxCookieCandidates is how many genuine session cookies of a request are
+// looked up in the store, the client decides how many it sends; the others
+// are taken to be stale
+const maxCookieCandidates = 4
+
+// cookieTokens returns the values of all the session cookies of r
+func (m *Manager) cookieTokens(r *http.Request) []string {
+	name := m.cookieName(r)
+	var ret []string
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			ret = append(ret, c.Value)
+		}
+	}
+	return ret
+}
+
+// cookieToken returns the value of the session cookie of r; of several, the
+// first whose session is in the store (or in the cookie itself, see
+// CookieFallback) of the first maxCookieCandidates genuine ones, or else
+// the first genuine one
+func (m *Manager) cookieToken(r *http.Request) string {
+	tokens := m.cookieTokens(r)
+	switch len(tokens) {
+	case 0:
+		return ""
+	case 1:
+		return tokens[0]
+	}
+	ret, checked := "", 0
+	for _, t := range tokens {
+		key, payload, ok := m.parseCookie(t)
+		if !ok {
+			continue
+		}
+		if checked++; checked > maxCookieCandidates {
+			break
+		}
+		if payload != nil || m.stored(key) {
+			return t
+		}
+		if ret == "" {
+			ret = t
+		}
+	}
+	if ret == "" {
+		return tokens[0]
+	}
+	return ret
+}
+
+// stored reports whether the session key can be read from the store
+func (m *Manager) stored(key string) bool {
+	if m.cacheGet(key) != nil {
+		return true
+	}
+	_, _, err := m.get(key)
+	return err == nil
+}
+
+// duplicateCookies reports whether r has more than one session cookie and
+// token, the session token it goes by, is one of them
+func (m *Manager) duplicateCookies(r *http.Request, token string) bool {
+	tokens := m.cookieTokens(r)
+	if len(tokens) < 2 {
+		return false
+	}
+	for _, t := range tokens {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
+
+// expireDuplicates clears the session cookies the client may have besides
+// c: those for the request path and its parents, host-only and for the
+// domains of c and the request (cookies are sent without their Path and
+// Domain, so these are guesses); c has to go out after them
+func (m *Manager) expireDuplicates(w http.ResponseWriter, r *http.Request, c *http.Cookie) {
+
+	domain := strings.TrimPrefix(c.Domain, ".")
+	domains := []string{""}
+	for _, d := range []string{domain, requestHost(r)} {
+		if d != "" && d != domains[len(domains)-1] {
+			domains = append(domains, d)
+		}
+	}
+
+	var paths []string
+	for p := r.URL.Path; p != "" && p != "/"; p = p[:strings.LastIndex(p, "/")] {
+		paths = append(paths, p)
+	}
+	paths = append(paths, "/")
+
+	for _, p := range paths {
+		for _, d := range domains {
+			if p == c.Path && d == domain {
+				continue
+			}
+			e := *c
+			e.Path, e.Domain, e.Value = p, d, ""
+			e.MaxAge, e.Expires = -1, time.Unix(1, 0)
+			setCookie(w, &e)
+		}
+	}
+
+}
@@ -0,0 +1,45 @@
+// Package echosession is gomemssn's Middleware for Echo:
+//
+//	e := echo.New()
+//	e.Use(echosession.Middleware(m))
+//	e.GET("/", func(c echo.Context) error {
+//		s := echosession.Get(c)
+//		...
+//	})
+//
+// It does what Manager.Middleware does: the session is loaded before the
+// handler runs and written right before the response header goes out (or
+// once it is done).
+package echosession
+
+import (
+	"net/http"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware returns Echo middleware loading and writing sessions with m,
+// requests whose session can't be loaded get a 500
+func Middleware(m *gomemssn.Manager) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var err error
+			res := c.Response()
+			orig := res.Writer
+			m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// w wraps orig, writes through res go to it first
+				c.SetRequest(r)
+				res.Writer = w
+				err = next(c)
+				res.Writer = orig
+			})).ServeHTTP(orig, c.Request())
+			return err
+		}
+	}
+}
+
+// Get returns the session Middleware loaded for c, nil if there is none
+func Get(c echo.Context) *gomemssn.Session {
+	return gomemssn.FromContext(c.Request().Context())
+}
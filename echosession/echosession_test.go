@@ -0,0 +1,41 @@
+package echosession
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	m := gomemssn.NewManager(nil, "gomemssn_test")
+	e := echo.New()
+	e.Use(Middleware(m))
+	e.GET("/set", func(c echo.Context) error {
+		Get(c).Values["v"] = "abc123"
+		return c.String(http.StatusOK, "ok")
+	})
+	e.GET("/get", func(c echo.Context) error {
+		v, _ := Get(c).Values["v"].(string)
+		return c.String(http.StatusOK, v)
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/set", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a cookie but got %v", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/get", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	if w.Body.String() != "abc123" {
+		t.Fatalf("expected the session value but got %q", w.Body.String())
+	}
+
+}
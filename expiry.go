@@ -0,0 +1,197 @@
+package gomemssn
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// touch extends the expiration of s (and its heavy values) in the backing
+// store without rewriting it, see SlidingExpiration.  Failures are not
+// reported: the session was read fine and the next touch or write will
+// extend it anyway.
+func (m *Manager) touch(s *Session) {
+	ttl := m.ttl(m.expiration(s))
+	st := m.store()
+	if err := st.Touch(m.storeKey(s.Key), ttl); err != nil {
+		return
+	}
+	s.Meta.ExpiresAt = m.now().Add(ttl)
+	s.expiresAt = s.Meta.ExpiresAt
+	for _, name := range m.HeavyKeys {
+		st.Touch(m.storeKey(bucketKey(s.Key, name)), ttl)
+	}
+	if c, ok := s.cas.(*chunkedToken); ok {
+		for _, k := range c.keys {
+			st.Touch(m.storeKey(k), ttl)
+		}
+	}
+	m.indexSession(s, false)
+}
+
+// TouchSession extends the expiration of the session of r in the backing
+// store and sends its cookie again, without reading or rewriting the values:
+// for a heartbeat an idle single page app calls to keep the user signed in.
+// Returns ErrNotFound if r has no session or it is gone from the store, and
+// ErrReadOnly while writes are off.  Meta.ExpiresAt and the user index (see
+// Session.SetUserID) are only brought up to date by the next read or write.
+func (m *Manager) TouchSession(w http.ResponseWriter, r *http.Request) error {
+
+	if m.ReadOnly() || m.Degraded() {
+		return ErrReadOnly
+	}
+	token := m.requestToken(r)
+	if token == "" {
+		return ErrNotFound
+	}
+	key, payload, ok := m.parseCookie(token)
+	if !ok || key == "" {
+		return ErrNotFound
+	}
+
+	if payload == nil {
+		ttl := m.ttl(m.keyExpiration(key))
+		st := m.store()
+		if err := st.Touch(m.storeKey(key), ttl); err != nil {
+			return err
+		}
+		if m.ExpiresHeader != "" && w != nil {
+			// AbsoluteExpiration is in the Meta, which isn't read
+			w.Header().Set(m.ExpiresHeader, strconv.Itoa(int(ttl/time.Second)))
+		}
+		for _, name := range m.HeavyKeys {
+			st.Touch(m.storeKey(bucketKey(key, name)), ttl)
+		}
+		if m.chunkSize() > 0 && st.Touch(m.storeKey(key+chunkMarkSuffix), ttl) == nil {
+			// chunked: the chunk keys are in the manifest, which is read
+			// but not decoded
+			data, _, err := m.storeGet(key)
+			if err != nil {
+				return err
+			}
+			keys, _, _, _ := parseManifest(key, data)
+			for _, k := range keys {
+				st.Touch(m.storeKey(k), ttl)
+			}
+		}
+	}
+
+	s := m.newSession(key)
+	if m.AuthenticatedKeyPrefix != "" && strings.HasPrefix(key, m.AuthenticatedKeyPrefix) {
+		// the tier goes by the Meta we don't read, but the prefix tells
+		s.Meta.LastAuthenticatedAt = m.now()
+	}
+	m.sessionCookie(r, s)
+	s.cookie.Value = token
+	if w != nil {
+		m.sendCookie(w, s.Cookie)
+	}
+	return nil
+
+}
+
+// TouchHandler is an http.Handler calling TouchSession, it responds 204, or
+// 401 if there is no session to touch
+func (m *Manager) TouchHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch err := m.TouchSession(w, r); err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case ErrNotFound:
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		default:
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// ExpiresAt returns when the entry of the session in the backing store
+// expires: what the store says, if it is a TTLStore (asked the first time,
+// and brought up to date by writes), otherwise Meta.ExpiresAt as of the last
+// read or write.  Zero if the session isn't stored (yet), or doesn't expire.
+func (s *Session) ExpiresAt() time.Time {
+	if s.expiresAt.IsZero() && s.m != nil && !s.skipped && s.loaded != nil && !s.inCookie {
+		s.expiresAt = s.Meta.ExpiresAt
+		if ts, ok := s.m.baseStore().(TTLStore); ok {
+			var ttl time.Duration
+			err := s.m.storeOp("TTL", func() (err error) {
+				ttl, err = ts.TTL(s.m.storeKey(s.Key))
+				return err
+			})
+			if err == nil && ttl > 0 {
+				s.expiresAt = s.now().Add(ttl)
+			} else if err == nil {
+				s.expiresAt = time.Time{}
+			}
+		}
+	}
+	return s.expiresAt
+}
+
+// ExpiresIn returns how long the session has left: until its entry in the
+// backing store expires (see ExpiresAt, a new session has the whole
+// Expiration), or until AbsoluteExpiration, if that comes first
+func (s *Session) ExpiresIn() time.Duration {
+	if s.m == nil || s.skipped {
+		return 0
+	}
+	m, now := s.m, s.now()
+	exp := s.ExpiresAt()
+	if exp.IsZero() {
+		exp = now.Add(m.expiration(s))
+	}
+	if m.AbsoluteExpiration > 0 && !s.Meta.CreatedAt.IsZero() {
+		if abs := s.Meta.CreatedAt.Add(m.AbsoluteExpiration); abs.Before(exp) {
+			exp = abs
+		}
+	}
+	return max(exp.Sub(now), 0)
+}
+
+// sendExpiresIn sets ExpiresHeader on w to what s has left
+func (m *Manager) sendExpiresIn(w http.ResponseWriter, s *Session) {
+	if m.ExpiresHeader == "" || w == nil || s.skipped {
+		return
+	}
+	w.Header().Set(m.ExpiresHeader, strconv.Itoa(int(s.ExpiresIn()/time.Second)))
+}
+
+// tooOld reports whether s is past AbsoluteExpiration
+func (m *Manager) tooOld(s *Session) bool {
+	return m.AbsoluteExpiration > 0 && !s.Meta.CreatedAt.IsZero() && m.now().Sub(s.Meta.CreatedAt) > m.AbsoluteExpiration
+}
+
+// expire deletes s, which is tooOld, and returns a new session to use
+// instead (a detached one if r can't get a new session)
+func (m *Manager) expire(r *http.Request, s *Session) (*Session, error) {
+	s.req = r
+	sessionHook(m.Hooks.OnDestroy, s)
+	if !m.ReadOnly() {
+		if err := m.delSession(s.Key); err != nil {
+			return nil, err
+		}
+	}
+	m.audit(r, AuditDestroy, s, "absolute expiration")
+	if m.noCookie(r) {
+		return m.skippedSession(), nil
+	}
+	return m.freshSession()
+}
+
+// defaultRotateGrace is the RotateGrace used when it is 0
+const defaultRotateGrace = time.Minute
+
+// rotateDue reports whether the key of s is older than RotateEvery
+func (m *Manager) rotateDue(s *Session) bool {
+	return m.RotateEvery > 0 && !s.Meta.KeyIssuedAt.IsZero() && m.now().Sub(s.Meta.KeyIssuedAt) > m.RotateEvery
+}
+
+// rotate moves s to a new key because of RotateEvery
+func (m *Manager) rotate(w http.ResponseWriter, r *http.Request, s *Session) error {
+	grace := m.RotateGrace
+	if grace <= 0 {
+		grace = defaultRotateGrace
+	}
+	return m.regenerate(w, r, s, grace, "rotation")
+}
@@ -0,0 +1,292 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a Manager.Now which only moves when told to
+type testClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{t: time.Now()}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// records touches, and counts reads
+type touchStore struct {
+	*MemoryStore
+	touched []string
+	gets    int
+}
+
+func (ts *touchStore) GetCAS(key string) ([]byte, interface{}, error) {
+	ts.gets++
+	return ts.MemoryStore.GetCAS(key)
+}
+
+func (ts *touchStore) Touch(key string, ttl time.Duration) error {
+	ts.touched = append(ts.touched, key)
+	return ts.MemoryStore.Touch(key, ttl)
+}
+
+func TestSlidingExpiration(t *testing.T) {
+
+	clock := newTestClock()
+	ts := &touchStore{MemoryStore: NewMemoryStore()}
+	m := NewManager(nil, "gomemssn_test")
+	m.Store = ts
+	m.Now = clock.Now
+	m.SlidingExpiration = true
+	m.Expiration = time.Hour
+
+	s := loadTestSession(t, m, "")
+	m.MustWriteSession(nil, s)
+	if len(ts.touched) != 0 {
+		t.Fatalf("new session should not be touched")
+	}
+	exp := s.Meta.ExpiresAt
+
+	clock.Advance(time.Millisecond)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	s = m.MustSession(w, r)
+	if len(ts.touched) != 1 || ts.touched[0] != m.storeKey(s.Key) {
+		t.Fatalf("expected the session to be touched but got: %v", ts.touched)
+	}
+	if !s.Meta.ExpiresAt.After(exp) {
+		t.Fatalf("expected ExpiresAt to move")
+	}
+	if c := w.Result().Cookies()[0]; c.MaxAge != 3600 || c.Expires.IsZero() {
+		t.Fatalf("expected cookie lifetime to follow, got MaxAge=%d Expires=%v", c.MaxAge, c.Expires)
+	}
+	// touching doesn't make the session need a write
+	cas := ts.cas
+	m.MustWriteSession(nil, s)
+	if ts.cas != cas {
+		t.Fatalf("touched session was written")
+	}
+
+}
+
+func TestAbsoluteExpiration(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.AbsoluteExpiration = time.Hour
+
+	s := loadTestSession(t, m, "")
+	if s.Meta.CreatedAt.IsZero() {
+		t.Fatalf("CreatedAt not set")
+	}
+	s.Values["user"] = "joe"
+	m.MustWriteSession(nil, s)
+	if s2 := loadTestSession(t, m, s.Key); s2.Key != s.Key {
+		t.Fatalf("session should still be valid")
+	}
+
+	s.Meta.CreatedAt = time.Now().Add(-2 * time.Hour)
+	m.MustWriteSession(nil, s)
+	s2 := loadTestSession(t, m, s.Key)
+	if s2.Key == s.Key || len(s2.Values) != 0 {
+		t.Fatalf("expected a new session in place of the expired one")
+	}
+	if _, _, err := m.get(s.Key); err != ErrNotFound {
+		t.Fatalf("expired session not deleted: %v", err)
+	}
+
+}
+
+func TestTouchSession(t *testing.T) {
+
+	ts := &touchStore{MemoryStore: NewMemoryStore()}
+	m := NewManager(nil, "gomemssn_test")
+	m.Store = ts
+	m.ChunkSize = 100
+	m.Expiration = time.Hour
+
+	s := loadTestSession(t, m, "")
+	s.Values["big"] = strings.Repeat("x", 500)
+	m.MustWriteSession(nil, s)
+	ts.touched = nil
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/heartbeat", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	m.TouchHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	if len(ts.touched) < 3 || ts.touched[0] != m.storeKey(s.Key) {
+		t.Fatalf("expected the session and its chunks to be touched but got: %v", ts.touched)
+	}
+	if cs := w.Result().Cookies(); len(cs) != 1 || cs[0].Value != s.Key {
+		t.Fatalf("expected the cookie to be sent again, got %v", cs)
+	}
+
+	r = httptest.NewRequest("POST", "/heartbeat", nil)
+	if err := m.TouchSession(httptest.NewRecorder(), r); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound without a cookie but got %v", err)
+	}
+	if err := m.DestroySession(nil, loadTestSession(t, m, s.Key)); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/heartbeat", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	m.TouchHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("expected 401 and no cookie for a destroyed session, got %d", w.Code)
+	}
+
+	// a session which isn't chunked isn't read
+	m.ChunkSize = 0
+	s = loadTestSession(t, m, "")
+	s.Values["small"] = "x"
+	m.MustWriteSession(nil, s)
+	ts.gets = 0
+	r = httptest.NewRequest("POST", "/heartbeat", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	if err := m.TouchSession(httptest.NewRecorder(), r); err != nil {
+		t.Fatal(err)
+	}
+	if ts.gets != 0 {
+		t.Fatalf("expected no reads but got %d", ts.gets)
+	}
+
+}
+
+func TestSoftExpiration(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now = clock.Now
+	m.Expiration = time.Hour
+	m.SoftExpiration = 30 * time.Minute
+
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+
+	clock.Advance(20 * time.Minute)
+	s2 := loadTestSession(t, m, s.Key)
+	if s2.Stale || s2.Values["v"] != "abc123" {
+		t.Fatalf("expected a fresh session")
+	}
+	m.MustWriteSession(nil, s2)
+
+	clock.Advance(40 * time.Minute)
+	s2 = loadTestSession(t, m, s.Key)
+	if !s2.Stale || s2.Values["v"] != "abc123" {
+		t.Fatalf("expected the session served and flagged stale")
+	}
+
+	// used again, fresh again
+	m.MustWriteSession(nil, s2)
+	if s2 = loadTestSession(t, m, s.Key); s2.Stale {
+		t.Fatalf("expected the session fresh after it was used")
+	}
+
+}
+
+func TestExpiresHeader(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now = clock.Now
+	m.Expiration = time.Hour
+	m.AbsoluteExpiration = 90 * time.Minute
+	m.ExpiresHeader = "X-Session-Expires"
+
+	visit := func(key string) (*Session, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("GET", "/", nil)
+		if key != "" {
+			r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: key})
+		}
+		w := httptest.NewRecorder()
+		return m.MustSession(w, r), w
+	}
+
+	s, w := visit("")
+	if v := w.Header().Get("X-Session-Expires"); v != "3600" {
+		t.Fatalf("expected a new session to have an hour, got %q", v)
+	}
+	m.MustWriteSession(w, s)
+
+	clock.Advance(20 * time.Minute)
+	s2, w := visit(s.Key)
+	if v := w.Header().Get("X-Session-Expires"); v != "2400" {
+		t.Fatalf("expected 40 minutes left, got %q", v)
+	}
+	s2.Values["v"] = 1.0
+	m.MustWriteSession(w, s2)
+	if v := w.Header().Get("X-Session-Expires"); v != "3600" {
+		t.Fatalf("expected the write to renew the hour, got %q", v)
+	}
+
+	// AbsoluteExpiration comes first
+	clock.Advance(30 * time.Minute)
+	s3, w := visit(s.Key)
+	s3.Values["v"] = 2.0
+	m.MustWriteSession(w, s3)
+	if v := w.Header().Get("X-Session-Expires"); v != "2400" || s3.ExpiresIn() != 40*time.Minute {
+		t.Fatalf("expected 40 minutes left, got %q", v)
+	}
+
+	w = httptest.NewRecorder()
+	if err := m.DestroySession(w, s3); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Header().Get("X-Session-Expires"); v != "0" {
+		t.Fatalf("expected 0 after destroying the session, got %q", v)
+	}
+
+}
+
+func TestExpiresAtFromStore(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now, m.stub.Now = clock.Now, clock.Now
+	m.Expiration = time.Hour
+
+	s := loadTestSession(t, m, "")
+	if !s.ExpiresAt().IsZero() {
+		t.Fatalf("expected no expiry for a session not stored yet")
+	}
+	m.MustWriteSession(nil, s)
+	if !s.ExpiresAt().Equal(clock.Now().Add(time.Hour)) {
+		t.Fatalf("expected the write to set the expiry, got %v", s.ExpiresAt())
+	}
+
+	// shortened behind the session's back, the store knows better than Meta
+	if err := m.stub.Touch(m.storeKey(s.Key), 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	s2 := loadTestSession(t, m, s.Key)
+	if got := s2.ExpiresAt(); !got.Equal(clock.Now().Add(10 * time.Minute)) {
+		t.Fatalf("expected the store's expiry, got %v", got)
+	}
+	if s2.Meta.ExpiresAt.Equal(s2.ExpiresAt()) {
+		t.Fatalf("expected Meta.ExpiresAt to be the one of the last write")
+	}
+
+}
@@ -0,0 +1,168 @@
+package gomemssn
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Exported sessions are the line "gomemssn export <version>" followed by the
+// session (metadata, all values including heavy ones, raw values) gob
+// encoded, whatever Codec, compression or chunking the Manager uses; so
+// they can be imported by a Manager with a different backing store or
+// Codec.  Values have to be gob encodable, which with GobCodec they are
+// already, and JSONCodec's maps and slices are registered below.  With
+// CanonicalEncoding the values and raw values are written as lists sorted by
+// key and the metadata as JSON (version 2), so the same session exports the
+// same way every time, but for values which are maps themselves.
+
+// exportVersion is the version of the format ExportSession writes,
+// canonicalExportVersion the one with CanonicalEncoding
+const (
+	exportVersion          = 1
+	canonicalExportVersion = 2
+)
+
+const exportHeader = "gomemssn export "
+
+type exportRecord struct {
+	Meta   Meta
+	Values Values
+	Raw    map[string][]byte
+}
+
+// canonicalExport is exportRecord in a stable order
+type canonicalExport struct {
+	Meta   []byte // JSON, which sorts map keys
+	Values []exportValue
+	Raw    []exportRaw
+}
+
+type exportValue struct {
+	Key   string
+	Value interface{}
+}
+
+type exportRaw struct {
+	Key  string
+	Data []byte
+}
+
+func newCanonicalExport(s *Session) (*canonicalExport, error) {
+	meta, err := json.Marshal(s.Meta)
+	if err != nil {
+		return nil, err
+	}
+	rec := &canonicalExport{Meta: meta}
+	for k, v := range s.Values {
+		rec.Values = append(rec.Values, exportValue{Key: k, Value: v})
+	}
+	sort.Slice(rec.Values, func(i, j int) bool { return rec.Values[i].Key < rec.Values[j].Key })
+	for k, data := range s.raw {
+		rec.Raw = append(rec.Raw, exportRaw{Key: k, Data: data})
+	}
+	sort.Slice(rec.Raw, func(i, j int) bool { return rec.Raw[i].Key < rec.Raw[j].Key })
+	return rec, nil
+}
+
+// record returns what rec holds as an exportRecord
+func (rec *canonicalExport) record() (*exportRecord, error) {
+	ret := &exportRecord{Values: make(Values, len(rec.Values))}
+	if err := json.Unmarshal(rec.Meta, &ret.Meta); err != nil {
+		return nil, err
+	}
+	for _, v := range rec.Values {
+		ret.Values[v.Key] = v.Value
+	}
+	for _, r := range rec.Raw {
+		if ret.Raw == nil {
+			ret.Raw = make(map[string][]byte)
+		}
+		ret.Raw[r.Key] = r.Data
+	}
+	return ret, nil
+}
+
+func init() {
+	// what JSONCodec decodes objects and arrays to
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// ExportSession returns the session with key, heavy values included, in a
+// form ImportSession takes, for copying sessions between backing stores
+func (m *Manager) ExportSession(key string) ([]byte, error) {
+
+	s, err := m.GetSessionByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range m.HeavyKeys {
+		if _, err := s.Bucket(name).Load(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	version, rec := exportVersion, interface{}(exportRecord{Meta: s.Meta, Values: s.Values, Raw: s.raw})
+	if m.CanonicalEncoding {
+		if rec, err = newCanonicalExport(s); err != nil {
+			return nil, fmt.Errorf("gomemssn: exporting session: %w", err)
+		}
+		version = canonicalExportVersion
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(exportHeader + strconv.Itoa(version) + "\n")
+	if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+		return nil, fmt.Errorf("gomemssn: exporting session: %w", err)
+	}
+	return buf.Bytes(), nil
+
+}
+
+// ImportSession writes data from ExportSession as the session with key,
+// replacing the session there if any.  It gets a fresh expiration.
+func (m *Manager) ImportSession(key string, data []byte) error {
+
+	if m.ReadOnly() || m.Degraded() {
+		return ErrReadOnly
+	}
+
+	line, body, ok := strings.Cut(string(data), "\n")
+	if !ok || !strings.HasPrefix(line, exportHeader) {
+		return fmt.Errorf("gomemssn: not an exported session")
+	}
+	var rec *exportRecord
+	switch v, _ := strconv.Atoi(strings.TrimPrefix(line, exportHeader)); v {
+	case exportVersion:
+		rec = &exportRecord{}
+		if err := gob.NewDecoder(strings.NewReader(body)).Decode(rec); err != nil {
+			return fmt.Errorf("gomemssn: importing session: %w", err)
+		}
+	case canonicalExportVersion:
+		var ce canonicalExport
+		err := gob.NewDecoder(strings.NewReader(body)).Decode(&ce)
+		if err == nil {
+			rec, err = ce.record()
+		}
+		if err != nil {
+			return fmt.Errorf("gomemssn: importing session: %w", err)
+		}
+	default:
+		return fmt.Errorf("gomemssn: unsupported export version %q", strings.TrimPrefix(line, exportHeader))
+	}
+
+	s := m.newSession(key)
+	s.Meta, s.raw = rec.Meta, rec.Raw
+	if rec.Values != nil {
+		s.Values = rec.Values
+	}
+	s.OnConflict = ConflictLastWriteWins
+	return m.WriteSession(nil, s)
+
+}
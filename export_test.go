@@ -0,0 +1,58 @@
+package gomemssn
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+
+	src := NewManager(nil, "gomemssn_test")
+	src.HeavyKeys = []string{"search"}
+	src.CompressThreshold = 10
+
+	s := loadTestSession(t, src, "")
+	s.Values["v"] = "abc123"
+	s.Values["search"] = strings.Repeat("x", 1000)
+	s.SetRaw("blob", []byte{1, 2, 3})
+	s.SetUserID("joe")
+	src.MustWriteSession(nil, s)
+
+	data, err := src.ExportSession(s.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a different store and codec
+	dst := NewManager(nil, "other")
+	dst.Codec = &JSONCodec{}
+	dst.HeavyKeys = src.HeavyKeys
+	if err := dst.ImportSession(s.Key, data); err != nil {
+		t.Fatal(err)
+	}
+	s2, err := dst.GetSessionByKey(s.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2.Values.GetString("v") != "abc123" || s2.UserID() != "joe" || !s2.Meta.CreatedAt.Equal(s.Meta.CreatedAt) {
+		t.Fatalf("session not imported: %+v %v", s2.Meta, s2.Values)
+	}
+	if b := s2.GetRaw("blob"); len(b) != 3 {
+		t.Fatalf("raw value not imported: %v", b)
+	}
+	if v, _ := s2.Bucket("search").Load(context.Background()); len(v.(string)) != 1000 {
+		t.Fatalf("heavy value not imported")
+	}
+	if found, _ := dst.SessionsForUser("joe"); len(found) != 1 {
+		t.Fatalf("imported session not indexed for its user")
+	}
+
+	if err := dst.ImportSession("k", []byte("gomemssn export 99\n")); err == nil {
+		t.Fatalf("expected an error for an unknown version")
+	}
+	if _, err := src.ExportSession("missing"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+
+}
@@ -0,0 +1,129 @@
+// Package fasthttpsession is gomemssn's Middleware for fasthttp, sharing
+// Managers and stores with net/http services:
+//
+//	h := fasthttpsession.Middleware(m, func(ctx *fasthttp.RequestCtx) {
+//		s := fasthttpsession.Get(ctx)
+//		...
+//	})
+//	fasthttp.ListenAndServe(":8080", h)
+//
+// It does what Manager.Middleware does: the session is loaded before the
+// handler runs and written once it is done, before fasthttp sends the
+// response.  Manager methods which want the request or the response
+// (RegenerateSession, DestroySession...) take Request(ctx) and Writer(ctx).
+package fasthttpsession
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// userValueKey is the fasthttp user value holding the request's *adapter
+type userValueKey struct{}
+
+// adapter is what Middleware keeps for the handler
+type adapter struct {
+	r *http.Request
+	w http.ResponseWriter
+}
+
+// Middleware returns next wrapped to load and write sessions with m,
+// requests whose session can't be loaded get a 500
+func Middleware(m *gomemssn.Manager, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+
+		r := &http.Request{}
+		if err := fasthttpadaptor.ConvertRequest(ctx, r, true); err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+		detach(r)
+
+		w := &writer{ctx: ctx, header: make(http.Header)}
+		m.Middleware(http.HandlerFunc(func(sw http.ResponseWriter, r *http.Request) {
+			ctx.SetUserValue(userValueKey{}, &adapter{r: r, w: sw})
+			next(ctx)
+		})).ServeHTTP(w, r)
+		ctx.RemoveUserValue(userValueKey{})
+
+		// fasthttp sends nothing before the handler returns, so the
+		// headers can go in now that the session was written
+		for k, vs := range w.header {
+			if k != "Set-Cookie" {
+				ctx.Response.Header.Del(k)
+			}
+			for _, v := range vs {
+				ctx.Response.Header.Add(k, v)
+			}
+		}
+
+	}
+}
+
+// Get returns the session Middleware loaded for ctx, nil if there is none
+func Get(ctx *fasthttp.RequestCtx) *gomemssn.Session {
+	if r := Request(ctx); r != nil {
+		return gomemssn.FromContext(r.Context())
+	}
+	return nil
+}
+
+// Request returns the net/http version of the request in ctx Middleware
+// works with, nil outside of Middleware; like ctx it must not be kept once
+// the handler returned
+func Request(ctx *fasthttp.RequestCtx) *http.Request {
+	if a, ok := ctx.UserValue(userValueKey{}).(*adapter); ok {
+		return a.r
+	}
+	return nil
+}
+
+// Writer returns a ResponseWriter writing to ctx, through which Middleware
+// writes the session; headers set on it are added to the response of ctx
+// when the handler returns.  nil outside of Middleware.
+func Writer(ctx *fasthttp.RequestCtx) http.ResponseWriter {
+	if a, ok := ctx.UserValue(userValueKey{}).(*adapter); ok {
+		return a.w
+	}
+	return nil
+}
+
+// detach copies the strings of r which may end up in a session (the path in
+// Meta.History, the User-Agent...), ConvertRequest leaves them pointing into
+// memory fasthttp reuses for the next request
+func detach(r *http.Request) {
+	r.Method, r.Host, r.RequestURI = strings.Clone(r.Method), strings.Clone(r.Host), strings.Clone(r.RequestURI)
+	u := *r.URL
+	u.Path, u.RawPath, u.RawQuery = strings.Clone(u.Path), strings.Clone(u.RawPath), strings.Clone(u.RawQuery)
+	r.URL = &u
+	h := make(http.Header, len(r.Header))
+	for k, vs := range r.Header {
+		k = strings.Clone(k)
+		for _, v := range vs {
+			h[k] = append(h[k], strings.Clone(v))
+		}
+	}
+	r.Header = h
+}
+
+// writer is the http.ResponseWriter for ctx, keeping the header aside
+type writer struct {
+	ctx    *fasthttp.RequestCtx
+	header http.Header
+}
+
+func (w *writer) Header() http.Header {
+	return w.header
+}
+
+func (w *writer) WriteHeader(code int) {
+	w.ctx.SetStatusCode(code)
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	return w.ctx.Write(b)
+}
@@ -0,0 +1,63 @@
+package fasthttpsession
+
+import (
+	"testing"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/valyala/fasthttp"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	m := gomemssn.NewManager(nil, "gomemssn_test")
+	h := Middleware(m, func(ctx *fasthttp.RequestCtx) {
+		s := Get(ctx)
+		switch string(ctx.Path()) {
+		case "/set":
+			s.Values["v"] = "abc123"
+			ctx.SetBodyString("ok")
+		case "/destroy":
+			if err := m.DestroySession(Writer(ctx), s); err != nil {
+				t.Error(err)
+			}
+		default:
+			ctx.SetBodyString(s.Values.GetString("v"))
+		}
+	})
+
+	serve := func(path, cookie string) *fasthttp.RequestCtx {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(path)
+		if cookie != "" {
+			ctx.Request.Header.SetCookie(m.TemplateCookie.Name, cookie)
+		}
+		h(ctx)
+		return ctx
+	}
+
+	ctx := serve("/set", "")
+	if string(ctx.Response.Body()) != "ok" {
+		t.Fatalf("unexpected response: %q", ctx.Response.Body())
+	}
+	c := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(c)
+	c.SetKey(m.TemplateCookie.Name)
+	if !ctx.Response.Header.Cookie(c) || len(c.Value()) == 0 {
+		t.Fatalf("expected a cookie but got %q", ctx.Response.Header.Peek("Set-Cookie"))
+	}
+	key := string(c.Value())
+
+	if ctx := serve("/get", key); string(ctx.Response.Body()) != "abc123" {
+		t.Fatalf("expected the session value but got %q", ctx.Response.Body())
+	}
+
+	serve("/destroy", key)
+	if ctx := serve("/get", key); string(ctx.Response.Body()) != "" {
+		t.Fatalf("expected an empty session but got %q", ctx.Response.Body())
+	}
+
+	if Get(&fasthttp.RequestCtx{}) != nil {
+		t.Fatal("expected no session outside of Middleware")
+	}
+
+}
@@ -0,0 +1,109 @@
+package gomemssn
+
+import (
+	"encoding/gob"
+)
+
+// flashKey is where flash messages are kept in Values
+const flashKey = "_flashes"
+
+// common flash categories, any string can be used
+const (
+	FlashError   = "error"
+	FlashInfo    = "info"
+	FlashSuccess = "success"
+)
+
+// Flash is a flash message, see AddFlash
+type Flash struct {
+	Category string
+	Value    interface{}
+}
+
+func init() {
+	gob.RegisterName("gomemssn.Flashes", []Flash{})
+}
+
+// AddFlash adds a "flash message" in category (which may be "") to this
+// session - uses the key "_flashes"
+func (s *Session) AddFlash(category string, v interface{}) {
+	s.Values[flashKey] = append(s.flashes(), Flash{Category: category, Value: v})
+}
+
+// Flashes pops the "flash messages" in the given categories (all of them if
+// none are given) from this session
+func (s *Session) Flashes(category ...string) []interface{} {
+	var ret []interface{}
+	var rest []Flash
+	for _, f := range s.flashes() {
+		if inCategories(f.Category, category) {
+			ret = append(ret, f.Value)
+		} else {
+			rest = append(rest, f)
+		}
+	}
+	if len(rest) > 0 {
+		s.Values[flashKey] = rest
+	} else {
+		delete(s.Values, flashKey)
+	}
+	return ret
+}
+
+// PeekFlashes is Flashes without removing them
+func (s *Session) PeekFlashes(category ...string) []interface{} {
+	var ret []interface{}
+	for _, f := range s.flashes() {
+		if inCategories(f.Category, category) {
+			ret = append(ret, f.Value)
+		}
+	}
+	return ret
+}
+
+func inCategories(c string, categories []string) bool {
+	if len(categories) == 0 {
+		return true
+	}
+	for _, c2 := range categories {
+		if c == c2 {
+			return true
+		}
+	}
+	return false
+}
+
+// flashes returns a copy of the flash messages, also understanding ones
+// stored by older versions (values without category) and ones which went
+// through a codec that doesn't keep types (JSON)
+func (s *Session) flashes() []Flash {
+	switch f := s.Values[flashKey].(type) {
+	case []Flash:
+		return append([]Flash(nil), f...)
+	case []interface{}:
+		ret := make([]Flash, 0, len(f))
+		for _, v := range f {
+			switch v := v.(type) {
+			case Flash:
+				ret = append(ret, v)
+			default:
+				ret = append(ret, flashFromJSON(v))
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+// flashFromJSON turns what a Flash becomes after a round trip through JSON
+// back into one, anything else is a value without category
+func flashFromJSON(v interface{}) Flash {
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 2 {
+		c, ok1 := m["Category"].(string)
+		val, ok2 := m["Value"]
+		if ok1 && ok2 {
+			return Flash{Category: c, Value: val}
+		}
+	}
+	return Flash{Value: v}
+}
@@ -0,0 +1,46 @@
+package gomemssn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlashes(t *testing.T) {
+
+	for _, codec := range []Codec{&GobCodec{}, &JSONCodec{}} {
+
+		m := NewManager(nil, "gomemssn_test")
+		m.Codec = codec
+
+		s := loadTestSession(t, m, "")
+		s.AddFlash(FlashError, "bad")
+		s.AddFlash(FlashInfo, "fyi")
+		s.AddFlash(FlashError, "worse")
+		m.MustWriteSession(nil, s)
+
+		s = loadTestSession(t, m, s.Key)
+		if f := s.PeekFlashes(); len(f) != 3 {
+			t.Fatalf("%T: expected 3 flashes but got: %v", codec, f)
+		}
+		if f := s.Flashes(FlashError); !reflect.DeepEqual(f, []interface{}{"bad", "worse"}) {
+			t.Fatalf("%T: unexpected error flashes: %v", codec, f)
+		}
+		if f := s.Flashes(FlashError); len(f) != 0 {
+			t.Fatalf("%T: error flashes not consumed: %v", codec, f)
+		}
+		if f := s.Flashes(); !reflect.DeepEqual(f, []interface{}{"fyi"}) {
+			t.Fatalf("%T: unexpected flashes: %v", codec, f)
+		}
+		if _, ok := s.Values[flashKey]; ok {
+			t.Fatalf("%T: flashes key left behind", codec)
+		}
+
+	}
+
+	// as stored by older versions
+	s := &Session{Values: Values{flashKey: []interface{}{"old"}}}
+	if f := s.Flashes(); !reflect.DeepEqual(f, []interface{}{"old"}) {
+		t.Fatalf("unexpected flashes: %v", f)
+	}
+
+}
@@ -0,0 +1,76 @@
+// Package ginsession is gomemssn's Middleware for Gin:
+//
+//	r := gin.New()
+//	r.Use(ginsession.Middleware(m))
+//	r.GET("/", func(c *gin.Context) {
+//		s := ginsession.Get(c)
+//		...
+//	})
+//
+// It does what Manager.Middleware does: the session is loaded before the
+// handlers run and written right before the response header goes out (or
+// once they are done).
+package ginsession
+
+import (
+	"net/http"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware returns Gin middleware loading and writing sessions with m,
+// requests whose session can't be loaded are aborted with a 500
+func Middleware(m *gomemssn.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ran := false
+		m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ran = true
+			orig := c.Writer
+			c.Request = r
+			c.Writer = &writer{ResponseWriter: orig, sw: w.(*gomemssn.SessionWriter)}
+			c.Next()
+			c.Writer = orig
+		})).ServeHTTP(c.Writer, c.Request)
+		if !ran {
+			c.Abort()
+		}
+	}
+}
+
+// Get returns the session Middleware loaded for c, nil if there is none
+func Get(c *gin.Context) *gomemssn.Session {
+	return gomemssn.FromContext(c.Request.Context())
+}
+
+// writer sends what is written through the SessionWriter, so the session is
+// written before the header
+type writer struct {
+	gin.ResponseWriter
+	sw *gomemssn.SessionWriter
+}
+
+func (w *writer) WriteHeader(code int) {
+	w.sw.Finish()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *writer) WriteHeaderNow() {
+	w.sw.Finish()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	w.sw.Finish()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *writer) WriteString(s string) (int, error) {
+	w.sw.Finish()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *writer) Flush() {
+	w.sw.Finish()
+	w.ResponseWriter.Flush()
+}
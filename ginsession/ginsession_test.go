@@ -0,0 +1,41 @@
+package ginsession
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	m := gomemssn.NewManager(nil, "gomemssn_test")
+	r := gin.New()
+	r.Use(Middleware(m))
+	r.GET("/set", func(c *gin.Context) {
+		Get(c).Values["v"] = "abc123"
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/get", func(c *gin.Context) {
+		c.String(http.StatusOK, "%v", Get(c).Values["v"])
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/set", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a cookie but got %v", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/get", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "abc123" {
+		t.Fatalf("expected the session value but got %q", w.Body.String())
+	}
+
+}
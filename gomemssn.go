@@ -2,15 +2,19 @@
 package gomemssn
 
 import (
-	"bytes"
-	"crypto/rand"
+	"container/list"
+	crand "crypto/rand"
 	"encoding/base64"
-	"encoding/gob"
+	"errors"
 	"fmt"
 	"github.com/bradfitz/gomemcache/memcache"
 	"log"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,66 +24,494 @@ import (
 func NewManager(client *memcache.Client, keyPrefix string) *Manager {
 
 	if client == nil {
-		log.Printf("NOTE: Memcache client is nil, falling back to storing sessions in memory with no expiration! This should only occur in a development environment, not in production.")
+		log.Printf("NOTE: Memcache client is nil, falling back to storing sessions in memory! This should only occur in a development environment, not in production.")
 	}
 
-	return &Manager{
+	m := &Manager{
 		Expiration:        time.Minute * 30,
-		TemplateCookie:    &http.Cookie{Name: keyPrefix + "_gomemssn", Path: "/", MaxAge: 60 * 30},
+		TemplateCookie:    &http.Cookie{Name: keyPrefix + "_gomemssn", Path: "/", MaxAge: 60 * 30, HttpOnly: true, SameSite: http.SameSiteLaxMode},
 		MemcacheKeyPrefix: keyPrefix,
 		Client:            client,
-		stubClient:        make(map[string]*Session),
+		NoCookieMethods:   []string{"OPTIONS", "HEAD"},
+		OnConflict:        ConflictLastWriteWins,
+		ConflictRetries:   3,
+		state:             &state{stub: NewMemoryStore()},
 	}
+	m.stub.Now = m.now
+	return m
 
 }
 
-func newKey() string {
-	b := make([]byte, 33)
-	rand.Read(b)
-	return base64.URLEncoding.EncodeToString(b)
+// now returns the time according to Now
+func (m *Manager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// now is the Manager's now, for sessions which may not have one
+func (s *Session) now() time.Time {
+	if s.m != nil {
+		return s.m.now()
+	}
+	return time.Now()
+}
+
+// defaultKeyLength and minKeyLength are in random bytes, see KeyLength
+const (
+	defaultKeyLength = 33
+	minKeyLength     = 16
+)
+
+// newKey returns a new session key from KeyGenerator, or a random one of
+// KeyLength bytes, with ShardHint's hint in front
+func (m *Manager) newKey() (string, error) {
+	if m.KeyGenerator != nil {
+		key := m.KeyGenerator()
+		if key == "" {
+			return "", fmt.Errorf("KeyGenerator returned an empty key")
+		}
+		if !validKey(key) {
+			return "", fmt.Errorf("KeyGenerator returned an invalid key %q", key)
+		}
+		return m.hintKey(key)
+	}
+	n := m.KeyLength
+	if n == 0 {
+		n = defaultKeyLength
+	}
+	b := make([]byte, max(n, minKeyLength))
+	if _, err := crand.Read(b); err != nil {
+		return "", fmt.Errorf("reading random session key: %w", err)
+	}
+	return m.hintKey(base64.URLEncoding.EncodeToString(b))
+}
+
+// freshSession returns a new session with a new key
+func (m *Manager) freshSession() (*Session, error) {
+	key, err := m.newKey()
+	if err != nil {
+		return nil, err
+	}
+	return m.newSession(key), nil
 }
 
 type Manager struct {
-	TemplateCookie    *http.Cookie        // this cookie is copied and the value modified for each one written to the client
-	Expiration        time.Duration       // how long until session expiration - passed back to memcache
-	Client            *memcache.Client    // the memcache client or nil to mean store in memory (stub for development)
-	MemcacheKeyPrefix string              // prefix memcache keys with this
-	stubClient        map[string]*Session // if client is null then we store sessions in memory here
-	stubClientMutex   sync.RWMutex        // control access to stubClient
+	TemplateCookie          *http.Cookie                                                     // this cookie is copied and the value modified for each one written to the client; set Domain, Secure etc. here (NewManager makes it HttpOnly and SameSite=Lax)
+	Expiration              time.Duration                                                    // how long until session expiration - passed back to memcache
+	AuthenticatedExpiration time.Duration                                                    // if > 0, the Expiration of authenticated sessions (see Session.MarkAuthenticated), so anonymous ones can be kept short
+	AuthenticatedCookie     *http.Cookie                                                     // if set, copied instead of TemplateCookie for authenticated sessions (keeping TemplateCookie's Name)
+	AuthenticatedKeyPrefix  string                                                           // prepended to the keys of authenticated sessions, so the tiers can be told apart in the backing store
+	ScrubOnLogin            []string                                                         // if not nil, MarkAuthenticated clears the values of the session except these keys (see Session.Clear), so nothing from before the login carries over; []string{} keeps none
+	Now                     func() time.Time                                                 // the clock expirations and lifetimes go by (and the in-memory stub's entries expire by), nil means time.Now; tests can set a fake one instead of sleeping
+	LazySessions            bool                                                             // new sessions get no cookie, and nothing is stored for them, until something is put in them and they are written (with a ResponseWriter)
+	AlwaysSetCookie         bool                                                             // send the cookie with every response, rather than only when it is new or changed or past half its MaxAge (which lets shared caches store more responses)
+	OnCookieTooBig          func(c *http.Cookie, err error) error                            // called when a cookie would be over the 4096 bytes browsers store, may trim c and return nil to send it anyway; nil means the error is returned
+	Partitioned             bool                                                             // if true, the cookie is sent Partitioned (CHIPS) and SameSite=None, so sessions work for the app embedded in iframes on other sites; SameSite=None and Partitioned cookies are always made Secure
+	CookieDomain            DomainPolicy                                                     // if set, the cookie's Domain is derived from the Host of each request (see RegistrableDomain, AllowedDomains), so one Manager serves a session cookie shared by several subdomains
+	TokenHeader             string                                                           // if set, the session token (what the cookie value would be) is also read from and sent back in this header, for clients without cookies; with Authorization, "Bearer <token>" is read and the token sent back in X-Session-Token
+	TokenOnly               bool                                                             // with TokenHeader, sessions are only carried in the header: no cookie is read or set
+	SecureAuto              bool                                                             // if true, the cookie is marked Secure exactly on requests which came over https, see IsHTTPS
+	CookieFunc              func(r *http.Request, c *http.Cookie)                            // if set, called to adjust the cookie (a copy of TemplateCookie) for each request: a stricter cookie for /admin, say (Secure, a short MaxAge, its own Path and Name; the cookie is read by the name it gives for the request)
+	Client                  *memcache.Client                                                 // the memcache client or nil to mean store in memory (stub for development)
+	Store                   Store                                                            // if set, sessions are kept here instead of Client, see Store
+	Servers                 []string                                                         // memcache servers for Replicas, used instead of Client
+	Replicas                int                                                              // if > 1, each session is written to this many of Servers and read from the first of them which has it, see replicas.go
+	ServerSelector          ServerSelector                                                   // picks the Servers of each session for Replicas, nil means RendezvousSelector
+	MemcacheKeyPrefix       string                                                           // prefix memcache keys with this
+	KeyLength               int                                                              // random bytes in new session keys (the key is the base64 of them), 0 means 33, less than 16 is not allowed
+	HashKeyPrefix           bool                                                             // use a 12 character hash of MemcacheKeyPrefix in backing store keys, for long prefixes (memcache keys are limited to 250 bytes)
+	KeyGenerator            func() string                                                    // if set, makes new session keys instead of KeyLength random bytes (UUIDs, keys with a shard hint...); keys must be unique, unguessable and at most 200 bytes of printable ASCII other than space, ':' and '#'
+	ShardHint               func() string                                                    // if set, new session keys carry the hint it returns, for a ShardedStore to route them by; it is called for each new key
+	KeyFunc                 func(key string) string                                          // if set, maps session keys (and the keys derived from them) to backing store keys instead of MemcacheKeyPrefix, e.g. to share a cluster between apps
+	KeyHashSecret           []byte                                                           // if set, entries are stored under an HMAC of the session key (and of the keys derived from it) and user indexes are encrypted, so nothing in the backing store can be used as a cookie, see keyhash.go
+	MigrateBareKeys         bool                                                             // look for sessions which are not under their prefixed key under the bare one, where versions before the prefix was applied put them, and move them over
+	Codec                   Codec                                                            // how sessions are serialized for memcache, nil means a plain GobCodec
+	SchemaVersion           int                                                              // version of what the application keeps in sessions, stored with them; bump it along with adding to Migrations
+	Migrations              map[int]Migration                                                // upgrades sessions stored with older SchemaVersions when they are read, see Migration
+	Validate                func(v Values) error                                             // if set, WriteSession checks the values with it before writing and fails with a *ValidationError if it returns an error, for invariants every handler must keep (required keys, no PII...)
+	ForceWrite              bool                                                             // write sessions every time WriteSession is called, even if they did not change
+	DeferWrites             bool                                                             // WriteSession of a session handed to a SessionWriter (see AutoWrite, Middleware) only marks it, the SessionWriter writes it once, when the response header goes out, see WriteSession
+	DeferCookies            bool                                                             // if true, Middleware holds the Set-Cookie headers of the session (and its JWT) back until the response header goes out, so changes late in the request replace earlier cookies rather than add to them, see CookieWriter
+	ChunkSize               int                                                              // encoded sessions bigger than this are split across several keys, 0 means just under memcache's 1MB item limit, < 0 disables chunking
+	CompressThreshold       int                                                              // if > 0, encoded sessions of at least this many bytes are gzipped in the backing store, see compress.go
+	OnConflict              ConflictStrategy                                                 // what to do when a session was modified concurrently, see ConflictStrategy
+	Merge                   Merger                                                           // used by ConflictMerge, nil means MergeChanges against what the request originally read
+	ConflictRetries         int                                                              // how many times ConflictMerge re-reads and merges before giving up
+	LockSessions            bool                                                             // Middleware holds the session's lock while handling a request, so requests with the same session run one at a time, see LockSession
+	LockTTL                 time.Duration                                                    // how long a session lock lasts if it isn't released, 0 means 30 seconds
+	LockWait                time.Duration                                                    // how long LockSession waits for a lock, 0 means LockTTL
+	TTLJitter               float64                                                          // randomly vary the memcache expiration of each write by up to +/- this fraction (0.1 = 10%), so sessions created in a burst do not all expire at once
+	DedupLoads              bool                                                             // if true, concurrent requests for the same session share one memcache read and decode
+	CheckRevoked            bool                                                             // every session read first checks the key wasn't passed to Revoke, at the cost of a round trip to the backing store, see revoke.go
+	LocalCacheTTL           time.Duration                                                    // how long sessions read with Prefetch are served from memory, 0 disables the local read cache
+	AbsoluteExpiration      time.Duration                                                    // if > 0, sessions older than this are deleted and replaced with a new one on their next read, however active they are
+	RenewMissingKeys        bool                                                             // if true, a cookie whose session is gone from the backing store gets a new session under a new key, rather than under the old one (which may have leaked), see Session.Expired
+	SoftExpiration          time.Duration                                                    // if > 0 (and under Expiration), sessions unused for longer are still served but with Session.Stale set, so the application can ask for the password again, or carry on, instead of the user losing the session outright at Expiration
+	ExpiresHeader           string                                                           // if set, responses of requests which use the session carry the whole seconds it has left (see Session.ExpiresIn) in this header, e.g. "X-Session-Expires", so single page apps can warn the user before it lapses and call TouchHandler
+	RotateEvery             time.Duration                                                    // if > 0, sessions whose key is older than this are moved to a new key (and the cookie re-issued) on their next request, limiting how long a leaked key is of use
+	RotateGrace             time.Duration                                                    // how long the old key keeps working after a rotation, for requests already under way, 0 means a minute
+	RememberCookie          *http.Cookie                                                     // template for the remember-me cookie (see RememberMe), nil means one named after TemplateCookie with "_remember" appended, HttpOnly and SameSite=Lax
+	RememberExpiration      time.Duration                                                    // how long remember-me tokens last, 0 means 30 days
+	SlidingExpiration       bool                                                             // if true, sessions are touched in the store on every read so Expiration counts from the last request rather than the last write, and the cookie's MaxAge/Expires follow; EarlyRefresh is not needed then
+	RollingCookie           bool                                                             // if true, the cookie's MaxAge/Expires are set from Expiration rather than TemplateCookie and it is sent with every response, so it lasts as long as the session does in the backing store
+	LocalCacheSize          int                                                              // the most sessions the local cache holds, 0 means 10000
+	LocalCacheAll           bool                                                             // with LocalCacheTTL, the local cache is read-through and write-through for all sessions rather than holding only prefetched ones, see cache.go
+	EarlyRefresh            time.Duration                                                    // if > 0, sessions are rewritten (extending their expiration) by a random request, usually within about this long of expiring, instead of all at the last moment
+	HeavyKeys               []string                                                         // keys in Values which are stored separately and only written when changed, see buckets.go
+	MaxSessionsPerUser      int                                                              // if > 0, the most sessions a user (see Session.SetUserID) may have at once, SessionLimit decides what happens beyond that
+	SessionLimit            SessionLimitPolicy                                               // what WriteSession does when a session would take its user over MaxSessionsPerUser, nil means EvictOldest
+	MaxKeys                 int                                                              // if > 0, the most keys a session may have in Values, see LimitPolicy
+	MaxSessionBytes         int                                                              // if > 0, the most bytes the main record of a session may take in memcache, see LimitPolicy
+	LimitPolicy             LimitPolicy                                                      // what WriteSession does when MaxKeys or MaxSessionBytes is exceeded
+	OnLimit                 func(s *Session, err error) error                                // called with LimitCallback, may trim s and return nil to write it anyway
+	FailOnDecodeError       bool                                                             // Session returns an error for sessions which can't be decoded, instead of replacing them with a new one, see DecodeError
+	OnDecodeError           func(r *http.Request, err *DecodeError)                          // called when a session which can't be decoded is replaced (or skipped by LoadSessions, r is nil then), nil means log it
+	MaxDecodeSize           int                                                              // if > 0, stored sessions (and heavy values) bigger than this many bytes, before or after decompression, are not decoded but handled as undecodable, see ErrDecodeRejected
+	AllowedTypes            []interface{}                                                    // if set, sessions holding values of other types than these (samples, as for RegisterType), the predeclared ones, time.Time and []interface{} and map[string]interface{} of them are handled as undecodable, see ErrDecodeRejected
+	OnStoreError            StoreErrorPolicy                                                 // what Session does when the backing store can't be read, see StoreErrorPolicy
+	OnWriteSkipped          func(s *Session)                                                 // called when a write is skipped because the Manager is read-only or degraded
+	WriteFailureThreshold   int                                                              // if > 0, after this many consecutive failed writes the Manager degrades to read-only for WriteFailureCooldown
+	WriteFailureCooldown    time.Duration                                                    // how long writes are skipped once degraded, then one is tried again
+	Logger                  Logger                                                           // where errors and LogLifecycle events are logged (a *slog.Logger works), nil means the standard log package without debug messages
+	LogLifecycle            bool                                                             // log what happens to sessions (loaded, missed, created, written, decode errors) at debug level
+	Metrics                 Metrics                                                          // if set, receives counts and timings of session reads, writes and store round trips, see PublishExpvar
+	Tracer                  Tracer                                                           // if set, spans are made for loading, decoding, writing and deleting sessions and each round trip to the backing store, see Tracer
+	Debug                   bool                                                             // development only: adds an X-Session-Debug header to responses describing what happened to the session
+	Hooks                   Hooks                                                            // callbacks for when sessions are created, loaded, written and destroyed
+	AuditSink               AuditSink                                                        // if set, receives security relevant session events (creation, destruction...)
+	HistoryLength           int                                                              // if > 0, keep a log of this many changes (when, which keys, request path) in Meta.History of each session
+	CanonicalEncoding       bool                                                             // if true, whether a session changed is told by its canonical form (see Session.Fingerprint) rather than a shallow copy, so changes to values made in place are written too, and exports come out the same for the same session
+	EncryptionKey           []byte                                                           // if set (16, 24 or 32 bytes), cookie values are encrypted with AES-GCM so not even the session key is visible, see crypt.go
+	OldEncryptionKeys       [][]byte                                                         // previous EncryptionKeys, still accepted when decrypting cookies (which are then sent again encrypted with EncryptionKey) and stored sessions, so the key can be rotated without signing everyone out
+	EncryptAtRest           bool                                                             // with EncryptionKey, session records and heavy values are also encrypted (AES-GCM) before they go to the backing store, so they can't be read by anyone with access to memcache
+	CookieFallback          bool                                                             // with EncryptionKey, sessions which can't be written to the backing store are kept in the cookie instead, if small enough, and read from it while the store is unavailable
+	SigningKey              []byte                                                           // if set, cookies are signed with HMAC-SHA256 and ones with a bad signature get a new session, see signing.go
+	OldSigningKeys          [][]byte                                                         // previous SigningKeys, cookies signed with them are still accepted (and re-signed with SigningKey), so the key can be rotated without signing everyone out
+	JWTKey                  []byte                                                           // if set, sessions with a user ID get a JWT cookie (HS256 with this key) which authenticates the user read-only when the session can't be read, see jwt.go
+	JWTExpiration           time.Duration                                                    // how long JWTs are valid, 0 means 15 minutes
+	JWTOnMiss               bool                                                             // if true, JWTs are also used when the session is missing from the backing store (e.g. it was flushed), not only when reading it fails; a destroyed session can't be told apart, see jwt.go
+	CookieCodec             CookieCodec                                                      // if set, how session keys are put in cookies instead of SigningKey's format, e.g. ExpressCookieCodec to share sessions with express-session
+	Binding                 Binding                                                          // properties of the client sessions are tied to, a request from a client which doesn't match is handled according to OnBindingMismatch
+	OnBindingMismatch       func(r *http.Request, s *Session, changed Binding) BindingAction // decides what happens to a session requested by a different client (changed says what differs), nil means BindingReject
+	ClientCertFingerprint   func(r *http.Request) string                                     // what BindClientCert binds to, nil means the SHA-256 of the certificate in r.TLS; behind a proxy terminating TLS, the fingerprint it passes on in a header
+	TrustedProxies          []*net.IPNet                                                     // requests from these addresses have their client IP taken from X-Forwarded-For/Forwarded/X-Real-IP, see ClientIP
+	Skip                    func(r *http.Request) bool                                       // requests for which session handling is skipped: Session returns an empty session without touching memcache or setting a cookie, and writing it does nothing
+	SkipPathPrefixes        []string                                                         // like Skip, for requests whose path starts with any of these (e.g. "/static/", "/healthz")
+	OnMiddlewareError       func(r *http.Request, err error)                                 // called when Middleware fails to write a session, nil means log it
+	NoCookieMethods         []string                                                         // requests with these methods never get a new session or a Set-Cookie (a detached empty session like with Skip instead), by default OPTIONS and HEAD
+	NewSessionLimit         int                                                              // if > 0, how many new sessions a client IP may get per NewSessionWindow, more get a detached session which is never stored (like with Skip), see ratelimit.go
+	NewSessionWindow        time.Duration                                                    // the window NewSessionLimit counts in, 0 means a minute
+	OnNewSessionLimit       func(r *http.Request, ip string)                                 // called for each request which got a detached session because of NewSessionLimit
+	ValuesCapacity          int                                                              // how many keys to preallocate room for in the Values of new sessions
+	PrivateCacheHeaders     bool                                                             // if true, responses of requests which use the session get Cache-Control: private and Vary: Cookie so shared caches never store them
+	*state                                                                                   // internals shared with derived Managers, see ForPath
+	trace                   *tracing                                                         // what a copy of the Manager made by traced works under
+}
+
+// state is the part of a Manager which is shared by Managers derived from it
+type state struct {
+	stub             *MemoryStore           // if neither Store nor Client is set then we store sessions in memory here
+	loads            map[string]*loadCall   // loads in progress when DedupLoads is on
+	loadsMutex       sync.Mutex             // control access to loads
+	cache            map[string]*cacheEntry // local read cache, see LocalCacheTTL
+	cacheLRU         *list.List             // entries of cache by last use
+	cacheMutex       sync.Mutex             // control access to cache
+	readOnly         atomic.Bool            // see SetReadOnly
+	writeFailures    atomic.Int32           // consecutive failed writes, see WriteFailureThreshold
+	circuitOpenUntil atomic.Int64           // unix nanos until which writes are skipped after too many failures
+	replicas         *replicaStore          // see Manager.Replicas
+	replicasOnce     sync.Once              // makes replicas
+	unhealthy        atomic.Bool            // the backing store failed its last health check, see StartHealthCheck
+	healthStop       chan struct{}          // closed to stop the health checks
+	healthMutex      sync.Mutex             // control access to healthStop
 }
 
 type Session struct {
-	Key    string       // the key for this session
-	Cookie *http.Cookie // the cookie we will write to the client
-	Values Values       // values of the session
+	Key        string            // the key for this session
+	Cookie     *http.Cookie      // the cookie we will write to the client
+	Values     Values            // values of the session
+	Meta       Meta              // bookkeeping stored alongside the values
+	OnConflict ConflictStrategy  // overrides Manager.OnConflict for writes of this session
+	Stale      bool              // the session went unused for longer than Manager.SoftExpiration: it is served as usual, but the application may want the user to sign in again
+	m          *Manager          // the manager that loaded this session
+	cas        interface{}       // token from the backing store of what we read, nil if nothing was there
+	raw        map[string][]byte // values stored with SetRaw
+	debug      *debugInfo        // what happened to this session during the request, only with Manager.Debug
+	deferTo    *SessionWriter    // with Manager.DeferWrites, the SessionWriter which writes the session
+	lastSeen   time.Time         // Meta.LastSeenAt as read, see IdleFor
+	cookie     http.Cookie       // what Cookie points to, saves an allocation
+	snap       *Snapshot         // as of the last read or write, for Middleware to see if there are changes
+	req        *http.Request     // the request the session was read for, for Hooks
+	modified   bool              // see MarkModified
+	inCookie   bool              // the session is kept in the cookie, see CookieFallback
+	fromJWT    bool              // the session couldn't be read and was made up from its JWT, see Manager.JWTKey
+	promote    bool              // MarkAuthenticated was called, the next write moves the session to the authenticated tier
+	created    bool              // Session started the session, see IsNew
+	source     string            // where the session came from, see Source
+	diag       *Diagnostics      // see Diagnostics
+	expiresAt  time.Time         // see ExpiresAt
+	mu         sync.RWMutex      // guards Values for Get, Set, Delete and Range
+	lazy       bool              // the client hasn't been sent the cookie yet, see LazySessions
+	skipped    bool              // the request matched Manager.Skip, the session was destroyed or is from PeekSession, nothing is (further) read or written
+	loaded     []byte            // the data as read from the backing store, the base for merging
+	buckets    map[string][]byte // heavy keys as read from or last written to the backing store, an entry means it was loaded
+}
+
+// casWritten is used as the cas token of a session we wrote ourselves, memcache
+// does not tell us the new cas value so further writes are plain sets
+type casWrittenToken struct{}
+
+var casWritten = casWrittenToken{}
+
+// ttl returns the expiration to use for a write of something which lasts
+// exp, with TTLJitter applied
+func (m *Manager) ttl(exp time.Duration) time.Duration {
+	if m.TTLJitter > 0 {
+		exp += time.Duration((rand.Float64()*2 - 1) * m.TTLJitter * float64(exp))
+	}
+	return exp.Truncate(time.Second)
+}
+
+// store returns where sessions are kept (see baseStore), with failures
+// wrapped in StoreError and instrumented if Metrics is set
+func (m *Manager) store() Store {
+	return hookStore{st: m.baseStore(), do: m.storeOp}
+}
+
+// baseStore returns where sessions are kept: Store, or Client, or the
+// in-memory stub
+func (m *Manager) baseStore() Store {
+	if m.Store != nil {
+		return m.Store
+	}
+	if m.Replicas > 1 && len(m.Servers) > 0 {
+		return m.replicaStore()
+	}
+	if m.Client != nil {
+		return MemcacheStore{Client: m.Client}
+	}
+	return m.stub
+}
+
+// MemoryStore returns the in-memory stub sessions are kept in when neither
+// Store nor Client is set, e.g. to set its MaxEntries or look at its Stats
+func (m *Manager) MemoryStore() *MemoryStore {
+	return m.stub
+}
+
+// usesStub reports whether sessions are kept in the in-memory stub
+func (m *Manager) usesStub() bool {
+	return unwrapStore(m.baseStore()) == m.stub
+}
+
+// Close stops the background work of the Manager (the in-memory stub's
+// janitor, health checks), it can't be used afterwards
+func (m *Manager) Close() {
+	m.stub.Stop()
+	m.stopHealthCheck()
+}
+
+// get reads the raw data for key from the store (reassembling it if it was
+// chunked), along with a token that can be passed to cas; returns ErrNotFound
+// on a miss
+func (m *Manager) get(key string) ([]byte, interface{}, error) {
+	data, token, err := m.storeGet(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.unchunk(key, data, token)
+}
+
+// storeGet is get without the reassembling of chunks
+func (m *Manager) storeGet(key string) ([]byte, interface{}, error) {
+	st := m.store()
+	if cs, ok := st.(CASStore); ok {
+		return cs.GetCAS(m.storeKey(key))
+	}
+	data, err := st.Get(m.storeKey(key))
+	return data, nil, err
 }
 
-// convenience function to add a "flash message" to this session - uses the key "_flashes"
-func (s *Session) AddFlash(v interface{}) {
-	flashes := []interface{}{}
-	// extract existing flash messages
-	f := s.Values["_flashes"]
-	if f != nil {
-		if f1, ok := f.([]interface{}); ok {
-			flashes = f1
+// getMulti is get for several keys at once, keys which are not found are
+// not in the result
+func (m *Manager) getMulti(keys []string) (map[string]*loaded, error) {
+
+	ret := make(map[string]*loaded, len(keys))
+
+	if ms, ok := m.store().(MultiGetStore); ok {
+		skeys := make([]string, len(keys))
+		for i, key := range keys {
+			skeys[i] = m.storeKey(key)
+		}
+		items, err := ms.GetMulti(skeys)
+		if err != nil {
+			return nil, err
+		}
+		for i, key := range keys {
+			it, ok := items[skeys[i]]
+			if !ok {
+				continue
+			}
+			data, token, err := m.unchunk(key, it.Data, it.CAS)
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			ret[key] = &loaded{data: data, cas: token}
+		}
+		return ret, nil
+	}
+
+	for _, key := range keys {
+		data, token, err := m.get(key)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
 		}
+		ret[key] = &loaded{data: data, cas: token}
 	}
-	// append this one
-	flashes = append(flashes, v)
-	// set it back
-	s.Values["_flashes"] = flashes
+	return ret, nil
+
+}
+
+// set unconditionally writes data under key, expiring after ttl
+func (m *Manager) set(key string, data []byte, ttl time.Duration) error {
+	m.cacheDel(key)
+	data, err := m.chunk(key, data, ttl)
+	if err != nil {
+		return err
+	}
+	return m.store().Set(m.storeKey(key), data, ttl)
+}
+
+// del removes key (and its chunks), it is not an error if it does not exist
+func (m *Manager) del(key string) error {
+	m.cacheDel(key)
+	if err := m.delChunks(key); err != nil {
+		return err
+	}
+	return m.store().Delete(m.storeKey(key))
+}
+
+// cas writes data under key only if it has not changed since it was read
+// with token (a nil token means it must not exist), returns ErrCASConflict
+// if it did change; with a store which is not a CASStore it is just set
+func (m *Manager) cas(key string, data []byte, token interface{}, ttl time.Duration) error {
+
+	m.cacheDel(key)
+
+	cs, ok := m.store().(CASStore)
+	if token == casWritten || !ok {
+		return m.set(key, data, ttl)
+	}
+	if c, ok := token.(*chunkedToken); ok {
+		token = c.token
+	}
+	data, err := m.chunk(key, data, ttl)
+	if err != nil {
+		return err
+	}
+	return cs.CompareAndSwap(m.storeKey(key), data, token, ttl)
+
+}
+
+// Meta is bookkeeping information which is stored along with the session
+// values but kept out of the Values map
+type Meta struct {
+	LastAuthenticatedAt time.Time            // last time the user proved who they are (login, password re-entry, 2FA...)
+	ExpiresAt           time.Time            // when the entry in the backing store expires, as of the last write
+	KeysAdded           map[string]time.Time // when each key was first written, only kept with LimitEvictOldest
+	LoginIntent         *LoginIntent         // where to resume after login, see SetLoginIntent
+	CreatedAt           time.Time            // when the session was started, see AbsoluteExpiration
+	KeyIssuedAt         time.Time            // when the session got its current key, see RotateEvery
+	UserID              string               // the application user the session belongs to, see SetUserID
+	ClientIP            string               // the client IP (or network) the session is bound to, see Manager.Binding
+	UserAgentHash       string               // the User-Agent the session is bound to, see Manager.Binding
+	ClientCert          string               // the fingerprint of the client certificate the session is bound to, see Manager.Binding
+	CookieIssuedAt      time.Time            // when the cookie was last sent to the client, see Manager.AlwaysSetCookie
+	SchemaVersion       int                  // the Manager's SchemaVersion when the session was written, see Migration
+	LastSeenAt          time.Time            // when the session was last used by a request (updated at most once a minute), see Session.IdleFor
+	CreatedIP           string               // the client IP the session was started from, see Manager.ClientIP
+	UserAgent           string               // the User-Agent of the client which last used the session (its first 256 bytes)
+	History             []Change             // the last changes to Values, oldest first, see Manager.HistoryLength
+}
+
+// record is what actually gets encoded and written to memcache
+type record struct {
+	Meta   Meta
+	Values Values
+	raw    map[string][]byte // written around the codec, see Session.SetRaw
+}
+
+// RecordAuthentication notes that the user just authenticated, call it after
+// a successful login or when the user re-enters their password
+func (s *Session) RecordAuthentication() {
+	s.Meta.LastAuthenticatedAt = s.now()
+}
+
+// RequireFreshAuth reports whether the user must re-verify their identity
+// before a sensitive action (changing email, payouts, etc.), i.e. they have
+// never authenticated in this session or did so longer than maxAge ago
+func (s *Session) RequireFreshAuth(maxAge time.Duration) bool {
+	t := s.Meta.LastAuthenticatedAt
+	return t.IsZero() || s.now().Sub(t) > maxAge
+}
+
+// Snapshot is a copy of a session's state, see Session.Snapshot
+type Snapshot struct {
+	values Values
+	meta   Meta
+	raw    map[string][]byte
+	sum    []byte // canonicalSum of the session, with Manager.CanonicalEncoding
 }
 
-// pops the "flash messages" from this session
-func (s *Session) Flashes() []interface{} {
-	f := s.Values["_flashes"]
-	if f != nil {
-		if f1, ok := f.([]interface{}); ok {
-			delete(s.Values, "_flashes")
-			return f1
+// Snapshot copies the current values and metadata so they can be restored
+// with Rollback, e.g. if a handler fails halfway through changing several
+// keys.  The copy of Values is shallow (but for namespaces, see
+// Session.Namespace): values which are mutated in place (rather than
+// replaced) are shared with the snapshot.  Meta is copied in full.
+func (s *Session) Snapshot() *Snapshot {
+	snap := &Snapshot{values: copyValues(s.Values), meta: copyMeta(s.Meta), raw: copyRaw(s.raw)}
+	if s.m != nil && s.m.CanonicalEncoding {
+		snap.sum = canonicalSum(s.Meta, s.Values, s.raw)
+	}
+	return snap
+}
+
+// Rollback restores the values and metadata to what they were when snap was taken
+func (s *Session) Rollback(snap *Snapshot) {
+	s.Values = copyValues(snap.values)
+	s.Meta = copyMeta(snap.meta)
+	s.raw = copyRaw(snap.raw)
+}
+
+// copyMeta returns a copy of meta which shares nothing with it
+func copyMeta(meta Meta) Meta {
+	if meta.KeysAdded != nil {
+		added := make(map[string]time.Time, len(meta.KeysAdded))
+		for k, t := range meta.KeysAdded {
+			added[k] = t
 		}
+		meta.KeysAdded = added
 	}
-	return nil
+	if meta.LoginIntent != nil {
+		li := *meta.LoginIntent
+		if li.Params != nil {
+			li.Params = make(map[string]string, len(meta.LoginIntent.Params))
+			for k, v := range meta.LoginIntent.Params {
+				li.Params[k] = v
+			}
+		}
+		meta.LoginIntent = &li
+	}
+	if meta.History != nil {
+		meta.History = append([]Change(nil), meta.History...)
+	}
+	return meta
 }
 
 type Values map[string]interface{}
@@ -141,62 +573,260 @@ func (v Values) SetBool(key string, val bool) {
 	v[key] = val
 }
 
-// TODO: make a way to delete a session and recreate it with a new id - to prevent
-// session fixation attacks.  You would call this function after logging in or
-// other access escalation, to avoid someone else piggy backing on your session.
-
 // Get or create the session object, sets the appropriate cookie, does
-// not write to the backing store
+// not write to the backing store; in a request with a session cache (see
+// WithSessionCache) repeated calls return the same session
 func (m *Manager) Session(w http.ResponseWriter, r *http.Request) (ret *Session, err error) {
 
+	if m.Tracer != nil && m.trace == nil {
+		return m.tracedSession(w, r)
+	}
+
 	name := m.TemplateCookie.Name
 	if name == "" {
 		return nil, fmt.Errorf("TemplateCookie cannot have empty string as name - put something in there")
 	}
 
-	cookie, err := r.Cookie(name)
-	if err == nil && len(cookie.Value) > 0 {
+	if m.ShouldSkip(r) {
+		return m.skippedSession(), nil
+	}
 
-		key := cookie.Value
+	if s := m.cachedSession(r); s != nil {
+		return s, nil
+	}
+	defer func() {
+		if err == nil {
+			m.cacheSession(r, ret)
+		}
+	}()
 
-		if m.Client != nil {
+	source := SourceNew
+	rebind := false
+	loadTime, cacheHit := time.Duration(0), false
+	key, payload, ok := "", []byte(nil), false
+	var l *loaded
+	var lerr error
+	token := m.requestToken(r)
+	if token != "" {
+		key, payload, ok = m.parseCookie(token)
+		if !ok {
+			m.audit(r, AuditTamper, nil, "bad cookie signature or malformed key")
+		} else if payload != nil {
+			start := time.Now()
+			payload, l, lerr = m.loadFirst(key, payload)
+			loadTime = time.Since(start)
+		}
+	}
+	if ok && payload != nil {
 
-			it, err := m.Client.Get(key)
-			if err == memcache.ErrCacheMiss {
-				ret = &Session{Key: key, Values: make(Values)}
-			} else if err != nil {
+		// the session was kept in the cookie, see CookieFallback
+		rec, err := m.decodeRecord(payload)
+		if err != nil {
+			return nil, err
+		}
+		source = SourceCookie
+		ret = m.newSession(key)
+		ret.Values, ret.Meta, ret.raw, ret.cas, ret.loaded = rec.Values, rec.Meta, rec.raw, casWritten, payload
+		ret.inCookie = true
+		if m.tooOld(ret) {
+			source = SourceExpired
+			if ret, err = m.expire(r, ret); err != nil || ret.skipped {
+				return ret, err
+			}
+		}
+
+	} else if ok {
+
+		if l == nil && lerr == nil {
+			start := time.Now()
+			l, lerr = m.load(key)
+			loadTime = time.Since(start)
+		}
+		err := lerr
+		cacheHit = l != nil && l.hit
+		if err == ErrNotFound && !m.CheckRevoked {
+			// a revoked key is deleted, its record tells it from a flushed one
+			if revoked, rerr := m.revoked(key); rerr != nil {
+				err = rerr
+			} else if revoked {
+				err = errRevoked
+			}
+		}
+		if err == errRevoked {
+			m.audit(r, AuditAnomaly, &Session{Key: key}, "revoked session key")
+		}
+		if err == ErrNotFound || err == errRevoked {
+			source = SourceMiss
+			if m.noCookie(r) {
+				return m.skippedSession(), nil
+			}
+			var js *Session
+			if err == ErrNotFound && m.JWTOnMiss {
+				js = m.jwtSession(r, key)
+			}
+			if js != nil {
+				source, ret = SourceJWT, js
+			} else if !m.usesStub() && err == ErrNotFound && !m.RenewMissingKeys {
+				ret = m.newSession(key)
+			} else if ret, err = m.freshSession(); err != nil {
 				return nil, err
-			} else {
-				ret = &Session{Key: key, Values: make(Values)}
-				err = gob.NewDecoder(bytes.NewReader(it.Value)).Decode(&ret.Values)
+			}
+		} else if de := (*DecodeError)(nil); errors.As(err, &de) && !m.FailOnDecodeError {
+			source = SourceCorrupt
+			if ret, err = m.corrupt(r, key, de); err != nil || ret.skipped {
+				return ret, err
+			}
+		} else if err != nil {
+			source = SourceError
+			if ret = m.jwtSession(r, key); ret != nil {
+				source = SourceJWT
+				m.logger().Warn("reading session failed, carrying on with its JWT", "path", r.URL.Path, "err", err)
+			} else if ret = m.storeError(r, key, err); ret == nil {
+				return nil, err
+			}
+		} else {
+			source = SourceHit
+			ret = m.loadedSession(key, l)
+			act, bound := BindingAllow, true
+			if m.tooOld(ret) {
+				source = SourceExpired
+				if ret, err = m.expire(r, ret); err != nil || ret.skipped {
+					return ret, err
+				}
+			} else if act, bound = m.checkBinding(r, ret); !bound && act == BindingReject {
+				source = SourceRejected
+				if m.noCookie(r) {
+					return m.skippedSession(), nil
+				}
+				if ret, err = m.freshSession(); err != nil {
+					return nil, err
+				}
+			} else if m.SlidingExpiration && !m.ReadOnly() {
+				m.touch(ret)
+			} else if m.shouldRefresh(ret) && !m.ReadOnly() {
+				err = m.refresh(ret)
 				if err != nil {
 					return nil, err
 				}
 			}
-
-		} else {
-			// look up the stub session
-			m.stubClientMutex.RLock()
-			ret = m.stubClient[key]
-			m.stubClientMutex.RUnlock()
-			if ret == nil {
-				ret = &Session{Key: newKey(), Values: make(Values)}
-			}
+			rebind = !bound && act == BindingRegenerate
 		}
 
 	} else {
+		if m.noCookie(r) {
+			return m.skippedSession(), nil
+		}
 		// new empty session
-		ret = &Session{Key: newKey(), Values: make(Values)}
+		if ret, err = m.freshSession(); err != nil {
+			return nil, err
+		}
+	}
+
+	if ret.loaded == nil && !ret.skipped && !m.allowNewSession(r) {
+		return m.skippedSession(), nil
 	}
 
 	// copy the cookie
-	newc := *m.TemplateCookie
-	// newc.MaxAge = int(m.Expiration / time.Second)
-	newc.Value = ret.Key
-	ret.Cookie = &newc
+	m.sessionCookie(r, ret)
+	if source == SourceCookie {
+		// leave it there until the session makes it to the store
+		ret.cookie.Value = token
+	} else if ret.cookie.Value, err = m.cookieValue(ret.Key); err != nil {
+		return nil, err
+	}
+	if err := m.checkCookie(ret.Cookie); err != nil {
+		return nil, err
+	}
 
-	// set it on the response writer - so the key goes back to the client
-	http.SetCookie(w, ret.Cookie)
+	// set it on the response writer - so the key goes back to the client,
+	// unless it has it already
+	setCookie := !m.noCookie(r) && (m.cookieDue(ret, source) || source == SourceHit && m.oldKeyCookie(token))
+	if !m.noCookie(r) && !m.TokenOnly && m.duplicateCookies(r, token) {
+		// leave the client with just the one
+		m.expireDuplicates(w, r, ret.Cookie)
+		setCookie = true
+	}
+	if m.LazySessions && (source == SourceNew || source == SourceMiss) {
+		// not until something is stored in it
+		ret.lazy, setCookie = true, false
+	}
+	if setCookie {
+		m.sendCookie(w, ret.Cookie)
+	}
+
+	if m.PrivateCacheHeaders {
+		setPrivateCacheHeaders(w.Header(), m.varyOn())
+	}
+
+	if m.Debug {
+		ret.debug = &debugInfo{source: source, read: len(ret.loaded)}
+		ret.debug.setHeader(w)
+	}
+
+	ret.req, ret.source = r, source
+	ret.diag = requestDiagnostics(r)
+	ret.diag.LoadDuration += loadTime
+	ret.diag.CacheHit = ret.diag.CacheHit || cacheHit
+	m.expireValues(ret)
+	ret.lastSeen = ret.Meta.LastSeenAt
+	ret.Stale = m.SoftExpiration > 0 && ret.IdleFor() > m.SoftExpiration
+	now := m.now()
+	if ret.loaded == nil {
+		ret.Meta.SchemaVersion = m.SchemaVersion
+		if ret.Meta.CreatedAt.IsZero() {
+			ret.Meta.CreatedAt = now
+		}
+		if ret.Meta.KeyIssuedAt.IsZero() {
+			ret.Meta.KeyIssuedAt = now
+		}
+		m.bindClient(r, ret)
+		m.trackClient(r, ret)
+		if setCookie && m.cookieAged(ret) {
+			ret.Meta.CookieIssuedAt = now
+		}
+		if !ret.skipped {
+			ret.created = true
+			sessionHook(m.Hooks.OnCreate, ret)
+		}
+	} else {
+		sessionHook(m.Hooks.OnLoad, ret)
+	}
+	ret.snap = ret.Snapshot()
+	// stored before these existed, set after the snapshot so they get saved
+	if ret.Meta.CreatedAt.IsZero() {
+		ret.Meta.CreatedAt = now
+	}
+	if ret.Meta.KeyIssuedAt.IsZero() {
+		ret.Meta.KeyIssuedAt = now
+	}
+	// (re)bound to this client, saved with the next write
+	m.bindClient(r, ret)
+	m.trackClient(r, ret)
+	if setCookie && ret.loaded != nil && m.cookieAged(ret) {
+		ret.Meta.CookieIssuedAt = now
+	}
+
+	if rebind && !m.noCookie(r) && !ret.ReadOnly() {
+		if err := m.regenerate(w, r, ret, 0, "binding changed"); err != nil {
+			return nil, err
+		}
+	} else if m.rotateDue(ret) && !m.noCookie(r) && !ret.ReadOnly() {
+		if err := m.rotate(w, r, ret); err != nil {
+			return nil, err
+		}
+	}
+
+	m.sendExpiresIn(w, ret)
+
+	if source != SourceHit && source != SourceError && source != SourceRejected {
+		m.audit(r, AuditCreate, ret, "")
+	}
+	if m.Metrics != nil {
+		m.Metrics.SessionLoaded(source)
+	}
+	m.setAttribute(AttrSource, source)
+	m.setAttribute(AttrSize, len(ret.loaded))
+	m.logLifecycle("session "+source, ret.Key)
 
 	return ret, nil
 
@@ -210,33 +840,224 @@ func (m *Manager) MustSession(w http.ResponseWriter, r *http.Request) *Session {
 	return ret
 }
 
-// write the actual session back to he memcache backend
+// shouldRefresh decides if s is close enough to expiring that this request
+// should rewrite it (see EarlyRefresh), this is the "XFetch" approach of
+// refreshing probabilistically more often the closer we are to expiry
+func (m *Manager) shouldRefresh(s *Session) bool {
+	if m.EarlyRefresh <= 0 || s.Meta.ExpiresAt.IsZero() {
+		return false
+	}
+	gap := time.Duration(float64(m.EarlyRefresh) * -math.Log(1-rand.Float64()))
+	return !m.now().Add(gap).Before(s.Meta.ExpiresAt)
+}
+
+// refresh rewrites the session as it was read with a new expiration; if some
+// other request wrote it in the meantime we leave it alone since that write
+// extended it anyway
+func (m *Manager) refresh(s *Session) error {
+	ttl := m.ttl(m.expiration(s))
+	rec := m.newRecord(s)
+	rec.Meta.ExpiresAt = m.now().Add(ttl)
+	b, err := m.encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+	err = m.cas(s.Key, b, s.cas, ttl)
+	if err == ErrCASConflict {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	s.Meta = rec.Meta
+	s.cas = casWritten
+	s.loaded = b
+	return nil
+}
+
+// write the actual session back to he memcache backend, see ConflictStrategy
+// for what happens if another request wrote it in the meantime.  Sessions
+// which did not change since they were read or last written are not
+// written (unless ForceWrite is set), see Session.MarkModified.  Values
+// Validate rejects are not written, a *ValidationError is returned.  With
+// DeferWrites, for a session Middleware (or AutoWrite) handed out, it only
+// marks the session for writing and returns nil: the write happens once,
+// right before the response header goes out, and its error goes to
+// OnMiddlewareError and SessionWriter.Err.  Once the header is out it
+// writes right away again.
 func (m *Manager) WriteSession(w http.ResponseWriter, s *Session) error {
+	if sw := s.deferTo; sw != nil && !sw.written {
+		// still checked now, so the handler hears about it
+		if err := m.validate(s); err != nil {
+			return err
+		}
+		sw.requested = true
+		return nil
+	}
+	tm, span := m.traced(s.requestContext(), "gomemssn.WriteSession")
+	err := tm.writeSession(w, s)
+	span.End(err)
+	return err
+}
 
-	key := s.Key
+// writeSession is WriteSession, without deferring
+func (m *Manager) writeSession(w http.ResponseWriter, s *Session) (err error) {
 
-	if m.Client == nil {
-		m.stubClientMutex.Lock()
-		m.stubClient[key] = s
-		m.stubClientMutex.Unlock()
-	} else {
+	if s.debug != nil {
+		defer func() { s.debug.wrote(w, s, err) }()
+	}
+
+	if s.skipped {
+		return nil
+	}
+
+	if m.skipWrite(s) {
+		s.debug.set("skipped")
+		if m.Degraded() {
+			return m.cookieFallback(w, s, nil)
+		}
+		return nil
+	}
+
+	if s.promote && w != nil {
+		// signed in with MarkAuthenticated, on to a new key
+		return m.promote(w, s)
+	}
+
+	if !m.ForceWrite && !m.changed(s) || s.lazy && !m.worthWriting(s) {
+		s.debug.set("unchanged")
+		return nil
+	}
+
+	if err := m.validate(s); err != nil {
+		return err
+	}
+	defer timeWrite(s, time.Now())
+
+	strategy := m.conflictStrategy(s)
+	if s.lazy && w != nil && m.cookieAged(s) {
+		s.Meta.CookieIssuedAt = m.now()
+	}
+	if m.cookieOnly() {
+		return m.writeCookie(w, s)
+	}
+	// whether s has to be added to its user's index once written
+	index := s.loaded == nil || s.snap == nil || s.snap.meta.UserID != s.Meta.UserID
+	if index {
+		if err := m.limitSessions(s); err != nil {
+			return err
+		}
+	}
+	change := m.recordChange(s)
+	// with a TxStore the index is written along with the session, see tx.go
+	tx := m.transactional()
+
+	for attempt := 1; ; attempt++ {
+
+		ttl := m.ttl(m.expiration(s))
+		s.Meta.ExpiresAt = m.now().Add(ttl)
+		s.expiresAt = s.Meta.ExpiresAt
 
-		buf := &bytes.Buffer{}
-		enc := gob.NewEncoder(buf)
-		err := enc.Encode(s.Values)
+		b, err := m.encodeLimited(s)
 		if err != nil {
 			return err
 		}
-		exp := int32(m.Expiration / time.Second)
-		err = m.Client.Set(&memcache.Item{Key: key, Value: buf.Bytes(), Expiration: exp})
+
+		err = m.tx(func(tm *Manager) error {
+			var err error
+			if strategy == ConflictLastWriteWins {
+				err = tm.set(s.Key, b, ttl)
+			} else {
+				err = tm.cas(s.Key, b, s.cas, ttl)
+			}
+			if err == nil && tx {
+				err = tm.indexSession(s, index)
+			}
+			return err
+		})
+		if err == nil {
+			m.writeSucceeded()
+			if m.Metrics != nil {
+				m.Metrics.SessionWritten(len(b))
+			}
+			m.setAttribute(AttrSize, len(b))
+			m.logLifecycle("session written", s.Key, "bytes", len(b))
+			s.cas = casWritten
+			s.loaded = b
+			m.cacheWritten(s, b)
+			s.snap, s.modified = s.Snapshot(), false
+			if s.lazy && w != nil {
+				// the first write, the client gets the cookie now
+				s.lazy = false
+				if err := m.setSessionCookie(w, s, false); err != nil {
+					return err
+				}
+			}
+			if s.inCookie && w != nil {
+				// it's in the store now, so drop it from the cookie
+				s.inCookie = false
+				if err := m.setSessionCookie(w, s, false); err != nil {
+					return err
+				}
+			}
+			if err := m.writeBuckets(s); err != nil {
+				return err
+			}
+			if !tx {
+				if err := m.indexSession(s, index); err != nil {
+					return err
+				}
+			}
+			if err := m.sendJWT(w, s); err != nil {
+				return err
+			}
+			m.sendExpiresIn(w, s)
+			sessionHook(m.Hooks.OnWrite, s)
+			return nil
+		}
+		if err != ErrCASConflict {
+			m.writeFailed()
+			return m.cookieFallback(w, s, err)
+		}
+
+		if strategy != ConflictMerge || attempt > m.ConflictRetries {
+			return &ConflictError{Key: s.Key, Attempts: attempt}
+		}
+
+		// what was read, which both requests changed
+		base := &Session{Values: make(Values)}
+		if s.loaded != nil {
+			if err := m.decodeSession(s.loaded, base); err != nil {
+				return err
+			}
+		}
+		merge := m.Merge
+		if merge == nil {
+			merge = MergeChanges(base.Values)
+		}
+
+		// see what the other request wrote and combine it with ours
+		theirs := &Session{Values: make(Values)}
+		data, token, err := m.get(s.Key)
+		if err == nil {
+			err = m.decodeSession(data, theirs)
+		} else if err == ErrNotFound {
+			err = nil
+		}
 		if err != nil {
 			return err
 		}
+		if !mergeMeta(&s.Meta, base.Meta, theirs.Meta) {
+			return &ConflictError{Key: s.Key, Attempts: attempt}
+		}
+		s.Values = merge(s.Values, theirs.Values)
+		m.mergeHistory(s, theirs.Meta.History, change)
+		s.cas = token
+		s.loaded = data
+		// theirs is what is stored now, with its user already indexed
+		index = data == nil || theirs.Meta.UserID != s.Meta.UserID
 
 	}
 
-	return nil
-
 }
 
 func (m *Manager) MustWriteSession(w http.ResponseWriter, s *Session) {
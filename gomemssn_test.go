@@ -1,6 +1,8 @@
 package gomemssn
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -144,17 +146,11 @@ func TestExpiration(t *testing.T) {
 
 	fmt.Printf("TestExpiration\n")
 
-	conn, err := net.Dial("tcp", testMemcacheServer)
-	if err != nil {
-		t.Logf("No memcache running locally (%v), skipping this test", testMemcacheServer)
-		t.SkipNow()
-	} else {
-		conn.Close()
-	}
-
-	memcacheClient := memcache.New(testMemcacheServer)
-	sm := NewManager(memcacheClient, "gomemssn_test")
+	// the in-memory stub goes by Manager.Now, so no waiting is needed
+	clock := newTestClock()
+	sm := NewManager(nil, "gomemssn_test")
 	sm.Expiration = time.Second * 2
+	sm.Now = clock.Now
 	manager = sm
 
 	s := &http.Server{Handler: formHandler}
@@ -174,8 +170,8 @@ func TestExpiration(t *testing.T) {
 		t.Fatalf("expected v='abc123' but got: %v", v)
 	}
 
-	// wait past the expiration
-	time.Sleep(time.Second * 3)
+	// move past the expiration
+	clock.Advance(time.Second * 3)
 
 	v = string(mustGet("http://127.0.0.1:18080/"))
 	fmt.Printf("v=%s\n", v)
@@ -184,3 +180,147 @@ func TestExpiration(t *testing.T) {
 	}
 
 }
+
+// sessions written before Meta existed are plain gob encoded Values
+func TestDecodeLegacy(t *testing.T) {
+
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(Values{"v": "abc123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Session{}
+	err = NewManager(nil, "gomemssn_test").decodeSession(buf.Bytes(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := s.Values.GetString("v"); v != "abc123" {
+		t.Fatalf("expected v='abc123' but got: %v", v)
+	}
+
+}
+
+func TestRequireFreshAuth(t *testing.T) {
+
+	s := &Session{Values: make(Values)}
+	if !s.RequireFreshAuth(time.Minute) {
+		t.Fatalf("never authenticated session should require fresh auth")
+	}
+
+	m := NewManager(nil, "gomemssn_test")
+	s.RecordAuthentication()
+	b, err := m.encodeSession(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2 := &Session{}
+	err = m.decodeSession(b, s2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2.RequireFreshAuth(time.Minute) {
+		t.Fatalf("just authenticated session should not require fresh auth")
+	}
+
+	s2.Meta.LastAuthenticatedAt = time.Now().Add(-time.Hour)
+	if !s2.RequireFreshAuth(time.Minute) {
+		t.Fatalf("stale authentication should require fresh auth")
+	}
+
+}
+
+func TestSnapshotRollback(t *testing.T) {
+
+	s := &Session{Values: Values{"a": "1"}}
+	s.Meta.KeysAdded = map[string]time.Time{"a": time.Unix(1, 0)}
+	s.Meta.History = make([]Change, 1, 4)
+	s.Meta.LoginIntent = &LoginIntent{Route: "r", Params: map[string]string{"p": "1"}}
+	snap := s.Snapshot()
+
+	s.Values["a"] = "2"
+	s.Values["b"] = "3"
+	s.RecordAuthentication()
+	// metadata changed in place
+	s.Meta.KeysAdded["b"] = time.Unix(2, 0)
+	s.Meta.History[0].Path = "/changed"
+	s.Meta.History = append(s.Meta.History, Change{Path: "/new"})
+	s.Meta.LoginIntent.Params["p"] = "2"
+
+	s.Rollback(snap)
+	if s.Values.GetString("a") != "1" || len(s.Values) != 1 {
+		t.Fatalf("expected values to be restored but got: %v", s.Values)
+	}
+	if !s.Meta.LastAuthenticatedAt.IsZero() {
+		t.Fatalf("expected meta to be restored")
+	}
+	if len(s.Meta.KeysAdded) != 1 || len(s.Meta.History) != 1 || s.Meta.History[0].Path != "" || s.Meta.LoginIntent.Params["p"] != "1" {
+		t.Fatalf("expected meta to be restored in full but got: %+v", s.Meta)
+	}
+	s.Meta.KeysAdded["c"] = time.Unix(3, 0)
+	s.Meta.History[0].Path = "/again"
+
+	// the snapshot is still good after being rolled back to
+	s.Values["a"] = "4"
+	s.Rollback(snap)
+	if s.Values.GetString("a") != "1" {
+		t.Fatalf("expected a='1' but got: %v", s.Values.GetString("a"))
+	}
+	if len(s.Meta.KeysAdded) != 1 || s.Meta.History[0].Path != "" {
+		t.Fatalf("expected the snapshot's meta untouched but got: %+v", s.Meta)
+	}
+
+}
+
+func TestTTLJitter(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.Expiration = time.Second * 1000
+	if ttl := m.ttl(m.Expiration); ttl != time.Second*1000 {
+		t.Fatalf("expected ttl=1000 without jitter but got: %v", ttl)
+	}
+
+	m.TTLJitter = 0.1
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		ttl := m.ttl(m.Expiration)
+		if ttl < time.Second*900 || ttl > time.Second*1100 {
+			t.Fatalf("ttl %v out of the +/-10%% range", ttl)
+		}
+		seen[ttl] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("expected jitter to produce different ttls")
+	}
+
+}
+
+func TestEarlyRefresh(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now = clock.Now
+
+	s := loadTestSession(t, m, "")
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	exp := s.Meta.ExpiresAt
+	if exp.IsZero() {
+		t.Fatalf("expected ExpiresAt to be set on write")
+	}
+
+	// nowhere near expiry
+	m.EarlyRefresh = time.Second
+	if s := loadTestSession(t, m, s.Key); !s.Meta.ExpiresAt.Equal(exp) {
+		t.Fatalf("session should not have been refreshed")
+	}
+
+	// with a huge window it's practically certain to be refreshed
+	m.EarlyRefresh = time.Hour * 24 * 365
+	clock.Advance(time.Millisecond * 10)
+	if s := loadTestSession(t, m, s.Key); !s.Meta.ExpiresAt.After(exp) {
+		t.Fatalf("session should have been refreshed")
+	}
+
+}
@@ -0,0 +1,90 @@
+// Package gomemssntest helps testing handlers which use gomemssn sessions:
+//
+//	m := gomemssntest.NewTestManager()
+//	r := httptest.NewRequest("GET", "/cart", nil)
+//	gomemssntest.WithSessionValues(t, m, r, gomemssn.Values{"uid": "joe"})
+//	w := httptest.NewRecorder()
+//	m.Middleware(handler).ServeHTTP(w, r)
+//	gomemssntest.AssertSessionValue(t, m, w.Result(), "items", 3.0)
+//
+// Sessions are kept in memory by the Manager itself.
+package gomemssntest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bradleypeabody/gomemssn"
+)
+
+// NewTestManager returns a Manager keeping sessions in memory, which sends
+// the session cookie with every response that writes the session, so
+// AssertSessionValue always finds it
+func NewTestManager() *gomemssn.Manager {
+	m := gomemssn.NewManager(nil, "gomemssntest")
+	m.AlwaysSetCookie = true
+	return m
+}
+
+// WithSessionValues writes a new session with vals and adds its cookie (and
+// any other m sets along with it) to r, as if the client had it already
+func WithSessionValues(t testing.TB, m *gomemssn.Manager, r *http.Request, vals gomemssn.Values) *gomemssn.Session {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s, err := m.Session(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("gomemssntest: creating the session: %v", err)
+	}
+	for k, v := range vals {
+		s.Values[k] = v
+	}
+	if err := m.WriteSession(w, s); err != nil {
+		t.Fatalf("gomemssntest: writing the session: %v", err)
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Value != "" {
+			r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+	}
+	return s
+}
+
+// ResponseSession returns the session whose cookie resp sets
+func ResponseSession(t testing.TB, m *gomemssn.Manager, resp *http.Response) *gomemssn.Session {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/", nil)
+	found := false
+	for _, c := range resp.Cookies() {
+		if c.Name == m.TemplateCookie.Name && c.Value != "" {
+			r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("gomemssntest: the response sets no session cookie (was the session written?)")
+	}
+	s, err := m.PeekSession(r)
+	if err != nil {
+		t.Fatalf("gomemssntest: reading the session: %v", err)
+	}
+	return s
+}
+
+// AssertSessionValue fails t unless the session resp sets the cookie of has
+// want under key (compared with reflect.DeepEqual, mind that numbers read
+// back as float64 with JSONCodec); a nil want means there is no such value
+func AssertSessionValue(t testing.TB, m *gomemssn.Manager, resp *http.Response, key string, want interface{}) {
+	t.Helper()
+	got, ok := ResponseSession(t, m, resp).Values[key]
+	if want == nil && !ok {
+		return
+	}
+	if !ok {
+		t.Fatalf("gomemssntest: session has no value %q, want %#v", key, want)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("gomemssntest: session value %q = %#v, want %#v", key, got, want)
+	}
+}
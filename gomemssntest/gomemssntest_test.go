@@ -0,0 +1,32 @@
+package gomemssntest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bradleypeabody/gomemssn"
+)
+
+func TestHelpers(t *testing.T) {
+
+	m := NewTestManager()
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := gomemssn.FromContext(r.Context())
+		s.Values["items"] = s.Values.GetInt64("items") + 1
+		delete(s.Values, "gone")
+	}))
+
+	r := httptest.NewRequest("GET", "/cart", nil)
+	seeded := WithSessionValues(t, m, r, gomemssn.Values{"uid": "joe", "items": int64(2), "gone": true})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	AssertSessionValue(t, m, w.Result(), "items", int64(3))
+	AssertSessionValue(t, m, w.Result(), "uid", "joe")
+	AssertSessionValue(t, m, w.Result(), "gone", nil)
+	if s := ResponseSession(t, m, w.Result()); s.Key != seeded.Key {
+		t.Fatalf("expected the seeded session, got %q", s.Key)
+	}
+
+}
@@ -0,0 +1,119 @@
+// Package gorillastore adapts a gomemssn.Manager to gorilla/sessions' Store
+// interface, so applications and middleware written against gorilla can keep
+// their sessions in memcache without changing handlers:
+//
+//	m := gomemssn.NewManager(memcache.New("localhost:11211"), "myapp")
+//	store := gorillastore.New(m)
+//	...
+//	s, err := store.Get(r, "myapp")
+//
+// Each session name gets its own cookie of that name.  The cookie's
+// attributes come from the Manager (TemplateCookie, CookieFunc...), of the
+// session's Options only a MaxAge < 0 is looked at, which deletes it.
+// Values keys have to be strings.
+package gorillastore
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/gorilla/sessions"
+)
+
+// Store implements sessions.Store
+type Store struct {
+	Manager  *gomemssn.Manager // sessions are read and written with this
+	mu       sync.Mutex
+	managers map[string]*gomemssn.Manager // for session names other than the Manager's cookie name
+}
+
+// New returns a Store using m
+func New(m *gomemssn.Manager) *Store {
+	return &Store{Manager: m}
+}
+
+// manager returns the Manager for sessions called name, m with name as the
+// cookie name
+func (st *Store) manager(name string) *gomemssn.Manager {
+	if name == st.Manager.TemplateCookie.Name {
+		return st.Manager
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if m, ok := st.managers[name]; ok {
+		return m
+	}
+	m := *st.Manager
+	c := *st.Manager.TemplateCookie
+	c.Name = name
+	m.TemplateCookie = &c
+	if st.managers == nil {
+		st.managers = make(map[string]*gomemssn.Manager)
+	}
+	st.managers[name] = &m
+	return &m
+}
+
+// Get returns the session name of r, read once per request (see
+// sessions.GetRegistry)
+func (st *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(st, name)
+}
+
+// New reads the session name of r, or returns a new one (IsNew) if there is
+// none
+func (st *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+
+	m := st.manager(name)
+	gs := sessions.NewSession(st, name)
+	c := m.TemplateCookie
+	gs.Options = &sessions.Options{Path: c.Path, Domain: c.Domain, MaxAge: c.MaxAge, Secure: c.Secure, HttpOnly: c.HttpOnly, Partitioned: c.Partitioned, SameSite: c.SameSite}
+	gs.IsNew = true
+
+	s, err := m.PeekSession(r)
+	if err == gomemssn.ErrNotFound {
+		return gs, nil
+	} else if err != nil {
+		return gs, err
+	}
+	gs.ID = s.Key
+	for k, v := range s.Values {
+		gs.Values[k] = v
+	}
+	gs.IsNew = false
+	return gs, nil
+
+}
+
+// Save writes gs and sets its cookie, or deletes it if Options.MaxAge < 0
+func (st *Store) Save(r *http.Request, w http.ResponseWriter, gs *sessions.Session) error {
+
+	m := st.manager(gs.Name())
+	s, err := m.Session(w, r)
+	if err != nil {
+		return err
+	}
+
+	if gs.Options != nil && gs.Options.MaxAge < 0 {
+		gs.ID = ""
+		return m.DestroySession(w, s)
+	}
+
+	vals := make(gomemssn.Values, len(gs.Values))
+	for k, v := range gs.Values {
+		ks, ok := k.(string)
+		if !ok {
+			return fmt.Errorf("gorillastore: key %#v of session %q is not a string", k, gs.Name())
+		}
+		vals[ks] = v
+	}
+	s.Values = vals
+	if err := m.WriteSession(w, s); err != nil {
+		return err
+	}
+	gs.ID = s.Key
+	return nil
+
+}
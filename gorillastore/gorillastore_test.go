@@ -0,0 +1,58 @@
+package gorillastore
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bradleypeabody/gomemssn"
+)
+
+func TestStore(t *testing.T) {
+
+	m := gomemssn.NewManager(nil, "gomemssn_test")
+	st := New(m)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	gs, err := st.Get(r, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gs.IsNew {
+		t.Fatal("expected a new session")
+	}
+	gs.Values["v"] = "abc123"
+	gs.AddFlash("hello")
+	w := httptest.NewRecorder()
+	if err := gs.Save(r, w); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "app" {
+		t.Fatalf("expected an app cookie but got %v", cookies)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	gs, err = st.Get(r, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gs.IsNew || gs.Values["v"] != "abc123" || len(gs.Flashes()) != 1 {
+		t.Fatalf("expected the saved session, got %v", gs.Values)
+	}
+
+	gs.Values[1] = "x"
+	if err := gs.Save(r, httptest.NewRecorder()); err == nil {
+		t.Fatal("expected an error for a non-string key")
+	}
+	delete(gs.Values, 1)
+
+	gs.Options.MaxAge = -1
+	if err := gs.Save(r, httptest.NewRecorder()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetSessionByKey(cookies[0].Value); err != gomemssn.ErrNotFound {
+		t.Fatalf("expected the session to be deleted, got %v", err)
+	}
+
+}
@@ -0,0 +1,89 @@
+package gomemssn
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// StartHealthCheck pings the backing store in the background so an outage
+// is noticed once, instead of by every request waiting out its own timeout.
+// While the store is down (see Healthy) Session doesn't try it and goes
+// straight to OnStoreError, and writes are skipped as when Degraded.  A
+// healthy store is pinged every interval; a failed one is retried sooner,
+// with the wait doubling from minHealthBackoff up to interval, so it is
+// back in use soon after it recovers.  Close stops the checks.
+
+// minHealthBackoff is the first wait before pinging a store which failed
+const minHealthBackoff = 100 * time.Millisecond
+
+// errUnhealthy is what reads fail with while the store is marked down
+var errUnhealthy = errors.New("gomemssn: backing store failed its health check")
+
+// Ping checks that the backing store can be reached, with a read of a key
+// which doesn't have to exist; it gives up when ctx is done
+func (m *Manager) Ping(ctx context.Context) error {
+	_, _, err := m.withContext(ctx).storeGet("health")
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Healthy reports whether the backing store passed its last health check,
+// always true without StartHealthCheck
+func (m *Manager) Healthy() bool {
+	return !m.unhealthy.Load()
+}
+
+// StartHealthCheck starts pinging the backing store every interval, each
+// ping giving up after timeout, see Ping and Healthy; it replaces health
+// checks started earlier
+func (m *Manager) StartHealthCheck(interval, timeout time.Duration) {
+
+	stop := make(chan struct{})
+	m.healthMutex.Lock()
+	if m.healthStop != nil {
+		close(m.healthStop)
+	}
+	m.healthStop = stop
+	m.healthMutex.Unlock()
+
+	go func() {
+		wait := time.Duration(0)
+		backoff := minHealthBackoff
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(wait):
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err := m.Ping(ctx)
+			cancel()
+			if err == nil {
+				if m.unhealthy.Swap(false) {
+					m.logger().Info("backing store is healthy again")
+				}
+				wait, backoff = interval, minHealthBackoff
+				continue
+			}
+			if !m.unhealthy.Swap(true) {
+				m.logger().Warn("backing store failed its health check", "err", err)
+			}
+			wait = min(backoff, interval)
+			backoff *= 2
+		}
+	}()
+
+}
+
+// stopHealthCheck stops what StartHealthCheck started
+func (m *Manager) stopHealthCheck() {
+	m.healthMutex.Lock()
+	defer m.healthMutex.Unlock()
+	if m.healthStop != nil {
+		close(m.healthStop)
+		m.healthStop = nil
+	}
+}
@@ -0,0 +1,68 @@
+package gomemssn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// a store which fails all reads while down is set
+type healthStore struct {
+	*MemoryStore
+	down *atomic.Bool
+}
+
+func (hs healthStore) GetCAS(key string) ([]byte, interface{}, error) {
+	if hs.down.Load() {
+		return nil, nil, errors.New("store is down")
+	}
+	return hs.MemoryStore.GetCAS(key)
+}
+
+func TestHealthCheck(t *testing.T) {
+
+	var down atomic.Bool
+	m := NewManager(nil, "gomemssn_test")
+	m.Store = healthStore{MemoryStore: NewMemoryStore(), down: &down}
+	defer m.Close()
+
+	if err := m.Ping(context.Background()); err != nil || !m.Healthy() {
+		t.Fatalf("expected a healthy store, got %v", err)
+	}
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+
+	waitFor := func(healthy bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for m.Healthy() != healthy {
+			if time.Now().After(deadline) {
+				t.Fatalf("store never became healthy=%v", healthy)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	m.StartHealthCheck(10*time.Millisecond, time.Second)
+	down.Store(true)
+	waitFor(false)
+	if !m.Degraded() {
+		t.Fatalf("expected writes to be skipped while the store is down")
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	if _, err := m.Session(httptest.NewRecorder(), r); !errors.Is(err, ErrStoreUnavailable) {
+		t.Fatalf("expected ErrStoreUnavailable but got %v", err)
+	}
+
+	down.Store(false)
+	waitFor(true)
+	if s2 := loadTestSession(t, m, s.Key); s2.Values["v"] != "abc123" {
+		t.Fatalf("unexpected values after recovery: %v", s2.Values)
+	}
+
+}
@@ -0,0 +1,74 @@
+package gomemssn
+
+import (
+	"reflect"
+	"sort"
+	"time"
+)
+
+// With HistoryLength set each write which changes Values appends a Change to
+// Meta.History, the last HistoryLength of them being kept, so an incident
+// investigation can see how a session got to the state it is in.  Only the
+// names of the keys which changed are kept, never the values.
+
+// Change is an entry in Meta.History
+type Change struct {
+	Time time.Time // when the session was written
+	Keys []string  // the keys of Values which were added, changed or removed, sorted
+	Path string    // URL path of the request which wrote it, "" if there was none
+}
+
+// changedKeys returns the keys of Values which differ from the snapshot of s
+func changedKeys(s *Session) []string {
+	var old Values
+	if s.snap != nil {
+		old = s.snap.values
+	}
+	var ret []string
+	for k, v := range s.Values {
+		if ov, ok := old[k]; !ok || !reflect.DeepEqual(ov, v) {
+			ret = append(ret, k)
+		}
+	}
+	for k := range old {
+		if _, ok := s.Values[k]; !ok {
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// recordChange appends what changed in s to its history, and returns the
+// entry, nil if nothing did or there is no history
+func (m *Manager) recordChange(s *Session) *Change {
+	if m.HistoryLength <= 0 {
+		return nil
+	}
+	keys := changedKeys(s)
+	if len(keys) == 0 {
+		return nil
+	}
+	c := Change{Time: m.now().UTC(), Keys: keys}
+	if s.req != nil {
+		c.Path = s.req.URL.Path
+	}
+	s.Meta.History = m.trimHistory(append(s.Meta.History, c))
+	return &c
+}
+
+// mergeHistory puts c after the history another request wrote, for a merged
+// conflicting write
+func (m *Manager) mergeHistory(s *Session, theirs []Change, c *Change) {
+	if c == nil {
+		return
+	}
+	s.Meta.History = m.trimHistory(append(append([]Change(nil), theirs...), *c))
+}
+
+func (m *Manager) trimHistory(h []Change) []Change {
+	if n := len(h) - m.HistoryLength; n > 0 {
+		h = append([]Change(nil), h[n:]...)
+	}
+	return h
+}
@@ -0,0 +1,44 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.HistoryLength = 2
+	key := ""
+	write := func(path string, f func(Values)) *Session {
+		r := httptest.NewRequest("POST", path, nil)
+		if key != "" {
+			r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: key})
+		}
+		s := m.MustSession(httptest.NewRecorder(), r)
+		f(s.Values)
+		m.MustWriteSession(nil, s)
+		key = s.Key
+		return s
+	}
+
+	write("/login", func(v Values) { v["uid"] = "joe"; v["role"] = "user" })
+	write("/cart", func(v Values) { v["cart"] = "1 item" })
+	write("/noop", func(v Values) {})
+	s := write("/admin", func(v Values) { v["role"] = "admin"; delete(v, "cart") })
+
+	var got []Change
+	for _, c := range s.Meta.History {
+		if c.Time.IsZero() {
+			t.Fatalf("expected the time of the change, got %+v", c)
+		}
+		got = append(got, Change{Keys: c.Keys, Path: c.Path})
+	}
+	want := []Change{{Keys: []string{"cart"}, Path: "/cart"}, {Keys: []string{"cart", "role"}, Path: "/admin"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the last two changes, got %+v", got)
+	}
+
+}
@@ -0,0 +1,32 @@
+package gomemssn
+
+import (
+	"net/http"
+)
+
+// Hooks are callbacks for stages of a session's life, for analytics, logging
+// or adding to sessions (say, stamping geo info on new ones) without
+// wrapping every handler.  r is the request the session was read for, nil
+// for sessions from the admin functions.  Changes OnCreate and OnLoad make
+// to s don't count as changes by themselves, they are saved whenever the
+// session is written; OnCreate is the place to seed new sessions with
+// defaults (a locale from Accept-Language, an experiment bucket...).
+type Hooks struct {
+	OnCreate  func(r *http.Request, s *Session) // Session started a new session
+	OnLoad    func(r *http.Request, s *Session) // Session read an existing session
+	OnWrite   func(r *http.Request, s *Session) // WriteSession wrote s to the backing store
+	OnDestroy func(r *http.Request, s *Session) // s is about to be destroyed, by DestroySession or AbsoluteExpiration
+}
+
+// IsNew reports whether Session started the session for this request, as
+// opposed to reading one the client had (see Hooks.OnCreate)
+func (s *Session) IsNew() bool {
+	return s.created
+}
+
+// sessionHook calls hook, if set, with s and the request it was read for
+func sessionHook(hook func(r *http.Request, s *Session), s *Session) {
+	if hook != nil {
+		hook(s.req, s)
+	}
+}
@@ -0,0 +1,53 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	var events []string
+	hook := func(name string) func(r *http.Request, s *Session) {
+		return func(r *http.Request, s *Session) {
+			if r == nil {
+				t.Errorf("expected the request in %s", name)
+			}
+			events = append(events, name)
+		}
+	}
+	m.Hooks = Hooks{OnLoad: hook("load"), OnWrite: hook("write"), OnDestroy: hook("destroy")}
+	m.Hooks.OnCreate = func(r *http.Request, s *Session) {
+		events = append(events, "create")
+		if !s.IsNew() {
+			t.Error("expected IsNew in OnCreate")
+		}
+		s.Values["country"] = r.Header.Get("X-Country")
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Country", "NZ")
+	s := m.MustSession(httptest.NewRecorder(), r)
+	m.MustWriteSession(nil, s)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(s.Cookie)
+	s2 := m.MustSession(httptest.NewRecorder(), r)
+	if !s.IsNew() || s2.IsNew() {
+		t.Fatalf("expected only the first session to be new")
+	}
+	if s2.Values["country"] != "NZ" {
+		t.Fatalf("expected what OnCreate set to be saved, got %v", s2.Values)
+	}
+	if err := m.DestroySession(httptest.NewRecorder(), s2); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(events, ","); got != "create,write,load,destroy" {
+		t.Fatalf("unexpected hook calls: %s", got)
+	}
+
+}
@@ -0,0 +1,158 @@
+package gomemssn
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// With JWTKey set, sessions tied to a user (see Session.SetUserID) come with
+// a second cookie holding a JWT (HS256) of the user ID, the session it was
+// issued for and an expiry.  When the session can't be read because the
+// backing store is down, the JWT still says who the user is: Session returns
+// a read-only session (see Session.FromJWT) with just the user ID, instead
+// of a signed out one.  A session missing from the store (flushed, evicted)
+// looks just like a destroyed one, so JWTs are only used for those with
+// JWTOnMiss.  JWTs are only accepted along with the session cookie they were
+// issued for, and dropped by DestroySession; they can't be revoked otherwise
+// (DestroyAllForUser doesn't), so JWTExpiration is short by default.
+
+const defaultJWTExpiration = 15 * time.Minute
+
+// jwtHeader is the encoded header of the JWTs, the only one accepted
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// jwtClaims are the claims of the JWTs
+type jwtClaims struct {
+	Subject   string `json:"sub"` // the user ID
+	SessionID string `json:"sid"` // SessionID of the session key
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (m *Manager) jwtCookieName() string {
+	return m.TemplateCookie.Name + "_jwt"
+}
+
+func (m *Manager) jwtExpiration() time.Duration {
+	if m.JWTExpiration > 0 {
+		return m.JWTExpiration
+	}
+	return defaultJWTExpiration
+}
+
+func (m *Manager) jwtSign(data string) string {
+	mac := hmac.New(sha256.New, m.JWTKey)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issueJWT returns a JWT for the user of the session key
+func (m *Manager) issueJWT(key, uid string) (string, error) {
+	now := m.now()
+	b, err := json.Marshal(jwtClaims{
+		Subject:   uid,
+		SessionID: SessionID(key),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(m.jwtExpiration()).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	data := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(b)
+	return data + "." + m.jwtSign(data), nil
+}
+
+// parseJWT returns the user ID in token if it is genuine, unexpired and for
+// the session key
+func (m *Manager) parseJWT(token, key string) (string, bool) {
+	header, rest, _ := strings.Cut(token, ".")
+	payload, sig, ok := strings.Cut(rest, ".")
+	if !ok || header != jwtHeader || !hmac.Equal([]byte(sig), []byte(m.jwtSign(header+"."+payload))) {
+		return "", false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", false
+	}
+	var c jwtClaims
+	if err := json.Unmarshal(b, &c); err != nil {
+		return "", false
+	}
+	if c.Subject == "" || c.SessionID != SessionID(key) || m.now().Unix() >= c.ExpiresAt {
+		return "", false
+	}
+	return c.Subject, true
+}
+
+// jwtSession returns a read-only session for the user of the JWT r has for
+// the session key, nil if there is no valid one
+func (m *Manager) jwtSession(r *http.Request, key string) *Session {
+	if len(m.JWTKey) == 0 {
+		return nil
+	}
+	c, err := r.Cookie(m.jwtCookieName())
+	if err != nil {
+		return nil
+	}
+	uid, ok := m.parseJWT(c.Value, key)
+	if !ok {
+		return nil
+	}
+	s := m.newSession(key)
+	s.Meta.UserID = uid
+	s.skipped, s.fromJWT = true, true
+	return s
+}
+
+// jwtCookie returns the cookie for the JWT value, one which expires it if
+// value is ""
+func (m *Manager) jwtCookie(r *http.Request, value string) *http.Cookie {
+	c := *m.TemplateCookie
+	if r != nil {
+		m.requestCookie(r, &c)
+	}
+	c.Name, c.Value, c.HttpOnly = m.jwtCookieName(), value, true
+	if value == "" {
+		c.MaxAge = -1
+		c.Expires = time.Unix(1, 0)
+	} else {
+		c.MaxAge = int(m.jwtExpiration() / time.Second)
+		c.Expires = m.now().Add(m.jwtExpiration())
+	}
+	return &c
+}
+
+// sendJWT sets the JWT cookie for s after it was written, or clears it if s
+// has no user (any more)
+func (m *Manager) sendJWT(w http.ResponseWriter, s *Session) error {
+	if len(m.JWTKey) == 0 || w == nil {
+		return nil
+	}
+	value := ""
+	if uid := s.Meta.UserID; uid != "" && s.Key != "" {
+		var err error
+		if value, err = m.issueJWT(s.Key, uid); err != nil {
+			return err
+		}
+	} else if s.req == nil {
+		return nil
+	} else if _, err := s.req.Cookie(m.jwtCookieName()); err != nil {
+		// nothing to clear
+		return nil
+	}
+	dropCookie(w.Header(), m.jwtCookieName())
+	setCookie(w, m.jwtCookie(s.req, value))
+	return nil
+}
+
+// FromJWT reports whether the session couldn't be read and was made up from
+// its JWT (see Manager.JWTKey): it has the user ID and nothing else, and is
+// read-only
+func (s *Session) FromJWT() bool {
+	return s.fromJWT
+}
@@ -0,0 +1,102 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJWT(t *testing.T) {
+
+	clock := newTestClock()
+	down := false
+	ms := NewMemoryStore()
+	m := NewManager(nil, "gomemssn_test")
+	m.Store = downStore{MemoryStore: ms, down: &down}
+	m.Now = clock.Now
+	m.JWTKey = []byte("0123456789abcdef")
+	m.JWTExpiration = time.Hour
+
+	w := httptest.NewRecorder()
+	s := loadTestSession(t, m, "")
+	s.SetUserID("joe")
+	m.MustWriteSession(w, s)
+	var jwt *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == m.TemplateCookie.Name+"_jwt" {
+			jwt = c
+		}
+	}
+	if jwt == nil || !jwt.HttpOnly || jwt.MaxAge != 3600 {
+		t.Fatalf("expected a JWT cookie but got %v", w.Result().Cookies())
+	}
+
+	load := func(key string) *Session {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: key})
+		r.AddCookie(jwt)
+		s, err := m.Session(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	if s2 := load(s.Key); s2.FromJWT() {
+		t.Fatalf("the session is there, the JWT should not be used")
+	}
+
+	down = true
+	if s2 := load(s.Key); !s2.FromJWT() || s2.UserID() != "joe" || !s2.ReadOnly() {
+		t.Fatalf("expected a read-only session for joe from the JWT, got %+v", s2.Meta)
+	}
+	down = false
+
+	// the cache was flushed, which looks like the session was destroyed
+	ms.Delete(m.storeKey(s.Key))
+	if s2 := load(s.Key); s2.FromJWT() {
+		t.Fatalf("the JWT should not be used for a missing session without JWTOnMiss")
+	}
+	m.JWTOnMiss = true
+	if s2 := load(s.Key); !s2.FromJWT() || s2.UserID() != "joe" {
+		t.Fatalf("expected the JWT to survive a flush, got %+v", s2.Meta)
+	}
+	// but only along with its session
+	if s2 := load("other"); s2.FromJWT() || s2.UserID() != "" {
+		t.Fatalf("the JWT should not work for another session")
+	}
+	clock.Advance(2 * time.Hour)
+	if s2 := load(s.Key); s2.FromJWT() {
+		t.Fatalf("the JWT should have expired")
+	}
+
+	// a forged one
+	clock.Advance(-2 * time.Hour)
+	jwt.Value = jwt.Value[:len(jwt.Value)-3] + "abc"
+	if s2 := load(s.Key); s2.FromJWT() {
+		t.Fatalf("a JWT with a bad signature should not be accepted")
+	}
+
+	// logging out drops it
+	s = loadTestSession(t, m, "")
+	s.SetUserID("ann")
+	m.MustWriteSession(nil, s)
+	w = httptest.NewRecorder()
+	if err := m.DestroySession(w, s); err != nil {
+		t.Fatal(err)
+	}
+	cleared := false
+	for _, c := range w.Result().Cookies() {
+		cleared = cleared || c.Name == m.TemplateCookie.Name+"_jwt" && c.MaxAge < 0
+	}
+	if !cleared {
+		t.Fatalf("expected the JWT cookie to be cleared, got %v", w.Result().Cookies())
+	}
+
+	m.JWTExpiration = 0
+	if c := m.jwtCookie(nil, "x"); c.MaxAge != 15*60 {
+		t.Fatalf("expected JWTs to last 15 minutes by default, got %d", c.MaxAge)
+	}
+
+}
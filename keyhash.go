@@ -0,0 +1,63 @@
+package gomemssn
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// With Manager.KeyHashSecret set the backing store never sees a session key:
+// entries are stored under an HMAC of the key (or of the key derived from
+// it), and user indexes, which list session keys, are encrypted.  Someone
+// who can read memcache, or list its keys, finds nothing they could put in a
+// cookie.  Shard hints (see KeyHint) are kept in front of the HMAC, so
+// ShardedStore still works.  Changing the secret loses all sessions, and
+// store keys can't be mapped back to session keys (gomemssnctl list shows
+// HMACs, MigrateBareKeys finds nothing).
+
+// hashKey returns the HMAC of key under KeyHashSecret, behind its shard hint
+func (m *Manager) hashKey(key string) string {
+	mac := hmac.New(sha256.New, m.KeyHashSecret)
+	mac.Write([]byte(key))
+	h := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	if hint := KeyHint(key); hint != "" {
+		return shardSep + hint + shardSep + h
+	}
+	return h
+}
+
+// indexKey is the AES key user indexes are encrypted with, derived from
+// KeyHashSecret
+func (m *Manager) indexKey() []byte {
+	h := sha256.Sum256(append([]byte("gomemssn user index\x00"), m.KeyHashSecret...))
+	return h[:]
+}
+
+// encodeIndex returns the user index entry listing keys
+func (m *Manager) encodeIndex(keys []string) ([]byte, error) {
+	data := []byte(strings.Join(keys, "\n"))
+	if len(m.KeyHashSecret) == 0 {
+		return data, nil
+	}
+	b, err := sealWith(m.indexKey(), data)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(sealMagic), b...), nil
+}
+
+// parseIndex returns the keys in a user index entry; one which can't be
+// decrypted (KeyHashSecret changed) lists none
+func (m *Manager) parseIndex(data []byte) []string {
+	if strings.HasPrefix(string(data), sealMagic) {
+		var ok bool
+		if data, ok = openWith(data[len(sealMagic):], [][]byte{m.indexKey()}); !ok {
+			return nil
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(string(data), "\n")
+}
@@ -0,0 +1,98 @@
+package gomemssn
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// storeKey is the key the backing store knows key (a session key or one
+// derived from it) by, see Manager.KeyFunc, Manager.MemcacheKeyPrefix and
+// Manager.KeyHashSecret
+func (m *Manager) storeKey(key string) string {
+	if len(m.KeyHashSecret) > 0 && key != "" {
+		key = m.hashKey(key)
+	}
+	if m.KeyFunc != nil {
+		return m.KeyFunc(key)
+	}
+	if m.HashKeyPrefix && m.MemcacheKeyPrefix != "" {
+		return hashPrefix(m.MemcacheKeyPrefix) + key
+	}
+	return m.MemcacheKeyPrefix + key
+}
+
+// StoreKey returns the key the backing store knows session key by, for tools
+// which look at the store directly (StoreKey("") is the prefix of them all
+// unless KeyFunc is set)
+func (m *Manager) StoreKey(key string) string {
+	return m.storeKey(key)
+}
+
+// maxKeyLength is the longest session key accepted, which leaves room for
+// MemcacheKeyPrefix and the suffixes of derived keys within memcache's 250
+const maxKeyLength = 200
+
+// validKey reports whether key can be a session key: not too long, and
+// printable ASCII other than space and the separators of derived keys (':'
+// and '#'), which memcache's text protocol would choke on or which could
+// name another entry
+func validKey(key string) bool {
+	if key == "" || len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c <= ' ' || c >= 0x7f || c == ':' || c == '#' {
+			return false
+		}
+	}
+	return true
+}
+
+// hashPrefix shortens a key prefix to 12 characters, see HashKeyPrefix
+func hashPrefix(prefix string) string {
+	h := sha256.Sum256([]byte(prefix))
+	return base64.RawURLEncoding.EncodeToString(h[:9])
+}
+
+// migrateBareKey moves the session key (and its heavy values) from the bare
+// key to its store key, see Manager.MigrateBareKeys, and returns it as get
+// would.  Sessions written in chunks under the bare key are not looked for,
+// chunking came after keys were prefixed.
+func (m *Manager) migrateBareKey(key string) ([]byte, interface{}, error) {
+
+	if m.storeKey(key) == key {
+		return nil, nil, ErrNotFound
+	}
+
+	st := m.store()
+	data, err := st.Get(key)
+	if err == ErrNotFound {
+		// possibly just migrated by a concurrent request
+		return m.get(key)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	// a concurrent migration of the same session is fine, the cas makes
+	// sure only one of them is written
+	err = m.cas(key, data, nil, m.ttl(m.keyExpiration(key)))
+	if err != nil && err != ErrCASConflict {
+		return nil, nil, err
+	}
+	for _, name := range m.HeavyKeys {
+		b, err := st.Get(bucketKey(key, name))
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if err := m.set(bucketKey(key, name), b, m.ttl(m.keyExpiration(key))); err != nil {
+			return nil, nil, err
+		}
+		st.Delete(bucketKey(key, name))
+	}
+	st.Delete(key)
+
+	return m.get(key)
+
+}
@@ -0,0 +1,169 @@
+package gomemssn
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStoreKeys(t *testing.T) {
+
+	m := NewManager(nil, "app1")
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+	if m.stub.Len() != 1 {
+		t.Fatalf("expected one entry but got %d", m.stub.Len())
+	}
+	if _, err := m.stub.Get("app1" + s.Key); err != nil {
+		t.Fatalf("session not under the prefixed key: %v", err)
+	}
+
+	// a second app on the same store doesn't see it
+	m2 := NewManager(nil, "app2")
+	m2.Store = m.stub
+	if _, _, err := m2.get(s.Key); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+
+	m2.KeyFunc = func(key string) string { return "shared/" + key }
+	s2 := loadTestSession(t, m2, "")
+	m2.MustWriteSession(nil, s2)
+	if _, err := m.stub.Get("shared/" + s2.Key); err != nil {
+		t.Fatalf("session not under the KeyFunc key: %v", err)
+	}
+
+}
+
+func TestMigrateBareKeys(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.HeavyKeys = []string{"cart"}
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	s.Values["cart"] = "stuff"
+	m.MustWriteSession(nil, s)
+
+	// move it where versions before the prefix was applied put it
+	for _, k := range []string{s.Key, bucketKey(s.Key, "cart")} {
+		b, err := m.stub.Get(m.storeKey(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.stub.Set(k, b, 0)
+		m.stub.Delete(m.storeKey(k))
+	}
+
+	if s := loadTestSession(t, m, s.Key); s.Values["v"] != nil {
+		t.Fatalf("bare key used without MigrateBareKeys: %v", s.Values)
+	}
+
+	m.MigrateBareKeys = true
+	s = loadTestSession(t, m, s.Key)
+	if s.Values["v"] != "abc123" {
+		t.Fatalf("session not migrated: %v", s.Values)
+	}
+	if v, err := s.Bucket("cart").Load(context.Background()); err != nil || v != "stuff" {
+		t.Fatalf("heavy value not migrated: %v %v", v, err)
+	}
+	m.stub.mu.RLock()
+	defer m.stub.mu.RUnlock()
+	for k := range m.stub.entries {
+		if !strings.HasPrefix(k, "gomemssn_test") {
+			t.Fatalf("bare key %q left behind", k)
+		}
+	}
+
+}
+
+func TestKeyGenerator(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	n := 0
+	m.KeyGenerator = func() string {
+		n++
+		return "shard1-" + strings.Repeat("k", n)
+	}
+	s := loadTestSession(t, m, "")
+	if s.Key != "shard1-k" {
+		t.Fatalf("expected the generated key but got %q", s.Key)
+	}
+	if err := m.RegenerateSession(nil, httptest.NewRequest("GET", "/", nil), s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Key != "shard1-kk" {
+		t.Fatalf("expected the next generated key but got %q", s.Key)
+	}
+
+	m.KeyGenerator = func() string { return "" }
+	_, err := m.Session(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if err == nil {
+		t.Fatal("expected an error for an empty key")
+	}
+
+}
+
+func TestMalformedKeys(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	for _, key := range []string{"a b", "a\r\nset x 0 0 1", "a:cart", strings.Repeat("k", maxKeyLength+1)} {
+		s := loadTestSession(t, m, key)
+		if s.Key == key || !validKey(s.Key) {
+			t.Fatalf("expected a new session for %q but got %q", key, s.Key)
+		}
+	}
+	if key := strings.Repeat("k", maxKeyLength); !validKey(key) {
+		t.Fatal("expected a key of maxKeyLength to be valid")
+	}
+
+	m.KeyGenerator = func() string { return "has space" }
+	if _, err := m.Session(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); err == nil {
+		t.Fatal("expected an error for an invalid generated key")
+	}
+
+}
+
+func TestKeyHashSecret(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.KeyHashSecret = []byte("server secret")
+	m.HeavyKeys = []string{"cart"}
+
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	s.Values["cart"] = "big"
+	s.SetUserID("joe")
+	m.MustWriteSession(nil, s)
+
+	m.stub.mu.Lock()
+	for k, e := range m.stub.entries {
+		if strings.Contains(k, s.Key) || bytes.Contains(e.data, []byte(s.Key)) {
+			t.Errorf("session key in the store: %q %q", k, e.data)
+		}
+	}
+	m.stub.mu.Unlock()
+
+	if s2 := loadTestSession(t, m, s.Key); s2.Values.GetString("v") != "abc123" {
+		t.Fatalf("expected the session back, got %v", s2.Values)
+	}
+	sessions, err := m.SessionsForUser("joe")
+	if err != nil || sessions[s.Key] == nil {
+		t.Fatalf("expected the session in the user index, got %v, %v", sessions, err)
+	}
+
+	// another secret finds nothing
+	m.KeyHashSecret = []byte("other secret")
+	if s2 := loadTestSession(t, m, s.Key); len(s2.Values) != 0 {
+		t.Fatalf("expected no session with another secret, got %v", s2.Values)
+	}
+	if sessions, _ := m.SessionsForUser("joe"); len(sessions) != 0 {
+		t.Fatalf("expected no sessions with another secret, got %v", sessions)
+	}
+
+	if h := KeyHint(m.storeKey("~eu~abc:cart")); h != "eu" {
+		t.Fatalf("expected the shard hint to be kept, got %q", h)
+	}
+
+}
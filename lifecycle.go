@@ -0,0 +1,188 @@
+package gomemssn
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RegenerateSession moves s to a fresh key: it is written under the new key
+// (with all its values), the old key is deleted from the backing store and the
+// cookie is re-issued.  Call it after logging in or any other privilege
+// escalation, so a key planted or sniffed before then (session fixation) is
+// worthless.  Returns ErrReadOnly if the session can't be written.
+func (m *Manager) RegenerateSession(w http.ResponseWriter, r *http.Request, s *Session) error {
+	return m.regenerate(w, r, s, 0, "")
+}
+
+// regenerate is RegenerateSession, but with grace > 0 the old key is left in
+// the backing store for that long instead of being deleted
+func (m *Manager) regenerate(w http.ResponseWriter, r *http.Request, s *Session, grace time.Duration, detail string) error {
+
+	if s.skipped {
+		return nil
+	}
+	if s.ReadOnly() {
+		return ErrReadOnly
+	}
+
+	// heavy values move with the session, read the ones we didn't yet
+	for _, name := range m.HeavyKeys {
+		if _, ok := s.buckets[name]; !ok {
+			if err := m.loadBucket(s, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	key, err := m.tierKey(s)
+	if err != nil {
+		return err
+	}
+	oldKey := s.Key
+	s.Key = key
+	s.cas, s.loaded, s.buckets = nil, nil, nil
+	s.Meta.KeyIssuedAt = m.now()
+	if err := m.writeSession(w, s); err != nil {
+		return err
+	}
+
+	if grace > 0 {
+		// requests already under way with the old key still find it, with the
+		// new KeyIssuedAt so they don't each rotate it again
+		m.cacheDel(oldKey)
+		if err := m.set(oldKey, s.loaded, grace); err != nil {
+			return err
+		}
+		st := m.store()
+		for _, name := range m.HeavyKeys {
+			st.Touch(m.storeKey(bucketKey(oldKey, name)), grace)
+		}
+	} else if err := m.delSession(oldKey); err != nil {
+		return err
+	}
+
+	if err := m.setSessionCookie(w, s, false); err != nil {
+		return err
+	}
+	if detail != "" {
+		detail = "; " + detail
+	}
+	m.audit(r, AuditRegenerate, s, "previous="+SessionID(oldKey)+detail)
+
+	return nil
+}
+
+// setSessionCookie (re)issues the cookie for s, or one which makes the client
+// delete it if expire is true, replacing one set earlier in the same response
+func (m *Manager) setSessionCookie(w http.ResponseWriter, s *Session, expire bool) error {
+	value, err := m.cookieValue(s.Key)
+	if err != nil {
+		return err
+	}
+	m.replaceCookie(w, s, value)
+	if err := m.checkCookie(s.Cookie); err != nil {
+		return err
+	}
+	if expire {
+		s.Cookie.MaxAge = -1
+		s.Cookie.Expires = time.Unix(1, 0)
+	}
+	if w != nil {
+		m.sendCookie(w, s.Cookie)
+	}
+	return nil
+}
+
+// replaceCookie sets the value of the cookie of s and removes the cookie set
+// earlier in the same response, if any, so it can be set again
+func (m *Manager) replaceCookie(w http.ResponseWriter, s *Session, value string) {
+	if s.Cookie == nil {
+		s.cookie = *m.TemplateCookie
+		crossSiteSecure(&s.cookie)
+		s.Cookie = &s.cookie
+	}
+	s.Cookie.Value = value
+	if w != nil {
+		dropCookie(w.Header(), s.Cookie.Name)
+	}
+}
+
+// dropCookie removes the Set-Cookie headers for the cookie name from h
+func dropCookie(h http.Header, name string) {
+	prefix := name + "="
+	kept := h["Set-Cookie"][:0]
+	for _, v := range h["Set-Cookie"] {
+		if !strings.HasPrefix(v, prefix) {
+			kept = append(kept, v)
+		}
+	}
+	h["Set-Cookie"] = kept
+}
+
+// DestroySession deletes s from the backing store and tells the client to
+// drop its cookie, i.e. logs out.  s is emptied and writing it afterwards does
+// nothing.  In read-only mode the cookie is still expired but ErrReadOnly is
+// returned as the session itself stays in the backing store.
+func (m *Manager) DestroySession(w http.ResponseWriter, s *Session) (err error) {
+
+	if s.skipped {
+		return nil
+	}
+	if m.Tracer != nil && m.trace == nil {
+		tm, span := m.traced(s.requestContext(), "gomemssn.DestroySession")
+		defer func() { span.End(err) }()
+		m = tm
+	}
+
+	sessionHook(m.Hooks.OnDestroy, s)
+	if s.req != nil {
+		// later calls to Session in this request start over
+		m.cacheSession(s.req, nil)
+	}
+	key := s.Key
+	s.Key = ""
+	if err := m.setSessionCookie(w, s, true); err != nil {
+		return err
+	}
+	if len(m.JWTKey) > 0 && w != nil {
+		setCookie(w, m.jwtCookie(s.req, ""))
+	}
+	if m.ExpiresHeader != "" && w != nil {
+		w.Header().Set(m.ExpiresHeader, "0")
+	}
+	for k := range s.Values {
+		delete(s.Values, k)
+	}
+	s.skipped = true
+
+	if m.ReadOnly() || m.Degraded() {
+		return ErrReadOnly
+	}
+	// with a TxStore it goes from its user's index at the same time, see
+	// tx.go; otherwise the index drops it when next read
+	tx, uid := m.transactional(), s.Meta.UserID
+	err = m.tx(func(tm *Manager) error {
+		err := tm.delSession(key)
+		if err == nil && tx {
+			err = tm.unindexSession(uid, key)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	m.audit(nil, AuditDestroy, &Session{Key: key}, "")
+	return nil
+}
+
+// delSession removes the session with key and its heavy values from the backing store
+func (m *Manager) delSession(key string) error {
+	for _, name := range m.HeavyKeys {
+		if err := m.del(bucketKey(key, name)); err != nil {
+			return err
+		}
+	}
+	return m.del(key)
+}
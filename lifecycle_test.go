@@ -0,0 +1,134 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegenerateSession(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.HeavyKeys = []string{"cart"}
+	m.OnConflict = ConflictFail
+
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["user"] = "joe"
+	s.Values["cart"] = "stuff"
+	m.MustWriteSession(w, s)
+	oldKey := s.Key
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.AddCookie(&http.Cookie{Name: s.Cookie.Name, Value: oldKey})
+	w = httptest.NewRecorder()
+	s = m.MustSession(w, r)
+	if err := m.RegenerateSession(w, r, s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Key == oldKey {
+		t.Fatalf("key was not changed")
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != s.Key {
+		t.Fatalf("expected only the new cookie to be set but got: %v", cookies)
+	}
+	if _, _, err := m.get(oldKey); err != ErrNotFound {
+		t.Fatalf("old key still in backing store: %v", err)
+	}
+	if _, _, err := m.get(bucketKey(oldKey, "cart")); err != ErrNotFound {
+		t.Fatalf("old heavy value still in backing store: %v", err)
+	}
+
+	s = loadTestSession(t, m, s.Key)
+	if s.Values["user"] != "joe" {
+		t.Fatalf("values not copied: %v", s.Values)
+	}
+	if v, err := s.Bucket("cart").Load(r.Context()); err != nil || v != "stuff" {
+		t.Fatalf("heavy value not copied: %v %v", v, err)
+	}
+	// and it can be written as usual afterwards
+	m.MustWriteSession(nil, s)
+
+	m.SetReadOnly(true)
+	if err := m.RegenerateSession(nil, r, s); err != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+
+}
+
+func TestDestroySession(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.HeavyKeys = []string{"cart"}
+
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["user"] = "joe"
+	s.Values["cart"] = "stuff"
+	m.MustWriteSession(w, s)
+	key := s.Key
+
+	w = httptest.NewRecorder()
+	s = loadTestSession(t, m, key)
+	if err := m.DestroySession(w, s); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 || cookies[0].Value != "" {
+		t.Fatalf("expected an expired cookie but got: %v", cookies)
+	}
+	if m.stub.Len() != 0 {
+		t.Fatalf("session still in backing store")
+	}
+
+	// writing it again must not bring it back
+	s.Values["user"] = "joe"
+	m.MustWriteSession(nil, s)
+	if m.stub.Len() != 0 {
+		t.Fatalf("destroyed session was written")
+	}
+
+}
+
+func TestRotateEvery(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.RotateEvery = time.Hour
+
+	s := loadTestSession(t, m, "")
+	s.Values["user"] = "joe"
+	m.MustWriteSession(nil, s)
+	oldKey := s.Key
+
+	newReq := func(key string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: key})
+		return r
+	}
+
+	// not due yet
+	s = m.MustSession(httptest.NewRecorder(), newReq(oldKey))
+	if s.Key != oldKey {
+		t.Fatalf("key rotated too early")
+	}
+
+	s.Meta.KeyIssuedAt = time.Now().Add(-2 * time.Hour)
+	m.MustWriteSession(nil, s)
+
+	w := httptest.NewRecorder()
+	s = m.MustSession(w, newReq(oldKey))
+	if s.Key == oldKey || s.Values.GetString("user") != "joe" {
+		t.Fatalf("expected the session under a new key, got %q %v", s.Key, s.Values)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != s.Key {
+		t.Fatalf("expected the new key in the cookie, got %v", cookies)
+	}
+
+	// the old key keeps working for a while
+	if s2 := m.MustSession(httptest.NewRecorder(), newReq(oldKey)); s2.Values.GetString("user") != "joe" || s2.Key != oldKey {
+		t.Fatalf("old key stopped working right away")
+	}
+
+}
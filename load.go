@@ -0,0 +1,111 @@
+package gomemssn
+
+// a session record as read from the backing store
+type loaded struct {
+	data []byte      // raw data
+	cas  interface{} // token for writing it back with cas
+	rec  *record     // decoded data
+	hit  bool        // it came from the local cache
+}
+
+// clone returns a copy with its own Values map
+func (l *loaded) clone() *loaded {
+	vals := make(Values, len(l.rec.Values))
+	for k, v := range l.rec.Values {
+		vals[k] = v
+	}
+	return &loaded{data: l.data, cas: l.cas, rec: &record{Meta: l.rec.Meta, Values: vals, raw: copyRaw(l.rec.raw)}}
+}
+
+// a load which other callers can wait on, see Manager.DedupLoads
+type loadCall struct {
+	done chan struct{}
+	l    *loaded
+	err  error
+}
+
+// fetch reads and decodes key from the backing store
+func (m *Manager) fetch(key string) (*loaded, error) {
+	data, token, err := m.get(key)
+	if err == ErrNotFound && m.MigrateBareKeys {
+		data, token, err = m.migrateBareKey(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	span := m.span("gomemssn.decode")
+	rec, err := m.decodeRecord(data)
+	if err != nil {
+		err = &DecodeError{Err: err}
+	}
+	span.End(err)
+	if err != nil {
+		return nil, err
+	}
+	l := &loaded{data: data, cas: token, rec: rec}
+	if m.LocalCacheTTL > 0 && m.LocalCacheAll {
+		m.cachePut(key, l.clone())
+	}
+	return l, nil
+}
+
+// load is fetch, but with DedupLoads on concurrent calls for the same key
+// wait for and share the result of the first one instead of each going to
+// the backing store.  Callers that shared a result get their own copy of the
+// Values map (the values themselves are shared).
+func (m *Manager) load(key string) (*loaded, error) {
+
+	if !m.Healthy() {
+		return nil, &StoreError{Op: "Get", Err: errUnhealthy}
+	}
+
+	if m.CheckRevoked {
+		if revoked, err := m.revoked(key); err != nil {
+			return nil, err
+		} else if revoked {
+			m.cacheDel(key)
+			return nil, errRevoked
+		}
+	}
+
+	if l := m.cacheGet(key); l != nil {
+		l.hit = true
+		return l, nil
+	}
+
+	if !m.DedupLoads {
+		return m.fetch(key)
+	}
+
+	m.loadsMutex.Lock()
+	if c, ok := m.loads[key]; ok {
+		m.loadsMutex.Unlock()
+		<-c.done
+		if c.err != nil {
+			return nil, c.err
+		}
+		return c.l.clone(), nil
+	}
+	if m.loads == nil {
+		m.loads = make(map[string]*loadCall)
+	}
+	c := &loadCall{done: make(chan struct{})}
+	m.loads[key] = c
+	m.loadsMutex.Unlock()
+
+	c.l, c.err = m.fetch(key)
+
+	m.loadsMutex.Lock()
+	delete(m.loads, key)
+	m.loadsMutex.Unlock()
+
+	// copy for ourselves so waiters copy from an untouched map
+	var ret *loaded
+	if c.err == nil {
+		ret = c.l.clone()
+	}
+	close(c.done)
+
+	return ret, c.err
+
+}
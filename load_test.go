@@ -0,0 +1,42 @@
+package gomemssn
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestDedupLoads(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.DedupLoads = true
+
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	sessions := make([]*Session, 20)
+	for i := range sessions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sessions[i] = loadTestSession(t, m, s.Key)
+		}(i)
+	}
+	wg.Wait()
+
+	// each one must have its own map
+	sessions[0].Values["v"] = "changed"
+	for _, s2 := range sessions[1:] {
+		if v := s2.Values.GetString("v"); v != "abc123" {
+			t.Fatalf("expected v='abc123' but got: %v", v)
+		}
+	}
+
+	if len(m.loads) != 0 {
+		t.Fatalf("expected no loads left in progress but got %d", len(m.loads))
+	}
+
+}
@@ -0,0 +1,143 @@
+package gomemssn
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Session locks serialize requests working on the same session, like PHP's
+// session locking: a request which takes the lock before reading the
+// session and releases it after writing it can't lose another's changes.
+// The lock is an entry next to the session added only if it doesn't exist
+// (memcache's add), with a random value so only its holder releases it, and
+// a TTL so a crashed server's locks go away.  Releasing swaps the value for
+// an empty one with a CAS (the store has no conditional delete), so a lock
+// which expired and was taken by someone else in the meantime is left
+// alone; an empty entry counts as free.  It needs a CASStore.
+
+var (
+	ErrLockUnsupported = errors.New("gomemssn: the backing store can't do locking (not a CASStore)")
+	ErrLockTimeout     = errors.New("gomemssn: timed out waiting for the session lock")
+)
+
+const (
+	defaultLockTTL  = 30 * time.Second
+	lockPollMin     = 5 * time.Millisecond
+	lockPollMax     = 100 * time.Millisecond
+	lockKeySuffix   = "#lock" // not ":", that's for heavy keys
+	lockTokenLength = 12
+	lockReleasedTTL = time.Second // how long the empty entry of a released lock stays around
+)
+
+// SessionLock is a held session lock, see LockSession
+type SessionLock struct {
+	key   string
+	token string
+}
+
+func (m *Manager) lockTTL() time.Duration {
+	if m.LockTTL <= 0 {
+		return defaultLockTTL
+	}
+	return m.LockTTL
+}
+
+// RequestKey returns the session key r's cookie (or TokenHeader) carries, ""
+// if there is none or it is not valid
+func (m *Manager) RequestKey(r *http.Request) string {
+	token := m.requestToken(r)
+	if token == "" {
+		return ""
+	}
+	key, _, ok := m.parseCookie(token)
+	if !ok {
+		return ""
+	}
+	return key
+}
+
+// LockSession waits until it gets the lock of the session key (see
+// RequestKey), for at most LockWait (LockTTL if 0) or until ctx is done.
+// Read the session after this and release the lock with UnlockSession once
+// it is written.
+func (m *Manager) LockSession(ctx context.Context, key string) (*SessionLock, error) {
+
+	if _, ok := unwrapStore(m.baseStore()).(CASStore); !ok {
+		return nil, ErrLockUnsupported
+	}
+
+	b := make([]byte, lockTokenLength)
+	if _, err := crand.Read(b); err != nil {
+		return nil, err
+	}
+	l := &SessionLock{key: key, token: base64.RawURLEncoding.EncodeToString(b)}
+
+	wait := m.LockWait
+	if wait <= 0 {
+		wait = m.lockTTL()
+	}
+	deadline := time.Now().Add(wait)
+	poll := lockPollMin
+
+	for {
+		err := m.cas(key+lockKeySuffix, []byte(l.token), nil, m.lockTTL())
+		if err == ErrCASConflict {
+			err = m.takeReleasedLock(l)
+		}
+		if err == nil {
+			return l, nil
+		} else if err != ErrCASConflict {
+			return nil, err
+		}
+		if time.Now().Add(poll).After(deadline) {
+			return nil, ErrLockTimeout
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(poll):
+		}
+		poll = min(2*poll, lockPollMax)
+	}
+
+}
+
+// takeReleasedLock takes the lock entry for l if it is there but empty
+// (released by UnlockSession), ErrCASConflict if it is held
+func (m *Manager) takeReleasedLock(l *SessionLock) error {
+	data, token, err := m.get(l.key + lockKeySuffix)
+	if err == ErrNotFound {
+		// expired since
+		return m.cas(l.key+lockKeySuffix, []byte(l.token), nil, m.lockTTL())
+	} else if err != nil {
+		return err
+	}
+	if len(data) != 0 {
+		return ErrCASConflict
+	}
+	return m.cas(l.key+lockKeySuffix, []byte(l.token), token, m.lockTTL())
+}
+
+// UnlockSession releases a lock taken with LockSession, it does nothing if
+// the lock expired and someone else has it now
+func (m *Manager) UnlockSession(l *SessionLock) error {
+	data, token, err := m.get(l.key + lockKeySuffix)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if string(data) != l.token {
+		return nil
+	}
+	// only if it is still ours between the get and now
+	err = m.cas(l.key+lockKeySuffix, nil, token, lockReleasedTTL)
+	if err == ErrCASConflict || err == ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package gomemssn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockSession(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.LockSessions = true
+	m.OnConflict = ConflictLastWriteWins
+
+	s := loadTestSession(t, m, "")
+	s.Values["n"] = 0
+	m.MustWriteSession(nil, s)
+
+	// read-modify-write with a pause in the middle, without the lock
+	// increments would get lost
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := FromContext(r.Context())
+		n := s.Values["n"].(int)
+		time.Sleep(time.Millisecond)
+		s.Values["n"] = n + 1
+	}))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Errorf("unexpected status %d", w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+	if s := loadTestSession(t, m, s.Key); s.Values["n"] != 10 {
+		t.Fatalf("expected 10 but got %v", s.Values["n"])
+	}
+
+	// held, times out
+	m.LockWait = 20 * time.Millisecond
+	l, err := m.LockSession(context.Background(), s.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.LockSession(context.Background(), s.Key); err != ErrLockTimeout {
+		t.Fatalf("expected ErrLockTimeout but got %v", err)
+	}
+	if err := m.UnlockSession(l); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.LockSession(context.Background(), s.Key); err != nil {
+		t.Fatalf("expected the lock to be free, got %v", err)
+	}
+
+	m.Store = plainStore{m.stub}
+	if _, err := m.LockSession(context.Background(), s.Key); err != ErrLockUnsupported {
+		t.Fatalf("expected ErrLockUnsupported but got %v", err)
+	}
+
+}
+
+// calls afterGet (once) right after a read
+type getHookStore struct {
+	*MemoryStore
+	afterGet func()
+}
+
+func (gs *getHookStore) GetCAS(key string) ([]byte, interface{}, error) {
+	data, token, err := gs.MemoryStore.GetCAS(key)
+	if f := gs.afterGet; f != nil {
+		gs.afterGet = nil
+		f()
+	}
+	return data, token, err
+}
+
+func TestUnlockSessionExpired(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	clock := newTestClock()
+	m.Now, m.stub.Now = clock.Now, clock.Now
+	gs := &getHookStore{MemoryStore: m.stub}
+	m.Store = gs
+	m.LockTTL = 10 * time.Second
+	m.LockWait = 20 * time.Millisecond
+
+	a, err := m.LockSession(context.Background(), "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a's lock expires and b takes it between UnlockSession's read and
+	// write, which must leave b's lock alone
+	var b *SessionLock
+	gs.afterGet = func() {
+		clock.Advance(11 * time.Second)
+		if b, err = m.LockSession(context.Background(), "k"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.UnlockSession(a); err != nil {
+		t.Fatal(err)
+	}
+	if b == nil {
+		t.Fatal("b didn't take the lock")
+	}
+	if _, err := m.LockSession(context.Background(), "k"); err != ErrLockTimeout {
+		t.Fatalf("expected ErrLockTimeout but got %v", err)
+	}
+
+	// released, the empty entry is free to take (and b can't release it
+	// again)
+	if err := m.UnlockSession(b); err != nil {
+		t.Fatal(err)
+	}
+	c, err := m.LockSession(context.Background(), "k")
+	if err != nil {
+		t.Fatalf("expected the lock to be free, got %v", err)
+	}
+	if err := m.UnlockSession(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.LockSession(context.Background(), "k"); err != ErrLockTimeout {
+		t.Fatalf("expected ErrLockTimeout but got %v", err)
+	}
+	if err := m.UnlockSession(c); err != nil {
+		t.Fatal(err)
+	}
+
+}
@@ -0,0 +1,50 @@
+package gomemssn
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger is what a Manager logs to, *slog.Logger implements it.  args are
+// alternating keys and values as with slog.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// stdLogger is the Logger used when Manager.Logger is nil: the standard log
+// package, without debug messages
+type stdLogger struct{}
+
+func (stdLogger) Debug(msg string, args ...interface{}) {}
+func (stdLogger) Info(msg string, args ...interface{})  { stdPrint("INFO", msg, args) }
+func (stdLogger) Warn(msg string, args ...interface{})  { stdPrint("WARN", msg, args) }
+func (stdLogger) Error(msg string, args ...interface{}) { stdPrint("ERROR", msg, args) }
+
+func stdPrint(level, msg string, args []interface{}) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "gomemssn: %s %s", level, msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	log.Print(b.String())
+}
+
+func (m *Manager) logger() Logger {
+	if m.Logger != nil {
+		return m.Logger
+	}
+	return stdLogger{}
+}
+
+// logLifecycle logs a session lifecycle event at debug level, if LogLifecycle
+// is on
+func (m *Manager) logLifecycle(msg string, key string, args ...interface{}) {
+	if !m.LogLifecycle {
+		return
+	}
+	m.logger().Debug(msg, append([]interface{}{"session_id", SessionID(key)}, args...)...)
+}
@@ -0,0 +1,36 @@
+package gomemssn
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+
+	buf := &bytes.Buffer{}
+	m := NewManager(nil, "gomemssn_test")
+	m.Logger = slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s := loadTestSession(t, m, "")
+	m.MustWriteSession(nil, s)
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing logged without LogLifecycle, got %s", buf)
+	}
+
+	m.LogLifecycle = true
+	s = loadTestSession(t, m, s.Key)
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+	out := buf.String()
+	for _, want := range []string{`msg="session hit"`, `msg="session written"`, "session_id=" + SessionID(s.Key)} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in the log: %s", want, out)
+		}
+	}
+	if strings.Contains(out, s.Key) {
+		t.Errorf("session key logged")
+	}
+
+}
@@ -0,0 +1,74 @@
+package gomemssn
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ManagerSet hosts several independently configured session namespaces
+// used on the same requests, e.g. a short-lived "auth" session and a
+// long-lived "prefs" one.  Each is a Manager of its own, with its own
+// cookie, expiration and store; managers sharing a backing store need
+// different MemcacheKeyPrefixes (or KeyFuncs).
+type ManagerSet struct {
+	names    []string
+	managers map[string]*Manager
+}
+
+// Sessions are the sessions of a request by ManagerSet name
+type Sessions map[string]*Session
+
+// NewManagerSet returns an empty *ManagerSet, see Add
+func NewManagerSet() *ManagerSet {
+	return &ManagerSet{managers: make(map[string]*Manager)}
+}
+
+// Add makes m available under name; names and cookie names must be unique
+// within the set
+func (ms *ManagerSet) Add(name string, m *Manager) error {
+	if _, ok := ms.managers[name]; ok {
+		return fmt.Errorf("gomemssn: ManagerSet already has %q", name)
+	}
+	for _, n := range ms.names {
+		if ms.managers[n].TemplateCookie.Name == m.TemplateCookie.Name {
+			return fmt.Errorf("gomemssn: %q and %q both use cookie %q", n, name, m.TemplateCookie.Name)
+		}
+	}
+	ms.names = append(ms.names, name)
+	ms.managers[name] = m
+	return nil
+}
+
+// Manager returns the Manager added under name, nil if there is none
+func (ms *ManagerSet) Manager(name string) *Manager {
+	return ms.managers[name]
+}
+
+// Sessions gets all of the request's sessions, see Manager.Session
+func (ms *ManagerSet) Sessions(w http.ResponseWriter, r *http.Request) (Sessions, error) {
+	ret := make(Sessions, len(ms.names))
+	for _, name := range ms.names {
+		s, err := ms.managers[name].Session(w, r)
+		if err != nil {
+			return nil, fmt.Errorf("gomemssn: session %q: %w", name, err)
+		}
+		ret[name] = s
+	}
+	return ret, nil
+}
+
+// WriteSessions writes all of sessions with their Managers, see
+// Manager.WriteSession; it goes on after an error and returns the first one
+func (ms *ManagerSet) WriteSessions(w http.ResponseWriter, sessions Sessions) error {
+	var first error
+	for _, name := range ms.names {
+		s := sessions[name]
+		if s == nil {
+			continue
+		}
+		if err := ms.managers[name].WriteSession(w, s); err != nil && first == nil {
+			first = fmt.Errorf("gomemssn: session %q: %w", name, err)
+		}
+	}
+	return first
+}
@@ -0,0 +1,54 @@
+package gomemssn
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestManagerSet(t *testing.T) {
+
+	auth := NewManager(nil, "auth")
+	auth.Expiration = 10 * time.Minute
+	prefs := NewManager(nil, "prefs")
+	prefs.Expiration = 30 * 24 * time.Hour
+	prefs.Store = auth.stub
+
+	ms := NewManagerSet()
+	if err := ms.Add("auth", auth); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Add("prefs", prefs); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Add("other", NewManager(nil, "auth")); err == nil {
+		t.Fatalf("expected an error for a duplicate cookie name")
+	}
+
+	w := httptest.NewRecorder()
+	ss, err := ms.Sessions(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss["auth"].Values["user"] = "joe"
+	ss["prefs"].Values["theme"] = "dark"
+	if err := ms.WriteSessions(w, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	ss, err = ms.Sessions(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss["auth"].Values["user"] != "joe" || ss["prefs"].Values["theme"] != "dark" || ss["auth"].Values["theme"] != nil {
+		t.Fatalf("unexpected sessions: %v %v", ss["auth"].Values, ss["prefs"].Values)
+	}
+	if ms.Manager("prefs") != prefs {
+		t.Fatalf("wrong manager")
+	}
+
+}
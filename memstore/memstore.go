@@ -0,0 +1,60 @@
+// Package memstore is the in-memory gomemssn.Store Managers without a
+// memcache client fall back to, for application tests which shouldn't need
+// a memcached running.  With a Clock, expiration can be tested without
+// sleeping:
+//
+//	clock := memstore.NewClock(time.Now())
+//	m := gomemssn.NewManager(nil, "myapp")
+//	m.Store = memstore.NewWithClock(clock)
+//	m.Now = clock.Now
+//	...
+//	clock.Advance(time.Hour) // sessions written above have expired
+package memstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn"
+)
+
+// Store is gomemssn.MemoryStore, it implements gomemssn.CASStore,
+// gomemssn.MultiGetStore, gomemssn.IncrStore and gomemssn.TTLStore
+type Store = gomemssn.MemoryStore
+
+// New returns an empty Store going by the real time
+func New() *Store {
+	return gomemssn.NewMemoryStore()
+}
+
+// NewWithClock returns an empty Store in which entries expire by clock
+func NewWithClock(clock *Clock) *Store {
+	st := gomemssn.NewMemoryStore()
+	st.Now = clock.Now
+	return st
+}
+
+// Clock is a time source which only moves when told to
+type Clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewClock returns a Clock stopped at t
+func NewClock(t time.Time) *Clock {
+	return &Clock{t: t}
+}
+
+// Now returns the time the clock is at
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
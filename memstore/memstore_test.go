@@ -0,0 +1,16 @@
+package memstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn/storetest"
+)
+
+func TestStore(t *testing.T) {
+	clock := NewClock(time.Now())
+	st := NewWithClock(clock)
+	defer st.Stop()
+	storetest.TestStore(t, st)
+	storetest.TestExpiration(t, st, clock.Advance)
+}
@@ -0,0 +1,41 @@
+package gomemssn
+
+import (
+	"net/http"
+	"time"
+)
+
+// lastSeenResolution is how far Meta.LastSeenAt may lag: it only moves on
+// once it is older than that, so not every request makes the session worth
+// writing
+const lastSeenResolution = time.Minute
+
+// maxUserAgentLength is as much of the User-Agent as Meta.UserAgent keeps
+const maxUserAgentLength = 256
+
+// trackClient keeps the metadata about the client of s (Meta.LastSeenAt,
+// CreatedIP, UserAgent) up to date for r
+func (m *Manager) trackClient(r *http.Request, s *Session) {
+	now := m.now()
+	if now.Sub(s.Meta.LastSeenAt) >= lastSeenResolution {
+		s.Meta.LastSeenAt = now
+	}
+	if s.loaded == nil && s.Meta.CreatedIP == "" {
+		s.Meta.CreatedIP = m.ClientIP(r)
+	}
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	s.Meta.UserAgent = ua
+}
+
+// IdleFor returns how long the session went unused before this request,
+// going by Meta.LastSeenAt (give or take a minute), 0 for a new session;
+// for idle timeouts, e.g. asking for the password again after a while
+func (s *Session) IdleFor() time.Duration {
+	if s.lastSeen.IsZero() {
+		return 0
+	}
+	return s.now().Sub(s.lastSeen)
+}
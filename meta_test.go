@@ -0,0 +1,47 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientMeta(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now = clock.Now
+	m.Expiration = 24 * time.Hour
+
+	load := func(key, ua string) *Session {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("User-Agent", ua)
+		if key != "" {
+			r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: key})
+		}
+		return m.MustSession(httptest.NewRecorder(), r)
+	}
+
+	s := load("", "browser/1")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+	if s.Meta.CreatedIP != "192.0.2.1" || s.Meta.UserAgent != "browser/1" || !s.Meta.LastSeenAt.Equal(clock.Now()) || s.IdleFor() != 0 {
+		t.Fatalf("unexpected metadata for a new session: %+v", s.Meta)
+	}
+
+	// seen again soon: nothing worth writing
+	clock.Advance(time.Second)
+	s2 := load(s.Key, "browser/1")
+	if m.changed(s2) || s2.IdleFor() != time.Second {
+		t.Fatalf("expected an unchanged session idle for a second, got %v", s2.IdleFor())
+	}
+
+	clock.Advance(time.Hour)
+	s2 = load(s.Key, "browser/2")
+	if s2.IdleFor() != time.Hour+time.Second || !s2.Meta.LastSeenAt.Equal(clock.Now()) || s2.Meta.UserAgent != "browser/2" || s2.Meta.CreatedIP != "192.0.2.1" {
+		t.Fatalf("unexpected metadata: %+v", s2.Meta)
+	}
+
+}
@@ -0,0 +1,64 @@
+package gomemssn
+
+import (
+	"expvar"
+	"time"
+)
+
+// Metrics receives counts and timings of what a Manager does, for feeding
+// Prometheus, expvar (see PublishExpvar) or the like.  Methods are called
+// synchronously from requests, concurrently, and should be quick.
+type Metrics interface {
+	SessionLoaded(source string)                   // Session returned a session; source is as in DebugHeader (hit, miss, new...)
+	SessionWritten(size int)                       // WriteSession stored a session of size bytes
+	DecodeFailed()                                 // a session read from the store or a cookie could not be decoded
+	StoreOp(op string, d time.Duration, err error) // a round trip to the backing store, op is the Store method; ErrNotFound and ErrCASConflict are normal outcomes, not failures
+}
+
+// timeStoreOp is the hookStore hook which reports to Metrics
+func (m *Manager) timeStoreOp(op string, f func() error) error {
+	start := time.Now()
+	err := f()
+	m.Metrics.StoreOp(op, time.Since(start), err)
+	return err
+}
+
+// ExpvarMetrics is Metrics as expvar counters in a map:
+//
+//	loaded.<source>, written, written_bytes, decode_failed,
+//	store.<op>, store.<op>.errors, store.<op>.ns (total time),
+//	stub_sessions (entries in the in-memory stub)
+type ExpvarMetrics struct {
+	Vars *expvar.Map
+}
+
+// PublishExpvar sets Metrics to an ExpvarMetrics published under name (which
+// like any expvar name can only be used once per process) and returns it
+func (m *Manager) PublishExpvar(name string) *ExpvarMetrics {
+	em := &ExpvarMetrics{Vars: expvar.NewMap(name)}
+	stub := m.stub
+	em.Vars.Set("stub_sessions", expvar.Func(func() interface{} { return stub.Len() }))
+	m.Metrics = em
+	return em
+}
+
+func (em *ExpvarMetrics) SessionLoaded(source string) {
+	em.Vars.Add("loaded."+source, 1)
+}
+
+func (em *ExpvarMetrics) SessionWritten(size int) {
+	em.Vars.Add("written", 1)
+	em.Vars.Add("written_bytes", int64(size))
+}
+
+func (em *ExpvarMetrics) DecodeFailed() {
+	em.Vars.Add("decode_failed", 1)
+}
+
+func (em *ExpvarMetrics) StoreOp(op string, d time.Duration, err error) {
+	em.Vars.Add("store."+op, 1)
+	em.Vars.Add("store."+op+".ns", int64(d))
+	if err != nil && err != ErrNotFound && err != ErrCASConflict {
+		em.Vars.Add("store."+op+".errors", 1)
+	}
+}
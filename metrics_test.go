@@ -0,0 +1,47 @@
+package gomemssn
+
+import (
+	"expvar"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	em := m.PublishExpvar("gomemssn_test")
+
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+	loadTestSession(t, m, s.Key)
+	m.stub.Set(m.storeKey(s.Key+"x"), []byte("garbage"), 0)
+	if _, err := m.fetch(s.Key + "x"); err == nil {
+		t.Fatalf("expected a decode error")
+	}
+
+	get := func(name string) string {
+		v := em.Vars.Get(name)
+		if v == nil {
+			return ""
+		}
+		return v.String()
+	}
+	for name, want := range map[string]string{
+		"loaded.new":       "1",
+		"loaded.hit":       "1",
+		"written":          "1",
+		"decode_failed":    "1",
+		"stub_sessions":    "2",
+		"store.GetCAS":     "2",
+		"store.Set":        "1",
+		"store.Set.errors": "",
+	} {
+		if got := get(name); got != want {
+			t.Errorf("%s: expected %q but got %q", name, want, got)
+		}
+	}
+	if expvar.Get("gomemssn_test") == nil {
+		t.Fatalf("not published")
+	}
+
+}
@@ -0,0 +1,185 @@
+package gomemssn
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// ShouldSkip reports whether session handling is skipped for r, see
+// Manager.Skip and Manager.SkipPathPrefixes
+func (m *Manager) ShouldSkip(r *http.Request) bool {
+	for _, p := range m.SkipPathPrefixes {
+		if strings.HasPrefix(r.URL.Path, p) {
+			return true
+		}
+	}
+	return m.Skip != nil && m.Skip(r)
+}
+
+// IsAuthenticated reports whether RecordAuthentication was ever called for
+// this session
+func (s *Session) IsAuthenticated() bool {
+	return !s.Meta.LastAuthenticatedAt.IsZero()
+}
+
+// RequireSession returns middleware for protected routes which only lets
+// requests through if check approves of their session (nil means
+// Session.IsAuthenticated).  Other requests are sent to loginURL with
+// RedirectToLogin, or get a 401 if loginURL is empty.  Requests whose session can't be loaded
+// get a 500.  The session is the one put in the request context by
+// Middleware, if used, otherwise it is loaded and put there.
+func (m *Manager) RequireSession(check func(r *http.Request, s *Session) bool, loginURL string) func(http.Handler) http.Handler {
+
+	if check == nil {
+		check = func(r *http.Request, s *Session) bool { return s.IsAuthenticated() }
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			s := FromContext(r.Context())
+			if s == nil {
+				r = WithSessionCache(r)
+				var err error
+				s, err = m.Session(w, r)
+				if err != nil {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				r = r.WithContext(NewContext(r.Context(), s))
+			}
+
+			if !check(r, s) {
+				if loginURL == "" {
+					http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				} else if err := m.RedirectToLogin(w, r, loginURL); err != nil {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+				return
+			}
+
+			next.ServeHTTP(w, r)
+
+		})
+	}
+
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying s, see FromContext
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the session put in ctx by Middleware (or RequireSession
+// or NewContext), nil if there is none
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(contextKey{}).(*Session)
+	return s
+}
+
+// Middleware loads the session before next runs and puts it in the request
+// context (see FromContext), and writes it back right before the response
+// header goes out (see AutoWrite), or after next returns if it never
+// does.  Writing does nothing if the session wasn't changed, see
+// WriteSession; new sessions are only stored once something is put in them.
+// Write errors can't be reported to the client and go to OnMiddlewareError
+// (the log by default); handlers which need to know should call
+// WriteSession themselves.  With LockSessions the session is locked for
+// the whole request.  The request gets a session cache (see
+// WithSessionCache), so handlers calling Session get the same session.
+// Once it is written the session goes back for reuse (see ReleaseSession),
+// so handlers must not keep it, or its Values, after they return.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		r = WithSessionCache(r)
+		if m.DeferCookies {
+			cw := NewCookieWriter(w)
+			defer cw.Finish()
+			w = cw
+		}
+		if key := m.RequestKey(r); m.LockSessions && key != "" {
+			l, err := m.LockSession(r.Context(), key)
+			if err != nil {
+				m.logger().Error("locking session failed", "path", r.URL.Path, "err", err)
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			defer m.UnlockSession(l)
+		}
+
+		s, err := m.Session(w, r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		sw := m.AutoWrite(w, r, s)
+		next.ServeHTTP(sw, r.WithContext(NewContext(r.Context(), s)))
+		sw.Finish()
+		m.ReleaseSession(s)
+
+	})
+}
+
+// worthWriting reports whether s should be written at the end of a request,
+// a new session nothing was put in isn't worth storing
+func (m *Manager) worthWriting(s *Session) bool {
+	return !(s.loaded == nil && !s.modified && s.snap != nil && s.snap.equal(s))
+}
+
+func (m *Manager) middlewareError(r *http.Request, err error) {
+	if m.OnMiddlewareError != nil {
+		m.OnMiddlewareError(r, err)
+		return
+	}
+	m.logger().Error("writing session failed", "path", r.URL.Path, "err", err)
+}
+
+// noCookie reports whether r's method is one of NoCookieMethods
+func (m *Manager) noCookie(r *http.Request) bool {
+	for _, meth := range m.NoCookieMethods {
+		if r.Method == meth {
+			return true
+		}
+	}
+	return false
+}
+
+// setPrivateCacheHeaders marks a response as personalized: Vary on the
+// request headers the session came in (Cookie, see varyOn) and
+// Cache-Control: private (replacing public, keeping other directives)
+func setPrivateCacheHeaders(h http.Header, varyOn []string) {
+
+	for _, name := range varyOn {
+		vary := false
+		for _, v := range h.Values("Vary") {
+			for _, f := range strings.Split(v, ",") {
+				f = strings.TrimSpace(f)
+				if f == "*" || strings.EqualFold(f, name) {
+					vary = true
+				}
+			}
+		}
+		if !vary {
+			h.Add("Vary", name)
+		}
+	}
+
+	var dirs []string
+	for _, d := range strings.Split(h.Get("Cache-Control"), ",") {
+		d = strings.TrimSpace(d)
+		switch strings.ToLower(d) {
+		case "", "public":
+			continue
+		case "private", "no-store":
+			return
+		}
+		dirs = append(dirs, d)
+	}
+	h.Set("Cache-Control", strings.Join(append([]string{"private"}, dirs...), ", "))
+
+}
@@ -0,0 +1,214 @@
+package gomemssn
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireSession(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	protected := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secret")
+	})
+
+	// anonymous session
+	s := loadTestSession(t, m, "")
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	newReq := func() *http.Request {
+		r := httptest.NewRequest("GET", "/account", nil)
+		r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	m.RequireSession(nil, "")(protected).ServeHTTP(w, newReq())
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 but got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	m.RequireSession(nil, "/login")(protected).ServeHTTP(w, newReq())
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/login" {
+		t.Fatalf("expected redirect to /login but got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	s.RecordAuthentication()
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	m.RequireSession(nil, "/login")(protected).ServeHTTP(w, newReq())
+	if w.Code != http.StatusOK || w.Body.String() != "secret" {
+		t.Fatalf("expected to get through but got %d %q", w.Code, w.Body.String())
+	}
+
+	// custom check
+	admin := func(r *http.Request, s *Session) bool { return s.Values.GetBool("admin") }
+	w = httptest.NewRecorder()
+	m.RequireSession(admin, "")(protected).ServeHTTP(w, newReq())
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 but got %d", w.Code)
+	}
+
+}
+
+func TestSkip(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.SkipPathPrefixes = []string{"/static/"}
+	m.Skip = func(r *http.Request) bool { return r.URL.Path == "/healthz" }
+
+	for _, p := range []string{"/static/app.js", "/healthz"} {
+		w := httptest.NewRecorder()
+		s, err := m.Session(w, httptest.NewRequest("GET", p, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Fatalf("%s: expected no cookie", p)
+		}
+		s.Values["v"] = "abc123"
+		if err := m.WriteSession(w, s); err != nil {
+			t.Fatal(err)
+		}
+		if m.stub.Len() != 0 || !s.ReadOnly() {
+			t.Fatalf("%s: expected nothing to be written", p)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	m.MustSession(w, httptest.NewRequest("GET", "/page", nil))
+	if len(w.Result().Cookies()) != 1 {
+		t.Fatalf("expected a cookie for a normal request")
+	}
+
+}
+
+func TestPrivateCacheHeaders(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.PrivateCacheHeaders = true
+
+	w := httptest.NewRecorder()
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.Header().Set("Vary", "Accept-Encoding")
+	m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	if cc := w.Header().Get("Cache-Control"); cc != "private, max-age=60" {
+		t.Fatalf("unexpected Cache-Control: %q", cc)
+	}
+	if v := w.Header().Values("Vary"); len(v) != 2 || v[1] != "Cookie" {
+		t.Fatalf("unexpected Vary: %q", v)
+	}
+
+	// already private enough, left alone
+	w = httptest.NewRecorder()
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Vary", "Cookie")
+	m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Fatalf("unexpected Cache-Control: %q", cc)
+	}
+	if v := w.Header().Values("Vary"); len(v) != 1 {
+		t.Fatalf("unexpected Vary: %q", v)
+	}
+
+}
+
+func TestNoCookieMethods(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+
+	for _, meth := range []string{"OPTIONS", "HEAD"} {
+		w := httptest.NewRecorder()
+		s, err := m.Session(w, httptest.NewRequest(meth, "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(w.Result().Cookies()) != 0 || s.Key != "" {
+			t.Fatalf("%s: expected no new session", meth)
+		}
+	}
+
+	// existing sessions are still readable but the cookie isn't re-sent
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("HEAD", "/", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	s2, err := m.Session(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2.Values.GetString("v") != "abc123" || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("expected existing session to load without a Set-Cookie")
+	}
+
+	m.NoCookieMethods = nil
+	w = httptest.NewRecorder()
+	m.MustSession(w, httptest.NewRequest("HEAD", "/", nil))
+	if len(w.Result().Cookies()) != 1 {
+		t.Fatalf("expected a cookie with NoCookieMethods empty")
+	}
+
+}
+
+func TestMiddleware(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	var handler func(s *Session)
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(FromContext(r.Context()))
+	}))
+	writes := func() uint64 {
+		m.stub.mu.RLock()
+		defer m.stub.mu.RUnlock()
+		return m.stub.cas
+	}
+
+	// untouched, not written
+	handler = func(s *Session) {}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if writes() != 0 {
+		t.Fatalf("unchanged session was written")
+	}
+
+	// changed, written
+	handler = func(s *Session) { s.Values["v"] = "abc123" }
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if writes() != 1 {
+		t.Fatalf("changed session was not written")
+	}
+	c := w.Result().Cookies()[0]
+
+	// written by the handler, not again
+	handler = func(s *Session) {
+		if s.Values.GetString("v") != "abc123" {
+			t.Fatalf("session not loaded")
+		}
+		s.Values["v"] = "x"
+		m.MustWriteSession(nil, s)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(c)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if writes() != 2 {
+		t.Fatalf("expected 2 writes, got %d", writes())
+	}
+
+	// mutated in place
+	handler = func(s *Session) { s.MarkModified() }
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if writes() != 3 {
+		t.Fatalf("expected MarkModified to cause a write")
+	}
+
+}
@@ -0,0 +1,63 @@
+package gomemssn
+
+import (
+	"sort"
+	"strings"
+)
+
+// Namespaces keep the values of independent parts of an application (a
+// cart, sign-in state, A/B tests...) apart, so they can pick names without
+// stepping on each other.  Each is a map of its own, kept in Values under
+// "_ns:" + its name, and written and read with the rest of the session.
+
+// namespacePrefix is what the keys of namespaces in Values start with
+const namespacePrefix = "_ns:"
+
+// Namespace returns the values of namespace name, creating it if need be.
+// Like Values it is not safe for concurrent use.
+func (s *Session) Namespace(name string) Values {
+	if s.Values == nil {
+		s.Values = make(Values)
+	}
+	// a plain map, so it reads back the same with either codec
+	ns, ok := s.Values[namespacePrefix+name].(map[string]interface{})
+	if !ok {
+		ns = make(map[string]interface{})
+		s.Values[namespacePrefix+name] = ns
+	}
+	return Values(ns)
+}
+
+// ClearNamespace removes namespace name and all its values
+func (s *Session) ClearNamespace(name string) {
+	delete(s.Values, namespacePrefix+name)
+}
+
+// Namespaces returns the names of the session's namespaces, sorted
+func (s *Session) Namespaces() []string {
+	var ret []string
+	for k := range s.Values {
+		if name, ok := strings.CutPrefix(k, namespacePrefix); ok {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// copyValues copies vals and the namespaces in it, so changes to a
+// namespace's values can be told from a Snapshot
+func copyValues(vals Values) Values {
+	ret := make(Values, len(vals))
+	for k, v := range vals {
+		if ns, ok := v.(map[string]interface{}); ok && strings.HasPrefix(k, namespacePrefix) {
+			c := make(map[string]interface{}, len(ns))
+			for nk, nv := range ns {
+				c[nk] = nv
+			}
+			v = c
+		}
+		ret[k] = v
+	}
+	return ret
+}
@@ -0,0 +1,45 @@
+package gomemssn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+
+	for _, codec := range []Codec{nil, &JSONCodec{}} {
+
+		m := NewManager(nil, "gomemssn_test")
+		m.Codec = codec
+		s := loadTestSession(t, m, "")
+		s.Values["items"] = "flat"
+		s.Namespace("cart").SetString("items", "cart")
+		s.Namespace("ab").SetString("items", "ab")
+		m.MustWriteSession(nil, s)
+
+		s = loadTestSession(t, m, s.Key)
+		if got := []string{s.Values.GetString("items"), s.Namespace("cart").GetString("items"), s.Namespace("ab").GetString("items")}; !reflect.DeepEqual(got, []string{"flat", "cart", "ab"}) {
+			t.Fatalf("expected the namespaces kept apart, got %v", got)
+		}
+		if got := s.Namespaces(); !reflect.DeepEqual(got, []string{"ab", "cart"}) {
+			t.Fatalf("unexpected namespaces %v", got)
+		}
+
+		// a change within a namespace is written
+		s.Namespace("cart").SetString("items", "more")
+		m.MustWriteSession(nil, s)
+		s = loadTestSession(t, m, s.Key)
+		if v := s.Namespace("cart").GetString("items"); v != "more" {
+			t.Fatalf("expected the namespace change written, got %q", v)
+		}
+
+		s.ClearNamespace("cart")
+		m.MustWriteSession(nil, s)
+		s = loadTestSession(t, m, s.Key)
+		if len(s.Namespace("cart")) != 0 || s.Namespace("ab").GetString("items") != "ab" {
+			t.Fatalf("expected only the cart cleared, got %v", s.Values)
+		}
+
+	}
+
+}
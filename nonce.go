@@ -0,0 +1,89 @@
+package gomemssn
+
+import (
+	crand "crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Nonces are single-use tokens (for password reset links, against double
+// submitted forms, as idempotency keys...) kept in the backing store, each
+// under its own key holding its expiration.  Using one overwrites it with
+// nonceUsed at the version it was read, so when two requests race to use it
+// only one succeeds.  They are not tied to the session key and so survive
+// RegenerateSession.
+
+// ErrNonceInvalid is returned by ConsumeNonce for a nonce which doesn't
+// exist, expired or was already used
+var ErrNonceInvalid = errors.New("gomemssn: invalid or used nonce")
+
+// nonceUsed is what a nonce is replaced with when it is consumed
+const nonceUsed = "used"
+
+func nonceKey(token string) string {
+	return "nonce:" + token
+}
+
+// IssueNonce stores a new single-use token which ConsumeNonce accepts once,
+// within ttl
+func (s *Session) IssueNonce(ttl time.Duration) (string, error) {
+
+	if s.m == nil || s.ReadOnly() {
+		return "", ErrReadOnly
+	}
+
+	b := make([]byte, 24)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	exp := strconv.FormatInt(s.m.now().Add(ttl).UnixNano(), 10)
+	// an add, on the off chance the token exists
+	if err := s.m.cas(nonceKey(token), []byte(exp), nil, ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+
+}
+
+// ConsumeNonce uses up token, returns ErrNonceInvalid if it wasn't issued,
+// expired or was used before.  The check is atomic with stores which
+// implement CASStore (memcache does).
+func (s *Session) ConsumeNonce(token string) error {
+
+	if s.m == nil || s.ReadOnly() {
+		return ErrReadOnly
+	}
+	if token == "" {
+		return ErrNonceInvalid
+	}
+
+	key := nonceKey(token)
+	data, cas, err := s.m.get(key)
+	if err == ErrNotFound {
+		return ErrNonceInvalid
+	} else if err != nil {
+		return err
+	}
+	exp, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		// nonceUsed
+		return ErrNonceInvalid
+	}
+	left := time.Unix(0, exp).Sub(s.m.now())
+	if left <= 0 {
+		return ErrNonceInvalid
+	}
+
+	// kept as used until it expires, so it can't be issued again either
+	// (memcache takes whole seconds, 0 being never)
+	err = s.m.cas(key, []byte(nonceUsed), cas, max(left, time.Second))
+	if err == ErrCASConflict {
+		return ErrNonceInvalid
+	}
+	return err
+
+}
@@ -0,0 +1,56 @@
+package gomemssn
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNonce(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now = clock.Now
+	s := loadTestSession(t, m, "")
+
+	token, err := s.IssueNonce(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// of concurrent uses only one gets through
+	var wg sync.WaitGroup
+	var ok atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.ConsumeNonce(token); err == nil {
+				ok.Add(1)
+			} else if err != ErrNonceInvalid {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if ok.Load() != 1 {
+		t.Fatalf("expected the nonce to be used once, got %d", ok.Load())
+	}
+	if err := s.ConsumeNonce(token); err != ErrNonceInvalid {
+		t.Fatalf("expected ErrNonceInvalid but got %v", err)
+	}
+	if err := s.ConsumeNonce("made-up"); err != ErrNonceInvalid {
+		t.Fatalf("expected ErrNonceInvalid but got %v", err)
+	}
+
+	token, err = s.IssueNonce(time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(5 * time.Millisecond)
+	if err := s.ConsumeNonce(token); err != ErrNonceInvalid {
+		t.Fatalf("expected an expired nonce to be rejected, got %v", err)
+	}
+
+}
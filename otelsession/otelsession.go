@@ -0,0 +1,59 @@
+// Package otelsession is a gomemssn.Tracer making OpenTelemetry spans:
+//
+//	m := gomemssn.NewManager(nil, "myapp")
+//	m.Tracer = otelsession.New(otel.GetTracerProvider())
+//
+// Session, WriteSession and DestroySession then show up in traces as
+// children of the request's span (if it has one, e.g. from otelhttp), with
+// spans for decoding and each round trip to the backing store below them.
+package otelsession
+
+import (
+	"context"
+
+	"github.com/bradleypeabody/gomemssn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope the spans are made under
+const ScopeName = "github.com/bradleypeabody/gomemssn"
+
+// Tracer implements gomemssn.Tracer
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a Tracer making spans with tp
+func New(tp trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: tp.Tracer(ScopeName)}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, gomemssn.Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal))
+	return ctx, otelSpan{span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) SetAttribute(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	}
+}
+
+func (s otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,51 @@
+package otelsession
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bradleypeabody/gomemssn"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	m := gomemssn.NewManager(nil, "gomemssn_test")
+	m.Tracer = New(tp)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	s := m.MustSession(httptest.NewRecorder(), r)
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+	parent.End()
+
+	names := map[string]bool{}
+	for _, sp := range rec.Ended() {
+		names[sp.Name()] = true
+		if sp.Name() == "gomemssn.Session" && sp.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("expected the Session span under the request's")
+		}
+		if sp.Name() == "gomemssn.WriteSession" {
+			found := false
+			for _, a := range sp.Attributes() {
+				if string(a.Key) == gomemssn.AttrSize && a.Value.AsInt64() > 0 {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("expected the size on the WriteSession span, got %v", sp.Attributes())
+			}
+		}
+	}
+	for _, n := range []string{"gomemssn.Session", "gomemssn.WriteSession", "gomemssn.store.Set"} {
+		if !names[n] {
+			t.Fatalf("no %s span in %v", n, names)
+		}
+	}
+
+}
@@ -0,0 +1,49 @@
+package gomemssn
+
+import (
+	"sync"
+)
+
+// Session structs (and their Values maps) are recycled through this pool when
+// the application hands them back with ReleaseSession
+var sessionPool = sync.Pool{New: func() interface{} { return &Session{} }}
+
+// maps bigger than this are not kept for reuse
+const maxPooledValues = 64
+
+// newSession returns an empty session for key belonging to m
+func (m *Manager) newSession(key string) *Session {
+	s := sessionPool.Get().(*Session)
+	s.Key = key
+	s.m = m
+	if s.Values == nil {
+		s.Values = make(Values, m.ValuesCapacity)
+	}
+	return s
+}
+
+// skippedSession returns a detached empty session, see Manager.Skip
+func (m *Manager) skippedSession() *Session {
+	s := m.newSession("")
+	s.skipped = true
+	return s
+}
+
+// ReleaseSession hands s back for reuse by later requests.  It is optional,
+// but saves allocations on busy servers; neither s nor its Values (or
+// Cookie) may be used in any way afterwards.  Middleware releases the
+// session itself once it is written.  If s is in its request's session
+// cache (see WithSessionCache) it is dropped from it, so later calls to
+// Session for the request load it again.
+func (m *Manager) ReleaseSession(s *Session) {
+	if s.req != nil && m.cachedSession(s.req) == s {
+		m.cacheSession(s.req, nil)
+	}
+	vals := s.Values
+	*s = Session{}
+	if len(vals) <= maxPooledValues {
+		clear(vals)
+		s.Values = vals
+	}
+	sessionPool.Put(s)
+}
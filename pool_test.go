@@ -0,0 +1,100 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func BenchmarkNewSession(b *testing.B) {
+	m := NewManager(nil, "bench")
+	m.ValuesCapacity = 8
+	r := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		s, err := m.Session(w, r)
+		if err != nil {
+			b.Fatal(err)
+		}
+		s.Values["a"] = i
+		m.ReleaseSession(s)
+	}
+}
+
+func BenchmarkLoadSession(b *testing.B) {
+	m := NewManager(nil, "bench")
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["a"] = "b"
+	m.MustWriteSession(w, s)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: s.Cookie.Name, Value: s.Key})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s, err := m.Session(httptest.NewRecorder(), r)
+		if err != nil {
+			b.Fatal(err)
+		}
+		m.ReleaseSession(s)
+	}
+}
+
+func TestReleaseSession(t *testing.T) {
+	m := NewManager(nil, "test")
+	s := m.MustSession(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	s.Values["a"] = "b"
+	m.ReleaseSession(s)
+	for i := 0; i < 10; i++ {
+		s := m.MustSession(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		if len(s.Values) != 0 || s.Cookie.Value != s.Key || s.skipped {
+			t.Fatalf("pooled session not reset: %#v", s)
+		}
+	}
+}
+
+func BenchmarkWriteSession(b *testing.B) {
+	m := NewManager(nil, "bench")
+	m.ForceWrite = true
+	s := m.MustSession(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	s.Values["user"] = "joe@example.com"
+	s.Values["cart"] = []string{"a", "b", "c"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := m.WriteSession(nil, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReleaseSessionCache(t *testing.T) {
+	m := NewManager(nil, "test")
+	r := WithSessionCache(httptest.NewRequest("GET", "/", nil))
+	s := m.MustSession(httptest.NewRecorder(), r)
+	m.ReleaseSession(s)
+	if m.cachedSession(r) != nil {
+		t.Fatal("released session still in the request cache")
+	}
+}
+
+func TestMiddlewareReleasesSession(t *testing.T) {
+	m := NewManager(nil, "test")
+	var s *Session
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s = FromContext(r.Context())
+		s.Values["a"] = "b"
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if s.Key != "" || len(s.Values) != 0 {
+		t.Fatalf("session not released: %#v", s)
+	}
+	c := w.Result().Cookies()
+	if len(c) != 1 {
+		t.Fatalf("cookies: %v", c)
+	}
+	if s := loadTestSession(t, m, c[0].Value); s.Values["a"] != "b" {
+		t.Fatalf("values: %v", s.Values)
+	}
+}
@@ -0,0 +1,611 @@
+// Package protocodec is a gomemssn.Codec writing sessions as protocol buffers
+// laid out as in session.proto, so services in other languages can read the
+// same sessions (and update them, with a cas of their own):
+//
+//	m := gomemssn.NewManager(nil, "myapp")
+//	m.Codec = &protocodec.Codec{}
+//
+// Values of any type made of the predeclared ones, []byte, time.Time,
+// slices, maps with string keys and structs can be stored.  Like with
+// gomemssn.JSONCodec they don't all come back as the type they went in as:
+// integers are read back as int64 (uint64 for unsigned ones), floats as
+// float64, slices as []interface{} and maps and structs as
+// map[string]interface{}.  TypeHooks aren't supported.
+//
+// The message is what the backing store holds unless the Manager wraps it:
+// leave Compress, EncryptAtRest, Session.SetRaw and chunking (ChunkSize -1
+// turns it off) alone for other languages to be able to read it.
+package protocodec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Codec implements gomemssn.Codec
+type Codec struct{}
+
+// field numbers of the messages in session.proto
+const (
+	sessionValues = 1
+	sessionMeta   = 2
+
+	valueNull   = 1
+	valueString = 2
+	valueInt    = 3
+	valueUint   = 4
+	valueDouble = 5
+	valueBool   = 6
+	valueBytes  = 7
+	valueTime   = 8
+	valueList   = 9
+	valueMap    = 10
+
+	listValues = 1
+	mapValues  = 1
+
+	entryKey   = 1
+	entryValue = 2
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// record returns the Meta and Values fields of v, a pointer to the struct
+// gomemssn encodes sessions as
+func record(v interface{}) (meta, vals reflect.Value, ok bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, reflect.Value{}, false
+	}
+	meta, vals = rv.Elem().FieldByName("Meta"), rv.Elem().FieldByName("Values")
+	if !meta.IsValid() || meta.Type() != reflect.TypeOf(gomemssn.Meta{}) || !vals.IsValid() || vals.Type() != reflect.TypeOf(gomemssn.Values{}) {
+		return reflect.Value{}, reflect.Value{}, false
+	}
+	return meta, vals, true
+}
+
+// Encode writes a Session message; v is a session record or Values
+func (Codec) Encode(v interface{}) ([]byte, error) {
+	var vals gomemssn.Values
+	var meta *gomemssn.Meta
+	switch x := v.(type) {
+	case gomemssn.Values:
+		vals = x
+	case *gomemssn.Values:
+		vals = *x
+	default:
+		mv, vv, ok := record(v)
+		if !ok {
+			return nil, fmt.Errorf("protocodec: can't encode %T", v)
+		}
+		m := mv.Interface().(gomemssn.Meta)
+		vals, meta = vv.Interface().(gomemssn.Values), &m
+	}
+	b, err := appendValues(nil, sessionValues, vals)
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil {
+		b = appendMessage(b, sessionMeta, appendMeta(nil, meta))
+	}
+	return b, nil
+}
+
+// Decode reads a Session message into v, a session record or *Values
+func (Codec) Decode(data []byte, v interface{}) error {
+	vals := make(gomemssn.Values)
+	var meta gomemssn.Meta
+	err := parse(data, func(num protowire.Number, typ protowire.Type, b []byte) error {
+		switch num {
+		case sessionValues:
+			return parseEntry(typ, b, func(k string, b []byte) error {
+				val, err := parseValue(b)
+				vals[k] = val
+				return err
+			})
+		case sessionMeta:
+			b, err := bytesField(typ, b)
+			if err != nil {
+				return err
+			}
+			return parseMeta(b, &meta)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if p, ok := v.(*gomemssn.Values); ok {
+		*p = vals
+		return nil
+	}
+	mv, vv, ok := record(v)
+	if !ok {
+		return fmt.Errorf("protocodec: can't decode into %T", v)
+	}
+	mv.Set(reflect.ValueOf(meta))
+	vv.Set(reflect.ValueOf(vals))
+	return nil
+}
+
+// encoding
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func fromUnixNano(n uint64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(n))
+}
+
+// appendValues appends vals as the map field num, in key order so equal
+// values encode the same
+func appendValues(b []byte, num protowire.Number, vals map[string]interface{}) ([]byte, error) {
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, err := appendValue(nil, reflect.ValueOf(vals[k]))
+		if err != nil {
+			return nil, fmt.Errorf("protocodec: value %q: %w", k, err)
+		}
+		b = appendMessage(b, num, appendMessage(appendString(nil, entryKey, k), entryValue, v))
+	}
+	return b, nil
+}
+
+// appendValue appends the fields of the Value message for v
+func appendValue(b []byte, v reflect.Value) ([]byte, error) {
+
+	if !v.IsValid() {
+		b = protowire.AppendTag(b, valueNull, protowire.VarintType)
+		return protowire.AppendVarint(b, 1), nil
+	}
+	if v.Type() == timeType {
+		b = protowire.AppendTag(b, valueTime, protowire.VarintType)
+		return protowire.AppendVarint(b, unixNano(v.Interface().(time.Time))), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		b = protowire.AppendTag(b, valueString, protowire.BytesType)
+		return protowire.AppendString(b, v.String()), nil
+	case reflect.Bool:
+		b = protowire.AppendTag(b, valueBool, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v.Bool())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b = protowire.AppendTag(b, valueInt, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeZigZag(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b = protowire.AppendTag(b, valueUint, protowire.VarintType)
+		return protowire.AppendVarint(b, v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		b = protowire.AppendTag(b, valueDouble, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(v.Float())), nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return appendValue(b, reflect.Value{})
+		}
+		return appendValue(b, v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return appendValue(b, reflect.Value{})
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			b = protowire.AppendTag(b, valueBytes, protowire.BytesType)
+			return protowire.AppendBytes(b, data), nil
+		}
+		var list []byte
+		for i := 0; i < v.Len(); i++ {
+			e, err := appendValue(nil, v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list = appendMessage(list, listValues, e)
+		}
+		return appendMessage(b, valueList, list), nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			return appendValue(b, reflect.Value{})
+		}
+		m := make(map[string]interface{}, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			m[it.Key().String()] = it.Value().Interface()
+		}
+		fields, err := appendValues(nil, mapValues, m)
+		if err != nil {
+			return nil, err
+		}
+		return appendMessage(b, valueMap, fields), nil
+	case reflect.Struct:
+		m := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.IsExported() {
+				m[f.Name] = v.Field(i).Interface()
+			}
+		}
+		fields, err := appendValues(nil, mapValues, m)
+		if err != nil {
+			return nil, err
+		}
+		return appendMessage(b, valueMap, fields), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+
+}
+
+func appendMeta(b []byte, m *gomemssn.Meta) []byte {
+	b = appendVarint(b, 1, unixNano(m.LastAuthenticatedAt))
+	b = appendVarint(b, 2, unixNano(m.ExpiresAt))
+	keys := make([]string, 0, len(m.KeysAdded))
+	for k := range m.KeysAdded {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b = appendMessage(b, 3, appendVarint(appendString(nil, entryKey, k), entryValue, unixNano(m.KeysAdded[k])))
+	}
+	if li := m.LoginIntent; li != nil {
+		var lb []byte
+		lb = appendString(lb, 1, li.Route)
+		params := make([]string, 0, len(li.Params))
+		for k := range li.Params {
+			params = append(params, k)
+		}
+		sort.Strings(params)
+		for _, k := range params {
+			lb = appendMessage(lb, 2, appendString(appendString(nil, entryKey, k), entryValue, li.Params[k]))
+		}
+		lb = appendVarint(lb, 3, unixNano(li.ExpiresAt))
+		b = appendMessage(b, 4, lb)
+	}
+	b = appendVarint(b, 5, unixNano(m.CreatedAt))
+	b = appendVarint(b, 6, unixNano(m.KeyIssuedAt))
+	b = appendString(b, 7, m.UserID)
+	b = appendString(b, 8, m.ClientIP)
+	b = appendString(b, 9, m.UserAgentHash)
+	b = appendString(b, 10, m.ClientCert)
+	b = appendVarint(b, 11, unixNano(m.CookieIssuedAt))
+	b = appendVarint(b, 12, uint64(m.SchemaVersion))
+	b = appendVarint(b, 13, unixNano(m.LastSeenAt))
+	b = appendString(b, 14, m.CreatedIP)
+	b = appendString(b, 15, m.UserAgent)
+	for _, c := range m.History {
+		var cb []byte
+		cb = appendVarint(cb, 1, unixNano(c.Time))
+		for _, k := range c.Keys {
+			cb = protowire.AppendTag(cb, 2, protowire.BytesType)
+			cb = protowire.AppendString(cb, k)
+		}
+		cb = appendString(cb, 3, c.Path)
+		b = appendMessage(b, 16, cb)
+	}
+	return b
+}
+
+// decoding
+
+var errWireType = errors.New("protocodec: unexpected wire type")
+
+// parse calls f with each field of the message data; b is the encoded
+// field value.  Fields f doesn't know are for it to skip, so messages
+// written with a newer session.proto can still be read.
+func parse(data []byte, f func(num protowire.Number, typ protowire.Type, b []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := f(num, typ, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func bytesField(typ protowire.Type, b []byte) ([]byte, error) {
+	if typ != protowire.BytesType {
+		return nil, errWireType
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return nil, protowire.ParseError(n)
+	}
+	return v, nil
+}
+
+func varintField(typ protowire.Type, b []byte) (uint64, error) {
+	if typ != protowire.VarintType {
+		return 0, errWireType
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	return v, nil
+}
+
+func stringField(typ protowire.Type, b []byte) (string, error) {
+	v, err := bytesField(typ, b)
+	return string(v), err
+}
+
+// parseEntry calls f with the key and the encoded value of a map entry
+func parseEntry(typ protowire.Type, b []byte, f func(key string, value []byte) error) error {
+	b, err := bytesField(typ, b)
+	if err != nil {
+		return err
+	}
+	var key string
+	var value []byte
+	err = parse(b, func(num protowire.Number, typ protowire.Type, b []byte) (err error) {
+		switch num {
+		case entryKey:
+			key, err = stringField(typ, b)
+		case entryValue:
+			value = b
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return f(key, value)
+}
+
+// parseValue returns the value in the Value message field b, nil for a
+// missing one
+func parseValue(b []byte) (interface{}, error) {
+	if b == nil {
+		return nil, nil
+	}
+	b, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return nil, protowire.ParseError(n)
+	}
+	var ret interface{}
+	err := parse(b, func(num protowire.Number, typ protowire.Type, b []byte) (err error) {
+		var u uint64
+		switch num {
+		case valueNull:
+			ret = nil
+		case valueString:
+			ret, err = stringField(typ, b)
+		case valueInt:
+			u, err = varintField(typ, b)
+			ret = protowire.DecodeZigZag(u)
+		case valueUint:
+			ret, err = varintField(typ, b)
+		case valueDouble:
+			if typ != protowire.Fixed64Type {
+				return errWireType
+			}
+			u, _ = protowire.ConsumeFixed64(b)
+			ret = math.Float64frombits(u)
+		case valueBool:
+			u, err = varintField(typ, b)
+			ret = u != 0
+		case valueBytes:
+			var data []byte
+			data, err = bytesField(typ, b)
+			ret = append([]byte{}, data...)
+		case valueTime:
+			u, err = varintField(typ, b)
+			ret = fromUnixNano(u)
+		case valueList:
+			ret, err = parseList(typ, b)
+		case valueMap:
+			ret, err = parseMap(typ, b)
+		}
+		return err
+	})
+	return ret, err
+}
+
+func parseList(typ protowire.Type, b []byte) ([]interface{}, error) {
+	b, err := bytesField(typ, b)
+	if err != nil {
+		return nil, err
+	}
+	ret := []interface{}{}
+	err = parse(b, func(num protowire.Number, typ protowire.Type, b []byte) error {
+		if num != listValues {
+			return nil
+		}
+		if typ != protowire.BytesType {
+			return errWireType
+		}
+		v, err := parseValue(b)
+		ret = append(ret, v)
+		return err
+	})
+	return ret, err
+}
+
+func parseMap(typ protowire.Type, b []byte) (map[string]interface{}, error) {
+	b, err := bytesField(typ, b)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]interface{}{}
+	err = parse(b, func(num protowire.Number, typ protowire.Type, b []byte) error {
+		if num != mapValues {
+			return nil
+		}
+		return parseEntry(typ, b, func(k string, b []byte) error {
+			v, err := parseValue(b)
+			ret[k] = v
+			return err
+		})
+	})
+	return ret, err
+}
+
+func parseMeta(data []byte, m *gomemssn.Meta) error {
+	return parse(data, func(num protowire.Number, typ protowire.Type, b []byte) (err error) {
+		var u uint64
+		switch num {
+		case 1:
+			u, err = varintField(typ, b)
+			m.LastAuthenticatedAt = fromUnixNano(u)
+		case 2:
+			u, err = varintField(typ, b)
+			m.ExpiresAt = fromUnixNano(u)
+		case 3:
+			err = parseEntry(typ, b, func(k string, b []byte) error {
+				var t uint64
+				if b != nil {
+					var n int
+					if t, n = protowire.ConsumeVarint(b); n < 0 {
+						return protowire.ParseError(n)
+					}
+				}
+				if m.KeysAdded == nil {
+					m.KeysAdded = make(map[string]time.Time)
+				}
+				m.KeysAdded[k] = fromUnixNano(t)
+				return nil
+			})
+		case 4:
+			m.LoginIntent, err = parseLoginIntent(typ, b)
+		case 5:
+			u, err = varintField(typ, b)
+			m.CreatedAt = fromUnixNano(u)
+		case 6:
+			u, err = varintField(typ, b)
+			m.KeyIssuedAt = fromUnixNano(u)
+		case 7:
+			m.UserID, err = stringField(typ, b)
+		case 8:
+			m.ClientIP, err = stringField(typ, b)
+		case 9:
+			m.UserAgentHash, err = stringField(typ, b)
+		case 10:
+			m.ClientCert, err = stringField(typ, b)
+		case 11:
+			u, err = varintField(typ, b)
+			m.CookieIssuedAt = fromUnixNano(u)
+		case 12:
+			u, err = varintField(typ, b)
+			m.SchemaVersion = int(int64(u))
+		case 13:
+			u, err = varintField(typ, b)
+			m.LastSeenAt = fromUnixNano(u)
+		case 14:
+			m.CreatedIP, err = stringField(typ, b)
+		case 15:
+			m.UserAgent, err = stringField(typ, b)
+		case 16:
+			var c gomemssn.Change
+			c, err = parseChange(typ, b)
+			m.History = append(m.History, c)
+		}
+		return err
+	})
+}
+
+func parseLoginIntent(typ protowire.Type, b []byte) (*gomemssn.LoginIntent, error) {
+	b, err := bytesField(typ, b)
+	if err != nil {
+		return nil, err
+	}
+	li := &gomemssn.LoginIntent{}
+	err = parse(b, func(num protowire.Number, typ protowire.Type, b []byte) (err error) {
+		switch num {
+		case 1:
+			li.Route, err = stringField(typ, b)
+		case 2:
+			err = parseEntry(typ, b, func(k string, b []byte) error {
+				var v []byte
+				if b != nil {
+					var n int
+					if v, n = protowire.ConsumeBytes(b); n < 0 {
+						return protowire.ParseError(n)
+					}
+				}
+				if li.Params == nil {
+					li.Params = make(map[string]string)
+				}
+				li.Params[k] = string(v)
+				return nil
+			})
+		case 3:
+			var u uint64
+			u, err = varintField(typ, b)
+			li.ExpiresAt = fromUnixNano(u)
+		}
+		return err
+	})
+	return li, err
+}
+
+func parseChange(typ protowire.Type, b []byte) (gomemssn.Change, error) {
+	var c gomemssn.Change
+	b, err := bytesField(typ, b)
+	if err != nil {
+		return c, err
+	}
+	err = parse(b, func(num protowire.Number, typ protowire.Type, b []byte) (err error) {
+		switch num {
+		case 1:
+			var u uint64
+			u, err = varintField(typ, b)
+			c.Time = fromUnixNano(u)
+		case 2:
+			var k string
+			k, err = stringField(typ, b)
+			c.Keys = append(c.Keys, k)
+		case 3:
+			c.Path, err = stringField(typ, b)
+		}
+		return err
+	})
+	return c, err
+}
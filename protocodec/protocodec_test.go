@@ -0,0 +1,130 @@
+package protocodec
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestCodec(t *testing.T) {
+
+	m := gomemssn.NewManager(nil, "gomemssn_test")
+	m.Codec = &Codec{}
+
+	when := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["str"] = "abc"
+	s.Values["int"] = 42
+	s.Values["neg"] = int8(-3)
+	s.Values["uint"] = uint(7)
+	s.Values["float"] = 1.5
+	s.Values["bool"] = true
+	s.Values["bytes"] = []byte{1, 2, 3}
+	s.Values["when"] = when
+	s.Values["nil"] = nil
+	s.Values["list"] = []string{"a", "b"}
+	s.Values["map"] = map[string]int{"x": 1}
+	s.AddFlash("info", "hello")
+	s.SetUserID("u1")
+	m.MustWriteSession(w, s)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	s2 := m.MustSession(httptest.NewRecorder(), r)
+
+	want := map[string]interface{}{
+		"str":   "abc",
+		"int":   int64(42),
+		"neg":   int64(-3),
+		"uint":  uint64(7),
+		"float": 1.5,
+		"bool":  true,
+		"bytes": []byte{1, 2, 3},
+		"when":  when.Local(),
+		"nil":   nil,
+		"list":  []interface{}{"a", "b"},
+		"map":   map[string]interface{}{"x": int64(1)},
+	}
+	for k, v := range want {
+		if got, ok := s2.Values[k]; !ok || !reflect.DeepEqual(got, v) {
+			t.Errorf("%s: expected %#v but got %#v", k, v, got)
+		}
+	}
+	if f := s2.Flashes("info"); len(f) != 1 || f[0] != "hello" {
+		t.Errorf("unexpected flashes: %#v", f)
+	}
+	if s2.Meta.UserID != "u1" || !s2.Meta.CreatedAt.Equal(s.Meta.CreatedAt) {
+		t.Errorf("unexpected meta: %+v", s2.Meta)
+	}
+
+	if _, err := (Codec{}).Encode(gomemssn.Values{"ch": make(chan int)}); err == nil {
+		t.Error("expected an error encoding a chan")
+	}
+
+}
+
+// TestWire checks the encoding against session.proto, as read by something
+// knowing nothing but the wire format
+func TestWire(t *testing.T) {
+
+	c := Codec{}
+	rec := struct {
+		Meta   gomemssn.Meta
+		Values gomemssn.Values
+	}{
+		Meta:   gomemssn.Meta{UserID: "u1", SchemaVersion: 3},
+		Values: gomemssn.Values{"n": -2},
+	}
+	b, err := c.Encode(&rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := func(b []byte) map[protowire.Number][]byte {
+		ret := make(map[protowire.Number][]byte)
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			b = b[n:]
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if typ == protowire.BytesType {
+				ret[num], _ = protowire.ConsumeBytes(b)
+			} else {
+				ret[num] = b[:n]
+			}
+			b = b[n:]
+		}
+		return ret
+	}
+
+	session := fields(b)
+	meta := fields(session[2])
+	if string(meta[7]) != "u1" {
+		t.Errorf("expected user_id u1 but got %q", meta[7])
+	}
+	if v, _ := protowire.ConsumeVarint(meta[12]); v != 3 {
+		t.Errorf("expected schema_version 3 but got %d", v)
+	}
+	entry := fields(session[1])
+	value := fields(entry[2])
+	if v, _ := protowire.ConsumeVarint(value[3]); string(entry[1]) != "n" || protowire.DecodeZigZag(v) != -2 {
+		t.Errorf("unexpected entry %q: %v", entry[1], value)
+	}
+
+	// unknown fields, from a newer session.proto, are skipped
+	b = protowire.AppendTag(b, 99, protowire.BytesType)
+	b = protowire.AppendString(b, "later")
+	rec.Meta, rec.Values = gomemssn.Meta{}, nil
+	if err := c.Decode(b, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Meta.UserID != "u1" || rec.Values["n"] != int64(-2) {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+
+}
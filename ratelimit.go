@@ -0,0 +1,59 @@
+package gomemssn
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// With NewSessionLimit set, new sessions are counted per client IP (see
+// ClientIP) in the backing store, in fixed windows of NewSessionWindow.  A
+// client over the limit gets a detached session, like with Skip: it works
+// for the request but is never stored and no cookie is set, so a bot
+// hammering the site can't fill the cache with sessions.  The counters are
+// kept like Session.Incr's; if the store can't be reached the limit is not
+// applied.
+
+// defaultNewSessionWindow is the NewSessionWindow used when it is 0
+const defaultNewSessionWindow = time.Minute
+
+func (m *Manager) newSessionWindow() time.Duration {
+	if m.NewSessionWindow > 0 {
+		return m.NewSessionWindow
+	}
+	return defaultNewSessionWindow
+}
+
+// allowNewSession counts a new session for the client of r and reports
+// whether it is within NewSessionLimit
+func (m *Manager) allowNewSession(r *http.Request) bool {
+
+	if m.NewSessionLimit <= 0 || m.ReadOnly() || m.Degraded() {
+		return true
+	}
+
+	window := m.newSessionWindow()
+	ip := m.ClientIP(r)
+	key := "newsessions:" + ip + ":" + strconv.FormatInt(m.now().UnixNano()/int64(window), 36)
+	n, err := m.incr(key, window)
+	if err != nil || n <= m.NewSessionLimit {
+		return true
+	}
+
+	if n == m.NewSessionLimit+1 {
+		// once per window is enough
+		m.audit(r, AuditAnomaly, nil, "new session limit reached")
+	}
+	if m.OnNewSessionLimit != nil {
+		m.OnNewSessionLimit(r, ip)
+	}
+	return false
+
+}
+
+// incr adds one to the counter key (creating it, expiring after ttl) and
+// returns the new count
+func (m *Manager) incr(key string, ttl time.Duration) (int, error) {
+	n, err := incr(m.store(), m.storeKey(key), 1, ttl)
+	return int(n), err
+}
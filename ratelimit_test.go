@@ -0,0 +1,48 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewSessionLimit(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now = clock.Now
+	m.NewSessionLimit = 2
+	var tripped []string
+	m.OnNewSessionLimit = func(r *http.Request, ip string) { tripped = append(tripped, ip) }
+
+	newSession := func(ip string) (*Session, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		return m.MustSession(w, r), w
+	}
+
+	for i := 0; i < 2; i++ {
+		if s, _ := newSession("192.0.2.1"); s.ReadOnly() {
+			t.Fatalf("session %d over the limit", i)
+		}
+	}
+	s, w := newSession("192.0.2.1")
+	if !s.ReadOnly() || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("expected a detached session without a cookie over the limit")
+	}
+	if len(tripped) != 1 || tripped[0] != "192.0.2.1" {
+		t.Fatalf("expected the callback for the client, got %v", tripped)
+	}
+
+	// other clients aren't affected, and the next window starts over
+	if s, _ = newSession("192.0.2.2"); s.ReadOnly() {
+		t.Fatalf("other client over the limit")
+	}
+	clock.Advance(time.Minute)
+	if s, _ = newSession("192.0.2.1"); s.ReadOnly() {
+		t.Fatalf("client still over the limit in the next window")
+	}
+
+}
@@ -0,0 +1,122 @@
+package gomemssn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// Raw values are []byte stored under their own names (separate from Values)
+// which are written to memcache as-is after the codec's output, for data the
+// application already has in a compact serialized form.  A record with raw
+// values is framed like this:
+//
+//	frameMagic, version byte, uvarint len(payload), payload,
+//	then for each raw value: uvarint len(name), name, uvarint len(data), data
+//
+// Neither gob nor json output can start with a zero byte, so records without
+// raw values are written exactly as before.
+
+const (
+	frameMagic   = "\x00GMS"
+	frameVersion = 1
+)
+
+var errBadFrame = errors.New("gomemssn: malformed record frame")
+
+// SetRaw stores b under name verbatim, the codec never sees it.  b must not
+// be modified afterwards.
+func (s *Session) SetRaw(name string, b []byte) {
+	if s.raw == nil {
+		s.raw = make(map[string][]byte)
+	}
+	s.raw[name] = b
+}
+
+// GetRaw returns what was stored under name with SetRaw, nil if nothing was
+func (s *Session) GetRaw(name string) []byte {
+	return s.raw[name]
+}
+
+// DeleteRaw removes the raw value name
+func (s *Session) DeleteRaw(name string) {
+	delete(s.raw, name)
+}
+
+func copyRaw(raw map[string][]byte) map[string][]byte {
+	if raw == nil {
+		return nil
+	}
+	ret := make(map[string][]byte, len(raw))
+	for k, v := range raw {
+		ret[k] = v
+	}
+	return ret
+}
+
+func appendUvarintBytes(b []byte, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// appendFrame frames the codec output payload together with the raw values
+func appendFrame(payload []byte, raw map[string][]byte) []byte {
+	names := make([]string, 0, len(raw))
+	size := len(frameMagic) + 1 + binary.MaxVarintLen64 + len(payload)
+	for name, data := range raw {
+		names = append(names, name)
+		size += 2*binary.MaxVarintLen64 + len(name) + len(data)
+	}
+	sort.Strings(names)
+	b := make([]byte, 0, size)
+	b = append(b, frameMagic...)
+	b = append(b, frameVersion)
+	b = appendUvarintBytes(b, payload)
+	for _, name := range names {
+		b = appendUvarintBytes(b, []byte(name))
+		b = appendUvarintBytes(b, raw[name])
+	}
+	return b
+}
+
+// reads one uvarint length prefixed chunk from the start of b
+func readUvarintBytes(b []byte) (chunk, rest []byte, err error) {
+	n, l := binary.Uvarint(b)
+	if l <= 0 || uint64(len(b)-l) < n {
+		return nil, nil, errBadFrame
+	}
+	return b[l : l+int(n)], b[l+int(n):], nil
+}
+
+// splitFrame returns the codec payload and raw values of data, if data is
+// not framed it is all payload
+func splitFrame(data []byte) (payload []byte, raw map[string][]byte, err error) {
+	if !bytes.HasPrefix(data, []byte(frameMagic)) {
+		return data, nil, nil
+	}
+	b := data[len(frameMagic):]
+	if len(b) < 1 || b[0] != frameVersion {
+		return nil, nil, errBadFrame
+	}
+	payload, b, err = readUvarintBytes(b[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	for len(b) > 0 {
+		var name, v []byte
+		name, b, err = readUvarintBytes(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, b, err = readUvarintBytes(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		if raw == nil {
+			raw = make(map[string][]byte)
+		}
+		raw[string(name)] = v
+	}
+	return payload, raw, nil
+}
@@ -0,0 +1,54 @@
+package gomemssn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRaw(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+
+	s := loadTestSession(t, m, "")
+	blob := []byte{0, 1, 2, 255, 'x'}
+	s.SetRaw("blob", blob)
+	s.SetRaw("empty", []byte{})
+	s.Values["v"] = "abc123"
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _, err := m.get(s.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, blob) {
+		t.Fatalf("expected raw value to be stored verbatim")
+	}
+
+	s = loadTestSession(t, m, s.Key)
+	if b := s.GetRaw("blob"); !bytes.Equal(b, blob) {
+		t.Fatalf("expected blob=%v but got: %v", blob, b)
+	}
+	if b := s.GetRaw("empty"); b == nil || len(b) != 0 {
+		t.Fatalf("expected empty raw value but got: %v", b)
+	}
+	if v := s.Values.GetString("v"); v != "abc123" {
+		t.Fatalf("expected v='abc123' but got: %v", v)
+	}
+
+	s.DeleteRaw("blob")
+	s.DeleteRaw("empty")
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	data, _, _ = m.get(s.Key)
+	if bytes.HasPrefix(data, []byte(frameMagic)) {
+		t.Fatalf("record without raw values should not be framed")
+	}
+
+	if _, _, err := splitFrame([]byte(frameMagic + "\x01\x05ab")); err != errBadFrame {
+		t.Fatalf("expected errBadFrame but got: %v", err)
+	}
+
+}
@@ -0,0 +1,121 @@
+package gomemssn
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrReadOnly is returned by operations which must write to the backing store
+// when the session is read-only, see Session.ReadOnly
+var ErrReadOnly = errors.New("gomemssn: session is read-only")
+
+// SetReadOnly turns read-only mode on or off.  While it is on sessions are
+// read as usual but WriteSession does nothing (calling OnWriteSkipped), for
+// freezing session state during backend migrations or incidents.
+func (m *Manager) SetReadOnly(readOnly bool) {
+	m.readOnly.Store(readOnly)
+}
+
+// ReadOnly reports whether read-only mode is on, see SetReadOnly
+func (m *Manager) ReadOnly() bool {
+	return m.readOnly.Load()
+}
+
+// Degraded reports whether writes are currently being skipped because too
+// many of them failed in a row (see WriteFailureThreshold) or the backing
+// store failed its health check (see StartHealthCheck)
+func (m *Manager) Degraded() bool {
+	if !m.Healthy() {
+		return true
+	}
+	until := m.circuitOpenUntil.Load()
+	return until != 0 && m.now().UnixNano() < until
+}
+
+// ReadOnly reports whether changes to this session will not be saved
+// because the Manager is read-only or degraded, or the request was skipped
+func (s *Session) ReadOnly() bool {
+	return s.skipped || (s.m != nil && (s.m.ReadOnly() || s.m.Degraded()))
+}
+
+func (m *Manager) writeSucceeded() {
+	m.writeFailures.Store(0)
+	m.circuitOpenUntil.Store(0)
+}
+
+// writeFailed counts a failed write and degrades to read-only if there were
+// WriteFailureThreshold of them in a row; after the cooldown the next write
+// is tried and if it fails too we are straight back to degraded
+func (m *Manager) writeFailed() {
+	if m.WriteFailureThreshold <= 0 {
+		return
+	}
+	if m.writeFailures.Add(1) >= int32(m.WriteFailureThreshold) {
+		m.circuitOpenUntil.Store(m.now().Add(m.WriteFailureCooldown).UnixNano())
+	}
+}
+
+// skipWrite returns true (after calling OnWriteSkipped) if writing s should
+// be skipped because we are read-only or degraded
+func (m *Manager) skipWrite(s *Session) bool {
+	if !m.ReadOnly() && !m.Degraded() {
+		return false
+	}
+	if m.OnWriteSkipped != nil {
+		m.OnWriteSkipped(s)
+	}
+	return true
+}
+
+// PeekSession returns the session r carries without any of what Session
+// does besides reading it: no cookie is set, nothing is created on a miss
+// (ErrNotFound is returned, also for expired and rejected sessions) and
+// nothing is written, the session is read-only.  For handlers which only
+// check login state and must not allocate sessions (static assets, health
+// checks, API GETs).
+func (m *Manager) PeekSession(r *http.Request) (*Session, error) {
+
+	token := m.requestToken(r)
+	if token == "" {
+		return nil, ErrNotFound
+	}
+	key, payload, ok := m.parseCookie(token)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	payload, l, err := m.loadFirst(key, payload)
+
+	var s *Session
+	if payload != nil {
+		// kept in the cookie, see CookieFallback
+		rec, err := m.decodeRecord(payload)
+		if err != nil {
+			return nil, err
+		}
+		s = m.newSession(key)
+		s.Values, s.Meta, s.raw = rec.Values, rec.Meta, rec.raw
+		s.inCookie, s.source = true, SourceCookie
+	} else {
+		if l == nil && err == nil {
+			l, err = m.load(key)
+		}
+		if err == errRevoked {
+			return nil, ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		s = m.loadedSession(key, l)
+	}
+
+	if m.tooOld(s) {
+		return nil, ErrNotFound
+	}
+	if act, bound := m.checkBinding(r, s); !bound && act == BindingReject {
+		return nil, ErrNotFound
+	}
+	m.expireValues(s)
+	s.skipped = true
+	s.snap = s.Snapshot()
+	return s, nil
+
+}
@@ -0,0 +1,114 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+func TestReadOnly(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	skipped := 0
+	m.OnWriteSkipped = func(s *Session) { skipped++ }
+
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+
+	m.SetReadOnly(true)
+	s = loadTestSession(t, m, s.Key)
+	if v := s.Values.GetString("v"); v != "abc123" {
+		t.Fatalf("expected reads to work, v='abc123' but got: %v", v)
+	}
+	s.Values["v"] = "def456"
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 1 {
+		t.Fatalf("expected 1 skipped write but got %d", skipped)
+	}
+
+	m.SetReadOnly(false)
+	if v := loadTestSession(t, m, s.Key).Values.GetString("v"); v != "abc123" {
+		t.Fatalf("write should have been skipped, expected v='abc123' but got: %v", v)
+	}
+
+}
+
+func TestWriteFailureDegrade(t *testing.T) {
+
+	// nothing listens there so every write fails
+	client := memcache.New("127.0.0.1:1")
+	client.Timeout = time.Millisecond * 100
+	m := NewManager(client, "gomemssn_test")
+	m.WriteFailureThreshold = 2
+	m.WriteFailureCooldown = time.Hour
+
+	s := loadTestSession(t, m, "")
+	for i := 0; i < 2; i++ {
+		if s.ReadOnly() {
+			t.Fatalf("should not be read-only before the threshold")
+		}
+		if err := m.WriteSession(nil, s); err == nil {
+			t.Fatalf("expected write to fail")
+		}
+	}
+
+	if !s.ReadOnly() || !m.Degraded() {
+		t.Fatalf("expected to be degraded after the threshold")
+	}
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatalf("expected write to be skipped but got: %v", err)
+	}
+
+	// cooldown over, the next write is tried again
+	m.circuitOpenUntil.Store(time.Now().Add(-time.Second).UnixNano())
+	if err := m.WriteSession(nil, s); err == nil {
+		t.Fatalf("expected write to be tried and fail")
+	}
+	if !m.Degraded() {
+		t.Fatalf("expected to be degraded again")
+	}
+
+}
+
+func TestPeekSession(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+
+	if _, err := m.PeekSession(httptest.NewRequest("GET", "/", nil)); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound without a cookie, got %v", err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: "unknown"})
+	if _, err := m.PeekSession(r); err != ErrNotFound || m.stub.Len() != 0 {
+		t.Fatalf("expected ErrNotFound and nothing stored for an unknown key, got %v", err)
+	}
+
+	s := loadTestSession(t, m, "")
+	s.RecordAuthentication()
+	m.MustWriteSession(nil, s)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(s.Cookie)
+	w := httptest.NewRecorder()
+	p, err := m.PeekSession(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.IsAuthenticated() || !p.ReadOnly() || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("expected the session, read-only")
+	}
+	p.Values["x"] = 1
+	m.MustWriteSession(w, p)
+	if s2 := loadTestSession(t, m, s.Key); s2.Values["x"] != nil {
+		t.Fatalf("expected a peeked session not to be written")
+	}
+
+}
@@ -0,0 +1,91 @@
+package gomemssn
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// returnURLKey is where RedirectToLogin keeps the URL to come back to
+const returnURLKey = "_return_url"
+
+// isLocalURL reports whether u is a path on this site, i.e. safe to
+// redirect to without becoming an open redirect
+func isLocalURL(u string) bool {
+	if u == "" || u[0] != '/' {
+		return false
+	}
+	// "//host" and "/\host" are treated as other hosts by browsers
+	if len(u) > 1 && (u[1] == '/' || u[1] == '\\') {
+		return false
+	}
+	return !strings.ContainsAny(u, "\r\n\t")
+}
+
+// RedirectToLogin remembers the URL of r in its session (GET and HEAD only,
+// other requests can't be replayed by a redirect), writes the session and
+// redirects to loginURL.  After a successful login use ConsumeReturnURL to
+// send the user back where they were.
+func (m *Manager) RedirectToLogin(w http.ResponseWriter, r *http.Request, loginURL string) error {
+
+	s, err := m.Session(w, r)
+	if err != nil {
+		return err
+	}
+
+	if r.Method == "GET" || r.Method == "HEAD" {
+		if u := r.URL.RequestURI(); isLocalURL(u) {
+			s.Values.SetString(returnURLKey, u)
+			err = m.WriteSession(w, s)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	http.Redirect(w, r, loginURL, http.StatusFound)
+	return nil
+
+}
+
+// ConsumeReturnURL returns the URL saved by RedirectToLogin and removes it
+// from the session (which still has to be written), or "" if there is none.
+// Only paths on this site are ever returned.
+func ConsumeReturnURL(s *Session) string {
+	u := s.Values.GetString(returnURLKey)
+	delete(s.Values, returnURLKey)
+	if !isLocalURL(u) {
+		return ""
+	}
+	return u
+}
+
+// LoginIntent describes where to resume a multi-step flow after the user
+// logs in: a route name as understood by the application plus its parameters
+type LoginIntent struct {
+	Route     string
+	Params    map[string]string
+	ExpiresAt time.Time // zero means it doesn't expire (other than with the session)
+}
+
+// SetLoginIntent remembers route and params to resume after login, for up to
+// ttl (0 means no limit).  It replaces any previous intent.
+func (s *Session) SetLoginIntent(route string, params map[string]string, ttl time.Duration) {
+	li := &LoginIntent{Route: route, Params: params}
+	if ttl > 0 {
+		li.ExpiresAt = s.now().Add(ttl)
+	}
+	s.Meta.LoginIntent = li
+}
+
+// ConsumeLoginIntent returns the intent saved with SetLoginIntent and
+// removes it from the session (which still has to be written), nil if there
+// is none or it expired
+func (s *Session) ConsumeLoginIntent() *LoginIntent {
+	li := s.Meta.LoginIntent
+	s.Meta.LoginIntent = nil
+	if li == nil || (!li.ExpiresAt.IsZero() && s.now().After(li.ExpiresAt)) {
+		return nil
+	}
+	return li
+}
@@ -0,0 +1,74 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReturnURL(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+
+	w := httptest.NewRecorder()
+	if err := m.RedirectToLogin(w, httptest.NewRequest("GET", "/orders?page=2", nil), "/login"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/login" {
+		t.Fatalf("expected redirect to /login but got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	key := w.Result().Cookies()[0].Value
+	s := loadTestSession(t, m, key)
+	if u := ConsumeReturnURL(s); u != "/orders?page=2" {
+		t.Fatalf("expected return url '/orders?page=2' but got: %q", u)
+	}
+	if u := ConsumeReturnURL(s); u != "" {
+		t.Fatalf("expected return url to be consumed but got: %q", u)
+	}
+
+	for _, u := range []string{"//evil.example.com/", "/\\evil.example.com", "https://evil.example.com/", "evil", ""} {
+		if isLocalURL(u) {
+			t.Fatalf("%q should not be considered local", u)
+		}
+	}
+	s.Values.SetString(returnURLKey, "//evil.example.com/")
+	if u := ConsumeReturnURL(s); u != "" {
+		t.Fatalf("expected foreign return url to be refused but got: %q", u)
+	}
+
+}
+
+func TestLoginIntent(t *testing.T) {
+
+	for _, c := range []Codec{&GobCodec{}, &JSONCodec{}} {
+
+		m := NewManager(nil, "gomemssn_test")
+		m.Codec = c
+
+		s := loadTestSession(t, m, "")
+		s.SetLoginIntent("onboarding.step", map[string]string{"step": "3"}, time.Hour)
+		if err := m.WriteSession(nil, s); err != nil {
+			t.Fatal(err)
+		}
+
+		s = loadTestSession(t, m, s.Key)
+		li := s.ConsumeLoginIntent()
+		if li == nil || li.Route != "onboarding.step" || li.Params["step"] != "3" {
+			t.Fatalf("%T: unexpected login intent: %#v", c, li)
+		}
+		if s.ConsumeLoginIntent() != nil {
+			t.Fatalf("%T: login intent should only be consumed once", c)
+		}
+
+	}
+
+	s := &Session{Values: make(Values)}
+	s.SetLoginIntent("x", nil, time.Hour)
+	s.Meta.LoginIntent.ExpiresAt = time.Now().Add(-time.Second)
+	if s.ConsumeLoginIntent() != nil {
+		t.Fatalf("expired login intent should not be returned")
+	}
+
+}
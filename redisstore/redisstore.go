@@ -0,0 +1,333 @@
+// Package redisstore is a gomemssn.Store keeping sessions in Redis, for
+// deployments which have Redis but not memcache:
+//
+//	m := gomemssn.NewManager(nil, "myapp")
+//	m.Store = redisstore.New(redis.NewClient(&redis.Options{Addr: "localhost:6379"}), "myapp:")
+//
+// With NewTx instead sessions are written together with their user's index
+// in one transaction, see gomemssn.TxStore.  That takes a single server (or
+// one behind Sentinel): a Redis Cluster or Ring can't make a transaction
+// over keys which may be on different nodes.
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store implements gomemssn.CASStore, gomemssn.MultiGetStore and
+// gomemssn.TTLStore.  Conditional
+// writes are done atomically by a Lua script comparing the stored value with
+// what was read.
+type Store struct {
+	Client  redis.UniversalClient // the redis client
+	Prefix  string                // prepended to every key
+	Timeout time.Duration         // if > 0, how long each call may take
+}
+
+// New returns a Store using client, with keys prefixed by prefix
+func New(client redis.UniversalClient, prefix string) *Store {
+	return &Store{Client: client, Prefix: prefix}
+}
+
+// TxStore is a Store which also implements gomemssn.TxStore, with WATCH and
+// MULTI/EXEC
+type TxStore struct {
+	*Store
+}
+
+// NewTx returns a TxStore using client, with keys prefixed by prefix
+func NewTx(client *redis.Client, prefix string) *TxStore {
+	return &TxStore{Store: New(client, prefix)}
+}
+
+// token is the cas token, the value as it was read
+type token struct {
+	data string
+}
+
+// sets KEYS[1] to ARGV[2] (expiring after ARGV[3] ms, 0 means never) only if
+// it currently holds ARGV[1]
+var casScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+func (s *Store) ctx() (context.Context, context.CancelFunc) {
+	if s.Timeout > 0 {
+		return context.WithTimeout(context.Background(), s.Timeout)
+	}
+	return context.Background(), func() {}
+}
+
+func (s *Store) Get(key string) ([]byte, error) {
+	data, _, err := s.GetCAS(key)
+	return data, err
+}
+
+func (s *Store) GetCAS(key string) ([]byte, interface{}, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	v, err := s.Client.Get(ctx, s.Prefix+key).Result()
+	if err == redis.Nil {
+		return nil, nil, gomemssn.ErrNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return []byte(v), &token{data: v}, nil
+}
+
+func (s *Store) GetMulti(keys []string) (map[string]*gomemssn.StoreItem, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	pkeys := make([]string, len(keys))
+	for i, k := range keys {
+		pkeys[i] = s.Prefix + k
+	}
+	vals, err := s.Client.MGet(ctx, pkeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]*gomemssn.StoreItem, len(keys))
+	for i, v := range vals {
+		if v, ok := v.(string); ok {
+			ret[keys[i]] = &gomemssn.StoreItem{Data: []byte(v), CAS: &token{data: v}}
+		}
+	}
+	return ret, nil
+}
+
+func (s *Store) Set(key string, data []byte, ttl time.Duration) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	return s.Client.Set(ctx, s.Prefix+key, data, ttl).Err()
+}
+
+func (s *Store) CompareAndSwap(key string, data []byte, tok interface{}, ttl time.Duration) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	if tok == nil {
+		ok, err := s.Client.SetNX(ctx, s.Prefix+key, data, ttl).Result()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return gomemssn.ErrCASConflict
+		}
+		return nil
+	}
+	t, ok := tok.(*token)
+	if !ok {
+		return gomemssn.ErrCASConflict
+	}
+	n, err := casScript.Run(ctx, s.Client, []string{s.Prefix + key}, t.data, data, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return gomemssn.ErrCASConflict
+	}
+	return nil
+}
+
+func (s *Store) Delete(key string) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	return s.Client.Del(ctx, s.Prefix+key).Err()
+}
+
+func (s *Store) Touch(key string, ttl time.Duration) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	var ok bool
+	var err error
+	if ttl > 0 {
+		ok, err = s.Client.PExpire(ctx, s.Prefix+key, ttl).Result()
+	} else {
+		ok, err = s.Client.Persist(ctx, s.Prefix+key).Result()
+		if err == nil && !ok {
+			// persist is false for keys without a ttl too
+			var n int64
+			n, err = s.Client.Exists(ctx, s.Prefix+key).Result()
+			ok = n > 0
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return gomemssn.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) TTL(key string) (time.Duration, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	ttl, err := s.Client.PTTL(ctx, s.Prefix+key).Result()
+	if err != nil {
+		return 0, err
+	}
+	switch ttl {
+	case -2:
+		return 0, gomemssn.ErrNotFound
+	case -1:
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// txRetries is how many times Tx runs its function again when a key it read
+// changed before the transaction could be made
+const txRetries = 5
+
+var errTxRetry = errors.New("redisstore: transaction raced")
+
+// Tx queues the changes f makes and makes them with MULTI/EXEC, watching the
+// keys of its CompareAndSwaps to check their tokens.  f reads the keys as
+// they are, not as it changed them; it runs again when a key it read changed
+// meanwhile.
+func (s *TxStore) Tx(f func(gomemssn.Store) error) error {
+	for attempt := 0; ; attempt++ {
+		tx := &queuedStore{Store: s.Store, read: make(map[*token]bool)}
+		if err := f(tx); err != nil {
+			return err
+		}
+		err := tx.commit()
+		if err == errTxRetry {
+			if attempt < txRetries {
+				continue
+			}
+			err = gomemssn.ErrCASConflict
+		}
+		return err
+	}
+}
+
+// queuedStore is the Store Tx hands to its function: reads go to Redis, changes
+// are queued for commit
+type queuedStore struct {
+	*Store
+	read map[*token]bool // tokens of what was read in this run
+	ops  []txOp
+}
+
+type txOp struct {
+	op   string // "set", "cas", "del" or "touch"
+	key  string
+	data []byte
+	tok  interface{}
+	ttl  time.Duration
+}
+
+func (tx *queuedStore) Get(key string) ([]byte, error) {
+	data, _, err := tx.GetCAS(key)
+	return data, err
+}
+
+func (tx *queuedStore) GetCAS(key string) ([]byte, interface{}, error) {
+	data, tok, err := tx.Store.GetCAS(key)
+	if t, ok := tok.(*token); ok {
+		tx.read[t] = true
+	}
+	return data, tok, err
+}
+
+func (tx *queuedStore) Set(key string, data []byte, ttl time.Duration) error {
+	tx.ops = append(tx.ops, txOp{op: "set", key: key, data: data, ttl: ttl})
+	return nil
+}
+
+func (tx *queuedStore) CompareAndSwap(key string, data []byte, tok interface{}, ttl time.Duration) error {
+	if _, ok := tok.(*token); tok != nil && !ok {
+		return gomemssn.ErrCASConflict
+	}
+	tx.ops = append(tx.ops, txOp{op: "cas", key: key, data: data, tok: tok, ttl: ttl})
+	return nil
+}
+
+func (tx *queuedStore) Delete(key string) error {
+	tx.ops = append(tx.ops, txOp{op: "del", key: key})
+	return nil
+}
+
+// Touch is queued like the changes, so it can't tell whether key exists
+func (tx *queuedStore) Touch(key string, ttl time.Duration) error {
+	tx.ops = append(tx.ops, txOp{op: "touch", key: key, ttl: ttl})
+	return nil
+}
+
+// commit makes the queued changes, if the keys of the CompareAndSwaps still
+// hold what their tokens say; errTxRetry means one f read itself doesn't,
+// or one was changed while committing
+func (tx *queuedStore) commit() error {
+
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	ctx, cancel := tx.ctx()
+	defer cancel()
+	var watch []string
+	for _, op := range tx.ops {
+		if op.op == "cas" {
+			watch = append(watch, tx.Prefix+op.key)
+		}
+	}
+
+	err := tx.Client.Watch(ctx, func(rtx *redis.Tx) error {
+		for _, op := range tx.ops {
+			if op.op != "cas" {
+				continue
+			}
+			v, err := rtx.Get(ctx, tx.Prefix+op.key).Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			t, _ := op.tok.(*token)
+			if (t == nil && err == redis.Nil) || (t != nil && err == nil && v == t.data) {
+				continue
+			}
+			if t == nil || tx.read[t] {
+				// changed since f read it (or created since it found nothing)
+				return errTxRetry
+			}
+			return gomemssn.ErrCASConflict
+		}
+		_, err := rtx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, op := range tx.ops {
+				key := tx.Prefix + op.key
+				switch op.op {
+				case "set", "cas":
+					pipe.Set(ctx, key, op.data, op.ttl)
+				case "del":
+					pipe.Del(ctx, key)
+				case "touch":
+					if op.ttl > 0 {
+						pipe.PExpire(ctx, key, op.ttl)
+					} else {
+						pipe.Persist(ctx, key)
+					}
+				}
+			}
+			return nil
+		})
+		return err
+	}, watch...)
+
+	if err == redis.TxFailedErr {
+		return errTxRetry
+	}
+	return err
+
+}
@@ -0,0 +1,287 @@
+package redisstore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/bradleypeabody/gomemssn/storetest"
+	"github.com/redis/go-redis/v9"
+)
+
+const testRedisServer = "127.0.0.1:6379"
+
+func TestStore(t *testing.T) {
+
+	conn, err := net.Dial("tcp", testRedisServer)
+	if err != nil {
+		t.Logf("No redis running locally (%v), skipping this test", testRedisServer)
+		t.SkipNow()
+	} else {
+		conn.Close()
+	}
+
+	st := New(redis.NewClient(&redis.Options{Addr: testRedisServer}), "gomemssn_test:")
+	m := gomemssn.NewManager(nil, "gomemssn_test")
+	m.Store = st
+	m.OnConflict = gomemssn.ConflictFail
+
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(w, s)
+
+	load := func() *gomemssn.Session {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+		return m.MustSession(httptest.NewRecorder(), r)
+	}
+	a, b := load(), load()
+	if a.Values.GetString("v") != "abc123" {
+		t.Fatalf("session not read back: %v", a.Values)
+	}
+	a.Values["v"] = "a"
+	m.MustWriteSession(nil, a)
+	b.Values["v"] = "b"
+	if err := m.WriteSession(nil, b); err == nil {
+		t.Fatalf("expected a conflict")
+	}
+
+	if err := st.Touch(s.Key, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DestroySession(nil, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Touch(s.Key, time.Minute); err != gomemssn.ErrNotFound {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+
+}
+
+func TestConformance(t *testing.T) {
+	conn, err := net.Dial("tcp", testRedisServer)
+	if err != nil {
+		t.Skipf("No redis running locally (%v)", testRedisServer)
+	}
+	conn.Close()
+	storetest.TestStore(t, NewTx(redis.NewClient(&redis.Options{Addr: testRedisServer}), "gomemssn_test:"))
+}
+
+// fakeRedis speaks enough RESP2 for Tx: GET, SET, DEL, PEXPIRE, PERSIST and
+// WATCH with MULTI/EXEC, expirations are ignored
+func fakeRedis(t *testing.T) string {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	data := make(map[string]string)
+	versions := make(map[string]int)
+
+	command := func(br *bufio.Reader) ([]string, error) {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+		if err != nil {
+			return nil, err
+		}
+		args := make([]string, n)
+		for i := range args {
+			if line, err = br.ReadString('\n'); err != nil {
+				return nil, err
+			}
+			l, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+			if err != nil {
+				return nil, err
+			}
+			b := make([]byte, l+2)
+			if _, err := io.ReadFull(br, b); err != nil {
+				return nil, err
+			}
+			args[i] = string(b[:l])
+		}
+		return args, nil
+	}
+
+	exists := func(key string) string {
+		if _, ok := data[key]; ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	}
+	run := func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "GET":
+			if v, ok := data[args[1]]; ok {
+				return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			}
+			return "$-1\r\n"
+		case "SET":
+			data[args[1]] = args[2]
+			versions[args[1]]++
+			return "+OK\r\n"
+		case "DEL":
+			r := exists(args[1])
+			delete(data, args[1])
+			versions[args[1]]++
+			return r
+		case "PEXPIRE", "PERSIST":
+			return exists(args[1])
+		case "PING":
+			return "+PONG\r\n"
+		case "CLIENT":
+			return "+OK\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	}
+
+	serve := func(c net.Conn) {
+		defer c.Close()
+		br := bufio.NewReader(c)
+		var watched map[string]int
+		var queued [][]string
+		multi := false
+		for {
+			args, err := command(br)
+			if err != nil || len(args) == 0 {
+				return
+			}
+			var res string
+			mu.Lock()
+			switch cmd := strings.ToUpper(args[0]); {
+			case multi && cmd != "EXEC":
+				queued = append(queued, args)
+				res = "+QUEUED\r\n"
+			case cmd == "MULTI":
+				multi, queued = true, nil
+				res = "+OK\r\n"
+			case cmd == "WATCH":
+				watched = make(map[string]int)
+				for _, k := range args[1:] {
+					watched[k] = versions[k]
+				}
+				res = "+OK\r\n"
+			case cmd == "UNWATCH":
+				watched = nil
+				res = "+OK\r\n"
+			case cmd == "EXEC":
+				multi, res = false, fmt.Sprintf("*%d\r\n", len(queued))
+				for k, v := range watched {
+					if versions[k] != v {
+						res = "*-1\r\n"
+					}
+				}
+				if res != "*-1\r\n" {
+					for _, q := range queued {
+						res += run(q)
+					}
+				}
+				watched = nil
+			default:
+				res = run(args)
+			}
+			mu.Unlock()
+			if _, err := io.WriteString(c, res); err != nil {
+				return
+			}
+		}
+	}
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(c)
+		}
+	}()
+
+	return ln.Addr().String()
+
+}
+
+func TestTx(t *testing.T) {
+
+	client := redis.NewClient(&redis.Options{Addr: fakeRedis(t)})
+	if _, ok := interface{}(New(client, "")).(gomemssn.TxStore); ok {
+		t.Fatal("expected a Store from New not to be a TxStore, it may be given a cluster")
+	}
+	st := NewTx(client, "gomemssn_test:")
+	expect := func(key, want string) {
+		t.Helper()
+		data, err := st.Get(key)
+		if (want == "" && err != gomemssn.ErrNotFound) || (want != "" && string(data) != want) {
+			t.Fatalf("%s: expected %q but got %q, %v", key, want, data, err)
+		}
+	}
+
+	failed := errors.New("failed")
+	err := st.Tx(func(tx gomemssn.Store) error {
+		tx.Set("a", []byte("one"), time.Hour)
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("expected the error of f but got %v", err)
+	}
+	expect("a", "")
+
+	if err := st.Tx(func(tx gomemssn.Store) error {
+		tx.Set("a", []byte("one"), time.Hour)
+		return tx.Set("b", []byte("one"), time.Hour)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expect("a", "one")
+	expect("b", "one")
+
+	// a stale token from outside is a conflict
+	_, token, _ := st.GetCAS("a")
+	st.Set("a", []byte("other"), time.Hour)
+	err = st.Tx(func(tx gomemssn.Store) error {
+		tx.(gomemssn.CASStore).CompareAndSwap("a", []byte("two"), token, time.Hour)
+		return tx.Delete("b")
+	})
+	if err != gomemssn.ErrCASConflict {
+		t.Fatalf("expected ErrCASConflict but got %v", err)
+	}
+	expect("a", "other")
+	expect("b", "one")
+
+	// one read in the transaction is read again
+	runs := 0
+	err = st.Tx(func(tx gomemssn.Store) error {
+		runs++
+		data, token, err := tx.(gomemssn.CASStore).GetCAS("a")
+		if err != nil {
+			return err
+		}
+		if runs == 1 {
+			st.Set("a", []byte("raced"), time.Hour)
+		}
+		tx.(gomemssn.CASStore).CompareAndSwap("a", append(data, '!'), token, time.Hour)
+		return tx.Delete("b")
+	})
+	if err != nil || runs != 2 {
+		t.Fatalf("expected a second run to succeed, got %d runs and %v", runs, err)
+	}
+	expect("a", "raced!")
+	expect("b", "")
+
+}
@@ -0,0 +1,168 @@
+package gomemssn
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Remember-me tokens keep a user signed in across browser restarts and long
+// after their session expired, in a cookie of their own (RememberCookie).
+// The cookie holds a selector, which says where the token is kept in the
+// backing store, and a validator, of which only a hash is stored, so a
+// leaked copy of the store can't be used to sign in.  Every use replaces the
+// token with a new one (the old one keeps working for RotateGrace, for
+// requests already under way), and a validator which doesn't match its
+// selector deletes the token, as it means it was stolen and used already.
+
+// ErrRememberInvalid is returned by AuthenticateRemembered when the request
+// has no remember-me cookie, or one which doesn't check out
+var ErrRememberInvalid = errors.New("gomemssn: invalid remember-me token")
+
+// defaultRememberExpiration is the RememberExpiration used when it is 0
+const defaultRememberExpiration = 30 * 24 * time.Hour
+
+func rememberKey(selector string) string {
+	return "remember:" + selector
+}
+
+func (m *Manager) rememberExpiration() time.Duration {
+	if m.RememberExpiration > 0 {
+		return m.RememberExpiration
+	}
+	return defaultRememberExpiration
+}
+
+// rememberCookie returns a copy of RememberCookie for r with value
+func (m *Manager) rememberCookie(r *http.Request, value string) *http.Cookie {
+	c := http.Cookie{Name: m.TemplateCookie.Name + "_remember", Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode}
+	if m.RememberCookie != nil {
+		c = *m.RememberCookie
+	}
+	if r != nil {
+		m.cookieDomain(r, &c)
+		if m.SecureAuto {
+			c.Secure = m.IsHTTPS(r)
+		}
+	}
+	crossSiteSecure(&c)
+	c.Value = value
+	if value == "" {
+		c.MaxAge = -1
+		c.Expires = time.Unix(1, 0)
+	} else {
+		c.MaxAge = int(m.rememberExpiration() / time.Second)
+		c.Expires = m.now().Add(m.rememberExpiration())
+	}
+	return &c
+}
+
+func hashValidator(validator string) string {
+	h := sha256.Sum256([]byte(validator))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// RememberMe issues a remember-me token for uid and sets its cookie on w;
+// call it when a user signs in with "keep me signed in" ticked
+func (m *Manager) RememberMe(w http.ResponseWriter, r *http.Request, uid string) error {
+
+	if m.ReadOnly() || m.Degraded() {
+		return ErrReadOnly
+	}
+
+	b := make([]byte, 12+32)
+	if _, err := crand.Read(b); err != nil {
+		return err
+	}
+	selector := base64.RawURLEncoding.EncodeToString(b[:12])
+	validator := base64.RawURLEncoding.EncodeToString(b[12:])
+
+	// the hash, whether the token was replaced already, and the user
+	rec := hashValidator(validator) + "\n\n" + uid
+	if err := m.cas(rememberKey(selector), []byte(rec), nil, m.rememberExpiration()); err != nil {
+		return err
+	}
+	http.SetCookie(w, m.rememberCookie(r, selector+"."+validator))
+	return nil
+
+}
+
+// AuthenticateRemembered returns the user whose remember-me token r has, and
+// sets a cookie with a new one on w; the application then signs the user
+// in, in a new session (see RegenerateSession).  Returns ErrRememberInvalid
+// if there is no valid token.
+func (m *Manager) AuthenticateRemembered(w http.ResponseWriter, r *http.Request) (string, error) {
+
+	c, err := r.Cookie(m.rememberCookie(r, "").Name)
+	if err != nil {
+		return "", ErrRememberInvalid
+	}
+	selector, validator, ok := strings.Cut(c.Value, ".")
+	if !ok || selector == "" {
+		return "", ErrRememberInvalid
+	}
+
+	data, token, err := m.get(rememberKey(selector))
+	if err == ErrNotFound {
+		return "", ErrRememberInvalid
+	} else if err != nil {
+		return "", err
+	}
+	f := strings.SplitN(string(data), "\n", 3)
+	if len(f) != 3 {
+		return "", ErrRememberInvalid
+	}
+	hash, rotated, uid := f[0], f[1] != "", f[2]
+
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashValidator(validator))) != 1 {
+		// someone guessed or stole the selector, the token is burnt
+		if !m.ReadOnly() {
+			m.del(rememberKey(selector))
+		}
+		return "", ErrRememberInvalid
+	}
+	if rotated || m.ReadOnly() || m.Degraded() {
+		// a request which raced the one replacing the token
+		return uid, nil
+	}
+
+	grace := m.RotateGrace
+	if grace <= 0 {
+		grace = defaultRotateGrace
+	}
+	err = m.cas(rememberKey(selector), []byte(hash+"\nrotated\n"+uid), token, grace)
+	if err == ErrCASConflict {
+		return uid, nil
+	} else if err != nil {
+		return "", err
+	}
+	if err := m.RememberMe(w, r, uid); err != nil {
+		return "", err
+	}
+	return uid, nil
+
+}
+
+// ForgetMe revokes the remember-me token of r and clears its cookie on w;
+// call it when the user signs out
+func (m *Manager) ForgetMe(w http.ResponseWriter, r *http.Request) error {
+	expired := m.rememberCookie(r, "")
+	c, err := r.Cookie(expired.Name)
+	if err != nil {
+		return nil
+	}
+	http.SetCookie(w, expired)
+	selector, _, _ := strings.Cut(c.Value, ".")
+	if selector == "" {
+		return nil
+	}
+	if m.ReadOnly() || m.Degraded() {
+		return ErrReadOnly
+	}
+	return m.del(rememberKey(selector))
+}
@@ -0,0 +1,108 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRememberMe(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+
+	w := httptest.NewRecorder()
+	if err := m.RememberMe(w, httptest.NewRequest("POST", "/login", nil), "joe"); err != nil {
+		t.Fatal(err)
+	}
+	c := w.Result().Cookies()[0]
+	if c.Name != "gomemssn_test_gomemssn_remember" || !c.HttpOnly || c.MaxAge != 30*24*3600 {
+		t.Fatalf("unexpected cookie: %v", c)
+	}
+
+	auth := func(c *http.Cookie) (string, *http.Cookie, error) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(c)
+		uid, err := m.AuthenticateRemembered(w, r)
+		var nc *http.Cookie
+		if cs := w.Result().Cookies(); len(cs) > 0 {
+			nc = cs[0]
+		}
+		return uid, nc, err
+	}
+
+	uid, c2, err := auth(c)
+	if err != nil || uid != "joe" {
+		t.Fatalf("expected joe but got %q, %v", uid, err)
+	}
+	if c2 == nil || c2.Value == c.Value {
+		t.Fatalf("expected the token to be rotated, got %v", c2)
+	}
+	// a request racing the rotation still gets in, without another rotation
+	if uid, c3, err := auth(c); err != nil || uid != "joe" || c3 != nil {
+		t.Fatalf("expected the old token to work in the grace period, got %q, %v, %v", uid, c3, err)
+	}
+
+	// a wrong validator burns the token
+	forged := *c2
+	forged.Value = forged.Value[:len(forged.Value)-2] + "xx"
+	if _, _, err := auth(&forged); err != ErrRememberInvalid {
+		t.Fatalf("expected ErrRememberInvalid but got %v", err)
+	}
+	if _, _, err := auth(c2); err != ErrRememberInvalid {
+		t.Fatalf("expected the token to be revoked, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	m.RememberMe(w, httptest.NewRequest("POST", "/login", nil), "joe")
+	c = w.Result().Cookies()[0]
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/logout", nil)
+	r.AddCookie(c)
+	if err := m.ForgetMe(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if cs := w.Result().Cookies(); len(cs) != 1 || cs[0].MaxAge >= 0 {
+		t.Fatalf("expected the cookie to be cleared, got %v", cs)
+	}
+	if _, _, err := auth(c); err != ErrRememberInvalid {
+		t.Fatalf("expected ErrRememberInvalid after ForgetMe but got %v", err)
+	}
+
+}
+
+// tokens may last longer than the 30 days memcache takes in seconds
+func TestRememberMeLong(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now, m.stub.Now = clock.Now, clock.Now
+	m.RememberExpiration = 90 * 24 * time.Hour
+
+	w := httptest.NewRecorder()
+	if err := m.RememberMe(w, httptest.NewRequest("POST", "/login", nil), "joe"); err != nil {
+		t.Fatal(err)
+	}
+	c := w.Result().Cookies()[0]
+	if c.MaxAge != 90*24*3600 {
+		t.Fatalf("unexpected cookie: %v", c)
+	}
+	selector, _, _ := strings.Cut(c.Value, ".")
+	ttl, err := m.stub.TTL(m.storeKey(rememberKey(selector)))
+	if err != nil || ttl != m.RememberExpiration {
+		t.Fatalf("expected the token to be stored for 90 days, got %v, %v", ttl, err)
+	}
+	if exp := memcacheExpiration(ttl, clock.Now()); int64(exp) != clock.Now().Add(ttl).Unix() {
+		t.Fatalf("expected memcache to get a Unix time but got %d", exp)
+	}
+
+	clock.Advance(60 * 24 * time.Hour)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(c)
+	if uid, err := m.AuthenticateRemembered(httptest.NewRecorder(), r); err != nil || uid != "joe" {
+		t.Fatalf("expected joe after 60 days but got %q, %v", uid, err)
+	}
+
+}
@@ -0,0 +1,212 @@
+package gomemssn
+
+import (
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// With Manager.Replicas each session is kept on several of Manager.Servers,
+// so losing a memcache server doesn't log out the users whose sessions were
+// on it.  Writes go to all replicas (a conditional write to the one the
+// session was read from, then plain ones to the rest) and reads go to them
+// in order until one has the session.  A replica which was down while a
+// session was written serves the older version once it is back, until the
+// session is written again; that is the price of not needing all of them.
+
+// ServerSelector picks the n of servers key is kept on, most preferred first.
+// It must pick the same ones for the same key as long as servers doesn't
+// change, and should change as few keys as possible when it does.
+type ServerSelector func(key string, servers []string, n int) []string
+
+// RendezvousSelector is the default ServerSelector, it picks the servers with
+// the highest hash of server and key, so adding or removing a server only
+// moves the keys which go to or were on that server
+func RendezvousSelector(key string, servers []string, n int) []string {
+	type scored struct {
+		server string
+		score  uint64
+	}
+	all := make([]scored, len(servers))
+	for i, srv := range servers {
+		h := fnv.New64a()
+		h.Write([]byte(srv))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		all[i] = scored{srv, h.Sum64()}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].score > all[j].score })
+	ret := make([]string, 0, n)
+	for _, s := range all[:min(n, len(all))] {
+		ret = append(ret, s.server)
+	}
+	return ret
+}
+
+// replicaStore is the Store used with Manager.Replicas
+type replicaStore struct {
+	servers []string
+	stores  map[string]Store // by server
+	n       int              // how many servers each key is on
+	pick    ServerSelector
+}
+
+// replicaToken is the cas token of a replicaStore, the one of the server the
+// data came from
+type replicaToken struct {
+	server string
+	token  interface{}
+}
+
+// replicaStore returns the store for Replicas, made on first use
+func (m *Manager) replicaStore() Store {
+	m.replicasOnce.Do(func() {
+		if m.replicas != nil {
+			return
+		}
+		rs := &replicaStore{servers: m.Servers, stores: make(map[string]Store), n: m.Replicas, pick: m.ServerSelector}
+		for _, srv := range m.Servers {
+			rs.stores[srv] = MemcacheStore{Client: memcache.New(srv)}
+		}
+		m.replicas = rs
+	})
+	return m.replicas
+}
+
+func (rs *replicaStore) replicasOf(key string) []string {
+	pick := rs.pick
+	if pick == nil {
+		pick = RendezvousSelector
+	}
+	return pick(key, rs.servers, rs.n)
+}
+
+func (rs *replicaStore) Get(key string) ([]byte, error) {
+	data, _, err := rs.GetCAS(key)
+	return data, err
+}
+
+// GetCAS returns what the first replica which has key has, ErrNotFound if any
+// replica said it doesn't have it, or else the error of the first one
+func (rs *replicaStore) GetCAS(key string) ([]byte, interface{}, error) {
+	var firstErr error
+	missing := false
+	for _, srv := range rs.replicasOf(key) {
+		var data []byte
+		var token interface{}
+		var err error
+		if cs, ok := rs.stores[srv].(CASStore); ok {
+			data, token, err = cs.GetCAS(key)
+		} else {
+			data, err = rs.stores[srv].Get(key)
+		}
+		if err == nil {
+			return data, replicaToken{server: srv, token: token}, nil
+		} else if err == ErrNotFound {
+			missing = true
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if missing || firstErr == nil {
+		return nil, nil, ErrNotFound
+	}
+	return nil, nil, firstErr
+}
+
+// Set writes to all replicas, it succeeds if any of them was written
+func (rs *replicaStore) Set(key string, data []byte, ttl time.Duration) error {
+	return rs.setOthers("", key, data, ttl)
+}
+
+// setOthers sets key on its replicas other than skip, returns nil if there
+// are none or any of them was written, or else the first error
+func (rs *replicaStore) setOthers(skip, key string, data []byte, ttl time.Duration) error {
+	var firstErr error
+	wrote := false
+	for _, srv := range rs.replicasOf(key) {
+		if srv == skip {
+			continue
+		}
+		if err := rs.stores[srv].Set(key, data, ttl); err == nil {
+			wrote = true
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if wrote {
+		return nil
+	}
+	return firstErr
+}
+
+// CompareAndSwap does the conditional write on the replica key was read from
+// (for a nil token, the first one which answers) and copies the data to the
+// rest
+func (rs *replicaStore) CompareAndSwap(key string, data []byte, token interface{}, ttl time.Duration) error {
+
+	cas := func(srv string, token interface{}) error {
+		if cs, ok := rs.stores[srv].(CASStore); ok {
+			return cs.CompareAndSwap(key, data, token, ttl)
+		}
+		return rs.stores[srv].Set(key, data, ttl)
+	}
+
+	var err error
+	written := ""
+	if rt, ok := token.(replicaToken); ok {
+		if err = cas(rt.server, rt.token); err == nil {
+			written = rt.server
+		}
+	} else {
+		err = ErrNotFound
+		for _, srv := range rs.replicasOf(key) {
+			if err = cas(srv, nil); err == nil || err == ErrCASConflict {
+				written = srv
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	rs.setOthers(written, key, data, ttl)
+	return nil
+
+}
+
+// Delete deletes key from all replicas, and fails if any of them fails
+// (a replica which kept it would bring it back)
+func (rs *replicaStore) Delete(key string) error {
+	var firstErr error
+	for _, srv := range rs.replicasOf(key) {
+		if err := rs.stores[srv].Delete(key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Touch touches key on all replicas, it succeeds if any of them has it
+func (rs *replicaStore) Touch(key string, ttl time.Duration) error {
+	var firstErr error
+	touched := false
+	for _, srv := range rs.replicasOf(key) {
+		err := rs.stores[srv].Touch(key, ttl)
+		if err == nil {
+			touched = true
+		} else if err != ErrNotFound && firstErr == nil {
+			firstErr = err
+		}
+	}
+	switch {
+	case touched:
+		return nil
+	case firstErr != nil:
+		return firstErr
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,62 @@
+package gomemssn
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// deadStore fails everything, like a memcache server which is down
+type deadStore struct{}
+
+var errDead = errors.New("server is down")
+
+func (deadStore) Get(key string) ([]byte, error)                       { return nil, errDead }
+func (deadStore) Set(key string, data []byte, ttl time.Duration) error { return errDead }
+func (deadStore) Delete(key string) error                              { return errDead }
+func (deadStore) Touch(key string, ttl time.Duration) error            { return errDead }
+
+func TestReplicas(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.Servers = []string{"mc1", "mc2", "mc3"}
+	m.Replicas = 2
+	m.OnConflict = ConflictFail
+	rs := &replicaStore{servers: m.Servers, stores: map[string]Store{}, n: m.Replicas}
+	for _, srv := range m.Servers {
+		rs.stores[srv] = NewMemoryStore()
+	}
+	m.replicas = rs
+
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+
+	on := RendezvousSelector(m.storeKey(s.Key), m.Servers, 2)
+	if len(on) != 2 || on[0] == on[1] {
+		t.Fatalf("expected 2 different servers but got %v", on)
+	}
+	for _, srv := range on {
+		if _, err := rs.stores[srv].Get(m.storeKey(s.Key)); err != nil {
+			t.Fatalf("session not on %s: %v", srv, err)
+		}
+	}
+
+	// the first one goes away, the session is still there and can be written
+	rs.stores[on[0]] = deadStore{}
+	s2 := loadTestSession(t, m, s.Key)
+	if s2.Values["v"] != "abc123" {
+		t.Fatalf("expected the session from the second replica, got %v", s2.Values)
+	}
+	s2.Values["v"] = "changed"
+	m.MustWriteSession(nil, s2)
+	if s3 := loadTestSession(t, m, s.Key); s3.Values["v"] != "changed" {
+		t.Fatalf("expected the change to be kept, got %v", s3.Values)
+	}
+
+	// deleting fails while a replica can't be reached
+	if err := rs.Delete(m.storeKey(s.Key)); err == nil {
+		t.Fatal("expected an error deleting with a server down")
+	}
+
+}
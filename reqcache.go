@@ -0,0 +1,64 @@
+package gomemssn
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// A handler chain may call Session more than once for a request (some
+// middleware, then the handler).  In a request carrying a session cache (see
+// WithSessionCache, which Middleware and RequireSession add) only the first
+// call loads the session and sets its cookie, later ones return the same
+// *Session.
+
+type sessionCacheKey struct{}
+
+// sessionCache holds the sessions of a request, by Manager
+type sessionCache struct {
+	mu       sync.Mutex
+	sessions map[*http.Cookie]*Session // keyed by TemplateCookie, which is a Manager's own (see ForPath) but shared with its withContext copies
+}
+
+// WithSessionCache returns r with a session cache, so repeated calls to
+// Session (of any Manager) with it or requests derived from it return the
+// same session; r itself if it has one already
+func WithSessionCache(r *http.Request) *http.Request {
+	if sessionCacheOf(r) != nil {
+		return r
+	}
+	c := &sessionCache{sessions: make(map[*http.Cookie]*Session)}
+	return r.WithContext(context.WithValue(r.Context(), sessionCacheKey{}, c))
+}
+
+func sessionCacheOf(r *http.Request) *sessionCache {
+	c, _ := r.Context().Value(sessionCacheKey{}).(*sessionCache)
+	return c
+}
+
+// cachedSession returns the session r's cache has for m, nil if none
+func (m *Manager) cachedSession(r *http.Request) *Session {
+	c := sessionCacheOf(r)
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessions[m.TemplateCookie]
+}
+
+// cacheSession puts s in r's cache for m (if r has one), or takes it out
+// for a nil s
+func (m *Manager) cacheSession(r *http.Request, s *Session) {
+	c := sessionCacheOf(r)
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s == nil {
+		delete(c.sessions, m.TemplateCookie)
+	} else {
+		c.sessions[m.TemplateCookie] = s
+	}
+}
@@ -0,0 +1,44 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionCache(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := m.MustSession(w, r)
+		if s != FromContext(r.Context()) {
+			t.Errorf("expected the handler to get the session Middleware loaded")
+		}
+		s.Values["v"] = "abc123"
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if n := len(w.Result().Header.Values("Set-Cookie")); n != 1 {
+		t.Fatalf("expected one Set-Cookie but got %d", n)
+	}
+
+	// without a cache every call loads
+	r := httptest.NewRequest("GET", "/", nil)
+	if m.MustSession(httptest.NewRecorder(), r) == m.MustSession(httptest.NewRecorder(), r) {
+		t.Fatalf("expected separate sessions without a cache")
+	}
+
+	r = WithSessionCache(r)
+	s := m.MustSession(httptest.NewRecorder(), r)
+	if m.MustSession(httptest.NewRecorder(), r) != s {
+		t.Fatalf("expected the cached session")
+	}
+	if m.ForPath("/admin").MustSession(httptest.NewRecorder(), r) == s {
+		t.Fatalf("expected a Manager for another path to have its own session")
+	}
+	m.DestroySession(httptest.NewRecorder(), s)
+	if m.MustSession(httptest.NewRecorder(), r) == s {
+		t.Fatalf("expected a new session after DestroySession")
+	}
+
+}
@@ -0,0 +1,50 @@
+package gomemssn
+
+import (
+	"errors"
+	"strconv"
+)
+
+// A revoked session key is deleted and also recorded as revoked for
+// Expiration, the longest a copy of the session can live elsewhere: in the
+// local cache of another instance (see LocalCacheTTL), on a replica which
+// missed the delete (see Replicas), in a backend restored from a snapshot.
+// A request for a session which isn't found always looks the record up, so
+// a revoked key never gets its JWT accepted (see JWTOnMiss) or is reused.
+// With CheckRevoked, every request's session read looks the record up first,
+// which costs a round trip to the backing store.
+
+// errRevoked is what load returns for a revoked session key
+var errRevoked = errors.New("gomemssn: session key was revoked")
+
+func revokedKey(key string) string {
+	return "revoked:" + key
+}
+
+// Revoke kills the session key at once, for a session ID known to have
+// leaked: it is deleted and refused from then on, with CheckRevoked even
+// where a copy of it is still around
+func (m *Manager) Revoke(key string) error {
+	if m.ReadOnly() || m.Degraded() {
+		return ErrReadOnly
+	}
+	at := strconv.FormatInt(m.now().Unix(), 10)
+	if err := m.set(revokedKey(key), []byte(at), m.maxExpiration()); err != nil {
+		return err
+	}
+	m.cacheDel(key)
+	if err := m.delSession(key); err != nil {
+		return err
+	}
+	m.audit(nil, AuditDestroy, &Session{Key: key}, "revoked")
+	return nil
+}
+
+// revoked reports whether key was passed to Revoke
+func (m *Manager) revoked(key string) (bool, error) {
+	_, err := m.store().Get(m.storeKey(revokedKey(key)))
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,75 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRevoke(t *testing.T) {
+
+	st := NewMemoryStore()
+	newManager := func() *Manager {
+		m := NewManager(nil, "gomemssn_test")
+		m.Store = st
+		m.LocalCacheTTL = time.Hour
+		m.LocalCacheAll = true
+		m.CheckRevoked = true
+		return m
+	}
+	m1, m2 := newManager(), newManager()
+
+	s := loadTestSession(t, m1, "")
+	s.Values["user"] = "joe"
+	m1.MustWriteSession(nil, s)
+	// another instance has it in its local cache
+	if s2 := loadTestSession(t, m2, s.Key); s2.Values["user"] != "joe" {
+		t.Fatalf("session not read: %v", s2.Values)
+	}
+
+	if err := m1.Revoke(s.Key); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []*Manager{m1, m2} {
+		s2 := loadTestSession(t, m, s.Key)
+		if s2.Key == s.Key || len(s2.Values) != 0 {
+			t.Fatalf("expected a new session in place of the revoked one, got %q %v", s2.Key, s2.Values)
+		}
+	}
+	if _, err := m2.GetSessionByKey(s.Key); err != ErrNotFound {
+		t.Fatalf("expected the revoked session to be deleted, got %v", err)
+	}
+
+}
+
+func TestRevokeJWT(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.JWTKey = []byte("0123456789abcdef")
+	m.JWTOnMiss = true
+
+	w := httptest.NewRecorder()
+	s := loadTestSession(t, m, "")
+	s.SetUserID("joe")
+	m.MustWriteSession(w, s)
+	if err := m.Revoke(s.Key); err != nil {
+		t.Fatal(err)
+	}
+
+	// without CheckRevoked the session is just missing, but the JWT still
+	// must not sign the user back in
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	s2, err := m.Session(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2.FromJWT() || s2.UserID() != "" || s2.Key == s.Key {
+		t.Fatalf("expected a new session in place of the revoked one, got %q %+v", s2.Key, s2.Meta)
+	}
+
+}
@@ -0,0 +1,47 @@
+package gomemssn
+
+// Values is a plain map and not safe for concurrent use.  Handlers which
+// hand the session to goroutines use these accessors instead, which may be
+// called from any number of goroutines at once; everything else (Values
+// itself, WriteSession...) still has to wait until those goroutines are done.
+
+// Get returns the value under key, and whether there is one
+func (s *Session) Get(key string) (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.Values[key]
+	return v, ok
+}
+
+// Set puts val under key
+func (s *Session) Set(key string, val interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Values == nil {
+		s.Values = make(Values)
+	}
+	s.Values[key] = val
+}
+
+// Delete removes key
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Values, key)
+}
+
+// Range calls f for each value until it returns false.  It goes over a copy,
+// so f may call Set and Delete and doesn't see their changes.
+func (s *Session) Range(f func(key string, val interface{}) bool) {
+	s.mu.RLock()
+	vals := make(Values, len(s.Values))
+	for k, v := range s.Values {
+		vals[k] = v
+	}
+	s.mu.RUnlock()
+	for k, v := range vals {
+		if !f(k, v) {
+			return
+		}
+	}
+}
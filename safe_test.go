@@ -0,0 +1,46 @@
+package gomemssn
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSessionAccessors(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	s := loadTestSession(t, m, "")
+	s.Values["keep"] = "x"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			k := strconv.Itoa(i)
+			s.Set(k, i)
+			if v, ok := s.Get(k); !ok || v != i {
+				t.Errorf("expected %d but got %v", i, v)
+			}
+			s.Range(func(key string, val interface{}) bool { return true })
+			if i%2 == 0 {
+				s.Delete(k)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	n := 0
+	s.Range(func(key string, val interface{}) bool {
+		n++
+		return true
+	})
+	if n != 6 {
+		t.Fatalf("expected 6 values but got %d: %v", n, s.Values)
+	}
+	m.MustWriteSession(nil, s)
+	if s2 := loadTestSession(t, m, s.Key); len(s2.Values) != 6 {
+		t.Fatalf("values set with Set not written: %v", s2.Values)
+	}
+
+}
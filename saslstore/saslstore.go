@@ -0,0 +1,330 @@
+// Package saslstore is a gomemssn.Store for memcache servers which require
+// SASL authentication (Memcachier, ElastiCache and others with auth turned
+// on), which gomemcache can't do.  It speaks memcache's binary protocol and
+// authenticates each connection with SASL PLAIN:
+//
+//	m := gomemssn.NewManager(nil, "myapp")
+//	m.Store = saslstore.New([]string{"mc1.example.com:11211"}, "user", "secret")
+//
+// PLAIN sends the password as is, use Dial to connect with TLS where the
+// network can't be trusted.
+package saslstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn"
+)
+
+// binary protocol opcodes
+const (
+	opGet      = 0x00
+	opSet      = 0x01
+	opAdd      = 0x02
+	opDelete   = 0x04
+	opTouch    = 0x1c
+	opSASLAuth = 0x21
+)
+
+// binary protocol response statuses
+const (
+	statusOK        = 0x00
+	statusNotFound  = 0x01
+	statusExists    = 0x02
+	statusNotStored = 0x05
+)
+
+const headerLen = 24
+
+// Store implements gomemssn.CASStore, the cas token is the item's cas value
+type Store struct {
+	Servers      []string                                     // memcache servers, keys are spread over them by hash
+	Username     string                                       // SASL user, "" means don't authenticate
+	Password     string                                       // SASL password
+	Dial         func(network, addr string) (net.Conn, error) // if set, used to connect instead of net.Dial (e.g. a tls.Dialer's Dial)
+	Timeout      time.Duration                                // how long connecting and each call may take, 0 means a second
+	MaxIdleConns int                                          // idle connections kept per server, 0 means 2
+	mu           sync.Mutex
+	idle         map[string][]*conn
+}
+
+// New returns a Store for servers, authenticating as username
+func New(servers []string, username, password string) *Store {
+	return &Store{Servers: servers, Username: username, Password: password}
+}
+
+type conn struct {
+	nc net.Conn
+	rw *bufio.ReadWriter
+}
+
+type response struct {
+	status uint16
+	extras []byte
+	value  []byte
+	cas    uint64
+}
+
+// ServerError is a response status the Store doesn't handle itself
+type ServerError struct {
+	Status  uint16
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("saslstore: memcache status 0x%02x: %s", e.Status, e.Message)
+}
+
+func (s *Store) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return time.Second
+}
+
+// server returns the server key is kept on
+func (s *Store) server(key string) (string, error) {
+	switch len(s.Servers) {
+	case 0:
+		return "", errors.New("saslstore: no servers")
+	case 1:
+		return s.Servers[0], nil
+	}
+	return s.Servers[crc32.ChecksumIEEE([]byte(key))%uint32(len(s.Servers))], nil
+}
+
+// getConn returns an idle connection to addr, or a new authenticated one
+func (s *Store) getConn(addr string) (*conn, error) {
+
+	s.mu.Lock()
+	if cs := s.idle[addr]; len(cs) > 0 {
+		c := cs[len(cs)-1]
+		s.idle[addr] = cs[:len(cs)-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+
+	var nc net.Conn
+	var err error
+	if s.Dial != nil {
+		nc, err = s.Dial("tcp", addr)
+	} else {
+		nc, err = net.DialTimeout("tcp", addr, s.timeout())
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{nc: nc, rw: bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc))}
+
+	if s.Username != "" {
+		nc.SetDeadline(time.Now().Add(s.timeout()))
+		auth := []byte("\x00" + s.Username + "\x00" + s.Password)
+		res, err := c.roundTrip(opSASLAuth, "PLAIN", nil, auth, 0)
+		if err == nil && res.status != statusOK {
+			err = fmt.Errorf("saslstore: authentication failed: %w", &ServerError{res.status, string(res.value)})
+		}
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+
+}
+
+func (s *Store) putConn(addr string, c *conn) {
+	n := s.MaxIdleConns
+	if n <= 0 {
+		n = 2
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.idle[addr]) >= n {
+		c.nc.Close()
+		return
+	}
+	if s.idle == nil {
+		s.idle = make(map[string][]*conn)
+	}
+	s.idle[addr] = append(s.idle[addr], c)
+}
+
+// do sends a request for key to its server and returns the response
+func (s *Store) do(op byte, key string, extras, value []byte, cas uint64) (*response, error) {
+	addr, err := s.server(key)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.getConn(addr)
+	if err != nil {
+		return nil, err
+	}
+	c.nc.SetDeadline(time.Now().Add(s.timeout()))
+	res, err := c.roundTrip(op, key, extras, value, cas)
+	if err != nil {
+		// the connection is in an unknown state
+		c.nc.Close()
+		return nil, err
+	}
+	s.putConn(addr, c)
+	return res, nil
+}
+
+func (c *conn) roundTrip(op byte, key string, extras, value []byte, cas uint64) (*response, error) {
+
+	h := make([]byte, headerLen)
+	h[0] = 0x80
+	h[1] = op
+	binary.BigEndian.PutUint16(h[2:], uint16(len(key)))
+	h[4] = byte(len(extras))
+	binary.BigEndian.PutUint32(h[8:], uint32(len(extras)+len(key)+len(value)))
+	binary.BigEndian.PutUint64(h[16:], cas)
+	c.rw.Write(h)
+	c.rw.Write(extras)
+	c.rw.WriteString(key)
+	c.rw.Write(value)
+	if err := c.rw.Flush(); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(c.rw, h); err != nil {
+		return nil, err
+	}
+	if h[0] != 0x81 || h[1] != op {
+		return nil, fmt.Errorf("saslstore: unexpected response header % x", h)
+	}
+	keyLen := int(binary.BigEndian.Uint16(h[2:]))
+	extrasLen := int(h[4])
+	body := make([]byte, binary.BigEndian.Uint32(h[8:]))
+	if _, err := io.ReadFull(c.rw, body); err != nil {
+		return nil, err
+	}
+	if extrasLen+keyLen > len(body) {
+		return nil, fmt.Errorf("saslstore: bad response lengths")
+	}
+	return &response{
+		status: binary.BigEndian.Uint16(h[6:]),
+		extras: body[:extrasLen],
+		value:  body[extrasLen+keyLen:],
+		cas:    binary.BigEndian.Uint64(h[16:]),
+	}, nil
+
+}
+
+// expiration returns ttl as memcache wants it, in seconds, or as a Unix time
+// past 30 days which memcache reads any longer expiration as
+func expiration(ttl time.Duration) uint32 {
+	if ttl > 30*24*time.Hour {
+		return uint32(time.Now().Add(ttl).Unix())
+	}
+	return uint32(ttl / time.Second)
+}
+
+// storeExtras are the flags (always 0) and expiration of a set or add
+func storeExtras(ttl time.Duration) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b[4:], expiration(ttl))
+	return b
+}
+
+func unexpected(res *response) error {
+	return &ServerError{Status: res.status, Message: string(res.value)}
+}
+
+func (s *Store) Get(key string) ([]byte, error) {
+	data, _, err := s.GetCAS(key)
+	return data, err
+}
+
+func (s *Store) GetCAS(key string) ([]byte, interface{}, error) {
+	res, err := s.do(opGet, key, nil, nil, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch res.status {
+	case statusOK:
+		return res.value, res.cas, nil
+	case statusNotFound:
+		return nil, nil, gomemssn.ErrNotFound
+	}
+	return nil, nil, unexpected(res)
+}
+
+func (s *Store) Set(key string, data []byte, ttl time.Duration) error {
+	res, err := s.do(opSet, key, storeExtras(ttl), data, 0)
+	if err != nil {
+		return err
+	}
+	if res.status != statusOK {
+		return unexpected(res)
+	}
+	return nil
+}
+
+func (s *Store) CompareAndSwap(key string, data []byte, token interface{}, ttl time.Duration) error {
+	op, cas := byte(opAdd), uint64(0)
+	if v, ok := token.(uint64); ok {
+		op, cas = opSet, v
+	}
+	res, err := s.do(op, key, storeExtras(ttl), data, cas)
+	if err != nil {
+		return err
+	}
+	switch res.status {
+	case statusOK:
+		return nil
+	case statusNotFound, statusExists, statusNotStored:
+		return gomemssn.ErrCASConflict
+	}
+	return unexpected(res)
+}
+
+func (s *Store) Delete(key string) error {
+	res, err := s.do(opDelete, key, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	if res.status != statusOK && res.status != statusNotFound {
+		return unexpected(res)
+	}
+	return nil
+}
+
+func (s *Store) Touch(key string, ttl time.Duration) error {
+	extras := make([]byte, 4)
+	binary.BigEndian.PutUint32(extras, expiration(ttl))
+	res, err := s.do(opTouch, key, extras, nil, 0)
+	if err != nil {
+		return err
+	}
+	switch res.status {
+	case statusOK:
+		return nil
+	case statusNotFound:
+		return gomemssn.ErrNotFound
+	}
+	return unexpected(res)
+}
+
+// Close closes the idle connections
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, cs := range s.idle {
+		for _, c := range cs {
+			c.nc.Close()
+		}
+	}
+	s.idle = nil
+	return nil
+}
@@ -0,0 +1,183 @@
+package saslstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn"
+	"github.com/bradleypeabody/gomemssn/storetest"
+)
+
+// fakeServer is a memcache speaking enough of the binary protocol for Store,
+// which wants SASL PLAIN with user/secret before anything else
+func fakeServer(t *testing.T) string {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	type item struct {
+		value []byte
+		cas   uint64
+	}
+	var mu sync.Mutex
+	items := make(map[string]*item)
+	var lastCAS uint64
+
+	serve := func(c net.Conn) {
+		defer c.Close()
+		br := bufio.NewReader(c)
+		authed := false
+		for {
+			h := make([]byte, headerLen)
+			if _, err := io.ReadFull(br, h); err != nil {
+				return
+			}
+			op := h[1]
+			keyLen := int(binary.BigEndian.Uint16(h[2:]))
+			extrasLen := int(h[4])
+			body := make([]byte, binary.BigEndian.Uint32(h[8:]))
+			if _, err := io.ReadFull(br, body); err != nil {
+				return
+			}
+			key := string(body[extrasLen : extrasLen+keyLen])
+			value := body[extrasLen+keyLen:]
+			cas := binary.BigEndian.Uint64(h[16:])
+
+			var status uint16
+			var resValue []byte
+			var resCAS uint64
+			mu.Lock()
+			it := items[key]
+			switch {
+			case op == opSASLAuth:
+				if key == "PLAIN" && string(value) == "\x00user\x00secret" {
+					authed = true
+				} else {
+					status, resValue = 0x20, []byte("Auth failure")
+				}
+			case !authed:
+				status, resValue = 0x20, []byte("Auth required")
+			case op == opGet && it == nil, op == opTouch && it == nil:
+				status = statusNotFound
+			case op == opGet:
+				resValue, resCAS = it.value, it.cas
+			case op == opAdd && it != nil:
+				status = statusExists
+			case op == opSet && cas != 0 && it == nil:
+				status = statusNotFound
+			case op == opSet && cas != 0 && it.cas != cas:
+				status = statusExists
+			case op == opSet, op == opAdd:
+				lastCAS++
+				items[key] = &item{value: append([]byte(nil), value...), cas: lastCAS}
+				resCAS = lastCAS
+			case op == opDelete && it == nil:
+				status = statusNotFound
+			case op == opDelete:
+				delete(items, key)
+			}
+			mu.Unlock()
+
+			res := make([]byte, headerLen+len(resValue))
+			res[0], res[1] = 0x81, op
+			binary.BigEndian.PutUint16(res[6:], status)
+			binary.BigEndian.PutUint32(res[8:], uint32(len(resValue)))
+			binary.BigEndian.PutUint64(res[16:], resCAS)
+			copy(res[headerLen:], resValue)
+			if _, err := c.Write(res); err != nil {
+				return
+			}
+		}
+	}
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(c)
+		}
+	}()
+
+	return ln.Addr().String()
+
+}
+
+func TestStore(t *testing.T) {
+
+	addr := fakeServer(t)
+
+	bad := New([]string{addr}, "user", "wrong")
+	if _, err := bad.Get("k"); err == nil {
+		t.Fatal("expected an error with the wrong password")
+	}
+
+	st := New([]string{addr}, "user", "secret")
+	defer st.Close()
+	m := gomemssn.NewManager(nil, "gomemssn_test")
+	m.Store = st
+	m.OnConflict = gomemssn.ConflictFail
+
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(w, s)
+
+	load := func() *gomemssn.Session {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+		return m.MustSession(httptest.NewRecorder(), r)
+	}
+
+	s1, s2 := load(), load()
+	if s1.Values["v"] != "abc123" {
+		t.Fatalf("unexpected values: %v", s1.Values)
+	}
+	s1.Values["v"] = "one"
+	m.MustWriteSession(nil, s1)
+	s2.Values["v"] = "two"
+	if err := m.WriteSession(nil, s2); err == nil {
+		t.Fatal("expected a conflict")
+	}
+
+	if err := st.Touch(m.StoreKey(s.Key), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DestroySession(nil, load()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Get(m.StoreKey(s.Key)); err != gomemssn.ErrNotFound {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+	if err := st.Touch(m.StoreKey(s.Key), 0); err != gomemssn.ErrNotFound {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+
+}
+
+func TestConformance(t *testing.T) {
+	st := New([]string{fakeServer(t)}, "user", "secret")
+	defer st.Close()
+	storetest.TestStore(t, st)
+}
+
+func TestExpiration(t *testing.T) {
+	if got := expiration(time.Hour); got != 3600 {
+		t.Errorf("expected 3600 but got %d", got)
+	}
+	want := time.Now().Add(90 * 24 * time.Hour).Unix()
+	if got := int64(expiration(90 * 24 * time.Hour)); got < want-1 || got > want+1 {
+		t.Errorf("expected about %d but got %d", want, got)
+	}
+}
@@ -0,0 +1,29 @@
+package gomemssn
+
+import (
+	"fmt"
+)
+
+// Sessions are stored with the Manager's SchemaVersion, and ones stored with
+// an older version are upgraded when read by running the Migrations from
+// their version up, so a deploy which renames keys or changes their types
+// doesn't have to drop or special-case the sessions already out there.  The
+// upgraded session is saved with its next write.  Heavy keys are not loaded
+// at that point and can't be migrated this way.
+
+// Migration upgrades session values from SchemaVersion n to n+1 (it is
+// Manager.Migrations[n]), in place
+type Migration func(v Values) error
+
+// migrate brings rec up to SchemaVersion
+func (m *Manager) migrate(rec *record) error {
+	for rec.Meta.SchemaVersion < m.SchemaVersion {
+		if f := m.Migrations[rec.Meta.SchemaVersion]; f != nil {
+			if err := f(rec.Values); err != nil {
+				return fmt.Errorf("gomemssn: migrating session from schema version %d: %w", rec.Meta.SchemaVersion, err)
+			}
+		}
+		rec.Meta.SchemaVersion++
+	}
+	return nil
+}
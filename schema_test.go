@@ -0,0 +1,50 @@
+package gomemssn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	s := loadTestSession(t, m, "")
+	s.Values["name"] = "joe"
+	s.Values["count"] = "3"
+	m.MustWriteSession(nil, s)
+
+	// a later deploy renames name and makes count an int
+	m.SchemaVersion = 2
+	m.Migrations = map[int]Migration{
+		0: func(v Values) error {
+			v["username"] = v["name"]
+			delete(v, "name")
+			return nil
+		},
+		1: func(v Values) error {
+			if v["count"] == "3" {
+				v["count"] = 3
+			}
+			return nil
+		},
+	}
+	s = loadTestSession(t, m, s.Key)
+	if s.Values["username"] != "joe" || s.Values["name"] != nil || s.Values["count"] != 3 || s.Meta.SchemaVersion != 2 {
+		t.Fatalf("session not migrated: %v %d", s.Values, s.Meta.SchemaVersion)
+	}
+
+	// new sessions start at the current version, so aren't migrated
+	s2 := loadTestSession(t, m, "")
+	s2.Values["name"] = "ann"
+	m.MustWriteSession(nil, s2)
+	if s2 = loadTestSession(t, m, s2.Key); s2.Values["name"] != "ann" {
+		t.Fatalf("new session was migrated: %v", s2.Values)
+	}
+
+	m.SchemaVersion = 3
+	m.Migrations[2] = func(v Values) error { return errors.New("nope") }
+	if _, err := m.GetSessionByKey(s.Key); err == nil {
+		t.Fatalf("expected the migration error")
+	}
+
+}
@@ -0,0 +1,36 @@
+package gomemssn
+
+import (
+	"strings"
+)
+
+// ForPath returns a Manager for a route group (e.g. "/admin") whose cookie
+// has Path=path and its own name, so that area's session is never sent
+// with requests outside it and can't be mixed up with the site wide one.
+// It shares m's backend, read-only state and caches; its settings start as
+// a copy of m's and can be changed independently.
+func (m *Manager) ForPath(path string) *Manager {
+
+	m2 := *m
+
+	c := *m.TemplateCookie
+	c.Path = path
+	c.Name = m.TemplateCookie.Name + cookieNameSuffix(path)
+	m2.TemplateCookie = &c
+
+	m2.HeavyKeys = append([]string(nil), m.HeavyKeys...)
+	m2.TrustedProxies = append(m2.TrustedProxies[:0:0], m.TrustedProxies...)
+
+	return &m2
+
+}
+
+// turns a path into something usable in a cookie name: "/admin/x" -> "_admin_x"
+func cookieNameSuffix(path string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.TrimRight(path, "/"))
+}
@@ -0,0 +1,42 @@
+package gomemssn
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForPath(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	admin := m.ForPath("/admin")
+	admin.Expiration = m.Expiration / 2
+
+	if admin.TemplateCookie.Path != "/admin" || admin.TemplateCookie.Name != "gomemssn_test_gomemssn_admin" {
+		t.Fatalf("unexpected cookie: %#v", admin.TemplateCookie)
+	}
+	if m.TemplateCookie.Path != "/" || m.Expiration == admin.Expiration {
+		t.Fatalf("the original manager should not change")
+	}
+
+	w := httptest.NewRecorder()
+	s, err := admin.Session(w, httptest.NewRequest("GET", "/admin/users", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.WriteSession(w, s); err != nil {
+		t.Fatal(err)
+	}
+	if c := w.Result().Cookies()[0]; c.Path != "/admin" {
+		t.Fatalf("expected cookie path /admin but got: %v", c.Path)
+	}
+
+	// the backend is shared
+	if _, _, err := m.get(s.Key); err != nil {
+		t.Fatalf("expected derived manager to share the backend but got: %v", err)
+	}
+	admin.SetReadOnly(true)
+	if !m.ReadOnly() {
+		t.Fatalf("expected read-only to be shared")
+	}
+
+}
@@ -0,0 +1,56 @@
+package gomemssn
+
+// Clear removes all the values of the session except those under keep, for
+// starting over at login or logout without losing the locale, the CSRF token
+// (CSRFKey) and such.  Internal entries (flashes, namespaces, the return
+// URL...) go too unless kept; heavy values (see Manager.HeavyKeys) are
+// removed from the backing store with the next write even if they weren't
+// loaded.  Not safe for concurrent use, like Values.
+func (s *Session) Clear(keep ...string) {
+
+	kept := make(map[string]bool, len(keep))
+	for _, k := range keep {
+		kept[k] = true
+	}
+
+	ttls, _ := s.Values[valueTTLKey].(map[string]interface{})
+	for k := range s.Values {
+		if !kept[k] {
+			delete(s.Values, k)
+		}
+	}
+	if len(ttls) > 0 {
+		// the expiries of the values which are left
+		left := make(map[string]interface{})
+		for k, exp := range ttls {
+			if _, ok := s.Values[k]; ok {
+				left[k] = exp
+			}
+		}
+		if len(left) > 0 {
+			s.Values[valueTTLKey] = left
+		}
+	}
+
+	if s.m == nil {
+		return
+	}
+	for _, name := range s.m.HeavyKeys {
+		if _, ok := s.buckets[name]; !ok && !kept[name] {
+			// not read, but there may be one in the store to remove
+			if s.buckets == nil {
+				s.buckets = make(map[string][]byte)
+			}
+			s.buckets[name] = []byte{}
+			s.modified = true
+		}
+	}
+
+}
+
+// scrubOnLogin clears s as ScrubOnLogin says, see MarkAuthenticated
+func (m *Manager) scrubOnLogin(s *Session) {
+	if m.ScrubOnLogin != nil {
+		s.Clear(m.ScrubOnLogin...)
+	}
+}
@@ -0,0 +1,47 @@
+package gomemssn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClear(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.HeavyKeys = []string{"cart"}
+
+	s := loadTestSession(t, m, "")
+	s.Values["locale"] = "fr"
+	s.Values["basket"] = 3.0
+	s.Values["cart"] = "big"
+	s.SetWithTTL("otp", "123456", time.Minute)
+	s.SetWithTTL("locale", "fr", time.Hour)
+	s.AddFlash("info", "hi")
+	token, err := s.CSRFToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.MustWriteSession(nil, s)
+
+	// the heavy value isn't loaded, it goes all the same
+	s2 := loadTestSession(t, m, s.Key)
+	s2.Clear("locale", CSRFKey)
+	if len(s2.Values) != 3 || s2.Values["locale"] != "fr" || s2.Values[CSRFKey] != token {
+		t.Fatalf("unexpected values left: %v", s2.Values)
+	}
+	if _, ok := s2.ValueTTL("locale"); !ok {
+		t.Fatalf("expected the expiry of the kept value to stay")
+	}
+	m.MustWriteSession(nil, s2)
+	if _, _, err := m.get(bucketKey(s.Key, "cart")); err != ErrNotFound {
+		t.Fatalf("expected the heavy value to be removed, got %v", err)
+	}
+
+	m.ScrubOnLogin = []string{"locale"}
+	s3 := loadTestSession(t, m, s.Key)
+	s3.MarkAuthenticated("joe")
+	if len(s3.Values) != 2 || s3.Values["locale"] != "fr" || s3.UserID() != "joe" {
+		t.Fatalf("unexpected values after login: %v", s3.Values)
+	}
+
+}
@@ -0,0 +1,137 @@
+package gomemssn
+
+import (
+	"time"
+)
+
+// ShadowStore is a Store for moving sessions to another backend (memcache
+// to Redis, say) or key prefix without logging anyone out:
+//
+//	m.Store = &gomemssn.ShadowStore{Old: m.Store, New: redisstore.New(rdb), Fallback: true}
+//
+// Writes go to both stores (a conditional write to the one the session was
+// read from, then a plain one to the other) and reads go to Old, or to New
+// with ReadNew.  Sessions move over as they are written; with Fallback a
+// read which misses goes to the other store too, so sessions which weren't
+// written since are still found.  A migration runs in phases: shadow writes
+// for a while (at least Expiration, for the sessions which are only read),
+// then ReadNew, then New alone.  Failed writes to the store which is not
+// read from don't fail the request, they go to OnShadowError.
+type ShadowStore struct {
+	Old           Store                           // where sessions are now
+	New           Store                           // where they are moving to, can be Old with NewKey
+	NewKey        func(key string) string         // if set, maps keys for New, e.g. to a new prefix
+	ReadNew       bool                            // read from New rather than Old
+	Fallback      bool                            // reads which miss in the store read from try the other one
+	OnShadowError func(op, key string, err error) // called when a write to the store which is not read from fails, nil means ignore it
+}
+
+// shadowToken is the cas token of a ShadowStore, that of the store the data
+// came from
+type shadowToken struct {
+	fromNew bool
+	token   interface{}
+}
+
+// side returns the New or Old store and the key for it
+func (ss *ShadowStore) side(isNew bool, key string) (Store, string) {
+	if !isNew {
+		return ss.Old, key
+	}
+	if ss.NewKey != nil {
+		key = ss.NewKey(key)
+	}
+	return ss.New, key
+}
+
+func (ss *ShadowStore) shadowError(op, key string, err error) {
+	if err != nil && ss.OnShadowError != nil {
+		ss.OnShadowError(op, key, err)
+	}
+}
+
+func getCAS(st Store, key string) ([]byte, interface{}, error) {
+	if cs, ok := st.(CASStore); ok {
+		return cs.GetCAS(key)
+	}
+	data, err := st.Get(key)
+	return data, nil, err
+}
+
+func (ss *ShadowStore) Get(key string) ([]byte, error) {
+	data, _, err := ss.GetCAS(key)
+	return data, err
+}
+
+func (ss *ShadowStore) GetCAS(key string) ([]byte, interface{}, error) {
+	st, k := ss.side(ss.ReadNew, key)
+	data, token, err := getCAS(st, k)
+	if err == ErrNotFound && ss.Fallback {
+		st, k = ss.side(!ss.ReadNew, key)
+		data, token, err = getCAS(st, k)
+		return data, &shadowToken{fromNew: !ss.ReadNew, token: token}, err
+	}
+	return data, &shadowToken{fromNew: ss.ReadNew, token: token}, err
+}
+
+func (ss *ShadowStore) Set(key string, data []byte, ttl time.Duration) error {
+	st, k := ss.side(ss.ReadNew, key)
+	if err := st.Set(k, data, ttl); err != nil {
+		return err
+	}
+	st, k = ss.side(!ss.ReadNew, key)
+	ss.shadowError("Set", k, st.Set(k, data, ttl))
+	return nil
+}
+
+// CompareAndSwap writes conditionally to the store read from: against the
+// token if the data came from it, as a new entry if it came from the other
+// one (it wasn't there) or token is nil.  The other store gets a plain Set.
+func (ss *ShadowStore) CompareAndSwap(key string, data []byte, token interface{}, ttl time.Duration) error {
+	var tok interface{}
+	if t, ok := token.(*shadowToken); ok && t.fromNew == ss.ReadNew {
+		tok = t.token
+	}
+	st, k := ss.side(ss.ReadNew, key)
+	var err error
+	if cs, ok := st.(CASStore); ok {
+		err = cs.CompareAndSwap(k, data, tok, ttl)
+	} else {
+		err = st.Set(k, data, ttl)
+	}
+	if err != nil {
+		return err
+	}
+	st, k = ss.side(!ss.ReadNew, key)
+	ss.shadowError("Set", k, st.Set(k, data, ttl))
+	return nil
+}
+
+func (ss *ShadowStore) Delete(key string) error {
+	st, k := ss.side(ss.ReadNew, key)
+	if err := st.Delete(k); err != nil {
+		return err
+	}
+	st, k = ss.side(!ss.ReadNew, key)
+	ss.shadowError("Delete", k, st.Delete(k))
+	return nil
+}
+
+// Touch touches both stores, a miss in the one read from is only made up
+// for by the other one with Fallback
+func (ss *ShadowStore) Touch(key string, ttl time.Duration) error {
+	st, k := ss.side(ss.ReadNew, key)
+	err := st.Touch(k, ttl)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	st, k = ss.side(!ss.ReadNew, key)
+	err2 := st.Touch(k, ttl)
+	if err2 != ErrNotFound {
+		ss.shadowError("Touch", k, err2)
+	}
+	if err == ErrNotFound && ss.Fallback && err2 == nil {
+		return nil
+	}
+	return err
+}
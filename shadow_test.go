@@ -0,0 +1,47 @@
+package gomemssn
+
+import (
+	"testing"
+)
+
+func TestShadowStore(t *testing.T) {
+
+	old, next := NewMemoryStore(), NewMemoryStore()
+	m := NewManager(nil, "gomemssn_test")
+	m.Store = old
+
+	// written before the migration started
+	before := loadTestSession(t, m, "")
+	before.Values["v"] = "before"
+	m.MustWriteSession(nil, before)
+
+	ss := &ShadowStore{Old: old, New: next, Fallback: true, NewKey: func(key string) string { return "v2:" + key }}
+	m.Store = ss
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "during"
+	m.MustWriteSession(nil, s)
+	if _, err := old.Get(m.StoreKey(s.Key)); err != nil {
+		t.Fatalf("expected the session in Old: %v", err)
+	}
+	if _, err := next.Get("v2:" + m.StoreKey(s.Key)); err != nil {
+		t.Fatalf("expected the session in New: %v", err)
+	}
+
+	// reading from New, the session only Old has is still found, and moves
+	// over with its next write
+	ss.ReadNew = true
+	s2 := loadTestSession(t, m, before.Key)
+	if s2.Values["v"] != "before" {
+		t.Fatalf("expected the fallback to Old, got %v", s2.Values)
+	}
+	s2.Values["v"] = "moved"
+	m.MustWriteSession(nil, s2)
+
+	ss.Old = NewMemoryStore()
+	for key, want := range map[string]string{s.Key: "during", before.Key: "moved"} {
+		if s3, err := m.GetSessionByKey(key); err != nil || s3.Values["v"] != want {
+			t.Fatalf("expected %q in New, got %v", want, err)
+		}
+	}
+
+}
@@ -0,0 +1,161 @@
+package gomemssn
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// With several memcache pools (one per region, say) a session has to be read
+// from the pool it was written to, wherever the request lands.  With
+// Manager.ShardHint set, new session keys start with "~" + hint + "~", and
+// so do the keys derived from them (heavy values, chunks, locks), so a
+// ShardedStore can tell the pool of any of them from the key alone.  Keys
+// which aren't a session's (user indexes, remember-me tokens, counters) have
+// no hint and go to the default pool.
+
+// shardSep encloses the shard hint in session keys
+const shardSep = "~"
+
+// KeyHint returns the shard hint of a session key, or of a backing store key
+// derived from one, "" if it has none
+func KeyHint(key string) string {
+	_, rest, ok := strings.Cut(key, shardSep)
+	if !ok {
+		return ""
+	}
+	hint, _, ok := strings.Cut(rest, shardSep)
+	if !ok {
+		return ""
+	}
+	return hint
+}
+
+// hintKey puts the hint from ShardHint in front of key
+func (m *Manager) hintKey(key string) (string, error) {
+	if m.ShardHint == nil {
+		return key, nil
+	}
+	hint := m.ShardHint()
+	hinted := shardSep + hint + shardSep + key
+	if hint == "" || strings.Contains(hint, shardSep) || !validKey(hinted) {
+		return "", fmt.Errorf("ShardHint returned an invalid hint %q", hint)
+	}
+	return hinted, nil
+}
+
+// ShardResolver picks the store a backing store key is kept in
+type ShardResolver interface {
+	Shard(key string) Store
+}
+
+// HintShards is a ShardResolver going by the shard hint of keys (see
+// KeyHint): Shards[hint], Default for keys without a hint or with one which
+// isn't in Shards
+type HintShards struct {
+	Shards  map[string]Store
+	Default Store
+}
+
+func (hs HintShards) Shard(key string) Store {
+	if st, ok := hs.Shards[KeyHint(key)]; ok {
+		return st
+	}
+	return hs.Default
+}
+
+// ShardedStore is a Store spreading keys over several stores as Resolver
+// says, which is consulted for every read and write:
+//
+//	m.ShardHint = func() string { return "eu" }
+//	m.Store = &gomemssn.ShardedStore{Resolver: gomemssn.HintShards{
+//		Shards:  map[string]gomemssn.Store{"eu": euPool, "us": usPool},
+//		Default: euPool,
+//	}}
+//
+// Conditional writes and locking need all the stores to be CASStores.
+type ShardedStore struct {
+	Resolver ShardResolver
+}
+
+func (ss *ShardedStore) Get(key string) ([]byte, error) {
+	return ss.Resolver.Shard(key).Get(key)
+}
+
+func (ss *ShardedStore) GetCAS(key string) ([]byte, interface{}, error) {
+	return getCAS(ss.Resolver.Shard(key), key)
+}
+
+func (ss *ShardedStore) Set(key string, data []byte, ttl time.Duration) error {
+	return ss.Resolver.Shard(key).Set(key, data, ttl)
+}
+
+func (ss *ShardedStore) CompareAndSwap(key string, data []byte, token interface{}, ttl time.Duration) error {
+	st := ss.Resolver.Shard(key)
+	if cs, ok := st.(CASStore); ok {
+		return cs.CompareAndSwap(key, data, token, ttl)
+	}
+	return st.Set(key, data, ttl)
+}
+
+func (ss *ShardedStore) Delete(key string) error {
+	return ss.Resolver.Shard(key).Delete(key)
+}
+
+func (ss *ShardedStore) Touch(key string, ttl time.Duration) error {
+	return ss.Resolver.Shard(key).Touch(key, ttl)
+}
+
+func (ss *ShardedStore) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	return incr(ss.Resolver.Shard(key), key, delta, ttl)
+}
+
+// GetMulti reads the keys of each store together, if it is a MultiGetStore
+func (ss *ShardedStore) GetMulti(keys []string) (map[string]*StoreItem, error) {
+	// grouped by index, stores can't be map keys (their dynamic type may
+	// not be comparable)
+	var shards []Store
+	var byShard [][]string
+	for _, key := range keys {
+		st := ss.Resolver.Shard(key)
+		i := 0
+		for i < len(shards) && !sameStore(shards[i], st) {
+			i++
+		}
+		if i == len(shards) {
+			shards, byShard = append(shards, st), append(byShard, nil)
+		}
+		byShard[i] = append(byShard[i], key)
+	}
+	ret := make(map[string]*StoreItem, len(keys))
+	for i, st := range shards {
+		if ms, ok := st.(MultiGetStore); ok {
+			items, err := ms.GetMulti(byShard[i])
+			if err != nil {
+				return nil, err
+			}
+			for k, it := range items {
+				ret[k] = it
+			}
+			continue
+		}
+		for _, key := range byShard[i] {
+			data, token, err := getCAS(st, key)
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			ret[key] = &StoreItem{Data: data, CAS: token}
+		}
+	}
+	return ret, nil
+}
+
+// sameStore reports whether a and b are the same store; ones which can't be
+// compared are taken to be different, they are then just read separately
+func sameStore(a, b Store) bool {
+	ta := reflect.TypeOf(a)
+	return ta == reflect.TypeOf(b) && ta != nil && ta.Comparable() && a == b
+}
@@ -0,0 +1,90 @@
+package gomemssn
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShardedStore(t *testing.T) {
+
+	eu, us := NewMemoryStore(), NewMemoryStore()
+	m := NewManager(nil, "gomemssn_test")
+	m.HeavyKeys = []string{"cart"}
+	m.Store = &ShardedStore{Resolver: HintShards{Shards: map[string]Store{"eu": eu, "us": us}, Default: eu}}
+
+	region := "us"
+	m.ShardHint = func() string { return region }
+	s := loadTestSession(t, m, "")
+	if !strings.HasPrefix(s.Key, "~us~") || KeyHint(m.StoreKey(s.Key)) != "us" {
+		t.Fatalf("expected the hint in the key, got %q", s.Key)
+	}
+	s.Values["v"] = "abc123"
+	s.Values["cart"] = "stuff"
+	m.MustWriteSession(nil, s)
+	if us.Len() != 2 || eu.Len() != 0 {
+		t.Fatalf("expected the session and its heavy value in the us pool, got %d and %d entries", us.Len(), eu.Len())
+	}
+
+	// read wherever the request lands
+	region = "eu"
+	if s2 := loadTestSession(t, m, s.Key); s2.Key != s.Key || s2.Values["v"] != "abc123" {
+		t.Fatalf("expected the session from the us pool, got %v", s2.Values)
+	}
+	found, err := m.GetSessionsByKey([]string{s.Key, loadTestSession(t, m, "").Key})
+	if err != nil || len(found) != 1 {
+		t.Fatalf("unexpected sessions %v (%v)", found, err)
+	}
+
+	if KeyHint("plainkey") != "" {
+		t.Fatal("expected no hint in a plain key")
+	}
+	region = "bad~hint"
+	if _, err := m.freshSession(); err == nil {
+		t.Fatal("expected an error for an invalid hint")
+	}
+
+}
+
+// sliceStore is a Store whose values can't be compared (or be map keys)
+type sliceStore struct {
+	st   *MemoryStore
+	tags []string
+}
+
+func (s sliceStore) Get(key string) ([]byte, error) { return s.st.Get(key) }
+func (s sliceStore) Set(key string, data []byte, ttl time.Duration) error {
+	return s.st.Set(key, data, ttl)
+}
+func (s sliceStore) Delete(key string) error                   { return s.st.Delete(key) }
+func (s sliceStore) Touch(key string, ttl time.Duration) error { return s.st.Touch(key, ttl) }
+
+func TestShardedStoreGetMulti(t *testing.T) {
+
+	eu, us := NewMemoryStore(), NewMemoryStore()
+	defer eu.Stop()
+	defer us.Stop()
+	ss := &ShardedStore{Resolver: HintShards{
+		Shards:  map[string]Store{"eu": sliceStore{st: eu}, "us": us},
+		Default: us,
+	}}
+	keys := []string{"~eu~a", "~us~b", "~eu~c", "d"}
+	for _, k := range keys {
+		if err := ss.Set(k, []byte(k), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := ss.GetMulti(append(keys, "~eu~missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != len(keys) {
+		t.Fatalf("expected %d items, got %v", len(keys), items)
+	}
+	for _, k := range keys {
+		if it := items[k]; it == nil || string(it.Data) != k {
+			t.Fatalf("unexpected item for %s: %v", k, it)
+		}
+	}
+
+}
@@ -0,0 +1,94 @@
+package gomemssn
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// With Manager.SigningKey set the cookie value is "key.signature", the
+// signature being the HMAC-SHA256 of the key.  Keys are random enough that
+// guessing one is hopeless anyway, but signing means a forged or mangled
+// cookie is rejected without a trip to the backing store and gets reported
+// (AuditTamper).  Changing SigningKey invalidates all existing cookies,
+// unless the old key is kept in OldSigningKeys: cookies signed with it are
+// still accepted, and sent again signed with SigningKey.  The same goes for
+// EncryptionKey and OldEncryptionKeys.
+
+// signedValue returns key with its signature appended, if we sign (or as
+// CookieCodec has it)
+func (m *Manager) signedValue(key string) string {
+	if m.CookieCodec != nil && key != "" {
+		return m.CookieCodec.EncodeKey(key)
+	}
+	if len(m.SigningKey) == 0 || key == "" {
+		return key
+	}
+	return key + "." + m.sign(key)
+}
+
+// verifySigned returns the session key from a signed value and whether its
+// signature (if we sign) is good
+func (m *Manager) verifySigned(value string) (string, bool) {
+	if m.CookieCodec != nil {
+		return m.CookieCodec.DecodeKey(value)
+	}
+	if len(m.SigningKey) == 0 {
+		return value, true
+	}
+	i := strings.LastIndexByte(value, '.')
+	if i <= 0 {
+		return "", false
+	}
+	key, sig := value[:i], value[i+1:]
+	for j := -1; j < len(m.OldSigningKeys); j++ {
+		sk := m.SigningKey
+		if j >= 0 {
+			sk = m.OldSigningKeys[j]
+		}
+		if hmac.Equal([]byte(sig), []byte(sign(sk, key))) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func (m *Manager) sign(key string) string {
+	return sign(m.SigningKey, key)
+}
+
+func sign(sk []byte, key string) string {
+	mac := hmac.New(sha256.New, sk)
+	mac.Write([]byte(key))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// oldKeyCookie reports whether value, a genuine cookie value, was signed or
+// encrypted with one of OldSigningKeys or OldEncryptionKeys
+func (m *Manager) oldKeyCookie(value string) bool {
+	if len(m.OldSigningKeys) == 0 && len(m.OldEncryptionKeys) == 0 {
+		return false
+	}
+	signed := value
+	if len(m.EncryptionKey) > 0 {
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return false
+		}
+		plain, ok := openWith(b, [][]byte{m.EncryptionKey})
+		if !ok {
+			return true
+		}
+		if len(plain) == 0 || plain[0] != 'k' {
+			// the session is in the cookie, it is sent again anyway
+			return false
+		}
+		signed = string(plain[1:])
+	}
+	if m.CookieCodec != nil || len(m.SigningKey) == 0 {
+		return false
+	}
+	i := strings.LastIndexByte(signed, '.')
+	return i > 0 && !hmac.Equal([]byte(signed[i+1:]), []byte(m.sign(signed[:i])))
+}
@@ -0,0 +1,88 @@
+package gomemssn
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignedCookies(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.SigningKey = []byte("0123456789abcdef0123456789abcdef")
+	buf := &bytes.Buffer{}
+	m.AuditSink = NewWriterSink(buf)
+
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["a"] = "b"
+	m.MustWriteSession(w, s)
+	c := w.Result().Cookies()[0]
+	if c.Value != s.Key+"."+m.sign(s.Key) {
+		t.Fatalf("cookie not signed: %q", c.Value)
+	}
+
+	get := func(value string) *Session {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: c.Name, Value: value})
+		return m.MustSession(httptest.NewRecorder(), r)
+	}
+
+	if s2 := get(c.Value); s2.Key != s.Key || s2.Values["a"] != "b" {
+		t.Fatalf("signed cookie not accepted")
+	}
+	for _, v := range []string{s.Key, s.Key + ".bad", s.Key + "." + m.sign("other"), "." + m.sign(s.Key)} {
+		if s2 := get(v); s2.Key == s.Key || len(s2.Values) != 0 {
+			t.Fatalf("cookie %q should not give the session", v)
+		}
+	}
+	if n := strings.Count(buf.String(), `"type":"tamper"`); n != 4 {
+		t.Fatalf("expected 4 tamper events, got %d", n)
+	}
+
+}
+
+func TestKeyRotation(t *testing.T) {
+
+	for _, encrypt := range []bool{false, true} {
+
+		m := NewManager(nil, "gomemssn_test")
+		m.SigningKey = []byte("old signing key")
+		if encrypt {
+			m.EncryptionKey = []byte("old-encrypt-key!")
+		}
+		w := httptest.NewRecorder()
+		s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+		s.Values["a"] = "b"
+		m.MustWriteSession(w, s)
+		c := w.Result().Cookies()[0]
+
+		get := func() (*Session, []*http.Cookie) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+			w := httptest.NewRecorder()
+			return m.MustSession(w, r), w.Result().Cookies()
+		}
+
+		m.OldSigningKeys, m.SigningKey = [][]byte{m.SigningKey}, []byte("new signing key")
+		if encrypt {
+			m.OldEncryptionKeys, m.EncryptionKey = [][]byte{m.EncryptionKey}, []byte("new-encrypt-key!")
+		}
+		s2, cs := get()
+		if s2.Key != s.Key || s2.Values["a"] != "b" {
+			t.Fatalf("cookie with the old keys not accepted (encrypt %v)", encrypt)
+		}
+		if len(cs) != 1 || cs[0].Value == c.Value || m.oldKeyCookie(cs[0].Value) {
+			t.Fatalf("expected the cookie sent again with the new keys (encrypt %v), got %v", encrypt, cs)
+		}
+
+		m.OldSigningKeys, m.OldEncryptionKeys = nil, nil
+		if s2, _ = get(); s2.Key == s.Key {
+			t.Fatalf("cookie with the old keys accepted once they were dropped (encrypt %v)", encrypt)
+		}
+
+	}
+
+}
@@ -0,0 +1,191 @@
+package gomemssn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EstimateSize returns how many bytes the session's main record would take
+// in memcache if it were written now (heavy keys are stored separately and
+// not counted), so applications can trim or refuse oversized state before
+// memcache rejects it.  It encodes the session, so it costs about as much
+// as a write minus the network round trip.
+func (s *Session) EstimateSize() (int, error) {
+	m := s.m
+	if m == nil {
+		m = &Manager{}
+	}
+	b, err := m.encodeRecord(m.newRecord(s))
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Size returns how many bytes the session's main record took in the backing
+// store when it was last read or written, 0 if it never was.  Unlike
+// EstimateSize it costs nothing, but doesn't count changes since.
+func (s *Session) Size() int {
+	return len(s.loaded)
+}
+
+// LimitPolicy says what WriteSession does with a session which is over
+// Manager.MaxKeys or Manager.MaxSessionBytes
+type LimitPolicy int
+
+const (
+	LimitReject      LimitPolicy = iota // don't write it, return the error
+	LimitEvictOldest                    // delete the oldest keys not starting with "_" until it fits
+	LimitCallback                       // call Manager.OnLimit and write it if that returns nil and it now fits
+)
+
+var (
+	ErrTooManyKeys     = errors.New("gomemssn: session has too many keys")
+	ErrSessionTooLarge = errors.New("gomemssn: session is too large")
+)
+
+// SizeError is the error for a session over MaxSessionBytes, it wraps
+// ErrSessionTooLarge
+type SizeError struct {
+	Size  int // bytes the main record would take
+	Limit int // MaxSessionBytes
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("%v (%d bytes, limit is %d)", ErrSessionTooLarge, e.Size, e.Limit)
+}
+
+func (e *SizeError) Unwrap() error {
+	return ErrSessionTooLarge
+}
+
+// checkLimits returns an error wrapping ErrTooManyKeys, or a *SizeError, if s
+// (whose main record is size bytes) is over the limits; this is before
+// anything is sent to the backing store
+func (m *Manager) checkLimits(s *Session, size int) error {
+	if m.MaxKeys > 0 && len(s.Values) > m.MaxKeys {
+		return fmt.Errorf("%w (%d keys, limit is %d)", ErrTooManyKeys, len(s.Values), m.MaxKeys)
+	}
+	if m.MaxSessionBytes > 0 && size > m.MaxSessionBytes {
+		return &SizeError{Size: size, Limit: m.MaxSessionBytes}
+	}
+	return nil
+}
+
+// ValidationError is returned by WriteSession for values Manager.Validate
+// rejected, the session was not written
+type ValidationError struct {
+	SessionID string // see SessionID
+	Err       error  // what Validate returned
+}
+
+func (e *ValidationError) Error() string {
+	return "gomemssn: invalid session values: " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// validate runs Validate on the values of s
+func (m *Manager) validate(s *Session) error {
+	if m.Validate == nil {
+		return nil
+	}
+	if err := m.Validate(s.Values); err != nil {
+		return &ValidationError{SessionID: SessionID(s.Key), Err: err}
+	}
+	return nil
+}
+
+// encodeLimited encodes the main record of s, applying LimitPolicy
+func (m *Manager) encodeLimited(s *Session) ([]byte, error) {
+
+	if m.LimitPolicy == LimitEvictOldest {
+		trackKeysAdded(s)
+	}
+
+	for {
+
+		b, err := m.encodeRecord(m.newRecord(s))
+		if err != nil {
+			return nil, err
+		}
+		err = m.checkLimits(s, len(b))
+		if err == nil {
+			return b, nil
+		}
+
+		switch m.LimitPolicy {
+
+		case LimitEvictOldest:
+			if !evictOldest(s) {
+				return nil, err
+			}
+
+		case LimitCallback:
+			if m.OnLimit == nil {
+				return nil, err
+			}
+			if err := m.OnLimit(s, err); err != nil {
+				return nil, err
+			}
+			b, err = m.encodeRecord(m.newRecord(s))
+			if err != nil {
+				return nil, err
+			}
+			if err := m.checkLimits(s, len(b)); err != nil {
+				return nil, err
+			}
+			return b, nil
+
+		default:
+			return nil, err
+
+		}
+
+	}
+
+}
+
+// trackKeysAdded updates Meta.KeysAdded to match the keys in Values
+func trackKeysAdded(s *Session) {
+	if s.Meta.KeysAdded == nil {
+		s.Meta.KeysAdded = make(map[string]time.Time, len(s.Values))
+	}
+	now := s.now()
+	for k := range s.Values {
+		if _, ok := s.Meta.KeysAdded[k]; !ok {
+			s.Meta.KeysAdded[k] = now
+		}
+	}
+	for k := range s.Meta.KeysAdded {
+		if _, ok := s.Values[k]; !ok {
+			delete(s.Meta.KeysAdded, k)
+		}
+	}
+}
+
+// evictOldest deletes the oldest key not starting with "_" from s, returns
+// false if there is none
+func evictOldest(s *Session) bool {
+	oldest := ""
+	var oldestT time.Time
+	for k := range s.Values {
+		if strings.HasPrefix(k, "_") {
+			continue
+		}
+		t := s.Meta.KeysAdded[k]
+		if oldest == "" || t.Before(oldestT) || (t.Equal(oldestT) && k < oldest) {
+			oldest, oldestT = k, t
+		}
+	}
+	if oldest == "" {
+		return false
+	}
+	delete(s.Values, oldest)
+	delete(s.Meta.KeysAdded, oldest)
+	return true
+}
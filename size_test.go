@@ -0,0 +1,147 @@
+package gomemssn
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateSize(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.HeavyKeys = []string{"search"}
+
+	s := loadTestSession(t, m, "")
+	small, err := s.EstimateSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Values["search"] = strings.Repeat("x", 10000)
+	n, err := s.EstimateSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != small {
+		t.Fatalf("heavy keys should not count, expected %d but got %d", small, n)
+	}
+
+	s.Values["v"] = strings.Repeat("x", 10000)
+	n, err = s.EstimateSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 10000 {
+		t.Fatalf("expected size of at least 10000 but got %d", n)
+	}
+
+	data, err := m.encodeRecord(m.newRecord(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != n {
+		t.Fatalf("expected estimate %d to match the encoded size %d", n, len(data))
+	}
+
+	if s.Size() != 0 {
+		t.Fatalf("expected no size before the session is written, got %d", s.Size())
+	}
+	m.MustWriteSession(nil, s)
+	if n, _ = s.EstimateSize(); s.Size() != n {
+		t.Fatalf("expected the written size %d but got %d", n, s.Size())
+	}
+	if s2 := loadTestSession(t, m, s.Key); s2.Size() != n {
+		t.Fatalf("expected the read size %d but got %d", n, s2.Size())
+	}
+
+}
+
+func TestLimits(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.MaxKeys = 2
+
+	s := loadTestSession(t, m, "")
+	s.Values["a"] = "1"
+	s.Values["b"] = "2"
+	s.Values["c"] = "3"
+	if err := m.WriteSession(nil, s); !errors.Is(err, ErrTooManyKeys) {
+		t.Fatalf("expected ErrTooManyKeys but got: %v", err)
+	}
+
+	m.MaxKeys = 0
+	m.MaxSessionBytes = 1000
+	s.Values["c"] = strings.Repeat("x", 2000)
+	err := m.WriteSession(nil, s)
+	var se *SizeError
+	if !errors.Is(err, ErrSessionTooLarge) || !errors.As(err, &se) || se.Size < 2000 || se.Limit != 1000 {
+		t.Fatalf("expected a SizeError but got: %v", err)
+	}
+
+	m.LimitPolicy = LimitCallback
+	m.OnLimit = func(s *Session, err error) error {
+		delete(s.Values, "c")
+		return nil
+	}
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+
+}
+
+func TestLimitEvictOldest(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.MaxKeys = 3
+	m.LimitPolicy = LimitEvictOldest
+
+	s := loadTestSession(t, m, "")
+	s.Values["_reserved"] = "0"
+	s.Values["a"] = "1"
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	s.Values["b"] = "2"
+	s.Values["c"] = "3"
+	if err := m.WriteSession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+
+	s = loadTestSession(t, m, s.Key)
+	if _, ok := s.Values["a"]; ok {
+		t.Fatalf("expected oldest key to be evicted but got: %v", s.Values)
+	}
+	if len(s.Values) != 3 || s.Values.GetString("_reserved") != "0" {
+		t.Fatalf("expected reserved and newer keys to be kept but got: %v", s.Values)
+	}
+
+}
+
+func TestValidate(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	errNoSSN := errors.New("no social security numbers in sessions")
+	m.Validate = func(v Values) error {
+		if _, ok := v["ssn"]; ok {
+			return errNoSSN
+		}
+		return nil
+	}
+
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+
+	s.Values["ssn"] = "078-05-1120"
+	err := m.WriteSession(nil, s)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || !errors.Is(err, errNoSSN) || ve.SessionID != SessionID(s.Key) {
+		t.Fatalf("expected a ValidationError but got %v", err)
+	}
+	if s2 := loadTestSession(t, m, s.Key); s2.Values["ssn"] != nil {
+		t.Fatalf("rejected values were written: %v", s2.Values)
+	}
+
+}
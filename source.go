@@ -0,0 +1,37 @@
+package gomemssn
+
+// Where a session came from, see Session.Source.  These are also the source
+// in DebugHeader, Metrics.SessionLoaded and the AttrSource span attribute.
+const (
+	SourceNew      = "new"      // the request had no session cookie: a first visit (or cleared cookies), a new session was started
+	SourceMiss     = "miss"     // the request had a cookie but its session is gone (expired, evicted, revoked), a new one was started
+	SourceHit      = "hit"      // read from the backing store
+	SourceCookie   = "cookie"   // read from the cookie, see Manager.CookieFallback
+	SourceExpired  = "expired"  // the session was past AbsoluteExpiration and replaced by a new one
+	SourceRejected = "rejected" // the session was bound to another client and replaced by a new one, see Manager.Binding
+	SourceCorrupt  = "corrupt"  // the session couldn't be decoded and was replaced by a new one, see DecodeError
+	SourceError    = "error"    // the backing store failed, see Manager.OnStoreError
+	SourceJWT      = "jwt"      // the session couldn't be read and was made up from its JWT, see FromJWT
+)
+
+// Source returns where the session came from, one of the Source constants
+// ("" for sessions Session skipped, see Manager.Skip), so a handler can
+// tell a first visit (SourceNew) from a visitor whose session lapsed
+// (SourceMiss, SourceExpired...) and say so
+func (s *Session) Source() string {
+	return s.source
+}
+
+// Expired reports whether the request came with a session which is no more,
+// gone from the backing store or past AbsoluteExpiration, and got a new one
+// (SourceMiss or SourceExpired), so a handler can say "your session
+// expired, please sign in again"
+func (s *Session) Expired() bool {
+	return s.source == SourceMiss || s.source == SourceExpired
+}
+
+// LoadedFromStore reports whether the session was read from the backing
+// store, rather than started for this request or recovered some other way
+func (s *Session) LoadedFromStore() bool {
+	return s.source == SourceHit
+}
@@ -0,0 +1,65 @@
+package gomemssn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSource(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now = clock.Now
+	m.Expiration = 24 * time.Hour
+	m.AbsoluteExpiration = time.Hour
+
+	s := loadTestSession(t, m, "")
+	if s.Source() != SourceNew || !s.IsNew() || s.LoadedFromStore() {
+		t.Fatalf("expected a new session, got %q", s.Source())
+	}
+	m.MustWriteSession(nil, s)
+
+	s = loadTestSession(t, m, s.Key)
+	if s.Source() != SourceHit || s.IsNew() || !s.LoadedFromStore() {
+		t.Fatalf("expected a session from the store, got %q", s.Source())
+	}
+
+	clock.Advance(2 * time.Hour)
+	if s2 := loadTestSession(t, m, s.Key); s2.Source() != SourceExpired || !s2.IsNew() {
+		t.Fatalf("expected an expired session, got %q", s2.Source())
+	}
+
+	if err := m.DeleteSessionByKey(s.Key); err != nil {
+		t.Fatal(err)
+	}
+	if s2 := loadTestSession(t, m, s.Key); s2.Source() != SourceMiss || !s2.IsNew() || s2.LoadedFromStore() {
+		t.Fatalf("expected a lapsed session, got %q", s2.Source())
+	} else if !s2.Expired() {
+		t.Error("expected the lapsed session to be reported as expired")
+	}
+
+}
+
+func TestRenewMissingKeys(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	st := NewMemoryStore()
+	defer st.Stop()
+	m.Store = st
+
+	if s := loadTestSession(t, m, ""); s.Expired() {
+		t.Error("a new session isn't an expired one")
+	}
+
+	// by default the key of the lapsed session is kept
+	if s := loadTestSession(t, m, "gone"); s.Key != "gone" || !s.Expired() {
+		t.Fatalf("expected the old key, got %q", s.Key)
+	}
+
+	m.RenewMissingKeys = true
+	s := loadTestSession(t, m, "gone")
+	if s.Key == "gone" || !s.Expired() || s.Source() != SourceMiss {
+		t.Fatalf("expected a new key, got %q (%s)", s.Key, s.Source())
+	}
+
+}
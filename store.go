@@ -0,0 +1,481 @@
+package gomemssn
+
+import (
+	"container/list"
+	"errors"
+	"github.com/bradfitz/gomemcache/memcache"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("gomemssn: not found in backing store")
+	ErrCASConflict = errors.New("gomemssn: cas conflict")
+)
+
+// Store is where sessions are kept.  MemcacheStore and MemoryStore are the
+// ones provided here, other backends (Redis, SQL...) can be plugged in by
+// setting Manager.Store.
+type Store interface {
+	// Get returns the data stored under key, or ErrNotFound
+	Get(key string) ([]byte, error)
+	// Set writes data under key, expiring after ttl
+	Set(key string, data []byte, ttl time.Duration) error
+	// Delete removes key, it is not an error if it does not exist
+	Delete(key string) error
+	// Touch resets the expiration of key to ttl without rewriting it,
+	// returns ErrNotFound if it does not exist
+	Touch(key string, ttl time.Duration) error
+}
+
+// CASStore is implemented by stores which can do conditional writes.  Without
+// it every write is a plain Set, concurrent writes always overwrite each
+// other and OnConflict has no effect.
+type CASStore interface {
+	Store
+	// GetCAS is Get which also returns a token identifying this version of
+	// the data
+	GetCAS(key string) ([]byte, interface{}, error)
+	// CompareAndSwap writes data under key only if it is still at the version
+	// token was returned with, or, for a nil token, if it does not exist;
+	// returns ErrCASConflict otherwise
+	CompareAndSwap(key string, data []byte, token interface{}, ttl time.Duration) error
+}
+
+// MultiGetStore is implemented by stores which can read many keys in one
+// round trip, used by Prefetch
+type MultiGetStore interface {
+	Store
+	// GetMulti returns the data and cas token (nil if the store is not a
+	// CASStore) of each key found, keys not found are not in the result
+	GetMulti(keys []string) (map[string]*StoreItem, error)
+}
+
+// IncrStore is implemented by stores which can add to a counter atomically,
+// used by Session.Incr; without it counters are updated with cas
+type IncrStore interface {
+	Store
+	// Incr adds delta to the decimal counter under key and returns the
+	// result, creating the counter (expiring after ttl) if it does not
+	// exist; counters don't go below 0
+	Incr(key string, delta int64, ttl time.Duration) (int64, error)
+}
+
+// TTLStore is implemented by stores which can tell how long an entry has
+// left, used by Session.ExpiresAt.  gomemcache has no way to ask (memcache's
+// meta commands can), so MemcacheStore doesn't implement it.
+type TTLStore interface {
+	Store
+	// TTL returns how long key has left, 0 if it doesn't expire, or
+	// ErrNotFound
+	TTL(key string) (time.Duration, error)
+}
+
+// TxStore is implemented by stores which can make several changes at once,
+// all of them or none, used to write a session together with its user's
+// index (see Session.SetUserID) and to delete it from both
+type TxStore interface {
+	Store
+	// Tx calls f with a Store whose Set, CompareAndSwap, Delete and Touch
+	// are made together if f returns nil, and not at all if it returns an
+	// error, which Tx returns.  If a CompareAndSwap conflicts none are made
+	// and Tx returns ErrCASConflict.  f may be called again (so it should
+	// only change the Store) and what it reads may not reflect its own
+	// changes yet.  The Store is a CASStore if the TxStore is.
+	Tx(f func(tx Store) error) error
+}
+
+// StoreItem is an entry returned by MultiGetStore.GetMulti
+type StoreItem struct {
+	Data []byte
+	CAS  interface{}
+}
+
+// MemcacheStore keeps sessions in memcache
+type MemcacheStore struct {
+	Client *memcache.Client
+}
+
+func (ms MemcacheStore) Get(key string) ([]byte, error) {
+	data, _, err := ms.GetCAS(key)
+	return data, err
+}
+
+// GetCAS returns the *memcache.Item as token, the client reads with "gets" so
+// it carries the cas id CompareAndSwap needs
+func (ms MemcacheStore) GetCAS(key string) ([]byte, interface{}, error) {
+	it, err := ms.Client.Get(key)
+	if err == memcache.ErrCacheMiss {
+		return nil, nil, ErrNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return it.Value, it, nil
+}
+
+func (ms MemcacheStore) GetMulti(keys []string) (map[string]*StoreItem, error) {
+	items, err := ms.Client.GetMulti(keys)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]*StoreItem, len(items))
+	for key, it := range items {
+		ret[key] = &StoreItem{Data: it.Value, CAS: it}
+	}
+	return ret, nil
+}
+
+// maxRelativeExpiration is the longest expiration memcache takes as a number
+// of seconds, it reads anything longer as a Unix time
+const maxRelativeExpiration = 30 * 24 * time.Hour
+
+// memcacheExpiration returns ttl as memcache expects it: in seconds, or as a
+// Unix time past maxRelativeExpiration
+func memcacheExpiration(ttl time.Duration, now time.Time) int32 {
+	if ttl > maxRelativeExpiration {
+		return int32(now.Add(ttl).Unix())
+	}
+	return int32(ttl / time.Second)
+}
+
+func (ms MemcacheStore) Set(key string, data []byte, ttl time.Duration) error {
+	return ms.Client.Set(&memcache.Item{Key: key, Value: data, Expiration: memcacheExpiration(ttl, time.Now())})
+}
+
+func (ms MemcacheStore) CompareAndSwap(key string, data []byte, token interface{}, ttl time.Duration) error {
+	exp := memcacheExpiration(ttl, time.Now())
+	var err error
+	if it, ok := token.(*memcache.Item); ok {
+		it2 := *it
+		it2.Value = data
+		it2.Expiration = exp
+		err = ms.Client.CompareAndSwap(&it2)
+	} else {
+		err = ms.Client.Add(&memcache.Item{Key: key, Value: data, Expiration: exp})
+	}
+	if err == memcache.ErrCASConflict || err == memcache.ErrNotStored {
+		return ErrCASConflict
+	}
+	return err
+}
+
+// Incr uses memcache's incr and decr, and add to create the counter
+func (ms MemcacheStore) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	for {
+		var n uint64
+		var err error
+		if delta >= 0 {
+			n, err = ms.Client.Increment(key, uint64(delta))
+		} else {
+			n, err = ms.Client.Decrement(key, uint64(-delta))
+		}
+		if err != memcache.ErrCacheMiss {
+			return int64(n), err
+		}
+		n0 := max(delta, 0)
+		err = ms.Client.Add(&memcache.Item{Key: key, Value: []byte(strconv.FormatInt(n0, 10)), Expiration: memcacheExpiration(ttl, time.Now())})
+		if err == nil {
+			return n0, nil
+		} else if err != memcache.ErrNotStored {
+			return 0, err
+		}
+		// someone else created it meanwhile
+	}
+}
+
+func (ms MemcacheStore) Delete(key string) error {
+	err := ms.Client.Delete(key)
+	if err == memcache.ErrCacheMiss {
+		return nil
+	}
+	return err
+}
+
+func (ms MemcacheStore) Touch(key string, ttl time.Duration) error {
+	err := ms.Client.Touch(key, memcacheExpiration(ttl, time.Now()))
+	if err == memcache.ErrCacheMiss {
+		return ErrNotFound
+	}
+	return err
+}
+
+// MemoryStore keeps sessions in a map, for development and tests.  Entries
+// expire like they would in memcache: they are not returned once their ttl
+// passed (going by Now, so tests can control time), and a janitor goroutine
+// (started with the first write, see Stop) removes them every
+// JanitorInterval.  With MaxEntries the least recently used entries are
+// evicted to make room, like memcache does when it runs out of memory.
+type MemoryStore struct {
+	JanitorInterval time.Duration    // how often expired entries are removed, 0 means a minute
+	Now             func() time.Time // the clock entries expire by, nil means time.Now
+	MaxEntries      int              // if > 0, the most entries kept, set it before the store is used
+	entries         map[string]*stubEntry
+	cas             uint64                   // last cas value handed out
+	lru             *list.List               // keys, most recently used first, only kept with MaxEntries
+	lruElems        map[string]*list.Element // the element of each key in lru
+	evictions       uint64                   // entries evicted for MaxEntries
+	mu              sync.RWMutex
+	janitor         sync.Once
+	stop            chan struct{}
+	stopOnce        sync.Once
+}
+
+// what MemoryStore keeps for each session, mirrors what memcache would have
+type stubEntry struct {
+	data    []byte
+	cas     uint64
+	expires time.Time // zero for never
+}
+
+func (e *stubEntry) live(now time.Time) bool {
+	return e != nil && (e.expires.IsZero() || now.Before(e.expires))
+}
+
+func (ms *MemoryStore) now() time.Time {
+	if ms.Now != nil {
+		return ms.Now()
+	}
+	return time.Now()
+}
+
+func (ms *MemoryStore) expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return ms.now().Add(ttl)
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*stubEntry), stop: make(chan struct{})}
+}
+
+func (ms *MemoryStore) Get(key string) ([]byte, error) {
+	data, _, err := ms.GetCAS(key)
+	return data, err
+}
+
+func (ms *MemoryStore) GetCAS(key string) ([]byte, interface{}, error) {
+	var e *stubEntry
+	if ms.MaxEntries > 0 {
+		ms.mu.Lock()
+		e = ms.entries[key]
+		ms.used(key)
+		ms.mu.Unlock()
+	} else {
+		ms.mu.RLock()
+		e = ms.entries[key]
+		ms.mu.RUnlock()
+	}
+	if !e.live(ms.now()) {
+		return nil, nil, ErrNotFound
+	}
+	return e.data, e.cas, nil
+}
+
+func (ms *MemoryStore) GetMulti(keys []string) (map[string]*StoreItem, error) {
+	ret := make(map[string]*StoreItem, len(keys))
+	now := ms.now()
+	ms.mu.Lock()
+	for _, key := range keys {
+		if e := ms.entries[key]; e.live(now) {
+			ret[key] = &StoreItem{Data: e.data, CAS: e.cas}
+			ms.used(key)
+		}
+	}
+	ms.mu.Unlock()
+	return ret, nil
+}
+
+func (ms *MemoryStore) Set(key string, data []byte, ttl time.Duration) error {
+	ms.startJanitor()
+	ms.mu.Lock()
+	ms.put(key, data, ttl)
+	ms.mu.Unlock()
+	return nil
+}
+
+func (ms *MemoryStore) CompareAndSwap(key string, data []byte, token interface{}, ttl time.Duration) error {
+	ms.startJanitor()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	e := ms.entries[key]
+	if !e.live(ms.now()) {
+		e = nil
+	}
+	if (e == nil && token != nil) || (e != nil && token != e.cas) {
+		return ErrCASConflict
+	}
+	ms.put(key, data, ttl)
+	return nil
+}
+
+// Incr keeps the expiration the counter was created with, like memcache
+func (ms *MemoryStore) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	ms.startJanitor()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	n, e := int64(0), ms.entries[key]
+	if e.live(ms.now()) {
+		n, _ = strconv.ParseInt(string(e.data), 10, 64)
+	} else {
+		e = nil
+	}
+	n = max(n+delta, 0)
+	ms.put(key, []byte(strconv.FormatInt(n, 10)), ttl)
+	if e != nil {
+		ms.entries[key].expires = e.expires
+	}
+	return n, nil
+}
+
+func (ms *MemoryStore) TTL(key string) (time.Duration, error) {
+	ms.mu.RLock()
+	e := ms.entries[key]
+	ms.mu.RUnlock()
+	now := ms.now()
+	if !e.live(now) {
+		return 0, ErrNotFound
+	}
+	if e.expires.IsZero() {
+		return 0, nil
+	}
+	return e.expires.Sub(now), nil
+}
+
+// put stores an entry, evicting the least recently used ones if there are
+// more than MaxEntries; ms.mu must be held
+func (ms *MemoryStore) put(key string, data []byte, ttl time.Duration) {
+	ms.cas++
+	ms.entries[key] = &stubEntry{data: data, cas: ms.cas, expires: ms.expiresAt(ttl)}
+	if ms.MaxEntries <= 0 {
+		return
+	}
+	if ms.lru == nil {
+		ms.lru, ms.lruElems = list.New(), make(map[string]*list.Element)
+	}
+	if el, ok := ms.lruElems[key]; ok {
+		ms.lru.MoveToFront(el)
+	} else {
+		ms.lruElems[key] = ms.lru.PushFront(key)
+	}
+	for ms.lru.Len() > ms.MaxEntries {
+		ms.remove(ms.lru.Back().Value.(string))
+		ms.evictions++
+	}
+}
+
+// used marks key as just used; ms.mu must be held
+func (ms *MemoryStore) used(key string) {
+	if el, ok := ms.lruElems[key]; ok {
+		ms.lru.MoveToFront(el)
+	}
+}
+
+// remove deletes key; ms.mu must be held
+func (ms *MemoryStore) remove(key string) {
+	delete(ms.entries, key)
+	if el, ok := ms.lruElems[key]; ok {
+		ms.lru.Remove(el)
+		delete(ms.lruElems, key)
+	}
+}
+
+func (ms *MemoryStore) Delete(key string) error {
+	ms.mu.Lock()
+	ms.remove(key)
+	ms.mu.Unlock()
+	return nil
+}
+
+func (ms *MemoryStore) Touch(key string, ttl time.Duration) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	e := ms.entries[key]
+	if !e.live(ms.now()) {
+		return ErrNotFound
+	}
+	e2 := *e
+	e2.expires = ms.expiresAt(ttl)
+	ms.entries[key] = &e2
+	ms.used(key)
+	return nil
+}
+
+// Len returns how many sessions are stored, including expired ones the
+// janitor didn't remove yet
+func (ms *MemoryStore) Len() int {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return len(ms.entries)
+}
+
+// Sweep removes expired entries, which the janitor does periodically, and
+// returns how many there were
+func (ms *MemoryStore) Sweep() int {
+	now := ms.now()
+	n := 0
+	ms.mu.Lock()
+	for k, e := range ms.entries {
+		if !e.live(now) {
+			ms.remove(k)
+			n++
+		}
+	}
+	ms.mu.Unlock()
+	return n
+}
+
+// stubEntryOverhead is roughly what an entry takes besides its key and data
+const stubEntryOverhead = 128
+
+// MemoryStoreStats is what MemoryStore.Stats reports
+type MemoryStoreStats struct {
+	Entries   int    // entries kept, including expired ones not removed yet
+	Expired   int    // of those, the expired ones
+	Bytes     int64  // approximate memory the entries take
+	Evictions uint64 // entries evicted to stay within MaxEntries so far
+}
+
+// Stats returns how many entries the store has and roughly how much memory
+// they take
+func (ms *MemoryStore) Stats() MemoryStoreStats {
+	now := ms.now()
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	st := MemoryStoreStats{Entries: len(ms.entries), Evictions: ms.evictions}
+	for k, e := range ms.entries {
+		if !e.live(now) {
+			st.Expired++
+		}
+		st.Bytes += int64(len(k) + len(e.data) + stubEntryOverhead)
+	}
+	return st
+}
+
+// Stop stops the janitor goroutine, entries still expire but are only
+// removed by Sweep
+func (ms *MemoryStore) Stop() {
+	ms.stopOnce.Do(func() { close(ms.stop) })
+}
+
+func (ms *MemoryStore) startJanitor() {
+	ms.janitor.Do(func() {
+		interval := ms.JanitorInterval
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		go func() {
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					ms.Sweep()
+				case <-ms.stop:
+					return
+				}
+			}
+		}()
+	})
+}
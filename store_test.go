@@ -0,0 +1,146 @@
+package gomemssn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// only the methods of Store, no cas or multi get
+type plainStore struct{ Store }
+
+func TestPlainStore(t *testing.T) {
+
+	ms := NewMemoryStore()
+	m := NewManager(nil, "test")
+	m.Store = plainStore{ms}
+	m.OnConflict = ConflictFail
+
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["a"] = "b"
+	m.MustWriteSession(w, s)
+	if ms.Len() != 1 || m.stub.Len() != 0 {
+		t.Fatalf("session not written to Store")
+	}
+	if err := ms.Touch(m.storeKey(s.Key), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: s.Cookie.Name, Value: s.Key})
+	s1 := m.MustSession(httptest.NewRecorder(), r)
+	s2 := m.MustSession(httptest.NewRecorder(), r)
+	if s1.Values["a"] != "b" {
+		t.Fatalf("bad value: %v", s1.Values["a"])
+	}
+	// without cas both writes go through
+	m.MustWriteSession(nil, s1)
+	m.MustWriteSession(nil, s2)
+
+	if err := m.Prefetch(context.Background(), []string{s.Key}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ms.Touch("nope", time.Minute); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+}
+
+func TestMemoryStoreExpiration(t *testing.T) {
+
+	ms := NewMemoryStore()
+	ms.JanitorInterval = time.Millisecond
+	defer ms.Stop()
+
+	ms.Set("a", []byte("a"), 5*time.Millisecond)
+	ms.Set("b", []byte("b"), 0)
+	if _, err := ms.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := ms.Get("a"); err != ErrNotFound {
+		t.Fatalf("expected expired entry to be gone but got %v", err)
+	}
+	if err := ms.Touch("a", time.Minute); err != ErrNotFound {
+		t.Fatalf("expired entries can't be touched")
+	}
+	if err := ms.CompareAndSwap("a", []byte("a2"), nil, time.Minute); err != nil {
+		t.Fatalf("expected add over an expired entry to work but got %v", err)
+	}
+	if ms.Len() != 2 {
+		t.Fatalf("expected 2 entries but got %d", ms.Len())
+	}
+
+	ms.Set("c", []byte("c"), time.Millisecond)
+	for i := 0; i < 100 && ms.Len() > 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if ms.Len() != 2 {
+		t.Fatalf("janitor didn't remove the expired entry")
+	}
+
+}
+
+func TestMemoryStoreLimits(t *testing.T) {
+
+	clock := newTestClock()
+	ms := NewMemoryStore()
+	ms.Now = clock.Now
+	ms.MaxEntries = 3
+	defer ms.Stop()
+
+	for _, k := range []string{"a", "b", "c"} {
+		ms.Set(k, []byte("data"), time.Minute)
+	}
+	// a was used last, so b is the one evicted
+	if _, err := ms.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	ms.Set("d", []byte("data"), time.Hour)
+	if _, err := ms.Get("b"); err != ErrNotFound {
+		t.Fatalf("expected b evicted, got %v", err)
+	}
+	for _, k := range []string{"a", "c", "d"} {
+		if _, err := ms.Get(k); err != nil {
+			t.Fatalf("expected %s kept: %v", k, err)
+		}
+	}
+
+	clock.Advance(2 * time.Minute)
+	st := ms.Stats()
+	if st.Entries != 3 || st.Expired != 2 || st.Evictions != 1 || st.Bytes < 3*int64(len("data")) {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	if n := ms.Sweep(); n != 2 || ms.Len() != 1 {
+		t.Fatalf("expected 2 entries swept, got %d and %d left", n, ms.Len())
+	}
+	ms.Delete("d")
+	if ms.Len() != 0 || ms.lru.Len() != 0 {
+		t.Fatalf("expected nothing left, got %d entries and %d in the LRU list", ms.Len(), ms.lru.Len())
+	}
+
+}
+
+func TestMemcacheExpiration(t *testing.T) {
+
+	now := time.Unix(1700000000, 0)
+	for _, c := range []struct {
+		ttl  time.Duration
+		want int32
+	}{
+		{0, 0},
+		{90 * time.Second, 90},
+		{maxRelativeExpiration, 2592000},
+		{maxRelativeExpiration + time.Second, 1700000000 + 2592001},
+		{90 * 24 * time.Hour, 1700000000 + 7776000},
+	} {
+		if got := memcacheExpiration(c.ttl, now); got != c.want {
+			t.Errorf("%v: expected %d but got %d", c.ttl, c.want, got)
+		}
+	}
+
+}
@@ -0,0 +1,137 @@
+package gomemssn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Errors from Manager methods which went to the backing store fall into
+// classes that can be told apart with errors.Is: ErrNotFound (nothing
+// stored under the key), ErrStoreUnavailable (the store failed, see
+// StoreError, which also gives the store's own error with errors.As) and
+// ErrDecodeFailed (the data is there but unreadable, see DecodeError).
+
+var (
+	ErrStoreUnavailable = errors.New("gomemssn: backing store unavailable")
+	ErrDecodeFailed     = errors.New("gomemssn: session can't be decoded")
+)
+
+// StoreError is a failure of the backing store (unreachable, timed out,
+// refused the request...), it matches ErrStoreUnavailable
+type StoreError struct {
+	Op  string // the Store method, e.g. "Get"
+	Err error  // what the store returned
+}
+
+func (e *StoreError) Error() string {
+	return "gomemssn: backing store " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StoreError) Is(target error) bool {
+	return target == ErrStoreUnavailable
+}
+
+// wrapStoreError returns err from the store operation op as a StoreError,
+// unless it is one of the normal outcomes (ErrNotFound, ErrCASConflict), the
+// context of the request running out, or a StoreError already
+func wrapStoreError(op string, err error) error {
+	switch err {
+	case nil, ErrNotFound, ErrCASConflict:
+		return err
+	}
+	var se *StoreError
+	if errors.As(err, &se) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &StoreError{Op: op, Err: err}
+}
+
+// storeOp is the hookStore hook of store(): it reports to Metrics and wraps
+// failures in StoreError
+func (m *Manager) storeOp(op string, f func() error) error {
+	var err error
+	if m.Metrics != nil {
+		err = m.timeStoreOp(op, f)
+	} else {
+		err = f()
+	}
+	return wrapStoreError(op, err)
+}
+
+// StoreErrorPolicy says what Session does when the session can't be read
+// from the backing store (memcache is down, SessionCtx timed out...)
+type StoreErrorPolicy int
+
+const (
+	FailClosed           StoreErrorPolicy = iota // return the error, the default
+	FailOpenEmptySession                         // log it and carry on with an empty session which is never written, so the stored one is left alone
+	FallbackToLocalCache                         // like FailOpenEmptySession, but with the session from the local cache if it has it, however old (see LocalCacheAll)
+)
+
+// storeError applies OnStoreError to the failed read of key, returning the
+// session to carry on with or nil to fail the request
+func (m *Manager) storeError(r *http.Request, key string, err error) *Session {
+
+	if m.OnStoreError == FailClosed {
+		return nil
+	}
+	m.logger().Warn("reading session failed, carrying on without it", "path", r.URL.Path, "err", err)
+
+	s := m.newSession(key)
+	if m.OnStoreError == FallbackToLocalCache {
+		if l := m.cacheStale(key); l != nil {
+			s.Values, s.Meta, s.raw = l.rec.Values, l.rec.Meta, l.rec.raw
+		}
+	}
+	// what's in the store may be newer, don't overwrite it
+	s.skipped = true
+	return s
+
+}
+
+// DecodeError is returned for a session which was read from the backing
+// store but can't be decoded (it is corrupt, or from an incompatible version
+// of the application), it matches ErrDecodeFailed.  Unless FailOnDecodeError is set, Session deletes
+// such sessions and starts over with a new one, reporting the error to
+// OnDecodeError.
+type DecodeError struct {
+	SessionID string // see SessionID
+	Err       error
+}
+
+func (e *DecodeError) Error() string {
+	return "gomemssn: decoding session: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrDecodeFailed
+}
+
+// corrupt deletes the session key which couldn't be decoded and returns a
+// new session to use instead (a detached one if r can't get a new session)
+func (m *Manager) corrupt(r *http.Request, key string, de *DecodeError) (*Session, error) {
+	de.SessionID = SessionID(key)
+	if m.OnDecodeError != nil {
+		m.OnDecodeError(r, de)
+	} else {
+		m.logger().Warn("replacing session which can't be decoded", "session_id", de.SessionID, "err", de.Err)
+	}
+	if !m.ReadOnly() {
+		if err := m.delSession(key); err != nil {
+			return nil, err
+		}
+	}
+	if m.noCookie(r) {
+		return m.skippedSession(), nil
+	}
+	return m.freshSession()
+}
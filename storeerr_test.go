@@ -0,0 +1,103 @@
+package gomemssn
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// a store which can be switched off
+type downStore struct {
+	*MemoryStore
+	down *bool
+}
+
+func (ds downStore) GetCAS(key string) ([]byte, interface{}, error) {
+	if *ds.down {
+		return nil, nil, errors.New("store is down")
+	}
+	return ds.MemoryStore.GetCAS(key)
+}
+
+func TestOnStoreError(t *testing.T) {
+
+	down := false
+	m := NewManager(nil, "gomemssn_test")
+	m.Store = downStore{MemoryStore: NewMemoryStore(), down: &down}
+	m.LocalCacheTTL = time.Nanosecond
+	m.LocalCacheAll = true
+
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+
+	newReq := func() *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: s.Key})
+		return r
+	}
+	down = true
+
+	m.OnStoreError = FallbackToLocalCache
+	s2, err := m.Session(httptest.NewRecorder(), newReq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2.Values.GetString("v") != "abc123" || !s2.ReadOnly() {
+		t.Fatalf("expected the cached session but got %v", s2.Values)
+	}
+
+	m.OnStoreError = FailOpenEmptySession
+	s2, err = m.Session(httptest.NewRecorder(), newReq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s2.Values) != 0 || !s2.ReadOnly() || s2.Key != s.Key {
+		t.Fatalf("expected an empty read-only session but got %v", s2.Values)
+	}
+	s2.Values["v"] = "overwritten"
+	m.MustWriteSession(nil, s2)
+
+	m.OnStoreError = FailClosed
+	_, err = m.Session(httptest.NewRecorder(), newReq())
+	var se *StoreError
+	if !errors.Is(err, ErrStoreUnavailable) || !errors.As(err, &se) || se.Op != "GetCAS" || se.Err.Error() != "store is down" {
+		t.Fatalf("expected a StoreError with FailClosed but got %v", err)
+	}
+
+	down = false
+	if s2 = loadTestSession(t, m, s.Key); s2.Values.GetString("v") != "abc123" {
+		t.Fatalf("stored session was changed: %v", s2.Values)
+	}
+
+}
+
+func TestDecodeError(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	var reported *DecodeError
+	m.OnDecodeError = func(r *http.Request, err *DecodeError) { reported = err }
+
+	key, _ := m.newKey()
+	m.stub.Set(m.storeKey(key), []byte("garbage"), 0)
+
+	s := loadTestSession(t, m, key)
+	if s.Key == key || reported == nil || reported.SessionID != SessionID(key) {
+		t.Fatalf("expected a new session and the error reported, got %q %v", s.Key, reported)
+	}
+	if _, _, err := m.get(key); err != ErrNotFound {
+		t.Fatalf("expected the bad entry to be deleted, got %v", err)
+	}
+
+	m.stub.Set(m.storeKey(key), []byte("garbage"), 0)
+	m.FailOnDecodeError = true
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: m.TemplateCookie.Name, Value: key})
+	var de *DecodeError
+	if _, err := m.Session(httptest.NewRecorder(), r); !errors.As(err, &de) || !errors.Is(err, ErrDecodeFailed) {
+		t.Fatalf("expected a DecodeError but got %v", err)
+	}
+
+}
@@ -0,0 +1,110 @@
+package gomemssn
+
+import (
+	"time"
+)
+
+// hookStore runs each operation of st through do (op is the name of the
+// method), for deadlines and instrumentation.  It passes the optional
+// interfaces of st through; on stores without them it behaves the same as
+// the plain Store methods.
+type hookStore struct {
+	st Store
+	do func(op string, f func() error) error
+}
+
+// unwrapStore returns the store under any hookStores
+func unwrapStore(st Store) Store {
+	for {
+		hs, ok := st.(hookStore)
+		if !ok {
+			return st
+		}
+		st = hs.st
+	}
+}
+
+func (hs hookStore) Get(key string) (data []byte, err error) {
+	err = hs.do("Get", func() (err error) {
+		data, err = hs.st.Get(key)
+		return err
+	})
+	return data, err
+}
+
+func (hs hookStore) Set(key string, data []byte, ttl time.Duration) error {
+	return hs.do("Set", func() error { return hs.st.Set(key, data, ttl) })
+}
+
+func (hs hookStore) Delete(key string) error {
+	return hs.do("Delete", func() error { return hs.st.Delete(key) })
+}
+
+func (hs hookStore) Touch(key string, ttl time.Duration) error {
+	return hs.do("Touch", func() error { return hs.st.Touch(key, ttl) })
+}
+
+func (hs hookStore) GetCAS(key string) (data []byte, token interface{}, err error) {
+	c, ok := hs.st.(CASStore)
+	if !ok {
+		data, err = hs.Get(key)
+		return data, nil, err
+	}
+	err = hs.do("GetCAS", func() (err error) {
+		data, token, err = c.GetCAS(key)
+		return err
+	})
+	return data, token, err
+}
+
+func (hs hookStore) CompareAndSwap(key string, data []byte, token interface{}, ttl time.Duration) error {
+	c, ok := hs.st.(CASStore)
+	if !ok {
+		return hs.Set(key, data, ttl)
+	}
+	return hs.do("CompareAndSwap", func() error { return c.CompareAndSwap(key, data, token, ttl) })
+}
+
+func (hs hookStore) GetMulti(keys []string) (items map[string]*StoreItem, err error) {
+	ms, ok := hs.st.(MultiGetStore)
+	if !ok {
+		items = make(map[string]*StoreItem, len(keys))
+		for _, key := range keys {
+			data, token, err := hs.GetCAS(key)
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			items[key] = &StoreItem{Data: data, CAS: token}
+		}
+		return items, nil
+	}
+	err = hs.do("GetMulti", func() (err error) {
+		items, err = ms.GetMulti(keys)
+		return err
+	})
+	return items, err
+}
+
+// Tx runs the whole transaction through do, f gets the store of the
+// transaction as it is
+func (hs hookStore) Tx(f func(Store) error) error {
+	ts, ok := hs.st.(TxStore)
+	if !ok {
+		return f(hs)
+	}
+	return hs.do("Tx", func() error { return ts.Tx(f) })
+}
+
+func (hs hookStore) Incr(key string, delta int64, ttl time.Duration) (n int64, err error) {
+	is, ok := hs.st.(IncrStore)
+	if !ok {
+		return casIncr(hs, key, delta, ttl)
+	}
+	err = hs.do("Incr", func() (err error) {
+		n, err = is.Incr(key, delta, ttl)
+		return err
+	})
+	return n, err
+}
@@ -0,0 +1,314 @@
+// Package storetest checks that a gomemssn.Store behaves the way Manager
+// relies on, for testing backends other than the ones in gomemssn:
+//
+//	func TestStore(t *testing.T) {
+//		st := mystore.New(...)
+//		storetest.TestStore(t, st)
+//		storetest.TestExpiration(t, st, func(d time.Duration) { time.Sleep(d) })
+//	}
+//
+// The CASStore, MultiGetStore, IncrStore, TTLStore and TxStore behaviour is checked too if st implements
+// them.  Keys are made unique to each run, so a shared server can be used.
+package storetest
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bradleypeabody/gomemssn"
+)
+
+// keyPrefix returns a prefix for the keys of one run
+func keyPrefix(t *testing.T) string {
+	b := make([]byte, 6)
+	if _, err := crand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return "storetest:" + hex.EncodeToString(b) + ":"
+}
+
+func expectData(t *testing.T, st gomemssn.Store, key string, want []byte) {
+	t.Helper()
+	data, err := st.Get(key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("Get(%q) = %q, want %q", key, data, want)
+	}
+}
+
+func expectNotFound(t *testing.T, st gomemssn.Store, key string) {
+	t.Helper()
+	if _, err := st.Get(key); err != gomemssn.ErrNotFound {
+		t.Fatalf("Get(%q): expected ErrNotFound but got %v", key, err)
+	}
+}
+
+// TestStore checks getting, setting, deleting and touching keys, and compare
+// and swap, multi gets, counters and ttls if st does them
+func TestStore(t *testing.T, st gomemssn.Store) {
+
+	p := keyPrefix(t)
+
+	t.Run("Basic", func(t *testing.T) {
+		k := p + "basic"
+		expectNotFound(t, st, k)
+		if err := st.Set(k, []byte("one"), time.Hour); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		expectData(t, st, k, []byte("one"))
+		if err := st.Set(k, []byte("two"), time.Hour); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		expectData(t, st, k, []byte("two"))
+		if err := st.Touch(k, time.Hour); err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+		expectData(t, st, k, []byte("two"))
+		if err := st.Delete(k); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		expectNotFound(t, st, k)
+		if err := st.Delete(k); err != nil {
+			t.Fatalf("Delete of a missing key: %v", err)
+		}
+		if err := st.Touch(k, time.Hour); err != gomemssn.ErrNotFound {
+			t.Fatalf("Touch of a missing key: expected ErrNotFound but got %v", err)
+		}
+	})
+
+	t.Run("Binary", func(t *testing.T) {
+		k := p + "binary"
+		data := make([]byte, 256)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		if err := st.Set(k, data, time.Hour); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		expectData(t, st, k, data)
+	})
+
+	if cs, ok := st.(gomemssn.CASStore); ok {
+		t.Run("CompareAndSwap", func(t *testing.T) { testCAS(t, cs, p+"cas") })
+	}
+	if ms, ok := st.(gomemssn.MultiGetStore); ok {
+		t.Run("GetMulti", func(t *testing.T) { testGetMulti(t, ms, p+"multi") })
+	}
+	if is, ok := st.(gomemssn.IncrStore); ok {
+		t.Run("Incr", func(t *testing.T) { testIncr(t, is, p+"incr") })
+	}
+	if ts, ok := st.(gomemssn.TTLStore); ok {
+		t.Run("TTL", func(t *testing.T) { testTTL(t, ts, p+"ttl") })
+	}
+	if ts, ok := st.(gomemssn.TxStore); ok {
+		t.Run("Tx", func(t *testing.T) { testTx(t, ts, p+"tx") })
+	}
+
+}
+
+func testCAS(t *testing.T, st gomemssn.CASStore, k string) {
+
+	if _, _, err := st.GetCAS(k); err != gomemssn.ErrNotFound {
+		t.Fatalf("GetCAS of a missing key: expected ErrNotFound but got %v", err)
+	}
+	// a nil token adds
+	if err := st.CompareAndSwap(k, []byte("one"), nil, time.Hour); err != nil {
+		t.Fatalf("CompareAndSwap adding: %v", err)
+	}
+	if err := st.CompareAndSwap(k, []byte("two"), nil, time.Hour); err != gomemssn.ErrCASConflict {
+		t.Fatalf("CompareAndSwap adding an existing key: expected ErrCASConflict but got %v", err)
+	}
+	expectData(t, st, k, []byte("one"))
+
+	data, token, err := st.GetCAS(k)
+	if err != nil || string(data) != "one" {
+		t.Fatalf("GetCAS = %q, %v", data, err)
+	}
+	if err := st.CompareAndSwap(k, []byte("two"), token, time.Hour); err != nil {
+		t.Fatalf("CompareAndSwap: %v", err)
+	}
+	expectData(t, st, k, []byte("two"))
+	if err := st.CompareAndSwap(k, []byte("three"), token, time.Hour); err != gomemssn.ErrCASConflict {
+		t.Fatalf("CompareAndSwap with a stale token: expected ErrCASConflict but got %v", err)
+	}
+
+	// a plain set makes tokens stale too
+	_, token, _ = st.GetCAS(k)
+	if err := st.Set(k, []byte("four"), time.Hour); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := st.CompareAndSwap(k, []byte("five"), token, time.Hour); err != gomemssn.ErrCASConflict {
+		t.Fatalf("CompareAndSwap after a Set: expected ErrCASConflict but got %v", err)
+	}
+
+	_, token, _ = st.GetCAS(k)
+	if err := st.Delete(k); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := st.CompareAndSwap(k, []byte("six"), token, time.Hour); err != gomemssn.ErrCASConflict {
+		t.Fatalf("CompareAndSwap of a deleted key: expected ErrCASConflict but got %v", err)
+	}
+	expectNotFound(t, st, k)
+
+}
+
+func testGetMulti(t *testing.T, st gomemssn.MultiGetStore, p string) {
+
+	for _, k := range []string{"a", "b"} {
+		if err := st.Set(p+k, []byte(k), time.Hour); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	items, err := st.GetMulti([]string{p + "a", p + "b", p + "missing"})
+	if err != nil {
+		t.Fatalf("GetMulti: %v", err)
+	}
+	if len(items) != 2 || items[p+"a"] == nil || string(items[p+"b"].Data) != "b" {
+		t.Fatalf("GetMulti: unexpected result %v", items)
+	}
+
+	// the tokens work with CompareAndSwap
+	if cs, ok := st.(gomemssn.CASStore); ok {
+		if err := cs.CompareAndSwap(p+"a", []byte("a2"), items[p+"a"].CAS, time.Hour); err != nil {
+			t.Fatalf("CompareAndSwap with a GetMulti token: %v", err)
+		}
+		expectData(t, st, p+"a", []byte("a2"))
+	}
+
+}
+
+func testIncr(t *testing.T, st gomemssn.IncrStore, k string) {
+
+	for _, c := range []struct{ delta, want int64 }{{2, 2}, {3, 5}, {-1, 4}, {-10, 0}, {1, 1}} {
+		if n, err := st.Incr(k, c.delta, time.Hour); err != nil || n != c.want {
+			t.Fatalf("Incr(%d) = %d, %v, want %d", c.delta, n, err, c.want)
+		}
+	}
+	expectData(t, st, k, []byte("1"))
+
+}
+
+func testTTL(t *testing.T, st gomemssn.TTLStore, k string) {
+
+	if _, err := st.TTL(k); err != gomemssn.ErrNotFound {
+		t.Fatalf("TTL of a missing key: expected ErrNotFound but got %v", err)
+	}
+	if err := st.Set(k, []byte("x"), time.Hour); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	// memcache and others only keep whole seconds
+	if ttl, err := st.TTL(k); err != nil || ttl <= time.Hour-time.Minute || ttl > time.Hour {
+		t.Fatalf("TTL = %v, %v, want about an hour", ttl, err)
+	}
+	if err := st.Set(k, []byte("x"), 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if ttl, err := st.TTL(k); err != nil || ttl != 0 {
+		t.Fatalf("TTL of a key which doesn't expire = %v, %v, want 0", ttl, err)
+	}
+
+}
+
+func testTx(t *testing.T, st gomemssn.TxStore, p string) {
+
+	a, b := p+"a", p+"b"
+	set := func(tx gomemssn.Store) error {
+		if err := tx.Set(a, []byte("one"), time.Hour); err != nil {
+			return err
+		}
+		return tx.Set(b, []byte("one"), time.Hour)
+	}
+
+	failed := errors.New("failed")
+	if err := st.Tx(func(tx gomemssn.Store) error { set(tx); return failed }); err != failed {
+		t.Fatalf("Tx failing: expected its error but got %v", err)
+	}
+	expectNotFound(t, st, a)
+	expectNotFound(t, st, b)
+	if err := st.Tx(set); err != nil {
+		t.Fatalf("Tx: %v", err)
+	}
+	expectData(t, st, a, []byte("one"))
+	expectData(t, st, b, []byte("one"))
+
+	cs, ok := st.(gomemssn.CASStore)
+	if !ok {
+		return
+	}
+	cas := func(tx gomemssn.Store, token interface{}) error {
+		c, ok := tx.(gomemssn.CASStore)
+		if !ok {
+			t.Fatal("the store of a transaction of a CASStore is no CASStore")
+		}
+		if err := c.CompareAndSwap(a, []byte("two"), token, time.Hour); err != nil {
+			return err
+		}
+		return tx.Delete(b)
+	}
+
+	// a conflict makes none of the changes
+	_, token, _ := cs.GetCAS(a)
+	if err := st.Set(a, []byte("other"), time.Hour); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := st.Tx(func(tx gomemssn.Store) error { return cas(tx, token) }); err != gomemssn.ErrCASConflict {
+		t.Fatalf("Tx with a stale token: expected ErrCASConflict but got %v", err)
+	}
+	expectData(t, st, a, []byte("other"))
+	expectData(t, st, b, []byte("one"))
+
+	// read in the transaction
+	err := st.Tx(func(tx gomemssn.Store) error {
+		_, token, err := tx.(gomemssn.CASStore).GetCAS(a)
+		if err != nil {
+			return err
+		}
+		return cas(tx, token)
+	})
+	if err != nil {
+		t.Fatalf("Tx: %v", err)
+	}
+	expectData(t, st, a, []byte("two"))
+	expectNotFound(t, st, b)
+
+}
+
+// TestExpiration checks that entries expire after their ttl, that Touch
+// extends it and that a ttl of 0 means never.  wait is called to let time
+// pass, time.Sleep for a real backend or advancing a fake clock.  Expiration
+// is tested in seconds, as memcache has no finer resolution.
+func TestExpiration(t *testing.T, st gomemssn.Store, wait func(d time.Duration)) {
+
+	p := keyPrefix(t)
+	for k, ttl := range map[string]time.Duration{"short": time.Second, "touched": time.Second, "never": 0} {
+		if err := st.Set(p+k, []byte(k), ttl); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	if err := st.Touch(p+"touched", time.Hour); err != nil {
+		t.Fatalf("Touch: %v", err)
+	}
+
+	wait(2 * time.Second)
+
+	expectNotFound(t, st, p+"short")
+	if err := st.Touch(p+"short", time.Hour); err != gomemssn.ErrNotFound {
+		t.Fatalf("Touch of an expired key: expected ErrNotFound but got %v", err)
+	}
+	expectData(t, st, p+"touched", []byte("touched"))
+	expectData(t, st, p+"never", []byte("never"))
+
+	if cs, ok := st.(gomemssn.CASStore); ok {
+		if err := cs.CompareAndSwap(p+"short", []byte("again"), nil, time.Hour); err != nil {
+			t.Fatalf("CompareAndSwap adding over an expired key: %v", err)
+		}
+		expectData(t, st, p+"short", []byte("again"))
+	}
+
+}
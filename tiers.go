@@ -0,0 +1,104 @@
+package gomemssn
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sessions come in two tiers: anonymous ones, which every visitor gets and
+// which can be kept short (Expiration), and authenticated ones (see
+// Session.IsAuthenticated), which can have their own lifetime, cookie
+// attributes and key prefix.  MarkAuthenticated moves a session up, the
+// move happens with its next WriteSession, which gives it a new key.
+
+// MarkAuthenticated signs userID in to the session: it ties it to the user
+// (SetUserID), records the authentication (RecordAuthentication) and moves it
+// to the authenticated tier (AuthenticatedExpiration, AuthenticatedCookie,
+// AuthenticatedKeyPrefix).  The next WriteSession with a ResponseWriter
+// gives the session a new key like RegenerateSession, as is due at login.
+// With ScrubOnLogin the values are cleared first.
+func (s *Session) MarkAuthenticated(userID string) {
+	if s.m != nil {
+		s.m.scrubOnLogin(s)
+	}
+	s.SetUserID(userID)
+	s.RecordAuthentication()
+	s.promote = true
+}
+
+// authenticated reports whether s is in the authenticated tier
+func (m *Manager) authenticated(s *Session) bool {
+	return s != nil && s.IsAuthenticated()
+}
+
+// expiration returns how long s is kept in the backing store
+func (m *Manager) expiration(s *Session) time.Duration {
+	if m.AuthenticatedExpiration > 0 && m.authenticated(s) {
+		return m.AuthenticatedExpiration
+	}
+	return m.Expiration
+}
+
+// maxExpiration is the longest any session is kept
+func (m *Manager) maxExpiration() time.Duration {
+	if m.AuthenticatedExpiration > m.Expiration {
+		return m.AuthenticatedExpiration
+	}
+	return m.Expiration
+}
+
+// keyExpiration is expiration for a session of which only the key is known:
+// the tier goes by AuthenticatedKeyPrefix if set, otherwise it is the longer
+// of the two, so no session is cut short
+func (m *Manager) keyExpiration(key string) time.Duration {
+	if m.AuthenticatedExpiration <= 0 {
+		return m.Expiration
+	}
+	if m.AuthenticatedKeyPrefix == "" {
+		return m.maxExpiration()
+	}
+	if strings.HasPrefix(key, m.AuthenticatedKeyPrefix) {
+		return m.AuthenticatedExpiration
+	}
+	return m.Expiration
+}
+
+// tierKey returns a new key for s, with AuthenticatedKeyPrefix if it is
+// authenticated
+func (m *Manager) tierKey(s *Session) (string, error) {
+	key, err := m.newKey()
+	if err != nil {
+		return "", err
+	}
+	if m.authenticated(s) {
+		key = m.AuthenticatedKeyPrefix + key
+	}
+	return key, nil
+}
+
+// sessionCookie sets up the cookie of s for r (without its value): a copy of
+// TemplateCookie, or AuthenticatedCookie for authenticated sessions
+func (m *Manager) sessionCookie(r *http.Request, s *Session) {
+	s.cookie = *m.TemplateCookie
+	if m.AuthenticatedCookie != nil && m.authenticated(s) {
+		s.cookie = *m.AuthenticatedCookie
+		s.cookie.Name = m.TemplateCookie.Name
+	}
+	if r != nil {
+		m.requestCookie(r, &s.cookie)
+	}
+	if m.cookieFollowsExpiration() {
+		exp := m.expiration(s)
+		s.cookie.MaxAge = int(exp / time.Second)
+		s.cookie.Expires = m.now().Add(exp)
+	}
+	s.Cookie = &s.cookie
+}
+
+// promote moves s, marked with MarkAuthenticated, to the authenticated tier
+func (m *Manager) promote(w http.ResponseWriter, s *Session) error {
+	s.promote = false
+	m.sessionCookie(s.req, s)
+	return m.regenerate(w, s.req, s, 0, "authenticated")
+}
@@ -0,0 +1,52 @@
+package gomemssn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarkAuthenticated(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.Expiration = 10 * time.Minute
+	m.AuthenticatedExpiration = 24 * time.Hour
+	m.AuthenticatedCookie = &http.Cookie{Name: "ignored", Path: "/", HttpOnly: true, MaxAge: 86400}
+	m.AuthenticatedKeyPrefix = "auth-"
+
+	s := loadTestSession(t, m, "")
+	s.Values["v"] = "abc123"
+	m.MustWriteSession(nil, s)
+	if d := time.Until(s.Meta.ExpiresAt); d > 10*time.Minute {
+		t.Fatalf("expected an anonymous session to expire within Expiration, got %v", d)
+	}
+	oldKey := s.Key
+
+	s.MarkAuthenticated("joe")
+	w := httptest.NewRecorder()
+	m.MustWriteSession(w, s)
+	if s.Key == oldKey || !strings.HasPrefix(s.Key, "auth-") {
+		t.Fatalf("expected a new key with the prefix, got %q", s.Key)
+	}
+	if _, err := m.GetSessionByKey(oldKey); err != ErrNotFound {
+		t.Fatalf("expected the old key to be gone, got %v", err)
+	}
+	if d := time.Until(s.Meta.ExpiresAt); d < time.Hour {
+		t.Fatalf("expected an authenticated session to last AuthenticatedExpiration, got %v", d)
+	}
+	cs := w.Result().Cookies()
+	if len(cs) == 0 || cs[len(cs)-1].Name != m.TemplateCookie.Name || cs[len(cs)-1].MaxAge != 86400 {
+		t.Fatalf("expected the cookie from AuthenticatedCookie, got %v", cs)
+	}
+
+	s2, err := m.GetSessionByKey(s.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2.Meta.UserID != "joe" || !s2.IsAuthenticated() || s2.Values["v"] != "abc123" {
+		t.Fatalf("unexpected session after the promotion: %+v %v", s2.Meta, s2.Values)
+	}
+
+}
@@ -0,0 +1,78 @@
+package gomemssn
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Clients which don't keep cookies (mobile apps, SPAs calling an API) can
+// carry the session key in a header instead, see Manager.TokenHeader.  The
+// token is exactly what the cookie value would be, so it is signed and
+// encrypted the same way, and sessions work the same whichever way they
+// come in.
+
+// TokenResponseHeader is the response header the token is sent back in when
+// TokenHeader is Authorization (which only makes sense in requests)
+const TokenResponseHeader = "X-Session-Token"
+
+// requestToken returns the session token of r: the TokenHeader if it has
+// one, otherwise the cookie value (unless TokenOnly, see cookieToken for
+// more than one cookie); "" if there is none
+func (m *Manager) requestToken(r *http.Request) string {
+	if m.TokenHeader != "" {
+		v := r.Header.Get(m.TokenHeader)
+		if strings.EqualFold(m.TokenHeader, "Authorization") {
+			scheme, token, ok := strings.Cut(v, " ")
+			v = ""
+			if ok && strings.EqualFold(scheme, "Bearer") {
+				v = strings.TrimSpace(token)
+			}
+		}
+		if v != "" || m.TokenOnly {
+			return v
+		}
+	}
+	return m.cookieToken(r)
+}
+
+// tokenResponseHeader is the header the token goes back to the client in
+func (m *Manager) tokenResponseHeader() string {
+	if strings.EqualFold(m.TokenHeader, "Authorization") {
+		return TokenResponseHeader
+	}
+	return m.TokenHeader
+}
+
+// sendCookie sends the session cookie c to the client, as a cookie and/or
+// in the token header; a cookie which expires it clears the header
+func (m *Manager) sendCookie(w http.ResponseWriter, c *http.Cookie) {
+	if !m.TokenOnly {
+		setCookie(w, c)
+	}
+	if m.TokenHeader != "" {
+		v := c.Value
+		if c.MaxAge < 0 {
+			v = ""
+		}
+		w.Header().Set(m.tokenResponseHeader(), v)
+	}
+}
+
+// unsendCookie takes back what sendCookie put in h for the cookie name
+func (m *Manager) unsendCookie(h http.Header, name string) {
+	dropCookie(h, name)
+	if m.TokenHeader != "" {
+		h.Del(m.tokenResponseHeader())
+	}
+}
+
+// varyOn is the request header responses which use the session depend on
+func (m *Manager) varyOn() []string {
+	switch {
+	case m.TokenHeader == "":
+		return []string{"Cookie"}
+	case m.TokenOnly:
+		return []string{m.TokenHeader}
+	}
+	return []string{"Cookie", m.TokenHeader}
+}
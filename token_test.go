@@ -0,0 +1,52 @@
+package gomemssn
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenHeader(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.TokenHeader = "Authorization"
+	m.TokenOnly = true
+
+	w := httptest.NewRecorder()
+	s := m.MustSession(w, httptest.NewRequest("GET", "/", nil))
+	s.Values["v"] = "abc"
+	m.MustWriteSession(w, s)
+	token := w.Header().Get(TokenResponseHeader)
+	if token == "" || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("expected the token in the header and no cookie, got %q %v", token, w.Result().Cookies())
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	s2 := m.MustSession(httptest.NewRecorder(), r)
+	if s2.Key != s.Key || s2.Values["v"] != "abc" {
+		t.Fatalf("expected the session back from the token, got %q %v", s2.Key, s2.Values)
+	}
+	if m.RequestKey(r) != s.Key {
+		t.Fatalf("expected RequestKey to read the token")
+	}
+
+	// cookies are ignored with TokenOnly, and used as well without it
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(s.Cookie)
+	if s3 := m.MustSession(httptest.NewRecorder(), r); s3.Key == s.Key {
+		t.Fatalf("expected the cookie to be ignored")
+	}
+	m.TokenOnly = false
+	if s3 := m.MustSession(httptest.NewRecorder(), r); s3.Key != s.Key {
+		t.Fatalf("expected the cookie to be used")
+	}
+
+	w = httptest.NewRecorder()
+	if err := m.DestroySession(w, s2); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := w.Header()[TokenResponseHeader]; !ok || v[0] != "" {
+		t.Fatalf("expected an empty token after destroying the session, got %v", v)
+	}
+
+}
@@ -0,0 +1,108 @@
+package gomemssn
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer makes spans for what a Manager does, so session latency shows up
+// in distributed traces along with the rest of the request: Session,
+// WriteSession and DestroySession each get a span (a child of the one in
+// the request context), with children for decoding and for every round trip
+// to the backing store.  See the otelsession package for OpenTelemetry.
+type Tracer interface {
+	// Start starts the span name as a child of the one in ctx
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	SetAttribute(key string, value interface{}) // value is a string, int or bool
+	End(err error)                              // err is what the operation failed with, nil if it didn't
+}
+
+// Attributes put on spans
+const (
+	AttrSource = "gomemssn.source" // of Session spans, where the session came from, as in DebugHeader (hit, miss, new...)
+	AttrSize   = "gomemssn.size"   // bytes read (Session) or written (WriteSession)
+	AttrHit    = "gomemssn.hit"    // of store Get spans, whether the key was found
+)
+
+type noSpan struct{}
+
+func (noSpan) SetAttribute(key string, value interface{}) {}
+func (noSpan) End(err error)                              {}
+
+// tracing is what a traced copy of a Manager works under
+type tracing struct {
+	ctx  context.Context
+	span Span
+}
+
+// traced starts the span name under ctx and returns a copy of m which makes
+// its children, or m and a span which does nothing if there is no Tracer
+func (m *Manager) traced(ctx context.Context, name string) (*Manager, Span) {
+	if m.Tracer == nil || m.trace != nil {
+		return m, noSpan{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := m.Tracer.Start(ctx, name)
+	m2 := *m
+	m2.trace = &tracing{ctx: ctx, span: span}
+	m2.Store = hookStore{st: m.baseStore(), do: m2.traceStoreOp}
+	return &m2, span
+}
+
+// span starts a child of the span m is traced under, see traced
+func (m *Manager) span(name string) Span {
+	if m.trace == nil {
+		return noSpan{}
+	}
+	_, span := m.Tracer.Start(m.trace.ctx, name)
+	return span
+}
+
+// setAttribute sets an attribute of the span m is traced under
+func (m *Manager) setAttribute(key string, value interface{}) {
+	if m.trace != nil {
+		m.trace.span.SetAttribute(key, value)
+	}
+}
+
+// traceStoreOp is the hookStore hook of traced Managers
+func (m *Manager) traceStoreOp(op string, f func() error) error {
+	span := m.span("gomemssn.store." + op)
+	err := f()
+	switch op {
+	case "Get", "GetCAS":
+		span.SetAttribute(AttrHit, err == nil)
+	}
+	if err == ErrNotFound || err == ErrCASConflict {
+		// normal outcomes
+		span.End(nil)
+	} else {
+		span.End(err)
+	}
+	return err
+}
+
+// requestContext returns the context of the request s was loaded for
+func (s *Session) requestContext() context.Context {
+	if s.req == nil {
+		return context.Background()
+	}
+	return s.req.Context()
+}
+
+// tracedSession is Session with a span
+func (m *Manager) tracedSession(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	tm, span := m.traced(r.Context(), "gomemssn.Session")
+	s, err := tm.Session(w, r)
+	if s != nil {
+		s.m = m
+	}
+	span.End(err)
+	return s, err
+}
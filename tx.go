@@ -0,0 +1,33 @@
+package gomemssn
+
+// With a Store which is a TxStore, a session and its entry in its user's
+// index (see users.go) are written in one transaction, and DestroySession
+// removes the session and its index entry in one, so a crash in between
+// can't leave an index listing a session which is gone or missing one which
+// isn't.  Other stores write the session first and the index after it.
+
+// transactional reports whether the backing store is a TxStore
+func (m *Manager) transactional() bool {
+	_, ok := unwrapStore(m.baseStore()).(TxStore)
+	return ok
+}
+
+// tx calls f with a copy of m whose store changes are made in one
+// transaction, or with m itself if the backing store isn't a TxStore
+func (m *Manager) tx(f func(tm *Manager) error) error {
+	if !m.transactional() {
+		return f(m)
+	}
+	var ferr error
+	err := hookStore{st: m.baseStore(), do: m.storeOp}.Tx(func(st Store) error {
+		tm := *m
+		tm.Store = st
+		ferr = f(&tm)
+		return ferr
+	})
+	if ferr != nil {
+		// already wrapped by the store of tm, or not from the store at all
+		return ferr
+	}
+	return err
+}
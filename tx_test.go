@@ -0,0 +1,105 @@
+package gomemssn
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// txStore queues the changes of a transaction and makes them when it
+// commits, or fails the commit with fail; not for concurrent use
+type txStore struct {
+	*MemoryStore
+	fail error
+	txs  int
+}
+
+type queuedStore struct {
+	*MemoryStore
+	ops []func() error
+}
+
+func (qs *queuedStore) Set(key string, data []byte, ttl time.Duration) error {
+	qs.ops = append(qs.ops, func() error { return qs.MemoryStore.Set(key, data, ttl) })
+	return nil
+}
+
+func (qs *queuedStore) CompareAndSwap(key string, data []byte, token interface{}, ttl time.Duration) error {
+	qs.ops = append(qs.ops, func() error { return qs.MemoryStore.CompareAndSwap(key, data, token, ttl) })
+	return nil
+}
+
+func (qs *queuedStore) Delete(key string) error {
+	qs.ops = append(qs.ops, func() error { return qs.MemoryStore.Delete(key) })
+	return nil
+}
+
+func (qs *queuedStore) Touch(key string, ttl time.Duration) error {
+	qs.ops = append(qs.ops, func() error { qs.MemoryStore.Touch(key, ttl); return nil })
+	return nil
+}
+
+func (ts *txStore) Tx(f func(Store) error) error {
+	qs := &queuedStore{MemoryStore: ts.MemoryStore}
+	if err := f(qs); err != nil {
+		return err
+	}
+	ts.txs++
+	if ts.fail != nil {
+		return ts.fail
+	}
+	for _, op := range qs.ops {
+		if err := op(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestTxStore(t *testing.T) {
+
+	ts := &txStore{MemoryStore: NewMemoryStore()}
+	m := NewManager(nil, "gomemssn_test")
+	m.Store = ts
+
+	indexed := func(key string) bool {
+		data, _, err := m.get(userIndexKey("u1"))
+		if err != nil && err != ErrNotFound {
+			t.Fatal(err)
+		}
+		for _, k := range m.parseIndex(data) {
+			if k == key {
+				return true
+			}
+		}
+		return false
+	}
+
+	s := loadTestSession(t, m, "")
+	s.SetUserID("u1")
+	m.MustWriteSession(nil, s)
+	if ts.txs != 1 || !indexed(s.Key) {
+		t.Fatalf("expected the session and index written in a transaction, got %d", ts.txs)
+	}
+
+	// neither is written if the transaction fails
+	ts.fail = errors.New("crashed")
+	s2 := loadTestSession(t, m, "")
+	s2.SetUserID("u1")
+	if err := m.WriteSession(nil, s2); !errors.Is(err, ts.fail) {
+		t.Fatalf("expected the transaction's error but got %v", err)
+	}
+	if _, _, err := m.get(s2.Key); err != ErrNotFound || indexed(s2.Key) {
+		t.Fatalf("expected nothing written, got %v", err)
+	}
+
+	// destroyed, it goes from the index as well
+	ts.fail = nil
+	if err := m.DestroySession(nil, s); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.get(s.Key); err != ErrNotFound || indexed(s.Key) {
+		t.Fatalf("expected the session and its index entry gone, got %v", err)
+	}
+
+}
@@ -0,0 +1,89 @@
+package gomemssn
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Concrete types stored in Values have to be registered with gob (for
+// GobCodec, the default) and gob has to be able to encode them: a struct
+// without exported fields or with a func field can't be.  Without checks
+// this shows up as a gob error from WriteSession in whichever request first
+// stores such a value.  RegisterType does both up front, and WriteSession's
+// error for values which can't be encoded is an *EncodeError naming them.
+
+// RegisterType registers the types of samples with gob.Register and checks
+// that values of them can be encoded; call it at startup, next to NewManager
+func RegisterType(samples ...interface{}) error {
+	for _, sample := range samples {
+		if err := registerType(sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MustRegisterType is RegisterType which panics on error
+func MustRegisterType(samples ...interface{}) {
+	if err := RegisterType(samples...); err != nil {
+		panic(err)
+	}
+}
+
+func registerType(sample interface{}) (err error) {
+	if sample == nil {
+		return fmt.Errorf("gomemssn: can't register nil")
+	}
+	defer func() {
+		// gob.Register panics on conflicting names
+		if r := recover(); r != nil {
+			err = fmt.Errorf("gomemssn: registering %T: %v", sample, r)
+		}
+	}()
+	gob.Register(sample)
+	if err := gob.NewEncoder(io.Discard).Encode(&Values{"v": sample}); err != nil {
+		return fmt.Errorf("gomemssn: values of type %T can't be stored: %w", sample, err)
+	}
+	return nil
+}
+
+// EncodeError is returned by WriteSession when the session can't be encoded
+// because of some of its values
+type EncodeError struct {
+	Types map[string]string // the type of each value which can't be encoded, by key
+	Err   error             // the error encoding the session
+}
+
+func (e *EncodeError) Error() string {
+	keys := make([]string, 0, len(e.Types))
+	for k := range e.Types {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = fmt.Sprintf("%q (%s)", k, e.Types[k])
+	}
+	return fmt.Sprintf("gomemssn: can't encode values %s, register their types (see RegisterType): %v", strings.Join(keys, ", "), e.Err)
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// encodeError returns an *EncodeError for err if encoding vals alone
+// shows which values it is because of, err otherwise
+func (m *Manager) encodeError(vals Values, err error) error {
+	types := make(map[string]string)
+	for k, v := range vals {
+		if _, e := m.codec().Encode(&Values{k: v}); e != nil {
+			types[k] = fmt.Sprintf("%T", v)
+		}
+	}
+	if len(types) == 0 {
+		return err
+	}
+	return &EncodeError{Types: types, Err: err}
+}
@@ -0,0 +1,40 @@
+package gomemssn
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type registeredCart struct{ Items []string }
+
+type unregisteredCart struct{ Items []string }
+
+type noExportedFields struct{ items []string }
+
+func TestRegisterType(t *testing.T) {
+
+	if err := RegisterType(registeredCart{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterType(noExportedFields{}); err == nil {
+		t.Fatalf("expected an error for a type gob can't encode")
+	}
+
+	m := NewManager(nil, "gomemssn_test")
+	s := loadTestSession(t, m, "")
+	s.Values["cart"] = registeredCart{Items: []string{"a"}}
+	m.MustWriteSession(nil, s)
+
+	s.Values["other"] = unregisteredCart{}
+	s.Values["f"] = func() {}
+	err := m.WriteSession(nil, s)
+	var ee *EncodeError
+	if !errors.As(err, &ee) || len(ee.Types) != 2 || ee.Types["other"] != "gomemssn.unregisteredCart" {
+		t.Fatalf("expected an EncodeError naming the values but got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"f" (func())`) {
+		t.Fatalf("unexpected error message: %v", err)
+	}
+
+}
@@ -0,0 +1,60 @@
+package gomemssn
+
+import (
+	"errors"
+)
+
+// Update applies f to the latest values of the session in the backing store
+// and writes them back, so a handler changing one key doesn't clobber what
+// concurrent requests did to others.  If someone else writes the session
+// between the read and the write it is read again and f run again (so f
+// should only change the Values it is given), up to ConflictRetries times,
+// then a *ConflictError is returned.  Afterwards s holds what was written;
+// changes to s.Values which weren't written before are lost, except to heavy
+// values.  Writes are only conditional with a CASStore (memcache is one).
+func (s *Session) Update(f func(Values) error) error {
+
+	m := s.m
+	if m == nil || s.ReadOnly() {
+		return ErrReadOnly
+	}
+
+	// heavy values aren't in the record, keep what was loaded of them
+	heavy := make(Values)
+	for _, name := range m.HeavyKeys {
+		if v, ok := s.Values[name]; ok {
+			heavy[name] = v
+		}
+	}
+
+	onConflict := s.OnConflict
+	s.OnConflict = ConflictFail
+	defer func() { s.OnConflict = onConflict }()
+
+	for attempt := 1; ; attempt++ {
+
+		l, err := m.fetch(s.Key)
+		if err == ErrNotFound {
+			s.Values, s.raw, s.cas, s.loaded = make(Values), nil, nil, nil
+		} else if err != nil {
+			return err
+		} else {
+			s.Values, s.Meta, s.raw, s.cas, s.loaded = l.rec.Values, l.rec.Meta, l.rec.raw, l.cas, l.data
+			m.expireValues(s)
+		}
+		for k, v := range heavy {
+			s.Values[k] = v
+		}
+		s.snap = s.Snapshot()
+
+		if err := f(s.Values); err != nil {
+			return err
+		}
+		err = m.WriteSession(nil, s)
+		if !errors.Is(err, ErrSessionConflict) || attempt > m.ConflictRetries {
+			return err
+		}
+
+	}
+
+}
@@ -0,0 +1,41 @@
+package gomemssn
+
+import (
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	s := loadTestSession(t, m, "")
+	s.Values["n"] = 0
+	m.MustWriteSession(nil, s)
+
+	// another request sets b while we are on our first try
+	other := loadTestSession(t, m, s.Key)
+	calls := 0
+	err := s.Update(func(v Values) error {
+		calls++
+		if calls == 1 {
+			other.Values["b"] = "theirs"
+			m.MustWriteSession(nil, other)
+		}
+		v["n"] = v["n"].(int) + 1
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected f to be run again after the conflict, ran %d times", calls)
+	}
+
+	s2 := loadTestSession(t, m, s.Key)
+	if s2.Values["n"] != 1 || s2.Values["b"] != "theirs" {
+		t.Fatalf("expected both changes to be kept, got %v", s2.Values)
+	}
+	if s.OnConflict != ConflictDefault {
+		t.Fatalf("expected OnConflict to be restored")
+	}
+
+}
@@ -0,0 +1,311 @@
+package gomemssn
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Sessions which have a user ID (see Session.SetUserID) are listed in an
+// index entry for that user, so all of a user's sessions can be found
+// ("signed in on 3 devices") or logged out at once.  The index holds the
+// session keys one per line (encrypted with KeyHashSecret, see keyhash.go)
+// and is added to when sessions are written; keys of sessions which are gone
+// or now belong to someone else are dropped when it is read.  It is written
+// after the session, so a failure in between leaves a session which is not
+// listed rather than the reverse, unless the Store is a TxStore: then it is
+// written with the session, and DestroySession removes the session from it.
+
+// SetUserID ties the session to an application user, see
+// Manager.SessionsForUser; "" unties it
+func (s *Session) SetUserID(uid string) {
+	s.Meta.UserID = uid
+}
+
+// UserID returns what was passed to SetUserID, "" if nothing was
+func (s *Session) UserID() string {
+	return s.Meta.UserID
+}
+
+// userIndexKey is where the index of uid's sessions is kept, uid is hashed so
+// it can be anything (memcache keys can't contain spaces)
+func userIndexKey(uid string) string {
+	h := sha256.Sum256([]byte(uid))
+	return "user:" + base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// indexTTL is how long index entries are kept, they are extended along with
+// the sessions in them and outlive them so they don't lose any
+func (m *Manager) indexTTL() time.Duration {
+	return 2 * m.maxExpiration()
+}
+
+// indexSession adds the key of s to the index of its user if it isn't there
+// yet (it was written for the first time or got a new user ID), otherwise it
+// just extends the index
+func (m *Manager) indexSession(s *Session, added bool) error {
+
+	uid := s.Meta.UserID
+	if uid == "" {
+		return nil
+	}
+	ikey := userIndexKey(uid)
+	if !added {
+		m.store().Touch(m.storeKey(ikey), m.indexTTL())
+		return nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		data, token, err := m.get(ikey)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		keys := m.parseIndex(data)
+		for _, k := range keys {
+			if k == s.Key {
+				return nil
+			}
+		}
+		if data, err = m.encodeIndex(append(keys, s.Key)); err != nil {
+			return err
+		}
+		err = m.cas(ikey, data, token, m.indexTTL())
+		if err != ErrCASConflict || attempt >= m.ConflictRetries {
+			return err
+		}
+	}
+
+}
+
+// unindexSession removes key from the index of uid, see DestroySession
+func (m *Manager) unindexSession(uid, key string) error {
+
+	if uid == "" {
+		return nil
+	}
+	ikey := userIndexKey(uid)
+
+	for attempt := 0; ; attempt++ {
+		data, token, err := m.get(ikey)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		keys := m.parseIndex(data)
+		live := make([]string, 0, len(keys))
+		for _, k := range keys {
+			if k != key {
+				live = append(live, k)
+			}
+		}
+		if len(live) == len(keys) {
+			return nil
+		}
+		if data, err = m.encodeIndex(live); err != nil {
+			return err
+		}
+		err = m.cas(ikey, data, token, m.indexTTL())
+		if err != ErrCASConflict || attempt >= m.ConflictRetries {
+			return err
+		}
+	}
+
+}
+
+// SessionsForUser returns the sessions tied to uid with SetUserID, by key
+func (m *Manager) SessionsForUser(uid string) (map[string]*Session, error) {
+
+	ikey := userIndexKey(uid)
+	data, token, err := m.get(ikey)
+	if err == ErrNotFound {
+		return map[string]*Session{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	keys := m.parseIndex(data)
+
+	ret, err := m.GetSessionsByKey(keys)
+	if err != nil {
+		return nil, err
+	}
+	live := keys[:0]
+	for _, k := range keys {
+		if s, ok := ret[k]; ok && s.Meta.UserID != uid {
+			delete(ret, k)
+		} else if ok {
+			live = append(live, k)
+		}
+	}
+
+	// drop stale keys, if this loses a race with a new session being added
+	// the index is just left as it was
+	if len(live) < len(keys) && !m.ReadOnly() {
+		if data, err := m.encodeIndex(live); err == nil {
+			m.cas(ikey, data, token, m.indexTTL())
+		}
+	}
+
+	return ret, nil
+
+}
+
+// DestroyAllForUser deletes all of uid's sessions from the backing store, i.e.
+// logs them out everywhere; call it after a password change, say.  The
+// cookies of the current request are not touched, use DestroySession for
+// that session if it is one of them.
+func (m *Manager) DestroyAllForUser(uid string) error {
+
+	if m.ReadOnly() || m.Degraded() {
+		return ErrReadOnly
+	}
+
+	sessions, err := m.SessionsForUser(uid)
+	if err != nil {
+		return err
+	}
+	for key := range sessions {
+		if err := m.DeleteSessionByKey(key); err != nil {
+			return err
+		}
+	}
+	return m.del(userIndexKey(uid))
+
+}
+
+// UserSession describes one of a user's sessions, for a page listing where
+// they are signed in, see ListUserSessions
+type UserSession struct {
+	Key        string    // the session key, for RevokeOthers or Revoke; don't show it, it is as good as the cookie
+	ID         string    // SessionID of the key, fine to show and log
+	CreatedAt  time.Time // when the session was started
+	LastSeenAt time.Time // when it was last used, see Meta.LastSeenAt
+	CreatedIP  string    // the client IP it was started from
+	UserAgent  string    // the browser or app which last used it
+}
+
+// ListUserSessions returns the sessions tied to uid with SetUserID, most
+// recently used first
+func (m *Manager) ListUserSessions(uid string) ([]UserSession, error) {
+
+	sessions, err := m.SessionsForUser(uid)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]UserSession, 0, len(sessions))
+	for key, s := range sessions {
+		ret = append(ret, UserSession{
+			Key:        key,
+			ID:         SessionID(key),
+			CreatedAt:  s.Meta.CreatedAt,
+			LastSeenAt: s.Meta.LastSeenAt,
+			CreatedIP:  s.Meta.CreatedIP,
+			UserAgent:  s.Meta.UserAgent,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i].LastSeenAt, ret[j].LastSeenAt
+		if a.Equal(b) {
+			return ret[i].Key < ret[j].Key
+		}
+		return a.After(b)
+	})
+	return ret, nil
+
+}
+
+// RevokeOthers revokes (see Revoke) all of uid's sessions but currentKey,
+// for a "sign out everywhere else" button
+func (m *Manager) RevokeOthers(currentKey, uid string) error {
+
+	if m.ReadOnly() || m.Degraded() {
+		return ErrReadOnly
+	}
+
+	sessions, err := m.SessionsForUser(uid)
+	if err != nil {
+		return err
+	}
+	for key := range sessions {
+		if key == currentKey {
+			continue
+		}
+		if err := m.Revoke(key); err != nil {
+			return err
+		}
+	}
+	return nil
+
+}
+
+// ErrTooManySessions is returned by WriteSession when the user of a session
+// has MaxSessionsPerUser already and SessionLimit is RejectNew
+var ErrTooManySessions = errors.New("gomemssn: user has too many sessions")
+
+// SessionLimitPolicy decides what happens when s is about to be written for
+// a user who has max (MaxSessionsPerUser) or more other sessions, given
+// oldest first.  It returns the sessions to destroy to make room, or an
+// error for WriteSession to return without writing s.
+type SessionLimitPolicy func(s *Session, others []*Session, max int) ([]*Session, error)
+
+// EvictOldest is a SessionLimitPolicy which destroys the oldest sessions, so
+// signing in on a new device signs out the least recently signed in one
+func EvictOldest(s *Session, others []*Session, max int) ([]*Session, error) {
+	return others[:len(others)-max+1], nil
+}
+
+// RejectNew is a SessionLimitPolicy which keeps the existing sessions and
+// fails the write of the new one with ErrTooManySessions
+func RejectNew(s *Session, others []*Session, max int) ([]*Session, error) {
+	return nil, ErrTooManySessions
+}
+
+// limitSessions enforces MaxSessionsPerUser before s is written for its
+// user for the first time
+func (m *Manager) limitSessions(s *Session) error {
+
+	uid := s.Meta.UserID
+	if m.MaxSessionsPerUser <= 0 || uid == "" {
+		return nil
+	}
+	sessions, err := m.SessionsForUser(uid)
+	if err != nil {
+		return err
+	}
+	delete(sessions, s.Key)
+	if len(sessions) < m.MaxSessionsPerUser {
+		return nil
+	}
+
+	others := make([]*Session, 0, len(sessions))
+	for _, o := range sessions {
+		others = append(others, o)
+	}
+	sort.Slice(others, func(i, j int) bool {
+		a, b := others[i].Meta.CreatedAt, others[j].Meta.CreatedAt
+		if a.Equal(b) {
+			return others[i].Key < others[j].Key
+		}
+		return a.Before(b)
+	})
+
+	policy := m.SessionLimit
+	if policy == nil {
+		policy = EvictOldest
+	}
+	evict, err := policy(s, others, m.MaxSessionsPerUser)
+	if err != nil {
+		return err
+	}
+	for _, o := range evict {
+		sessionHook(m.Hooks.OnDestroy, o)
+		if err := m.delSession(o.Key); err != nil {
+			return err
+		}
+		m.audit(s.req, AuditDestroy, o, "session limit")
+	}
+	return nil
+
+}
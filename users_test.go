@@ -0,0 +1,138 @@
+package gomemssn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionsForUser(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+
+	var keys []string
+	for i := 0; i < 3; i++ {
+		s := loadTestSession(t, m, "")
+		s.SetUserID("joe@example.com")
+		m.MustWriteSession(nil, s)
+		keys = append(keys, s.Key)
+	}
+	other := loadTestSession(t, m, "")
+	other.SetUserID("ann")
+	m.MustWriteSession(nil, other)
+
+	found, err := m.SessionsForUser("joe@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 || found[keys[0]] == nil {
+		t.Fatalf("expected 3 sessions but got %v", found)
+	}
+
+	// logged out of one, switched user in another
+	s, _ := m.GetSessionByKey(keys[0])
+	m.DestroySession(nil, s)
+	s, _ = m.GetSessionByKey(keys[1])
+	s.SetUserID("ann")
+	m.MustWriteSession(nil, s)
+	if found, _ = m.SessionsForUser("joe@example.com"); len(found) != 1 || found[keys[2]] == nil {
+		t.Fatalf("expected only the third session but got %v", found)
+	}
+	if data, _, _ := m.get(userIndexKey("joe@example.com")); string(data) != keys[2] {
+		t.Fatalf("stale keys not dropped from the index: %q", data)
+	}
+
+	// and regenerated sessions are still found
+	s = loadTestSession(t, m, other.Key)
+	if err := m.RegenerateSession(nil, nil, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.DestroyAllForUser("ann"); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{s.Key, keys[1]} {
+		if _, err := m.GetSessionByKey(k); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound but got %v", err)
+		}
+	}
+	if _, err := m.GetSessionByKey(keys[2]); err != nil {
+		t.Fatalf("other user's session was destroyed: %v", err)
+	}
+
+}
+
+func TestMaxSessionsPerUser(t *testing.T) {
+
+	m := NewManager(nil, "gomemssn_test")
+	m.MaxSessionsPerUser = 2
+
+	var keys []string
+	login := func(i int) error {
+		s := loadTestSession(t, m, "")
+		s.Meta.CreatedAt = time.Now().Add(time.Duration(i) * time.Minute)
+		s.SetUserID("joe")
+		keys = append(keys, s.Key)
+		return m.WriteSession(nil, s)
+	}
+	for i := 0; i < 3; i++ {
+		if err := login(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	found, _ := m.SessionsForUser("joe")
+	if len(found) != 2 || found[keys[0]] != nil {
+		t.Fatalf("expected the oldest session to be evicted but got %v", found)
+	}
+
+	// rewriting a session already counted doesn't evict anything
+	s, _ := m.GetSessionByKey(keys[2])
+	s.Values["x"] = 1
+	m.MustWriteSession(nil, s)
+	if found, _ = m.SessionsForUser("joe"); len(found) != 2 {
+		t.Fatalf("expected 2 sessions but got %v", found)
+	}
+
+	m.SessionLimit = RejectNew
+	if err := login(3); err != ErrTooManySessions {
+		t.Fatalf("expected ErrTooManySessions but got %v", err)
+	}
+	if _, err := m.GetSessionByKey(keys[3]); err != ErrNotFound {
+		t.Fatalf("expected the rejected session not to be written, got %v", err)
+	}
+	if found, _ = m.SessionsForUser("joe"); len(found) != 2 || found[keys[1]] == nil {
+		t.Fatalf("expected the existing sessions to be kept but got %v", found)
+	}
+
+}
+
+func TestListUserSessions(t *testing.T) {
+
+	clock := newTestClock()
+	m := NewManager(nil, "gomemssn_test")
+	m.Now = clock.Now
+
+	var keys []string
+	for i := 0; i < 3; i++ {
+		s := loadTestSession(t, m, "")
+		s.SetUserID("joe")
+		m.MustWriteSession(nil, s)
+		keys = append(keys, s.Key)
+		clock.Advance(time.Minute)
+	}
+
+	list, err := m.ListUserSessions("joe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Key != keys[2] || list[2].Key != keys[0] || list[0].ID != SessionID(keys[2]) || list[0].CreatedIP == "" {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	if err := m.RevokeOthers(keys[1], "joe"); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ = m.ListUserSessions("joe"); len(list) != 1 || list[0].Key != keys[1] {
+		t.Fatalf("expected only the current session left, got %+v", list)
+	}
+
+}
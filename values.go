@@ -0,0 +1,85 @@
+package gomemssn
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The GetString style accessors return the zero value both when the key is
+// missing and when it holds something else; these tell the cases apart.
+// Keep in mind that with JSONCodec values come back as JSON types (numbers
+// are float64, slices []interface{}...), GetTime and GetStringSlice
+// understand both forms.
+
+var (
+	ErrNoValue   = errors.New("gomemssn: no such value")
+	ErrValueType = errors.New("gomemssn: value has a different type")
+)
+
+func init() {
+	// so SetTime works with GobCodec
+	gob.Register(time.Time{})
+}
+
+// Get returns the value under key if it is there and a T
+func Get[T any](v Values, key string) (T, bool) {
+	ret, ok := v[key].(T)
+	return ret, ok
+}
+
+// Lookup is Get returning why it failed: an error wrapping ErrNoValue or
+// ErrValueType
+func Lookup[T any](v Values, key string) (T, error) {
+	var zero T
+	val, ok := v[key]
+	if !ok {
+		return zero, fmt.Errorf("%w: %q", ErrNoValue, key)
+	}
+	ret, ok := val.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: %q is %T, not %T", ErrValueType, key, val, zero)
+	}
+	return ret, nil
+}
+
+func (v Values) SetTime(key string, val time.Time) {
+	v[key] = val
+}
+
+// GetTime returns the time under key, ok is false if there is none
+func (v Values) GetTime(key string) (ret time.Time, ok bool) {
+	switch val := v[key].(type) {
+	case time.Time:
+		return val, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, val)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+func (v Values) SetStringSlice(key string, val []string) {
+	v[key] = val
+}
+
+// GetStringSlice returns the strings under key, ok is false if there are
+// none (or it's not all strings)
+func (v Values) GetStringSlice(key string) (ret []string, ok bool) {
+	switch val := v[key].(type) {
+	case []string:
+		return val, true
+	case []interface{}:
+		ret = make([]string, 0, len(val))
+		for _, e := range val {
+			s, ok := e.(string)
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, s)
+		}
+		return ret, true
+	}
+	return nil, false
+}
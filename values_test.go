@@ -0,0 +1,50 @@
+package gomemssn
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTypedValues(t *testing.T) {
+
+	now := time.Now().Truncate(time.Second).UTC()
+
+	for _, codec := range []Codec{&GobCodec{}, &JSONCodec{}} {
+
+		m := NewManager(nil, "gomemssn_test")
+		m.Codec = codec
+
+		s := loadTestSession(t, m, "")
+		s.Values.SetString("s", "")
+		s.Values.SetTime("t", now)
+		s.Values.SetStringSlice("ss", []string{"a", "b"})
+		m.MustWriteSession(nil, s)
+		s = loadTestSession(t, m, s.Key)
+
+		if v, ok := Get[string](s.Values, "s"); !ok || v != "" {
+			t.Fatalf("%T: expected empty string to be found", codec)
+		}
+		if _, ok := Get[string](s.Values, "nope"); ok {
+			t.Fatalf("%T: missing key found", codec)
+		}
+		if _, err := Lookup[string](s.Values, "nope"); !errors.Is(err, ErrNoValue) {
+			t.Fatalf("%T: expected ErrNoValue but got %v", codec, err)
+		}
+		if _, err := Lookup[int](s.Values, "s"); !errors.Is(err, ErrValueType) {
+			t.Fatalf("%T: expected ErrValueType but got %v", codec, err)
+		}
+		if v, ok := s.Values.GetTime("t"); !ok || !v.Equal(now) {
+			t.Fatalf("%T: unexpected time %v", codec, v)
+		}
+		if v, ok := s.Values.GetStringSlice("ss"); !ok || !reflect.DeepEqual(v, []string{"a", "b"}) {
+			t.Fatalf("%T: unexpected string slice %v", codec, v)
+		}
+		if _, ok := s.Values.GetStringSlice("s"); ok {
+			t.Fatalf("%T: string is not a string slice", codec)
+		}
+
+	}
+
+}
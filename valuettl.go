@@ -0,0 +1,78 @@
+package gomemssn
+
+import (
+	"time"
+)
+
+// Values set with SetWithTTL expire on their own, before the session does:
+// their expiries are kept in Values under "_ttls" (as Unix milliseconds,
+// which both codecs read back as numbers), and values past theirs are
+// dropped when the session is read.
+
+// valueTTLKey is where the expiries of values are kept in Values
+const valueTTLKey = "_ttls"
+
+// SetWithTTL puts val under key until ttl has passed, after which sessions
+// are read without it, for short lived values (a one time password
+// challenge, a counter) in a long lived session.  Replacing the value with
+// a plain assignment keeps the expiry, use SetWithTTL again to move it.
+func (s *Session) SetWithTTL(key string, val interface{}, ttl time.Duration) {
+	if s.Values == nil {
+		s.Values = make(Values)
+	}
+	s.Values[key] = val
+	// a new map, so the change shows against the session's Snapshot
+	old, _ := s.Values[valueTTLKey].(map[string]interface{})
+	ttls := make(map[string]interface{}, len(old)+1)
+	for k, v := range old {
+		ttls[k] = v
+	}
+	ttls[key] = s.now().Add(ttl).UnixMilli()
+	s.Values[valueTTLKey] = ttls
+}
+
+// ValueTTL returns how long until the value under key expires, and whether
+// it was set with SetWithTTL
+func (s *Session) ValueTTL(key string) (time.Duration, bool) {
+	ttls, _ := s.Values[valueTTLKey].(map[string]interface{})
+	exp, ok := unixMilli(ttls[key])
+	if !ok {
+		return 0, false
+	}
+	return time.UnixMilli(exp).Sub(s.now()), true
+}
+
+// unixMilli returns an expiry as gob (int64) or JSON (float64) decodes it
+func unixMilli(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// expireValues drops the values of s which expired, and the expiries of
+// values which are gone
+func (m *Manager) expireValues(s *Session) {
+	ttls, ok := s.Values[valueTTLKey].(map[string]interface{})
+	if !ok {
+		return
+	}
+	now := m.now().UnixMilli()
+	keep := make(map[string]interface{}, len(ttls))
+	for k, v := range ttls {
+		_, present := s.Values[k]
+		if exp, ok := unixMilli(v); ok && present && exp > now {
+			keep[k] = v
+		} else {
+			delete(s.Values, k)
+		}
+	}
+	if len(keep) == 0 {
+		delete(s.Values, valueTTLKey)
+	} else if len(keep) < len(ttls) {
+		s.Values[valueTTLKey] = keep
+	}
+}
@@ -0,0 +1,46 @@
+package gomemssn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetWithTTL(t *testing.T) {
+
+	for _, codec := range []Codec{nil, &JSONCodec{}} {
+
+		clock := newTestClock()
+		m := NewManager(nil, "gomemssn_test")
+		m.Now = clock.Now
+		m.Codec = codec
+		s := loadTestSession(t, m, "")
+		s.Values["uid"] = "joe"
+		s.SetWithTTL("otp", "123456", 5*time.Minute)
+		s.SetWithTTL("tries", "3", time.Hour)
+		m.MustWriteSession(nil, s)
+
+		clock.Advance(time.Minute)
+		s = loadTestSession(t, m, s.Key)
+		if s.Values["otp"] != "123456" {
+			t.Fatalf("expected the value before its TTL, got %v", s.Values)
+		}
+		if ttl, ok := s.ValueTTL("otp"); !ok || ttl <= 4*time.Minute-time.Millisecond || ttl > 4*time.Minute {
+			t.Fatalf("unexpected TTL %v", ttl)
+		}
+
+		clock.Advance(5 * time.Minute)
+		s = loadTestSession(t, m, s.Key)
+		if _, ok := s.Values["otp"]; ok || s.Values["tries"] != "3" || s.Values["uid"] != "joe" {
+			t.Fatalf("expected only the expired value gone, got %v", s.Values)
+		}
+
+		delete(s.Values, "tries")
+		m.MustWriteSession(nil, s)
+		s = loadTestSession(t, m, s.Key)
+		if _, ok := s.Values[valueTTLKey]; ok {
+			t.Fatalf("expected the expiries gone with the values, got %v", s.Values)
+		}
+
+	}
+
+}